@@ -1,95 +1,69 @@
 package coinapi
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"reflect"
 	"time"
 )
 
-// retry: 重试次数
-// method: 调用的函数，比如: api.GetTicker,注意：不是api.GetTicker(...)
-// params: 参数,顺序一定要按照实际调用函数入参顺序一样
-func RE(retry int, method interface{}, params ...interface{}) interface{} {
-	invokeM := reflect.ValueOf(method)
-	if invokeM.Kind() != reflect.Func {
-		panic("method not a function")
-		return nil
-	}
-
-	var value []reflect.Value = make([]reflect.Value, len(params))
-	var i int = 0
-	for ; i < len(params); i++ {
-		value[i] = reflect.ValueOf(params[i])
-	}
-
-	var retV interface{}
-	var retryC int = 0
-_CALL:
-	if retryC > 0 {
-		log.Println("sleep....", time.Duration(retryC*200*int(time.Millisecond)))
-		time.Sleep(time.Duration(retryC * 200 * int(time.Millisecond)))
-	}
+//批量撤单时两次撤单之间的间隔. 直接用构造函数创建的api没有挂载限频器, 靠这个间隔控制频率
+const CANCEL_INTERVAL = 100 * time.Millisecond
 
-	retValues := invokeM.Call(value)
-	for _, vl := range retValues {
-		if vl.Type().String() == "error" {
-			if !vl.IsNil() {
-				log.Println(vl)
-				retryC++
-				if retryC <= retry {
-					log.Printf("Invoke Method[%s] Error , Begin Retry Call [%d] ...", invokeM.String(), retryC)
-					goto _CALL
-				} else {
-					panic("Invoke Method Fail " + invokeM.String())
-				}
-			}
-		} else {
-			retV = vl.Interface()
-		}
-	}
-	return retV
-}
-
-//call all unfinished orders
+//call all unfinished orders, 每次撤单间隔 CANCEL_INTERVAL
 func CancelAllUnfinishedOrders(api Api, cp CurrencyPair) int {
 	if api == nil {
-		log.Println("api instance is nil, please new a api instance")
+		DefaultLogger.Error("api instance is nil, please new a api instance")
 		return -1
 	}
 
-	orders := RE(10, api.GetUnfinishedOrders, cp)
-	if orders != nil {
-		c := 0
-		for _, ord := range orders.([]Order) {
-			_, err := api.CancelOrder(fmt.Sprintf("%d", ord.OrderID), cp)
-			if err != nil {
-				log.Println(err)
-			}
-			c++
-			time.Sleep(100 * time.Millisecond) //控制频率
-		}
+	var orders []Order
+	err := Retry(context.Background(), DefaultRetryPolicy, func() (err error) {
+		orders, err = api.GetUnfinishedOrders(cp)
+		return
+	})
+	if err != nil {
+		DefaultLogger.Error("get unfinished orders failed", "exchange", api.GetExchangeName(), "pair", cp, "err", err)
+		return 0
+	}
 
-		return c
+	c := 0
+	for i, ord := range orders {
+		if i > 0 {
+			time.Sleep(CANCEL_INTERVAL) //控制频率
+		}
+		_, err := api.CancelOrder(fmt.Sprintf("%d", ord.OrderID), cp)
+		if err != nil {
+			DefaultLogger.Warn("cancel order failed", "exchange", api.GetExchangeName(), "order_id", ord.OrderID, "err", err)
+		}
+		c++
 	}
-	return 0
+	return c
 }
 
-//call all unfinished future orders
+//call all unfinished future orders, 每次撤单间隔 CANCEL_INTERVAL
 func CancelAllUnfinishedFutureOrders(api FutureApi, contractType string, cp CurrencyPair) {
 	if api == nil {
-		log.Println("api instance is nil, please new a api instance")
+		DefaultLogger.Error("api instance is nil, please new a api instance")
 		return
 	}
 
-	orders := RE(10, api.GetUnfinishedFutureOrders, cp, contractType)
-	if orders != nil {
-		for _, ord := range orders.([]Order) {
-			_, err := api.FutureCancelOrder(cp, contractType, fmt.Sprintf("%d", ord.OrderID))
-			if err != nil {
-				log.Println(err)
-			}
-			time.Sleep(100 * time.Millisecond) //控制频率
+	var orders []FutureOrder
+	err := Retry(context.Background(), DefaultRetryPolicy, func() (err error) {
+		orders, err = api.GetUnfinishedFutureOrders(cp, contractType)
+		return
+	})
+	if err != nil {
+		DefaultLogger.Error("get unfinished future orders failed", "exchange", api.GetExchangeName(), "pair", cp, "contract_type", contractType, "err", err)
+		return
+	}
+
+	for i, ord := range orders {
+		if i > 0 {
+			time.Sleep(CANCEL_INTERVAL) //控制频率
+		}
+		_, err := api.FutureCancelOrder(cp, contractType, fmt.Sprintf("%d", ord.OrderID))
+		if err != nil {
+			DefaultLogger.Warn("cancel future order failed", "exchange", api.GetExchangeName(), "order_id", ord.OrderID, "err", err)
 		}
 	}
 }
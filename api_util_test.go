@@ -0,0 +1,39 @@
+package coinapi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//记录撤单时间
+type cancelTestApi struct {
+	Api
+	orders  []Order
+	cancels []time.Time
+}
+
+func (a *cancelTestApi) GetExchangeName() string {
+	return "cancel_test"
+}
+
+func (a *cancelTestApi) GetUnfinishedOrders(cp CurrencyPair) ([]Order, error) {
+	return a.orders, nil
+}
+
+func (a *cancelTestApi) CancelOrder(orderId string, cp CurrencyPair) (bool, error) {
+	a.cancels = append(a.cancels, time.Now())
+	return true, nil
+}
+
+//没有限频器时也按 CANCEL_INTERVAL 控制撤单频率
+func TestCancelAllUnfinishedOrders(t *testing.T) {
+	api := &cancelTestApi{orders: []Order{{OrderID: 1}, {OrderID: 2}, {OrderID: 3}}}
+	assert.Equal(t, 3, CancelAllUnfinishedOrders(api, NewCurrencyPair("BTC", "USD")))
+	if assert.Len(t, api.cancels, 3) {
+		for i := 1; i < len(api.cancels); i++ {
+			assert.True(t, api.cancels[i].Sub(api.cancels[i-1]) >= CANCEL_INTERVAL, "cancel %d", i)
+		}
+	}
+}
@@ -0,0 +1,410 @@
+//Api/FutureApi 实现的一致性测试. 各交易所的适配器、模拟盘和回测在自己的测试里用模拟服务调用
+//TestApi/TestFutureApi, 检查所有实现都遵守同样的约定:
+//   - 盘口 AskList 按价格从低到高, BidList 从高到低, 买一低于卖一, 不超过请求的档数
+//   - 错误为 *ApiError, 余额不足为 ERR_KIND_INSUFFICIENT_FUNDS, 订单不存在等参数错误为 ERR_KIND_INVALID_REQUEST
+//   - 查询不到的订单返回错误而不是 nil, nil; 没有订单时返回空列表而不是 nil
+//   - 订单状态按 ORDER_UNFINISHED -> ORDER_FINISH/ORDER_CANCEL 变化, 已撤销的订单不能再撤销;
+//     查不到已撤销订单的交易所(如poloniex)查询已撤销的订单时返回 ERR_KIND_INVALID_REQUEST
+//   - 交易所没有的接口返回 ERR_KIND_UNSUPPORTED, 对应的子测试标记为跳过; 其他方法返回空结果视为失败
+//   - Ticker.Date、Kline.Timestamp 为unix秒, Order.OrderTime、FutureOrder.OrderTime、Trade.Date 为毫秒
+package apitest
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+	"github.com/stretchr/testify/assert"
+)
+
+//不存在的订单号
+const UNKNOWN_ORDER_ID = "987654321"
+
+//提现测试的地址和手续费
+const (
+	WITHDRAW_ADDRESS = "1BoatSLRHtKNngkdXEeobR76b53LETtpyT"
+	WITHDRAW_FEE     = "0.0001"
+)
+
+//unix秒和毫秒时间戳的合理范围(2001年到2286年)
+const (
+	MIN_UNIX_SECONDS = 1e9
+	MAX_UNIX_SECONDS = 1e10
+	MIN_UNIX_MILLIS  = 1e12
+	MAX_UNIX_MILLIS  = 1e13
+)
+
+type Config struct {
+	Api  Api
+	Pair CurrencyPair
+	//测试订单的数量. 账户需要有足够的计价币按卖一价买入 Amount, 盘口需要有足够的流动性立即成交;
+	//提现测试提取 Amount/10 的币, 账户需要有足够的币支付提现数量和 WITHDRAW_FEE
+	Amount float64
+	//K线周期, 默认 1min
+	KlinePeriod string
+	//提现的资金密码
+	SafePwd string
+	//跳过的子测试名; 交易所不支持的方法返回 ERR_KIND_UNSUPPORTED, 不需要列在这里
+	Skip []string
+}
+
+func (c Config) run(t *testing.T, name string, test func(t *testing.T)) {
+	run(t, name, c.Api.GetExchangeName(), c.Skip, test)
+}
+
+func (c Config) klinePeriod() string {
+	if c.KlinePeriod == "" {
+		return "1min"
+	}
+	return c.KlinePeriod
+}
+
+//在 skip 中的子测试标记为跳过
+func run(t *testing.T, name, exchange string, skip []string, test func(t *testing.T)) {
+	t.Run(name, func(t *testing.T) {
+		for _, s := range skip {
+			if s == name {
+				t.Skip("not supported by " + exchange)
+			}
+		}
+		test(t)
+	})
+}
+
+//对 config.Api 运行所有现货一致性测试. 测试会下单, 只能对模拟服务或模拟盘运行
+func TestApi(t *testing.T, config Config) {
+	api, cp := config.Api, config.Pair
+	amount := strconv.FormatFloat(config.Amount, 'f', -1, 64)
+
+	config.run(t, "Ticker", func(t *testing.T) {
+		ticker, err := api.GetTicker(cp)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.True(t, ticker.Last > 0, "last %v", ticker.Last)
+		if ticker.Buy > 0 && ticker.Sell > 0 {
+			assert.True(t, ticker.Buy <= ticker.Sell, "buy %v above sell %v", ticker.Buy, ticker.Sell)
+		}
+		if ticker.Date != 0 {
+			AssertUnixSeconds(t, int64(ticker.Date), "ticker date")
+		}
+	})
+
+	config.run(t, "Depth", func(t *testing.T) {
+		depth, err := api.GetDepth(cp, 5)
+		if assert.NoError(t, err) {
+			AssertDepth(t, depth, 5)
+		}
+	})
+
+	config.run(t, "Account", func(t *testing.T) {
+		acc, err := api.GetAccount()
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.NotEmpty(t, acc.SubAccounts)
+		for currency, sub := range acc.SubAccounts {
+			assert.True(t, sub.Amount >= 0 && sub.FrozenAmount >= 0, "%s balance %v/%v", currency, sub.Amount, sub.FrozenAmount)
+		}
+	})
+
+	config.run(t, "Withdraw", func(t *testing.T) {
+		currency := string(cp.BaseCurrency)
+		before := balance(t, api, currency)
+		withdrawAmount := config.Amount / 10
+		id, err := api.Withdraw(formatPrice(withdrawAmount), currency, WITHDRAW_FEE, WITHDRAW_ADDRESS, "", config.SafePwd)
+		skipUnsupported(t, err)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.NotEmpty(t, id)
+		after := balance(t, api, currency)
+		assert.True(t, after <= before-withdrawAmount+1e-9, "%s balance %v before and %v after withdrawing %v", currency, before, after, withdrawAmount)
+
+		//CancelWithdraw 不在 Api 接口里, 只测试提供了的交易所
+		canceler, ok := api.(interface {
+			CancelWithdraw(id, currency, safePwd string) (bool, error)
+		})
+		if !ok {
+			return
+		}
+		ok, err = canceler.CancelWithdraw(id, currency, config.SafePwd)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.InDelta(t, before, balance(t, api, currency), 1e-9, "%s balance after canceling the withdrawal", currency)
+	})
+
+	config.run(t, "RestingOrder", func(t *testing.T) {
+		bid, _ := bestPrices(t, api, cp)
+		order, err := api.LimitBuy(amount, formatPrice(bid*0.8), cp)
+		if !assert.NoError(t, err) {
+			return
+		}
+		id := strconv.Itoa(order.OrderID)
+		assert.True(t, order.OrderID > 0, "order id %d", order.OrderID)
+
+		got, err := api.GetOneOrder(id, cp)
+		if assert.NoError(t, err) && assert.NotNil(t, got) {
+			assert.Equal(t, order.OrderID, got.OrderID)
+			assert.Equal(t, TradeSide(BUY), got.Side)
+			assert.Equal(t, TradeStatus(ORDER_UNFINISHED), got.Status)
+			assert.InDelta(t, config.Amount, got.Amount, 1e-9)
+			assert.Equal(t, 0.0, got.DealAmount)
+			if got.OrderTime != 0 {
+				AssertUnixMillis(t, int64(got.OrderTime), "order time")
+			}
+		}
+		orders, err := api.GetUnfinishedOrders(cp)
+		assert.NoError(t, err)
+		assert.True(t, containsOrder(orders, order.OrderID), "order %s not in unfinished orders", id)
+
+		ok, err := api.CancelOrder(id, cp)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		orders, err = api.GetUnfinishedOrders(cp)
+		assert.NoError(t, err)
+		assert.False(t, containsOrder(orders, order.OrderID), "canceled order %s still unfinished", id)
+	})
+
+	config.run(t, "CanceledOrder", func(t *testing.T) {
+		bid, _ := bestPrices(t, api, cp)
+		order, err := api.LimitBuy(amount, formatPrice(bid*0.8), cp)
+		if !assert.NoError(t, err) {
+			return
+		}
+		id := strconv.Itoa(order.OrderID)
+		ok, err := api.CancelOrder(id, cp)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		got, err := api.GetOneOrder(id, cp)
+		if err != nil {
+			AssertErrorKind(t, err, ERR_KIND_INVALID_REQUEST)
+		} else if assert.NotNil(t, got) {
+			assert.Equal(t, TradeStatus(ORDER_CANCEL), got.Status)
+		}
+		ok, err = api.CancelOrder(id, cp)
+		assert.False(t, ok)
+		AssertErrorKind(t, err, ERR_KIND_INVALID_REQUEST)
+	})
+
+	config.run(t, "FilledOrder", func(t *testing.T) {
+		bid, ask := bestPrices(t, api, cp)
+		price := ask * 1.05
+		order, err := api.LimitBuy(amount, formatPrice(price), cp)
+		if !assert.NoError(t, err) {
+			return
+		}
+		got, err := api.GetOneOrder(strconv.Itoa(order.OrderID), cp)
+		if assert.NoError(t, err) && assert.NotNil(t, got) {
+			assert.Equal(t, TradeStatus(ORDER_FINISH), got.Status)
+			assert.InDelta(t, config.Amount, got.DealAmount, 1e-9)
+			assert.True(t, got.AvgPrice > 0 && got.AvgPrice <= price+1e-9, "avg price %v, limit %v", got.AvgPrice, price)
+		}
+
+		//卖出除去手续费后买到的币
+		sell := minFloat(config.Amount, balance(t, api, string(cp.BaseCurrency)))
+		order, err = api.LimitSell(strconv.FormatFloat(sell, 'f', -1, 64), formatPrice(bid*0.95), cp)
+		if !assert.NoError(t, err) {
+			return
+		}
+		got, err = api.GetOneOrder(strconv.Itoa(order.OrderID), cp)
+		if assert.NoError(t, err) && assert.NotNil(t, got) {
+			assert.Equal(t, TradeStatus(ORDER_FINISH), got.Status)
+			assert.Equal(t, TradeSide(SELL), got.Side)
+		}
+	})
+
+	//与 OkCNApi 一致, 市价买单的 price 为花费的计价币总额
+	config.run(t, "MarketOrder", func(t *testing.T) {
+		_, ask := bestPrices(t, api, cp)
+		order, err := api.MarketBuy("", formatPrice(ask*config.Amount), cp)
+		skipUnsupported(t, err)
+		if !assert.NoError(t, err) {
+			return
+		}
+		got, err := api.GetOneOrder(strconv.Itoa(order.OrderID), cp)
+		if !assert.NoError(t, err) || !assert.NotNil(t, got) {
+			return
+		}
+		assert.Equal(t, TradeStatus(ORDER_FINISH), got.Status)
+		assert.True(t, got.DealAmount > 0 && got.AvgPrice > 0, "deal %v at %v", got.DealAmount, got.AvgPrice)
+
+		sell := minFloat(got.DealAmount, balance(t, api, string(cp.BaseCurrency)))
+		order, err = api.MarketSell(strconv.FormatFloat(sell, 'f', -1, 64), "", cp)
+		if !assert.NoError(t, err) {
+			return
+		}
+		got, err = api.GetOneOrder(strconv.Itoa(order.OrderID), cp)
+		if assert.NoError(t, err) && assert.NotNil(t, got) {
+			assert.Equal(t, TradeStatus(ORDER_FINISH), got.Status)
+			assert.InDelta(t, sell, got.DealAmount, 1e-9)
+		}
+	})
+
+	config.run(t, "OrderNotFound", func(t *testing.T) {
+		order, err := api.GetOneOrder(UNKNOWN_ORDER_ID, cp)
+		assert.Nil(t, order)
+		AssertErrorKind(t, err, ERR_KIND_INVALID_REQUEST)
+	})
+
+	config.run(t, "InsufficientFunds", func(t *testing.T) {
+		bid, _ := bestPrices(t, api, cp)
+		_, err := api.LimitBuy("1000000000", formatPrice(bid*0.8), cp)
+		AssertErrorKind(t, err, ERR_KIND_INSUFFICIENT_FUNDS)
+	})
+
+	config.run(t, "NoUnfinishedOrders", func(t *testing.T) {
+		orders, err := api.GetUnfinishedOrders(cp)
+		if !assert.NoError(t, err) {
+			return
+		}
+		for _, o := range orders {
+			_, err := api.CancelOrder(strconv.Itoa(o.OrderID), cp)
+			assert.NoError(t, err)
+		}
+		orders, err = api.GetUnfinishedOrders(cp)
+		assert.NoError(t, err)
+		assert.NotNil(t, orders)
+		assert.Empty(t, orders)
+	})
+
+	config.run(t, "OrderHistory", func(t *testing.T) {
+		orders, err := api.GetOrderHistory(cp, 1, 10)
+		skipUnsupported(t, err)
+		if !assert.NoError(t, err) {
+			return
+		}
+		//前面的子测试成交和撤销过订单
+		assert.NotEmpty(t, orders)
+		assert.True(t, len(orders) <= 10, "%d orders in a page of 10", len(orders))
+		for _, o := range orders {
+			assert.NotEqual(t, TradeStatus(ORDER_UNFINISHED), o.Status, "unfinished order %d in history", o.OrderID)
+		}
+	})
+
+	config.run(t, "Trades", func(t *testing.T) {
+		trades, err := api.GetTrades(cp, 0)
+		skipUnsupported(t, err)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.NotEmpty(t, trades)
+		for _, trade := range trades {
+			AssertUnixMillis(t, trade.Date, "trade date")
+		}
+	})
+
+	config.run(t, "Klines", func(t *testing.T) {
+		klines, err := api.GetKlineRecords(cp, config.klinePeriod(), 10, 0)
+		skipUnsupported(t, err)
+		if assert.NoError(t, err) && assert.NotEmpty(t, klines) {
+			AssertKlines(t, klines)
+		}
+	})
+}
+
+//盘口按最优价格在前排序, 买一低于卖一
+func AssertDepth(t *testing.T, depth *Depth, size int) {
+	if !assert.NotNil(t, depth) {
+		return
+	}
+	assert.True(t, len(depth.AskList) <= size, "%d asks, size %d", len(depth.AskList), size)
+	assert.True(t, len(depth.BidList) <= size, "%d bids, size %d", len(depth.BidList), size)
+	for i, r := range depth.AskList {
+		assert.True(t, r.Price > 0 && r.Amount > 0, "ask %d: %+v", i, r)
+		if i > 0 {
+			assert.True(t, depth.AskList[i-1].Price < r.Price, "asks not ascending at %d: %v", i, depth.AskList)
+		}
+	}
+	for i, r := range depth.BidList {
+		assert.True(t, r.Price > 0 && r.Amount > 0, "bid %d: %+v", i, r)
+		if i > 0 {
+			assert.True(t, depth.BidList[i-1].Price > r.Price, "bids not descending at %d: %v", i, depth.BidList)
+		}
+	}
+	if len(depth.AskList) > 0 && len(depth.BidList) > 0 {
+		assert.True(t, depth.BidList[0].Price < depth.AskList[0].Price, "best bid %v not below best ask %v",
+			depth.BidList[0].Price, depth.AskList[0].Price)
+	}
+}
+
+//K线按时间升序, 时间为unix秒, 最高最低价包含开盘收盘价
+func AssertKlines(t *testing.T, klines []Kline) {
+	for i, k := range klines {
+		AssertUnixSeconds(t, k.Timestamp, "kline timestamp")
+		assert.True(t, k.Low <= k.Open && k.Low <= k.Close && k.High >= k.Open && k.High >= k.Close, "kline %d: %+v", i, k)
+		if i > 0 {
+			assert.True(t, klines[i-1].Timestamp < k.Timestamp, "klines not ascending at %d", i)
+		}
+	}
+}
+
+func AssertUnixSeconds(t *testing.T, ts int64, name string) {
+	assert.True(t, ts >= MIN_UNIX_SECONDS && ts < MAX_UNIX_SECONDS, "%s %d is not unix seconds", name, ts)
+}
+
+func AssertUnixMillis(t *testing.T, ts int64, name string) {
+	assert.True(t, ts >= MIN_UNIX_MILLIS && ts < MAX_UNIX_MILLIS, "%s %d is not unix milliseconds", name, ts)
+}
+
+func AssertErrorKind(t *testing.T, err error, kind int) {
+	var apiErr *ApiError
+	if assert.True(t, errors.As(err, &apiErr), "expected ApiError, got %v", err) {
+		assert.Equal(t, ErrorKind(kind), apiErr.Kind, "error %v", err)
+	}
+}
+
+//ERR_KIND_UNSUPPORTED 的错误把子测试标记为跳过
+func skipUnsupported(t *testing.T, err error) {
+	var apiErr *ApiError
+	if errors.As(err, &apiErr) && apiErr.Kind == ERR_KIND_UNSUPPORTED {
+		t.Skip(apiErr.Error())
+	}
+}
+
+//currency 的可用余额
+func balance(t *testing.T, api Api, currency string) float64 {
+	acc, err := api.GetAccount()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	for c, sub := range acc.SubAccounts {
+		if strings.EqualFold(c, currency) {
+			return sub.Amount
+		}
+	}
+	return 0
+}
+
+//从盘口取买一卖一价
+func bestPrices(t *testing.T, api Api, cp CurrencyPair) (bid, ask float64) {
+	depth, err := api.GetDepth(cp, 1)
+	if !assert.NoError(t, err) || !assert.NotEmpty(t, depth.BidList) || !assert.NotEmpty(t, depth.AskList) {
+		t.FailNow()
+	}
+	return depth.BidList[0].Price, depth.AskList[0].Price
+}
+
+func containsOrder(orders []Order, id int) bool {
+	for _, o := range orders {
+		if o.OrderID == id {
+			return true
+		}
+	}
+	return false
+}
+
+//保留8位小数, 避免价格乘以系数后出现过长的小数
+func formatPrice(price float64) string {
+	return strconv.FormatFloat(price, 'f', 8, 64)
+}
+
+func minFloat(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
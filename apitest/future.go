@@ -0,0 +1,218 @@
+package apitest
+
+import (
+	"strconv"
+	"testing"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+	"github.com/stretchr/testify/assert"
+)
+
+type FutureConfig struct {
+	Api          FutureApi
+	Pair         CurrencyPair
+	ContractType string
+	//测试订单的张数和杠杆. 账户需要有足够的保证金按卖一价开多 Amount 张
+	Amount    int
+	LeverRate int
+	Skip      []string
+}
+
+func (c FutureConfig) run(t *testing.T, name string, test func(t *testing.T)) {
+	run(t, name, c.Api.GetExchangeName(), c.Skip, test)
+}
+
+//对 config.Api 运行所有合约一致性测试. 测试会下单, 只能对模拟服务或模拟盘运行
+func TestFutureApi(t *testing.T, config FutureConfig) {
+	api, cp, ct := config.Api, config.Pair, config.ContractType
+	amount, lever := strconv.Itoa(config.Amount), config.LeverRate
+
+	config.run(t, "Ticker", func(t *testing.T) {
+		ticker, err := api.GetFutureTicker(cp, ct)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.True(t, ticker.Last > 0, "last %v", ticker.Last)
+		if ticker.Buy > 0 && ticker.Sell > 0 {
+			assert.True(t, ticker.Buy <= ticker.Sell, "buy %v above sell %v", ticker.Buy, ticker.Sell)
+		}
+		if ticker.Date != 0 {
+			AssertUnixSeconds(t, int64(ticker.Date), "ticker date")
+		}
+	})
+
+	config.run(t, "Depth", func(t *testing.T) {
+		depth, err := api.GetFutureDepth(cp, ct, 5)
+		if assert.NoError(t, err) {
+			AssertDepth(t, depth, 5)
+		}
+	})
+
+	config.run(t, "Index", func(t *testing.T) {
+		index, err := api.GetFutureIndex(cp)
+		assert.NoError(t, err)
+		assert.True(t, index > 0, "index %v", index)
+	})
+
+	config.run(t, "EstimatedPrice", func(t *testing.T) {
+		price, err := api.GetFutureEstimatedPrice(cp)
+		assert.NoError(t, err)
+		assert.True(t, price > 0, "estimated price %v", price)
+	})
+
+	config.run(t, "ExchangeRate", func(t *testing.T) {
+		rate, err := api.GetExchangeRate()
+		skipUnsupported(t, err)
+		assert.NoError(t, err)
+		assert.True(t, rate > 0, "exchange rate %v", rate)
+	})
+
+	config.run(t, "Contract", func(t *testing.T) {
+		value, err := api.GetContractValue(cp)
+		assert.NoError(t, err)
+		assert.True(t, value > 0, "contract value %v", value)
+		weekday, hour, minute, second := api.GetDeliveryTime()
+		assert.True(t, weekday >= 0 && weekday <= 6, "weekday %d", weekday)
+		assert.True(t, hour >= 0 && hour <= 23 && minute >= 0 && minute <= 59 && second >= 0 && second <= 59,
+			"delivery time %02d:%02d:%02d", hour, minute, second)
+		fee, err := api.GetFee()
+		assert.NoError(t, err)
+		assert.True(t, fee >= 0 && fee < 1, "fee %v%%", fee)
+	})
+
+	config.run(t, "UserInfo", func(t *testing.T) {
+		acc, err := api.GetFutureUserInfo()
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.NotEmpty(t, acc.FutureSubAccounts)
+		for currency, sub := range acc.FutureSubAccounts {
+			assert.True(t, sub.KeepDeposit >= 0, "%s keep deposit %v", currency, sub.KeepDeposit)
+		}
+	})
+
+	config.run(t, "RestingOrder", func(t *testing.T) {
+		bid, _ := bestFuturePrices(t, api, cp, ct)
+		id, err := api.PlaceFutureOrder(cp, ct, formatPrice(bid*0.8), amount, OPEN_BUY, 0, lever)
+		if !assert.NoError(t, err) {
+			return
+		}
+		orders, err := api.GetFutureOrders([]string{id}, cp, ct)
+		if assert.NoError(t, err) && assert.Len(t, orders, 1) {
+			o := orders[0]
+			assert.Equal(t, id, strconv.FormatInt(o.OrderID, 10))
+			assert.Equal(t, TradeStatus(ORDER_UNFINISHED), o.Status)
+			assert.Equal(t, OPEN_BUY, o.OType)
+			assert.Equal(t, lever, o.LeverRate)
+			assert.Equal(t, float64(config.Amount), o.Amount)
+			if o.OrderTime != 0 {
+				AssertUnixMillis(t, o.OrderTime, "order time")
+			}
+		}
+		unfinished, err := api.GetUnfinishedFutureOrders(cp, ct)
+		assert.NoError(t, err)
+		assert.True(t, containsFutureOrder(unfinished, id), "order %s not in unfinished orders", id)
+
+		ok, err := api.FutureCancelOrder(cp, ct, id)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		orders, err = api.GetFutureOrders([]string{id}, cp, ct)
+		if assert.NoError(t, err) && assert.Len(t, orders, 1) {
+			assert.Equal(t, TradeStatus(ORDER_CANCEL), orders[0].Status)
+		}
+		unfinished, err = api.GetUnfinishedFutureOrders(cp, ct)
+		assert.NoError(t, err)
+		assert.NotNil(t, unfinished)
+		assert.False(t, containsFutureOrder(unfinished, id), "canceled order %s still unfinished", id)
+
+		ok, err = api.FutureCancelOrder(cp, ct, id)
+		assert.False(t, ok)
+		AssertErrorKind(t, err, ERR_KIND_INVALID_REQUEST)
+	})
+
+	config.run(t, "Position", func(t *testing.T) {
+		bid, ask := bestFuturePrices(t, api, cp, ct)
+		before := longAmount(t, api, cp, ct)
+		id, err := api.PlaceFutureOrder(cp, ct, formatPrice(ask*1.05), amount, OPEN_BUY, 0, lever)
+		if !assert.NoError(t, err) {
+			return
+		}
+		orders, err := api.GetFutureOrders([]string{id}, cp, ct)
+		if assert.NoError(t, err) && assert.Len(t, orders, 1) {
+			assert.Equal(t, TradeStatus(ORDER_FINISH), orders[0].Status)
+			assert.Equal(t, float64(config.Amount), orders[0].DealAmount)
+		}
+		assert.Equal(t, before+float64(config.Amount), longAmount(t, api, cp, ct))
+
+		//平仓数量不能超过持仓
+		_, err = api.PlaceFutureOrder(cp, ct, formatPrice(bid*0.95), strconv.Itoa(int(before)+config.Amount+1), CLOSE_BUY, 0, lever)
+		AssertErrorKind(t, err, ERR_KIND_INVALID_REQUEST)
+
+		id, err = api.PlaceFutureOrder(cp, ct, formatPrice(bid*0.95), amount, CLOSE_BUY, 0, lever)
+		if !assert.NoError(t, err) {
+			return
+		}
+		orders, err = api.GetFutureOrders([]string{id}, cp, ct)
+		if assert.NoError(t, err) && assert.Len(t, orders, 1) {
+			assert.Equal(t, TradeStatus(ORDER_FINISH), orders[0].Status)
+		}
+		assert.Equal(t, before, longAmount(t, api, cp, ct))
+	})
+
+	config.run(t, "OrderNotFound", func(t *testing.T) {
+		orders, err := api.GetFutureOrders([]string{UNKNOWN_ORDER_ID}, cp, ct)
+		assert.Empty(t, orders)
+		AssertErrorKind(t, err, ERR_KIND_INVALID_REQUEST)
+		ok, err := api.FutureCancelOrder(cp, ct, UNKNOWN_ORDER_ID)
+		assert.False(t, ok)
+		AssertErrorKind(t, err, ERR_KIND_INVALID_REQUEST)
+	})
+
+	config.run(t, "InsufficientFunds", func(t *testing.T) {
+		bid, _ := bestFuturePrices(t, api, cp, ct)
+		_, err := api.PlaceFutureOrder(cp, ct, formatPrice(bid*0.8), "100000000", OPEN_BUY, 0, lever)
+		AssertErrorKind(t, err, ERR_KIND_INSUFFICIENT_FUNDS)
+	})
+
+	config.run(t, "Klines", func(t *testing.T) {
+		klines, err := api.GetKlineRecords(ct, cp, "1min", 10, 0)
+		skipUnsupported(t, err)
+		if !assert.NoError(t, err) || !assert.NotEmpty(t, klines) {
+			return
+		}
+		spot := make([]Kline, 0, len(klines))
+		for _, k := range klines {
+			if assert.NotNil(t, k.Kline) {
+				spot = append(spot, *k.Kline)
+			}
+		}
+		AssertKlines(t, spot)
+	})
+}
+
+func bestFuturePrices(t *testing.T, api FutureApi, cp CurrencyPair, contractType string) (bid, ask float64) {
+	depth, err := api.GetFutureDepth(cp, contractType, 1)
+	if !assert.NoError(t, err) || !assert.NotEmpty(t, depth.BidList) || !assert.NotEmpty(t, depth.AskList) {
+		t.FailNow()
+	}
+	return depth.BidList[0].Price, depth.AskList[0].Price
+}
+
+func longAmount(t *testing.T, api FutureApi, cp CurrencyPair, contractType string) float64 {
+	positions, err := api.GetFuturePosition(cp, contractType)
+	assert.NoError(t, err)
+	amount := 0.0
+	for _, p := range positions {
+		amount += p.BuyAmount
+	}
+	return amount
+}
+
+func containsFutureOrder(orders []FutureOrder, id string) bool {
+	for _, o := range orders {
+		if strconv.FormatInt(o.OrderID, 10) == id {
+			return true
+		}
+	}
+	return false
+}
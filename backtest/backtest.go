@@ -0,0 +1,252 @@
+//用K线回测策略. 策略通过与实盘相同的 Api/FutureApi 下单, 订单按 FillModel 在K线上成交,
+//流动性不受限制. 回测输出权益曲线、成交记录和收益率、最大回撤、夏普比率、胜率、换手率等统计
+package backtest
+
+import (
+	"fmt"
+	"math"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+)
+
+const EXCHANGE_NAME = "backtest"
+
+//比较数量时容忍的浮点误差
+const epsilon = 1e-9
+
+const (
+	FILL_CLOSE     = iota //在下单的K线收盘价成交
+	FILL_NEXT_OPEN        //在下一根K线开盘价成交
+	FILL_INTRABAR         //市价单在下一根K线开盘价成交, 限价单在之后的K线最高最低价触及挂单价时成交
+)
+
+type FillModel int
+
+func (m FillModel) String() string {
+	switch m {
+	case FILL_CLOSE:
+		return "CLOSE"
+	case FILL_NEXT_OPEN:
+		return "NEXT_OPEN"
+	case FILL_INTRABAR:
+		return "INTRABAR"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+type Config struct {
+	FillModel      FillModel
+	Slippage       float64 //市价单和立即成交的限价单的滑点比例, 0.001 表示买入价上浮0.1%、卖出价下浮0.1%
+	MakerFee       float64 //挂单成交的手续费率
+	TakerFee       float64 //吃单成交的手续费率
+	PeriodsPerYear float64 //夏普比率的年化系数, 为0时按前两根K线的间隔估算
+	ContractValue  float64 //合约回测每张合约的面值(美元), 为0时 btc 为100, 其他币种为10
+}
+
+//现货策略, 每根K线调用一次, api 只能看到当前K线及之前的行情
+type Strategy interface {
+	OnBar(api Api, bar Kline) error
+}
+
+//合约策略
+type FutureStrategy interface {
+	OnBar(api FutureApi, bar FutureKline) error
+}
+
+//把函数用作 Strategy
+type StrategyFunc func(api Api, bar Kline) error
+
+func (f StrategyFunc) OnBar(api Api, bar Kline) error {
+	return f(api, bar)
+}
+
+//把函数用作 FutureStrategy
+type FutureStrategyFunc func(api FutureApi, bar FutureKline) error
+
+func (f FutureStrategyFunc) OnBar(api FutureApi, bar FutureKline) error {
+	return f(api, bar)
+}
+
+type EquityPoint struct {
+	Timestamp int64 //K线时间, unix秒
+	Equity    float64
+}
+
+//一笔成交. 现货的 Type 为 buy/sell, 合约为 open_long/open_short/close_long/close_short
+type Fill struct {
+	OrderID   int64
+	Timestamp int64
+	Type      string
+	Price     float64
+	Amount    float64 //现货为币的数量, 合约为张数
+	Notional  float64 //成交额, 与初始权益同一单位: 现货为计价币, 合约为 张数*面值/价格 的币
+	Fee       float64 //现货折算成计价币, 合约为币
+	Profit    float64 //卖出和平仓的盈亏, 已扣除手续费
+}
+
+func (f Fill) closing() bool {
+	return f.Type == "sell" || f.Type == "close_long" || f.Type == "close_short"
+}
+
+type Stats struct {
+	Return      float64 //总收益率
+	MaxDrawdown float64 //最大回撤比例
+	Sharpe      float64 //年化夏普比率, 无风险利率为0
+	WinRate     float64 //盈利的卖出和平仓成交占比
+	Turnover    float64 //成交额 / 初始权益
+	Trades      int     //成交笔数
+}
+
+type Result struct {
+	Equity []EquityPoint //每根K线收盘时的权益, 现货以计价币计, 合约以币计
+	Fills  []Fill
+	Stats  Stats
+}
+
+//用 bars 回测现货策略, balances 为初始余额, 权益以 cp 的计价币计
+func Run(strategy Strategy, cp CurrencyPair, bars []Kline, balances map[Currency]float64, config Config) (*Result, error) {
+	if len(bars) == 0 {
+		return nil, fmt.Errorf("backtest: no bars")
+	}
+	broker := newSpotBroker(cp, bars, balances, config)
+	initial := broker.equity()
+	result := &Result{}
+	for i := range bars {
+		broker.index = i
+		broker.match()
+		if err := strategy.OnBar(broker, bars[i]); err != nil {
+			return nil, err
+		}
+		result.Equity = append(result.Equity, EquityPoint{Timestamp: bars[i].Timestamp, Equity: broker.equity()})
+	}
+	result.Fills = broker.fills
+	result.Stats = computeStats(initial, result.Equity, result.Fills, config.periodsPerYear(bars))
+	return result, nil
+}
+
+//用 bars 回测合约策略, deposit 为合约账户的初始权益(币)
+func RunFuture(strategy FutureStrategy, cp CurrencyPair, contractType string, bars []FutureKline, deposit float64, config Config) (*Result, error) {
+	if len(bars) == 0 {
+		return nil, fmt.Errorf("backtest: no bars")
+	}
+	klines := make([]Kline, len(bars))
+	for i := range bars {
+		klines[i] = *bars[i].Kline
+	}
+	broker := newFutureBroker(cp, contractType, bars, deposit, config)
+	result := &Result{}
+	for i := range bars {
+		broker.index = i
+		broker.match()
+		if err := strategy.OnBar(broker, bars[i]); err != nil {
+			return nil, err
+		}
+		result.Equity = append(result.Equity, EquityPoint{Timestamp: bars[i].Timestamp, Equity: broker.rights()})
+	}
+	result.Fills = broker.fills
+	result.Stats = computeStats(deposit, result.Equity, result.Fills, config.periodsPerYear(klines))
+	return result, nil
+}
+
+//订单在bar上的成交价. first 表示订单第一次参与撮合, 这时价格已经穿过的限价单按吃单成交;
+//之后才被穿过或触及的限价单按挂单价成交
+func (c Config) fillPrice(bar Kline, buy, market bool, limit float64, first bool) (price float64, maker, ok bool) {
+	ref := bar.Open
+	if c.FillModel == FILL_CLOSE {
+		ref = bar.Close
+	}
+	slipped := ref * (1 - c.Slippage)
+	if buy {
+		slipped = ref * (1 + c.Slippage)
+	}
+	if market {
+		return slipped, false, true
+	}
+
+	crossed, touched := ref <= limit, bar.Low <= limit
+	if !buy {
+		crossed, touched = ref >= limit, bar.High >= limit
+	}
+	switch {
+	case crossed && first && buy:
+		return math.Min(slipped, limit), false, true
+	case crossed && first:
+		return math.Max(slipped, limit), false, true
+	case crossed, c.FillModel == FILL_INTRABAR && touched:
+		return limit, true, true
+	}
+	return 0, false, false
+}
+
+//订单在第index根K线是否第一次参与撮合. FILL_CLOSE 下单时已经按当根K线的收盘价撮合过一次,
+//之后都不是第一次
+func (c Config) firstMatch(placedAt, index int) bool {
+	return c.FillModel != FILL_CLOSE && placedAt == index-1
+}
+
+func (c Config) fee(maker bool) float64 {
+	if maker {
+		return c.MakerFee
+	}
+	return c.TakerFee
+}
+
+func (c Config) periodsPerYear(bars []Kline) float64 {
+	if c.PeriodsPerYear > 0 {
+		return c.PeriodsPerYear
+	}
+	if len(bars) < 2 || bars[1].Timestamp <= bars[0].Timestamp {
+		return 1
+	}
+	return 365 * 24 * 3600 / float64(bars[1].Timestamp-bars[0].Timestamp)
+}
+
+func (c Config) contractValue(cp CurrencyPair) float64 {
+	if c.ContractValue > 0 {
+		return c.ContractValue
+	}
+	if cp.CustomSymbol("_", true) == "btc_usd" {
+		return 100
+	}
+	return 10
+}
+
+//K线只在当前及之前的范围内可见, since 为毫秒, size 为0时返回全部
+func visibleBars(bars []Kline, index, size, since int) []Kline {
+	var visible []Kline
+	for _, bar := range bars[:index+1] {
+		if since <= 0 || bar.Timestamp*1000 >= int64(since) {
+			visible = append(visible, bar)
+		}
+	}
+	if size > 0 && len(visible) > size {
+		visible = visible[len(visible)-size:]
+	}
+	return visible
+}
+
+//买一卖一为收盘价加减滑点, 即市价单按收盘价成交时的价格; Slippage 为0时买一等于卖一
+func (c Config) barTicker(bar Kline) *Ticker {
+	return &Ticker{
+		Last: bar.Close,
+		Buy:  bar.Close * (1 - c.Slippage),
+		Sell: bar.Close * (1 + c.Slippage),
+		High: bar.High,
+		Low:  bar.Low,
+		Vol:  bar.Vol,
+		Date: uint64(bar.Timestamp),
+	}
+}
+
+//买卖各一档, 价格与 barTicker 的买一卖一相同, 数量为成交量
+func (c Config) barDepth(bar Kline) *Depth {
+	return &Depth{
+		AskList: DepthRecords{{Price: bar.Close * (1 + c.Slippage), Amount: bar.Vol}},
+		BidList: DepthRecords{{Price: bar.Close * (1 - c.Slippage), Amount: bar.Vol}},
+	}
+}
+
+func apiError(kind int, format string, args ...interface{}) error {
+	return &ApiError{Exchange: EXCHANGE_NAME, Kind: ErrorKind(kind), Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,252 @@
+package backtest
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+	"github.com/qct/cryptocurrency-exchange-api/apitest"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	btcUsdt = NewCurrencyPair("BTC", "USDT")
+	btcUsd  = NewCurrencyPair("BTC", "USD")
+)
+
+//每根K线间隔一分钟, 参数依次为开盘价、收盘价、最高价、最低价
+func testBars(ohlc ...[4]float64) []Kline {
+	bars := make([]Kline, len(ohlc))
+	for i, v := range ohlc {
+		bars[i] = Kline{Timestamp: int64(i * 60), Open: v[0], Close: v[1], High: v[2], Low: v[3], Vol: 10}
+	}
+	return bars
+}
+
+func TestRun_CloseBuyAndHold(t *testing.T) {
+	bars := testBars([4]float64{100, 100, 100, 100}, [4]float64{100, 110, 110, 100},
+		[4]float64{110, 99, 110, 99}, [4]float64{99, 120, 120, 99})
+	strategy := StrategyFunc(func(api Api, bar Kline) error {
+		if bar.Timestamp != 0 {
+			return nil
+		}
+		order, err := api.MarketBuy("", "1000", btcUsdt)
+		assert.NoError(t, err)
+		assert.Equal(t, TradeStatus(ORDER_FINISH), order.Status)
+		assert.InDelta(t, 10, order.DealAmount, 1e-9)
+		return nil
+	})
+
+	result, err := Run(strategy, btcUsdt, bars, map[Currency]float64{"USDT": 1000}, Config{TakerFee: 0.001, PeriodsPerYear: 1})
+	assert.NoError(t, err)
+	if assert.Len(t, result.Equity, 4) {
+		for i, want := range []float64{999, 1098.9, 989.01, 1198.8} {
+			assert.InDelta(t, want, result.Equity[i].Equity, 1e-9)
+		}
+	}
+	if assert.Len(t, result.Fills, 1) {
+		assert.Equal(t, "buy", result.Fills[0].Type)
+		assert.InDelta(t, 1, result.Fills[0].Fee, 1e-9)
+	}
+	assert.InDelta(t, 0.1988, result.Stats.Return, 1e-9)
+	assert.InDelta(t, 0.1, result.Stats.MaxDrawdown, 1e-9)
+	assert.InDelta(t, 1, result.Stats.Turnover, 1e-9)
+	assert.Equal(t, 0.0, result.Stats.WinRate)
+	assert.Equal(t, 1, result.Stats.Trades)
+}
+
+func TestRun_NextOpenWithSlippage(t *testing.T) {
+	bars := testBars([4]float64{100, 100, 100, 100}, [4]float64{100, 105, 106, 99},
+		[4]float64{110, 112, 113, 109}, [4]float64{120, 118, 121, 117})
+	strategy := StrategyFunc(func(api Api, bar Kline) error {
+		switch bar.Timestamp {
+		case 0:
+			order, err := api.MarketBuy("", "1000", btcUsdt)
+			assert.NoError(t, err)
+			assert.Equal(t, TradeStatus(ORDER_UNFINISHED), order.Status)
+		case 120:
+			acc, err := api.GetAccount()
+			assert.NoError(t, err)
+			amount := strconv.FormatFloat(acc.SubAccounts["BTC"].Amount, 'f', -1, 64)
+			_, err = api.MarketSell(amount, "", btcUsdt)
+			assert.NoError(t, err)
+		}
+		return nil
+	})
+
+	result, err := Run(strategy, btcUsdt, bars, map[Currency]float64{"USDT": 1000}, Config{FillModel: FILL_NEXT_OPEN, Slippage: 0.01})
+	assert.NoError(t, err)
+	if assert.Len(t, result.Fills, 2) {
+		buy, sell := result.Fills[0], result.Fills[1]
+		assert.Equal(t, int64(60), buy.Timestamp)
+		assert.InDelta(t, 101, buy.Price, 1e-9)
+		assert.InDelta(t, 1000/101.0, buy.Amount, 1e-9)
+		assert.Equal(t, int64(180), sell.Timestamp)
+		assert.InDelta(t, 118.8, sell.Price, 1e-9)
+		assert.InDelta(t, (118.8-101)*1000/101, sell.Profit, 1e-6)
+	}
+	assert.InDelta(t, 1000, result.Equity[0].Equity, 1e-9)
+	assert.InDelta(t, 118.8*1000/101, result.Equity[3].Equity, 1e-6)
+	assert.Equal(t, 1.0, result.Stats.WinRate)
+}
+
+func TestRun_IntrabarLimitOrders(t *testing.T) {
+	bars := testBars([4]float64{100, 100, 100, 100}, [4]float64{100, 98, 101, 96},
+		[4]float64{98, 97, 99, 94}, [4]float64{97, 97, 97, 97})
+	var ids []string
+	strategy := StrategyFunc(func(api Api, bar Kline) error {
+		if bar.Timestamp == 0 {
+			//第一次撮合时已经被开盘价穿过, 按开盘价吃单成交
+			order, err := api.LimitBuy("1", "105", btcUsdt)
+			assert.NoError(t, err)
+			ids = append(ids, strconv.Itoa(order.OrderID))
+			//之后的K线最低价触及挂单价时按挂单价成交
+			order, err = api.LimitBuy("1", "95", btcUsdt)
+			assert.NoError(t, err)
+			ids = append(ids, strconv.Itoa(order.OrderID))
+		}
+		if bar.Timestamp == 60 {
+			order, err := api.GetOneOrder(ids[1], btcUsdt)
+			assert.NoError(t, err)
+			assert.Equal(t, TradeStatus(ORDER_UNFINISHED), order.Status)
+		}
+		return nil
+	})
+
+	result, err := Run(strategy, btcUsdt, bars, map[Currency]float64{"USDT": 1000}, Config{FillModel: FILL_INTRABAR, MakerFee: 0.001, TakerFee: 0.002})
+	assert.NoError(t, err)
+	if assert.Len(t, result.Fills, 2) {
+		assert.Equal(t, int64(60), result.Fills[0].Timestamp)
+		assert.InDelta(t, 100, result.Fills[0].Price, 1e-9)
+		assert.InDelta(t, 0.002*100, result.Fills[0].Fee, 1e-9)
+		assert.Equal(t, int64(120), result.Fills[1].Timestamp)
+		assert.InDelta(t, 95, result.Fills[1].Price, 1e-9)
+		assert.InDelta(t, 0.001*95, result.Fills[1].Fee, 1e-9)
+	}
+	assert.InDelta(t, 1000-100-95+(2-0.003)*97, result.Equity[3].Equity, 1e-9)
+}
+
+//FILL_CLOSE 下单时没有成交的限价单挂过一根K线后按挂单价、MakerFee 成交, 不算吃单
+func TestRun_CloseRestingLimitIsMaker(t *testing.T) {
+	bars := testBars([4]float64{100, 100, 100, 100}, [4]float64{100, 90, 100, 90})
+	config := Config{FillModel: FILL_CLOSE, MakerFee: 0.001, TakerFee: 0.002, Slippage: 0.01}
+
+	result, err := Run(StrategyFunc(func(api Api, bar Kline) error {
+		if bar.Timestamp == 0 {
+			order, err := api.LimitBuy("1", "95", btcUsdt)
+			assert.NoError(t, err)
+			assert.Equal(t, TradeStatus(ORDER_UNFINISHED), order.Status)
+		}
+		return nil
+	}), btcUsdt, bars, map[Currency]float64{"USDT": 1000}, config)
+	assert.NoError(t, err)
+	if assert.Len(t, result.Fills, 1) {
+		assert.Equal(t, int64(60), result.Fills[0].Timestamp)
+		assert.InDelta(t, 95, result.Fills[0].Price, 1e-9)
+		assert.InDelta(t, 0.001*95, result.Fills[0].Fee, 1e-9)
+	}
+
+	klines := bars
+	futureBars := make([]FutureKline, len(klines))
+	for i := range klines {
+		futureBars[i] = FutureKline{Kline: &klines[i]}
+	}
+	result, err = RunFuture(FutureStrategyFunc(func(api FutureApi, bar FutureKline) error {
+		if bar.Timestamp == 0 {
+			_, err := api.PlaceFutureOrder(btcUsd, QUARTER_CONTRACT, "95", "1", OPEN_BUY, 0, 10)
+			assert.NoError(t, err)
+		}
+		return nil
+	}), btcUsd, QUARTER_CONTRACT, futureBars, 1, config)
+	assert.NoError(t, err)
+	if assert.Len(t, result.Fills, 1) {
+		assert.InDelta(t, 95, result.Fills[0].Price, 1e-9)
+		assert.InDelta(t, 100/95.0*0.001, result.Fills[0].Fee, 1e-12)
+	}
+}
+
+func TestRun_NoLookAhead(t *testing.T) {
+	bars := testBars([4]float64{100, 101, 102, 99}, [4]float64{101, 102, 103, 100}, [4]float64{102, 103, 104, 101})
+	strategy := StrategyFunc(func(api Api, bar Kline) error {
+		klines, err := api.GetKlineRecords(btcUsdt, "1min", 0, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, bar, klines[len(klines)-1])
+		ticker, err := api.GetTicker(btcUsdt)
+		assert.NoError(t, err)
+		assert.Equal(t, bar.Close, ticker.Last)
+
+		_, err = api.GetTicker(NewCurrencyPair("LTC", "USDT"))
+		apitest.AssertErrorKind(t, err, ERR_KIND_INVALID_REQUEST)
+		_, err = api.LimitSell("1", "100", btcUsdt)
+		apitest.AssertErrorKind(t, err, ERR_KIND_INSUFFICIENT_FUNDS)
+		return nil
+	})
+
+	_, err := Run(strategy, btcUsdt, bars, map[Currency]float64{"USDT": 1000}, Config{})
+	assert.NoError(t, err)
+}
+
+func TestRun_StrategyError(t *testing.T) {
+	boom := errors.New("boom")
+	_, err := Run(StrategyFunc(func(api Api, bar Kline) error {
+		return boom
+	}), btcUsdt, testBars([4]float64{1, 1, 1, 1}), nil, Config{})
+	assert.Equal(t, boom, err)
+
+	_, err = Run(StrategyFunc(func(api Api, bar Kline) error {
+		return nil
+	}), btcUsdt, nil, nil, Config{})
+	assert.Error(t, err)
+}
+
+func TestRunFuture_LongRoundTrip(t *testing.T) {
+	klines := testBars([4]float64{100, 100, 100, 100}, [4]float64{100, 105, 106, 99}, [4]float64{105, 110, 111, 104})
+	bars := make([]FutureKline, len(klines))
+	for i := range klines {
+		bars[i] = FutureKline{Kline: &klines[i]}
+	}
+	strategy := FutureStrategyFunc(func(api FutureApi, bar FutureKline) error {
+		switch bar.Timestamp {
+		case 0:
+			_, err := api.PlaceFutureOrder(btcUsd, QUARTER_CONTRACT, "", "10", OPEN_BUY, 1, 10)
+			assert.NoError(t, err)
+			_, err = api.PlaceFutureOrder(btcUsd, QUARTER_CONTRACT, "", "1000", OPEN_BUY, 1, 10)
+			apitest.AssertErrorKind(t, err, ERR_KIND_INSUFFICIENT_FUNDS)
+		case 60:
+			positions, err := api.GetFuturePosition(btcUsd, QUARTER_CONTRACT)
+			assert.NoError(t, err)
+			if assert.Len(t, positions, 1) {
+				assert.Equal(t, 10.0, positions[0].BuyAmount)
+				assert.Equal(t, 100.0, positions[0].BuyPriceAvg)
+			}
+		case 120:
+			_, err := api.PlaceFutureOrder(btcUsd, QUARTER_CONTRACT, "", "10", CLOSE_BUY, 1, 10)
+			assert.NoError(t, err)
+		}
+		return nil
+	})
+
+	result, err := RunFuture(strategy, btcUsd, QUARTER_CONTRACT, bars, 1, Config{})
+	assert.NoError(t, err)
+	profit := 10 * 100 * (1/100.0 - 1/110.0)
+	if assert.Len(t, result.Fills, 2) {
+		assert.Equal(t, "open_long", result.Fills[0].Type)
+		assert.Equal(t, "close_long", result.Fills[1].Type)
+		assert.InDelta(t, profit, result.Fills[1].Profit, 1e-9)
+	}
+	assert.InDelta(t, 1+10*100*(1/100.0-1/105.0), result.Equity[1].Equity, 1e-9)
+	assert.InDelta(t, 1+profit, result.Equity[2].Equity, 1e-9)
+	assert.InDelta(t, profit, result.Stats.Return, 1e-9)
+	assert.Equal(t, 1.0, result.Stats.WinRate)
+	//成交额以币计: 开仓 10*100/100, 平仓 10*100/110, 初始权益为1个币
+	assert.InDelta(t, 10.0+1000/110.0, result.Stats.Turnover, 1e-9)
+}
+
+func TestSharpe(t *testing.T) {
+	assert.Equal(t, 0.0, sharpe([]float64{0.01}, 365))
+	assert.Equal(t, 0.0, sharpe([]float64{0.01, 0.01, 0.01}, 365))
+	//均值0.02, 样本标准差0.01
+	assert.InDelta(t, 2*2, sharpe([]float64{0.01, 0.02, 0.03}, 4), 1e-9)
+	assert.Equal(t, "INTRABAR", FillModel(FILL_INTRABAR).String())
+}
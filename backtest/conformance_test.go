@@ -0,0 +1,58 @@
+package backtest
+
+import (
+	"testing"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+	"github.com/qct/cryptocurrency-exchange-api/apitest"
+	"github.com/stretchr/testify/assert"
+)
+
+//从 2017-09-30 16:00 UTC 开始, 每根K线间隔一分钟
+func conformanceBars() []Kline {
+	bars := testBars([4]float64{100, 100, 101, 99}, [4]float64{100, 101, 102, 99}, [4]float64{101, 100, 102, 99})
+	for i := range bars {
+		bars[i].Timestamp += 1506787200
+	}
+	return bars
+}
+
+//在第一根K线上对回测账户运行一致性测试. 有滑点时盘口的买一才低于卖一
+func TestSpotBroker_ApiConformance(t *testing.T) {
+	ran := false
+	strategy := StrategyFunc(func(api Api, bar Kline) error {
+		if !ran {
+			ran = true
+			apitest.TestApi(t, apitest.Config{Api: api, Pair: btcUsdt, Amount: 0.5})
+		}
+		return nil
+	})
+	_, err := Run(strategy, btcUsdt, conformanceBars(), map[Currency]float64{"USDT": 1000, "BTC": 1}, Config{Slippage: 0.001})
+	assert.NoError(t, err)
+	assert.True(t, ran)
+}
+
+func TestFutureBroker_ApiConformance(t *testing.T) {
+	klines := conformanceBars()
+	bars := make([]FutureKline, len(klines))
+	for i := range klines {
+		bars[i] = FutureKline{Kline: &klines[i]}
+	}
+	ran := false
+	strategy := FutureStrategyFunc(func(api FutureApi, bar FutureKline) error {
+		if !ran {
+			ran = true
+			apitest.TestFutureApi(t, apitest.FutureConfig{
+				Api:          api,
+				Pair:         btcUsd,
+				ContractType: QUARTER_CONTRACT,
+				Amount:       10,
+				LeverRate:    10,
+			})
+		}
+		return nil
+	})
+	_, err := RunFuture(strategy, btcUsd, QUARTER_CONTRACT, bars, 10, Config{Slippage: 0.001})
+	assert.NoError(t, err)
+	assert.True(t, ran)
+}
@@ -0,0 +1,361 @@
+package backtest
+
+import (
+	"strconv"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+	"github.com/qct/cryptocurrency-exchange-api/margin"
+)
+
+type futureOrder struct {
+	FutureOrder
+	placedAt   int
+	matchPrice bool
+}
+
+func (o *futureOrder) open() bool {
+	return o.Status == ORDER_UNFINISHED
+}
+
+func (o *futureOrder) isBuy() bool {
+	return margin.IsBuy(o.OType)
+}
+
+var fillTypes = map[int]string{
+	OPEN_BUY:   "open_long",
+	OPEN_SELL:  "open_short",
+	CLOSE_BUY:  "close_long",
+	CLOSE_SELL: "close_short",
+}
+
+//合约回测账户, 只能交易一个合约, 实现 FutureApi. 与 OkEx 一样以币计保证金和盈亏,
+//保证金在开仓时按成交价和杠杆固定. 回测不模拟交割和强平
+type futureBroker struct {
+	config       Config
+	pair         CurrencyPair
+	contractType string
+	bars         []FutureKline
+	index        int
+	nextId       int64
+	orders       []*futureOrder
+	fills        []Fill
+
+	balance    float64 //静态权益, 包含已实现盈亏, 扣除了手续费
+	profitReal float64
+	position   margin.Position
+}
+
+func newFutureBroker(cp CurrencyPair, contractType string, bars []FutureKline, deposit float64, config Config) *futureBroker {
+	return &futureBroker{
+		config:       config,
+		pair:         cp,
+		contractType: contractType,
+		bars:         bars,
+		balance:      deposit,
+		position:     margin.Position{ContractValue: config.contractValue(cp)},
+	}
+}
+
+func (b *futureBroker) bar() Kline {
+	return *b.bars[b.index].Kline
+}
+
+func (b *futureBroker) contractValue() float64 {
+	return b.config.contractValue(b.pair)
+}
+
+func (b *futureBroker) profitUnreal() float64 {
+	price := b.bar().Close
+	return b.position.ProfitUnreal(price, price)
+}
+
+//以当前K线收盘价计算的账户权益(币)
+func (b *futureBroker) rights() float64 {
+	return b.balance + b.profitUnreal()
+}
+
+//持仓保证金加上开仓挂单冻结的保证金, 市价开仓单按当前收盘价估算
+func (b *futureBroker) keepDeposit() float64 {
+	deposit := b.position.Margin()
+	for _, o := range b.orders {
+		if o.open() && margin.IsOpen(o.OType) {
+			deposit += b.orderMargin(o)
+		}
+	}
+	return deposit
+}
+
+func (b *futureBroker) orderMargin(o *futureOrder) float64 {
+	price := o.Price
+	if o.matchPrice {
+		price = b.bar().Close
+	}
+	return margin.Deposit(o.Amount, b.contractValue(), price, o.LeverRate)
+}
+
+//还没成交的平仓单的张数, 回测的订单只会一次全部成交
+func (b *futureBroker) pendingClose(otype int) float64 {
+	pending := 0.0
+	for _, o := range b.orders {
+		if o.open() && o.OType == otype {
+			pending += o.Amount
+		}
+	}
+	return pending
+}
+
+func (b *futureBroker) checkContract(cp CurrencyPair, contractType string) error {
+	if cp.Symbol() != b.pair.Symbol() || contractType != b.contractType {
+		return apiError(ERR_KIND_INVALID_REQUEST, "unsupported contract %s %s", cp.Symbol(), contractType)
+	}
+	return nil
+}
+
+//用当前K线撮合之前K线下的订单
+func (b *futureBroker) match() {
+	for _, o := range b.orders {
+		if o.open() && o.placedAt < b.index {
+			b.tryFill(o, b.config.firstMatch(o.placedAt, b.index))
+		}
+	}
+}
+
+//手续费按成交面值折合成币从静态权益中扣除
+func (b *futureBroker) tryFill(o *futureOrder, first bool) {
+	price, maker, ok := b.config.fillPrice(b.bar(), o.isBuy(), o.matchPrice, o.Price, first)
+	if !ok {
+		return
+	}
+	amount := o.Amount
+	profit := b.position.Fill(o.OType, price, amount, o.LeverRate)
+	b.balance += profit
+	b.profitReal += profit
+
+	fee := amount * b.contractValue() / price * b.config.fee(maker)
+	b.balance -= fee
+	b.fills = append(b.fills, Fill{
+		OrderID:   o.OrderID,
+		Timestamp: b.bar().Timestamp,
+		Type:      fillTypes[o.OType],
+		Price:     price,
+		Amount:    amount,
+		Notional:  amount * b.contractValue() / price,
+		Fee:       fee,
+		Profit:    profit - fee,
+	})
+
+	o.Fee = fee
+	o.AvgPrice = price
+	o.DealAmount = amount
+	o.Status = ORDER_FINISH
+}
+
+func (b *futureBroker) GetExchangeName() string {
+	return EXCHANGE_NAME
+}
+
+//没有交割价格, 返回当前收盘价
+func (b *futureBroker) GetFutureEstimatedPrice(cp CurrencyPair) (float64, error) {
+	if err := b.checkContract(cp, b.contractType); err != nil {
+		return 0, err
+	}
+	return b.bar().Close, nil
+}
+
+func (b *futureBroker) GetFutureTicker(cp CurrencyPair, contractType string) (*Ticker, error) {
+	if err := b.checkContract(cp, contractType); err != nil {
+		return nil, err
+	}
+	return b.config.barTicker(b.bar()), nil
+}
+
+func (b *futureBroker) GetFutureDepth(cp CurrencyPair, contractType string, size int) (*Depth, error) {
+	if err := b.checkContract(cp, contractType); err != nil {
+		return nil, err
+	}
+	return b.config.barDepth(b.bar()), nil
+}
+
+//没有指数价格, 返回当前收盘价
+func (b *futureBroker) GetFutureIndex(cp CurrencyPair) (float64, error) {
+	return b.GetFutureEstimatedPrice(cp)
+}
+
+func (b *futureBroker) GetFutureUserInfo() (*FutureAccount, error) {
+	deposit, unreal := b.keepDeposit(), b.profitUnreal()
+	rights := b.balance + unreal
+	riskRate := 10000.0
+	if deposit > epsilon {
+		riskRate = rights / deposit
+	}
+	currency := string(b.pair.BaseCurrency)
+	return &FutureAccount{FutureSubAccounts: map[string]FutureSubAccount{currency: {
+		Currency:      currency,
+		AccountRights: rights,
+		KeepDeposit:   deposit,
+		ProfitReal:    b.profitReal,
+		ProfitUnreal:  unreal,
+		RiskRate:      riskRate,
+	}}}, nil
+}
+
+//开仓检查可用保证金, 平仓检查可平数量. FILL_CLOSE 时立即按当前K线撮合, 其他模型等下一根K线
+func (b *futureBroker) PlaceFutureOrder(cp CurrencyPair, contractType, price, amount string, openType, matchPrice, leverRate int) (string, error) {
+	if err := b.checkContract(cp, contractType); err != nil {
+		return "", err
+	}
+	o := &futureOrder{placedAt: b.index, matchPrice: matchPrice == 1}
+	o.OType, o.LeverRate = openType, leverRate
+	o.Currency = cp.CustomSymbol("_", true)
+	if openType < OPEN_BUY || openType > CLOSE_SELL {
+		return "", apiError(ERR_KIND_INVALID_REQUEST, "invalid open type %d", openType)
+	}
+	if leverRate <= 0 {
+		return "", apiError(ERR_KIND_INVALID_REQUEST, "invalid lever rate %d", leverRate)
+	}
+	var err error
+	if o.Amount, err = strconv.ParseFloat(amount, 64); err != nil || o.Amount <= 0 || o.Amount != float64(int64(o.Amount)) {
+		return "", apiError(ERR_KIND_INVALID_REQUEST, "invalid amount %q", amount)
+	}
+	if !o.matchPrice {
+		if o.Price, err = strconv.ParseFloat(price, 64); err != nil || o.Price <= 0 {
+			return "", apiError(ERR_KIND_INVALID_REQUEST, "invalid price %q", price)
+		}
+	}
+
+	if p := b.position; !p.Empty() && p.LeverRate != leverRate {
+		return "", apiError(ERR_KIND_INVALID_REQUEST, "lever rate %d differs from position's %d", leverRate, p.LeverRate)
+	}
+	switch openType {
+	case OPEN_BUY, OPEN_SELL:
+		required := b.orderMargin(o)
+		if available := b.rights() - b.keepDeposit(); available+epsilon < required {
+			return "", apiError(ERR_KIND_INSUFFICIENT_FUNDS, "insufficient %s margin: need %v, available %v", cp.BaseCurrency, required, available)
+		}
+	case CLOSE_BUY, CLOSE_SELL:
+		if available := b.position.Held(openType) - b.pendingClose(openType); available+epsilon < o.Amount {
+			return "", apiError(ERR_KIND_INVALID_REQUEST, "close amount %v exceeds available position %v", o.Amount, available)
+		}
+	}
+
+	b.nextId++
+	o.OrderID = b.nextId
+	o.OrderTime = b.bar().Timestamp * 1000
+	o.Status = ORDER_UNFINISHED
+	b.orders = append(b.orders, o)
+	if b.config.FillModel == FILL_CLOSE {
+		b.tryFill(o, true)
+	}
+	return strconv.FormatInt(o.OrderID, 10), nil
+}
+
+func (b *futureBroker) findOrder(cp CurrencyPair, contractType, orderId string) (*futureOrder, error) {
+	if err := b.checkContract(cp, contractType); err != nil {
+		return nil, err
+	}
+	for _, o := range b.orders {
+		if strconv.FormatInt(o.OrderID, 10) == orderId {
+			return o, nil
+		}
+	}
+	return nil, apiError(ERR_KIND_INVALID_REQUEST, "order %s not found", orderId)
+}
+
+func (b *futureBroker) FutureCancelOrder(cp CurrencyPair, contractType, orderId string) (bool, error) {
+	o, err := b.findOrder(cp, contractType, orderId)
+	if err != nil {
+		return false, err
+	}
+	if !o.open() {
+		return false, apiError(ERR_KIND_INVALID_REQUEST, "order %s is %s", orderId, o.Status)
+	}
+	o.Status = ORDER_CANCEL
+	return true, nil
+}
+
+//没有持仓时返回空
+func (b *futureBroker) GetFuturePosition(cp CurrencyPair, contractType string) ([]FuturePosition, error) {
+	if err := b.checkContract(cp, contractType); err != nil {
+		return nil, err
+	}
+	p := b.position
+	if p.Empty() {
+		return []FuturePosition{}, nil
+	}
+	return []FuturePosition{{
+		BuyAmount:      p.BuyAmount,
+		BuyAvailable:   p.BuyAmount - b.pendingClose(CLOSE_BUY),
+		BuyPriceAvg:    p.BuyPriceAvg,
+		BuyPriceCost:   p.BuyPriceAvg,
+		BuyProfitReal:  p.BuyProfitReal,
+		LeverRate:      p.LeverRate,
+		SellAmount:     p.SellAmount,
+		SellAvailable:  p.SellAmount - b.pendingClose(CLOSE_SELL),
+		SellPriceAvg:   p.SellPriceAvg,
+		SellPriceCost:  p.SellPriceAvg,
+		SellProfitReal: p.SellProfitReal,
+		Symbol:         cp.CustomSymbol("_", true),
+		ContractType:   contractType,
+	}}, nil
+}
+
+//订单不存在时返回错误
+func (b *futureBroker) GetFutureOrders(orderIds []string, cp CurrencyPair, contractType string) ([]FutureOrder, error) {
+	orders := make([]FutureOrder, 0, len(orderIds))
+	for _, id := range orderIds {
+		o, err := b.findOrder(cp, contractType, id)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, o.FutureOrder)
+	}
+	return orders, nil
+}
+
+func (b *futureBroker) GetUnfinishedFutureOrders(cp CurrencyPair, contractType string) ([]FutureOrder, error) {
+	if err := b.checkContract(cp, contractType); err != nil {
+		return nil, err
+	}
+	orders := []FutureOrder{}
+	for _, o := range b.orders {
+		if o.open() {
+			orders = append(orders, o.FutureOrder)
+		}
+	}
+	return orders, nil
+}
+
+//与 OkExApi 一致, 以百分比表示吃单费率
+func (b *futureBroker) GetFee() (float64, error) {
+	return b.config.TakerFee * 100, nil
+}
+
+func (b *futureBroker) GetExchangeRate() (float64, error) {
+	return -1, NewUnsupportedError(EXCHANGE_NAME, "GetExchangeRate")
+}
+
+func (b *futureBroker) GetContractValue(cp CurrencyPair) (float64, error) {
+	return b.config.contractValue(cp), nil
+}
+
+//与 OkExApi 一致, 星期五16:00
+func (b *futureBroker) GetDeliveryTime() (int, int, int, int) {
+	return 4, 16, 0, 0
+}
+
+//只返回当前及之前的K线, period 被忽略
+func (b *futureBroker) GetKlineRecords(contractType string, cp CurrencyPair, period string, size, since int) ([]FutureKline, error) {
+	if err := b.checkContract(cp, contractType); err != nil {
+		return nil, err
+	}
+	var klines []FutureKline
+	for _, bar := range b.bars[:b.index+1] {
+		if since <= 0 || bar.Timestamp*1000 >= int64(since) {
+			klines = append(klines, bar)
+		}
+	}
+	if size > 0 && len(klines) > size {
+		klines = klines[len(klines)-size:]
+	}
+	return klines, nil
+}
@@ -0,0 +1,345 @@
+package backtest
+
+import (
+	"strconv"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+)
+
+type spotOrder struct {
+	Order
+	placedAt int     //下单时的K线序号
+	funds    float64 //市价买单冻结的计价币
+}
+
+func (o *spotOrder) isBuy() bool {
+	return o.Side == BUY || o.Side == BUY_MARKET
+}
+
+func (o *spotOrder) isMarket() bool {
+	return o.Side == BUY_MARKET || o.Side == SELL_MARKET
+}
+
+func (o *spotOrder) open() bool {
+	return o.Status == ORDER_UNFINISHED
+}
+
+//现货回测账户, 只能交易一个交易对, 实现 Api
+type spotBroker struct {
+	config   Config
+	pair     CurrencyPair
+	bars     []Kline
+	index    int
+	nextId   int
+	balances map[Currency]*SubAccount
+	orders   []*spotOrder
+	fills    []Fill
+	cost     float64 //持有的基础币的总成本, 按平均成本计算卖出盈亏
+}
+
+func newSpotBroker(cp CurrencyPair, bars []Kline, balances map[Currency]float64, config Config) *spotBroker {
+	b := &spotBroker{config: config, pair: cp, bars: bars, balances: map[Currency]*SubAccount{}}
+	for currency, amount := range balances {
+		b.account(currency).Amount = amount
+	}
+	//初始持有的基础币按第一根K线的开盘价计成本
+	b.cost = b.account(cp.BaseCurrency).Amount * bars[0].Open
+	return b
+}
+
+func (b *spotBroker) account(currency Currency) *SubAccount {
+	acc, ok := b.balances[currency]
+	if !ok {
+		acc = &SubAccount{Currency: string(currency)}
+		b.balances[currency] = acc
+	}
+	return acc
+}
+
+func (b *spotBroker) bar() Kline {
+	return b.bars[b.index]
+}
+
+//以当前K线收盘价计算的总权益(计价币)
+func (b *spotBroker) equity() float64 {
+	base, counter := b.account(b.pair.BaseCurrency), b.account(b.pair.CounterCurrency)
+	return counter.Amount + counter.FrozenAmount + (base.Amount+base.FrozenAmount)*b.bar().Close
+}
+
+func (b *spotBroker) checkPair(cp CurrencyPair) error {
+	if cp.Symbol() != b.pair.Symbol() {
+		return apiError(ERR_KIND_INVALID_REQUEST, "unsupported pair %s", cp.Symbol())
+	}
+	return nil
+}
+
+func (b *spotBroker) parseAmount(name, value string) (float64, error) {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil || v <= 0 {
+		return 0, apiError(ERR_KIND_INVALID_REQUEST, "invalid %s %q", name, value)
+	}
+	return v, nil
+}
+
+//用当前K线撮合之前K线下的订单
+func (b *spotBroker) match() {
+	for _, o := range b.orders {
+		if o.open() && o.placedAt < b.index {
+			b.tryFill(o, b.config.firstMatch(o.placedAt, b.index))
+		}
+	}
+}
+
+func (b *spotBroker) tryFill(o *spotOrder, first bool) {
+	price, maker, ok := b.config.fillPrice(b.bar(), o.isBuy(), o.isMarket(), o.Price, first)
+	if !ok {
+		return
+	}
+	base, counter := b.account(b.pair.BaseCurrency), b.account(b.pair.CounterCurrency)
+	rate := b.config.fee(maker)
+	amount, fee := o.Amount, 0.0
+	fill := Fill{OrderID: int64(o.OrderID), Timestamp: b.bar().Timestamp, Price: price}
+	switch o.Side {
+	case BUY, BUY_MARKET:
+		spent := price * amount
+		if o.Side == BUY {
+			counter.FrozenAmount -= o.Price * amount
+			counter.Amount += (o.Price - price) * amount
+		} else {
+			spent = o.funds
+			amount = spent / price
+			counter.FrozenAmount -= o.funds
+			o.funds = 0
+		}
+		fee = amount * rate
+		base.Amount += amount - fee
+		b.cost += spent
+		fill.Type, fill.Fee = "buy", fee*price
+	default:
+		received := price * amount
+		fee = received * rate
+		base.FrozenAmount -= amount
+		counter.Amount += received - fee
+		held := base.Amount + base.FrozenAmount + amount
+		avgCost := 0.0
+		if held > epsilon {
+			avgCost = b.cost / held
+		}
+		b.cost -= avgCost * amount
+		fill.Type, fill.Fee, fill.Profit = "sell", fee, received-fee-avgCost*amount
+	}
+	fill.Amount, fill.Notional = amount, price*amount
+	b.fills = append(b.fills, fill)
+
+	o.Amount = amount
+	o.DealAmount = amount
+	o.AvgPrice = price
+	o.Fee = fee
+	o.Status = ORDER_FINISH
+}
+
+func (b *spotBroker) GetExchangeName() string {
+	return EXCHANGE_NAME
+}
+
+func (b *spotBroker) GetTicker(cp CurrencyPair) (*Ticker, error) {
+	if err := b.checkPair(cp); err != nil {
+		return nil, err
+	}
+	return b.config.barTicker(b.bar()), nil
+}
+
+func (b *spotBroker) GetDepth(cp CurrencyPair, size int) (*Depth, error) {
+	if err := b.checkPair(cp); err != nil {
+		return nil, err
+	}
+	return b.config.barDepth(b.bar()), nil
+}
+
+func (b *spotBroker) LimitBuy(amount, price string, cp CurrencyPair) (*Order, error) {
+	return b.placeOrder(BUY, amount, price, cp)
+}
+
+func (b *spotBroker) LimitSell(amount, price string, cp CurrencyPair) (*Order, error) {
+	return b.placeOrder(SELL, amount, price, cp)
+}
+
+//与 OkCNApi 一致, price 为买入花费的计价币总额, amount 被忽略
+func (b *spotBroker) MarketBuy(amount, price string, cp CurrencyPair) (*Order, error) {
+	return b.placeOrder(BUY_MARKET, amount, price, cp)
+}
+
+//price 被忽略
+func (b *spotBroker) MarketSell(amount, price string, cp CurrencyPair) (*Order, error) {
+	return b.placeOrder(SELL_MARKET, amount, price, cp)
+}
+
+//冻结资金, FILL_CLOSE 时立即按当前K线撮合, 其他模型等下一根K线
+func (b *spotBroker) placeOrder(side TradeSide, amount, price string, cp CurrencyPair) (*Order, error) {
+	if err := b.checkPair(cp); err != nil {
+		return nil, err
+	}
+	o := &spotOrder{placedAt: b.index}
+	o.Side = side
+	o.CurrencyPair = cp.Symbol()
+	var err error
+	if side != BUY_MARKET {
+		if o.Amount, err = b.parseAmount("amount", amount); err != nil {
+			return nil, err
+		}
+	}
+	if side != SELL_MARKET {
+		if o.Price, err = b.parseAmount("price", price); err != nil {
+			return nil, err
+		}
+	}
+
+	base, counter := b.account(cp.BaseCurrency), b.account(cp.CounterCurrency)
+	switch side {
+	case BUY, BUY_MARKET:
+		cost := o.Price
+		if side == BUY {
+			cost *= o.Amount
+		}
+		if counter.Amount+epsilon < cost {
+			return nil, apiError(ERR_KIND_INSUFFICIENT_FUNDS, "insufficient %s: need %v, available %v", counter.Currency, cost, counter.Amount)
+		}
+		counter.Amount -= cost
+		counter.FrozenAmount += cost
+		if side == BUY_MARKET {
+			o.funds = cost
+		}
+	default:
+		if base.Amount+epsilon < o.Amount {
+			return nil, apiError(ERR_KIND_INSUFFICIENT_FUNDS, "insufficient %s: need %v, available %v", base.Currency, o.Amount, base.Amount)
+		}
+		base.Amount -= o.Amount
+		base.FrozenAmount += o.Amount
+	}
+
+	b.nextId++
+	o.OrderID = b.nextId
+	o.OrderTime = int(b.bar().Timestamp * 1000)
+	o.Status = ORDER_UNFINISHED
+	b.orders = append(b.orders, o)
+	if b.config.FillModel == FILL_CLOSE {
+		b.tryFill(o, true)
+	}
+	order := o.Order
+	return &order, nil
+}
+
+func (b *spotBroker) findOrder(orderId string, cp CurrencyPair) (*spotOrder, error) {
+	id, err := strconv.Atoi(orderId)
+	if err != nil {
+		return nil, apiError(ERR_KIND_INVALID_REQUEST, "invalid order id %q", orderId)
+	}
+	for _, o := range b.orders {
+		if o.OrderID == id && o.CurrencyPair == cp.Symbol() {
+			return o, nil
+		}
+	}
+	return nil, apiError(ERR_KIND_INVALID_REQUEST, "order %s not found", orderId)
+}
+
+func (b *spotBroker) CancelOrder(orderId string, cp CurrencyPair) (bool, error) {
+	o, err := b.findOrder(orderId, cp)
+	if err != nil {
+		return false, err
+	}
+	if !o.open() {
+		return false, apiError(ERR_KIND_INVALID_REQUEST, "order %s is %s", orderId, o.Status)
+	}
+	base, counter := b.account(b.pair.BaseCurrency), b.account(b.pair.CounterCurrency)
+	switch o.Side {
+	case BUY:
+		counter.FrozenAmount -= o.Price * o.Amount
+		counter.Amount += o.Price * o.Amount
+	case BUY_MARKET:
+		counter.FrozenAmount -= o.funds
+		counter.Amount += o.funds
+		o.funds = 0
+	default:
+		base.FrozenAmount -= o.Amount
+		base.Amount += o.Amount
+	}
+	o.Status = ORDER_CANCEL
+	return true, nil
+}
+
+func (b *spotBroker) GetOneOrder(orderId string, cp CurrencyPair) (*Order, error) {
+	o, err := b.findOrder(orderId, cp)
+	if err != nil {
+		return nil, err
+	}
+	order := o.Order
+	return &order, nil
+}
+
+func (b *spotBroker) GetUnfinishedOrders(cp CurrencyPair) ([]Order, error) {
+	orders := []Order{}
+	for _, o := range b.orders {
+		if o.CurrencyPair == cp.Symbol() && o.open() {
+			orders = append(orders, o.Order)
+		}
+	}
+	return orders, nil
+}
+
+//已完成和已撤销的订单, 按下单时间倒序分页, currentPage 从1开始
+func (b *spotBroker) GetOrderHistory(cp CurrencyPair, currentPage, pageSize int) ([]Order, error) {
+	if currentPage < 1 || pageSize < 1 {
+		return nil, apiError(ERR_KIND_INVALID_REQUEST, "invalid page %d/%d", currentPage, pageSize)
+	}
+	orders := []Order{}
+	skip := (currentPage - 1) * pageSize
+	for i := len(b.orders) - 1; i >= 0 && len(orders) < pageSize; i-- {
+		o := b.orders[i]
+		if o.CurrencyPair != cp.Symbol() || o.open() {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		orders = append(orders, o.Order)
+	}
+	return orders, nil
+}
+
+//Asset 为按当前收盘价计算的总权益(计价币)
+func (b *spotBroker) GetAccount() (*Account, error) {
+	acc := &Account{Exchange: EXCHANGE_NAME, SubAccounts: make(map[string]SubAccount, len(b.balances))}
+	for currency, sub := range b.balances {
+		acc.SubAccounts[string(currency)] = *sub
+	}
+	acc.Asset = b.equity()
+	acc.NetAsset = acc.Asset
+	return acc, nil
+}
+
+func (b *spotBroker) Withdraw(amount, currency, fees, receiveAddr, memo, safePwd string) (string, error) {
+	return "", NewUnsupportedError(EXCHANGE_NAME, "Withdraw")
+}
+
+//只返回当前及之前的K线, period 被忽略
+func (b *spotBroker) GetKlineRecords(cp CurrencyPair, period string, size, since int) ([]Kline, error) {
+	if err := b.checkPair(cp); err != nil {
+		return nil, err
+	}
+	return visibleBars(b.bars, b.index, size, since), nil
+}
+
+//账户自己的成交, Tid 为成交序号, 只返回 Tid 大于since的成交
+func (b *spotBroker) GetTrades(cp CurrencyPair, since int64) ([]Trade, error) {
+	if err := b.checkPair(cp); err != nil {
+		return nil, err
+	}
+	trades := []Trade{}
+	for i, f := range b.fills {
+		if tid := int64(i + 1); tid > since {
+			trades = append(trades, Trade{Tid: tid, Type: f.Type, Amount: f.Amount, Price: f.Price, Date: f.Timestamp * 1000})
+		}
+	}
+	return trades, nil
+}
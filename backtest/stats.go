@@ -0,0 +1,63 @@
+package backtest
+
+import "math"
+
+//initial 为回测开始前的权益, 收益率序列从 initial 到第一根K线开始计算
+func computeStats(initial float64, equity []EquityPoint, fills []Fill, periodsPerYear float64) Stats {
+	stats := Stats{Trades: len(fills)}
+	if initial <= 0 || len(equity) == 0 {
+		return stats
+	}
+	stats.Return = equity[len(equity)-1].Equity/initial - 1
+
+	peak, prev := initial, initial
+	returns := make([]float64, 0, len(equity))
+	for _, p := range equity {
+		peak = math.Max(peak, p.Equity)
+		if peak > 0 {
+			stats.MaxDrawdown = math.Max(stats.MaxDrawdown, 1-p.Equity/peak)
+		}
+		if prev != 0 {
+			returns = append(returns, p.Equity/prev-1)
+		}
+		prev = p.Equity
+	}
+	stats.Sharpe = sharpe(returns, periodsPerYear)
+
+	closes, wins, traded := 0, 0, 0.0
+	for _, f := range fills {
+		traded += f.Notional
+		if f.closing() {
+			closes++
+			if f.Profit > 0 {
+				wins++
+			}
+		}
+	}
+	if closes > 0 {
+		stats.WinRate = float64(wins) / float64(closes)
+	}
+	stats.Turnover = traded / initial
+	return stats
+}
+
+//样本标准差为0时返回0
+func sharpe(returns []float64, periodsPerYear float64) float64 {
+	if len(returns) < 2 {
+		return 0
+	}
+	mean := 0.0
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+	variance := 0.0
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+	}
+	std := math.Sqrt(variance / float64(len(returns)-1))
+	if std < epsilon {
+		return 0
+	}
+	return mean / std * math.Sqrt(periodsPerYear)
+}
@@ -1,32 +1,35 @@
 package builder
 
 import (
-	"context"
 	. "github.com/qct/cryptocurrency-exchange-api"
-	"github.com/qct/cryptocurrency-exchange-api/chbtc"
-	"github.com/qct/cryptocurrency-exchange-api/okcoin"
-	"github.com/qct/cryptocurrency-exchange-api/poloniex"
-	"log"
-	"net"
+	_ "github.com/qct/cryptocurrency-exchange-api/chbtc"
+	_ "github.com/qct/cryptocurrency-exchange-api/okcoin"
+	_ "github.com/qct/cryptocurrency-exchange-api/poloniex"
 	"net/http"
 	"time"
 )
 
 type ApiBuilder struct {
-	client      *http.Client
+	client      *http.Client //由 HttpClient 注入, 为nil时按transport创建
+	transport   TransportProfile
+	built       *http.Client
 	httpTimeout time.Duration
 	apiKey      string
 	secretKey   string
+	credentials CredentialProvider
+	middlewares []Middleware
+	rateLimit   *RateLimitPolicy
+	failFast    bool
+	nonce       NonceProvider
+	clockSync   time.Duration
+	baseUrl     string
+	userAgent   string
+	logger      Logger
+	metrics     MetricsRegistry
 }
 
 func NewApiBuilder() *ApiBuilder {
-	client := http.DefaultClient
-	transport := &http.Transport{
-		MaxIdleConns:    10,
-		IdleConnTimeout: 4 * time.Second,
-	}
-	client.Transport = transport
-	return &ApiBuilder{client: client}
+	return &ApiBuilder{transport: DefaultTransportProfile}
 }
 
 func (b *ApiBuilder) ApiKey(key string) *ApiBuilder {
@@ -39,50 +42,204 @@ func (b *ApiBuilder) ApiSecretKey(key string) *ApiBuilder {
 	return b
 }
 
+//从provider读取key(环境变量、文件或加密的keystore), 优先于 ApiKey/ApiSecretKey.
+//签名时每次都会重新读取, provider轮换key后不需要重新Build
+func (b *ApiBuilder) Credentials(provider CredentialProvider) *ApiBuilder {
+	b.credentials = provider
+	return b
+}
+
+//使用应用自己的http client, 此时 Transport 配置不生效; client本身不会被修改
+func (b *ApiBuilder) HttpClient(client *http.Client) *ApiBuilder {
+	b.client = client
+	return b
+}
+
+func (b *ApiBuilder) Transport(profile TransportProfile) *ApiBuilder {
+	b.transport = profile
+	b.built = nil
+	return b
+}
+
+//把请求发往baseUrl(如本地的模拟服务)而不是交易所的默认地址, 只替换 协议://主机 部分
+func (b *ApiBuilder) BaseUrl(baseUrl string) *ApiBuilder {
+	b.baseUrl = baseUrl
+	return b
+}
+
+func (b *ApiBuilder) UserAgent(userAgent string) *ApiBuilder {
+	b.userAgent = userAgent
+	return b
+}
+
 func (b *ApiBuilder) HttpTimeout(timeout time.Duration) *ApiBuilder {
 	b.httpTimeout = timeout
-	b.client.Timeout = timeout
-	transport := b.client.Transport.(*http.Transport)
-	if transport != nil {
-		transport.ResponseHeaderTimeout = timeout
-		transport.TLSHandshakeTimeout = timeout
-		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
-			return net.DialTimeout(network, addr, timeout)
+	b.built = nil
+	return b
+}
+
+//注册http中间件, 之后Build出来的所有api都会经过这些中间件
+func (b *ApiBuilder) Use(middlewares ...Middleware) *ApiBuilder {
+	b.middlewares = append(b.middlewares, middlewares...)
+	return b
+}
+
+//每次api调用和每个http请求各记一条带 exchange、method、endpoint、latency 字段的日志, 默认不输出
+func (b *ApiBuilder) Logger(logger Logger) *ApiBuilder {
+	b.logger = logger
+	return b
+}
+
+//记录每个api方法的调用次数、错误数、耗时和限频等待时间, 可通过 PrometheusHandler 暴露
+func (b *ApiBuilder) Metrics(registry MetricsRegistry) *ApiBuilder {
+	b.metrics = registry
+	return b
+}
+
+//覆盖交易所默认的限频策略. 同一apiKey的限频器按第一次构建时的策略配置, 之后构建时不会修改, 见 SharedRateLimiter
+func (b *ApiBuilder) RateLimit(policy RateLimitPolicy) *ApiBuilder {
+	b.rateLimit = &policy
+	return b
+}
+
+//令牌不足时直接返回 ErrRateLimited, 而不是阻塞等待
+func (b *ApiBuilder) RateLimitFailFast(failFast bool) *ApiBuilder {
+	b.failFast = failFast
+	return b
+}
+
+//指定之后Build出来的api使用的nonce生成器(如 NewFileNonce 持久化的), 与 ApiKey/Credentials 的调用顺序无关.
+//未指定时同一交易所、同一apiKey共用一个内存中的nonce序列
+func (b *ApiBuilder) Nonce(nonce NonceProvider) *ApiBuilder {
+	b.nonce = nonce
+	return b
+}
+
+//每隔interval同步一次交易所服务端时间, 签名时使用校正后的时间. 同一交易所、同一 BaseUrl 只同步一份
+func (b *ApiBuilder) SyncServerTime(interval time.Duration) *ApiBuilder {
+	b.clockSync = interval
+	return b
+}
+
+//按交易所名称从注册表构建现货api, 未注册的交易所返回 ErrUnsupportedExchange
+func (b *ApiBuilder) Build(exName string) (Api, error) {
+	driver, err := LookupApi(exName)
+	if err != nil {
+		return nil, err
+	}
+	config, err := b.config(exName, driver.DefaultRateLimit)
+	if err != nil {
+		return nil, err
+	}
+	if driver.ServerTime != nil {
+		b.syncClock(exName, driver.ServerTime(config.HttpClient, config.BaseUrl))
+	}
+	if b.metrics == nil && b.logger == nil {
+		return driver.New(config)
+	}
+	return NewInstrumentedApi(driver.New, config, b.metrics, b.logger)
+}
+
+func (b *ApiBuilder) BuildFutureApi(exName string) (FutureApi, error) {
+	driver, err := LookupFutureApi(exName)
+	if err != nil {
+		return nil, err
+	}
+	config, err := b.config(exName, driver.DefaultRateLimit)
+	if err != nil {
+		return nil, err
+	}
+	if driver.ServerTime != nil {
+		b.syncClock(exName, driver.ServerTime(config.HttpClient, config.BaseUrl))
+	}
+	if b.metrics == nil && b.logger == nil {
+		return driver.New(config)
+	}
+	return NewInstrumentedFutureApi(driver.New, config, b.metrics, b.logger)
+}
+
+func (b *ApiBuilder) config(exName string, defaultPolicy RateLimitPolicy) (ApiConfig, error) {
+	//provider每次返回的key(包括轮换后的)出现在日志和错误信息里时都打码
+	provider := RedactedCredentials(b.provider(), DefaultRedactor)
+	credentials, err := provider.Credentials()
+	if err != nil {
+		return ApiConfig{}, err
+	}
+	apiKey := credentials.ApiKey
+	client, err := b.buildClient(exName, apiKey, defaultPolicy)
+	if err != nil {
+		return ApiConfig{}, err
+	}
+	return ApiConfig{
+		HttpClient:   client,
+		ApiKey:       b.apiKey,
+		ApiSecretKey: b.secretKey,
+		Credentials:  provider,
+		BaseUrl:      b.baseUrl,
+		Nonce:        b.nonceProvider(exName, apiKey)}, nil
+}
+
+func (b *ApiBuilder) provider() CredentialProvider {
+	if b.credentials == nil {
+		return StaticCredentials{ApiKey: b.apiKey, ApiSecretKey: b.secretKey}
+	}
+	return b.credentials
+}
+
+//同一交易所、同一apiKey构建出来的api共用一个限频器
+func (b *ApiBuilder) buildClient(exName, apiKey string, defaultPolicy RateLimitPolicy) (*http.Client, error) {
+	client, err := b.baseClient()
+	if err != nil {
+		return nil, err
+	}
+	policy := defaultPolicy
+	if b.rateLimit != nil {
+		policy = *b.rateLimit
+	}
+	limiter := SharedRateLimiter(exName, apiKey, policy)
+	middlewares := b.middlewares[:len(b.middlewares):len(b.middlewares)]
+	if b.logger != nil {
+		middlewares = append(middlewares, LogRequests(b.logger, exName))
+	}
+	var observers []RateLimitObserver
+	if b.metrics != nil {
+		observers = append(observers, RateLimitWaitObserver(exName, b.metrics))
+	}
+	middlewares = append(middlewares, RateLimit(limiter, b.failFast, observers...))
+	if b.userAgent != "" {
+		middlewares = append(middlewares, UserAgent(b.userAgent))
+	}
+	return WithMiddleware(client, middlewares...), nil
+}
+
+//同一个builder构建出来的api共用一个连接池
+func (b *ApiBuilder) baseClient() (*http.Client, error) {
+	if b.client != nil {
+		client := *b.client
+		if b.httpTimeout > 0 {
+			client.Timeout = b.httpTimeout
 		}
+		return &client, nil
 	}
-	return b
+	if b.built == nil {
+		transport, err := b.transport.NewTransport(b.httpTimeout)
+		if err != nil {
+			return nil, err
+		}
+		b.built = &http.Client{Transport: transport, Timeout: b.httpTimeout}
+	}
+	return b.built, nil
 }
 
-func (b *ApiBuilder) Build(exName string) (api Api) {
-	switch exName {
-	case OK_CN:
-		api = okcoin.NewOkCNApi(b.client, b.apiKey, b.secretKey)
-	case CHBTC:
-		api = chbtc.NewApi(b.client, b.apiKey, b.secretKey)
-	case POLONIEX:
-		api = poloniex.New(b.client, b.apiKey, b.secretKey)
-		//case OK_COM:
-		//    api = okcoin.NewCOM(b.client, b.apiKey, b.secretKey)
-		//case COIN_CHECK:
-		//    api = coincheck.New(b.client, b.apiKey, b.secretKey)
-		//case ZAIF:
-		//    api = zaif.New(b.client, b.apiKey, b.secretKey)
-		//    api = yunbi.New(b.client, b.apiKey, b.secretKey)
-		//case YUNBI:
-		//    api = huobi.New(b.client, b.apiKey, b.secretKey)
-		//case HUOBI:
-	default:
-		log.Println("error")
-	}
-	return api
-}
-
-func (b *ApiBuilder) BuildFutureApi(exName string) (api FutureApi) {
-	switch exName {
-	case OK_EX:
-		api = okcoin.NewOkExApi(b.client, b.apiKey, b.secretKey)
-	default:
-		log.Println("error")
-	}
-	return api
+func (b *ApiBuilder) nonceProvider(exName, apiKey string) NonceProvider {
+	if b.nonce != nil {
+		return b.nonce
+	}
+	return SharedNonceProvider(exName, apiKey)
+}
+
+func (b *ApiBuilder) syncClock(exName string, fetch ServerTimeFunc) {
+	if b.clockSync > 0 {
+		SharedServerClock(exName, b.baseUrl, fetch).Start(b.clockSync)
+	}
 }
@@ -1,20 +1,187 @@
 package builder
 
 import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
 	"github.com/qct/cryptocurrency-exchange-api"
+	"github.com/qct/cryptocurrency-exchange-api/poloniex"
 	"github.com/stretchr/testify/assert"
-	"testing"
 )
 
 var b = NewApiBuilder()
 
 func TestApiBuilder_Build(t *testing.T) {
-	assert.Equal(t, b.ApiKey("").ApiSecretKey("").Build(coinapi.OK_CN).GetExchangeName(), "okcoin.cn")
-	assert.Equal(t, b.ApiKey("").ApiSecretKey("").Build(coinapi.OK_COM).GetExchangeName(), "okcoin.com")
-	assert.Equal(t, b.ApiKey("").ApiSecretKey("").Build(coinapi.HUOBI).GetExchangeName(), "huobi.com")
-	assert.Equal(t, b.ApiKey("").ApiSecretKey("").Build(coinapi.CHBTC).GetExchangeName(), "chbtc.com")
-	assert.Equal(t, b.ApiKey("").ApiSecretKey("").Build(coinapi.YUNBI).GetExchangeName(), "yunbi.com")
-	assert.Equal(t, b.ApiKey("").ApiSecretKey("").Build(coinapi.POLONIEX).GetExchangeName(), "poloniex.com")
-	assert.Equal(t, b.ApiKey("").ApiSecretKey("").Build(coinapi.COIN_CHECK).GetExchangeName(), "coincheck.com")
-	assert.Equal(t, b.ApiKey("").ApiSecretKey("").Build(coinapi.ZAIF).GetExchangeName(), "zaif.jp")
+	for exName, expected := range map[string]string{
+		coinapi.OK_CN:    "okcoin.cn",
+		coinapi.CHBTC:    "chbtc.com",
+		coinapi.POLONIEX: "poloniex.com",
+	} {
+		api, err := b.ApiKey("").ApiSecretKey("").Build(exName)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, api.GetExchangeName())
+	}
+
+	futureApi, err := b.ApiKey("").ApiSecretKey("").BuildFutureApi(coinapi.OK_EX)
+	assert.NoError(t, err)
+	assert.Equal(t, "okex.com", futureApi.GetExchangeName())
+}
+
+func TestApiBuilder_BuildUnsupported(t *testing.T) {
+	for _, exName := range []string{coinapi.OK_COM, coinapi.HUOBI, coinapi.YUNBI, coinapi.COIN_CHECK, coinapi.ZAIF} {
+		api, err := b.ApiKey("").ApiSecretKey("").Build(exName)
+		assert.Nil(t, api)
+		assert.True(t, errors.Is(err, coinapi.ErrUnsupportedExchange))
+	}
+
+	_, err := b.BuildFutureApi(coinapi.OK_CN)
+	assert.True(t, errors.Is(err, coinapi.ErrUnsupportedExchange))
+}
+
+func TestApiBuilder_BaseUrlAndUserAgent(t *testing.T) {
+	var path, userAgent string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		userAgent = r.UserAgent()
+		w.Write([]byte(`{"asks":[["0.0076",1.5]],"bids":[["0.0075",2]],"isFrozen":"0","seq":1}`))
+	}))
+	defer ts.Close()
+
+	api, err := NewApiBuilder().BaseUrl(ts.URL).UserAgent("coinapi-test").Build(coinapi.POLONIEX)
+	assert.NoError(t, err)
+	depth, err := api.GetDepth(coinapi.NewCurrencyPair("ETH", "BTC"), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "/public", path)
+	assert.Equal(t, "coinapi-test", userAgent)
+	assert.Equal(t, 0.0076, depth.AskList[0].Price)
+}
+
+type rotatingCredentials struct {
+	credentials coinapi.Credentials
+}
+
+func (r *rotatingCredentials) Credentials() (coinapi.Credentials, error) {
+	return r.credentials, nil
+}
+
+func TestApiBuilder_CredentialRotation(t *testing.T) {
+	var keys []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Key"))
+		w.Write([]byte(`{"BTC":"1.5"}`))
+	}))
+	defer ts.Close()
+
+	provider := &rotatingCredentials{coinapi.Credentials{ApiKey: "key1", ApiSecretKey: "secret1"}}
+	api, err := NewApiBuilder().BaseUrl(ts.URL).Credentials(provider).Build(coinapi.POLONIEX)
+	assert.NoError(t, err)
+	api.GetAccount()
+	provider.credentials = coinapi.Credentials{ApiKey: "key2", ApiSecretKey: "secret2"}
+	api.GetAccount()
+	assert.Equal(t, []string{"key1", "key2"}, keys)
+}
+
+type fixedNonce int64
+
+func (n fixedNonce) Next(min int64) (int64, error) {
+	return int64(n), nil
+}
+
+//Nonce 在 ApiKey 之前或之后调用都对之后Build出来的api生效
+func TestApiBuilder_NonceBeforeApiKey(t *testing.T) {
+	var nonces []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		nonces = append(nonces, r.PostForm.Get("nonce"))
+		w.Write([]byte(`{"BTC":"1.5"}`))
+	}))
+	defer ts.Close()
+
+	api, err := NewApiBuilder().BaseUrl(ts.URL).Nonce(fixedNonce(42)).ApiKey("nonce-key1").ApiSecretKey("secret").Build(coinapi.POLONIEX)
+	assert.NoError(t, err)
+	api.GetAccount()
+	api, err = NewApiBuilder().BaseUrl(ts.URL).ApiKey("nonce-key2").ApiSecretKey("secret").Nonce(fixedNonce(43)).Build(coinapi.POLONIEX)
+	assert.NoError(t, err)
+	api.GetAccount()
+	assert.Equal(t, []string{"42", "43"}, nonces)
+}
+
+//轮换后的key同样在错误信息和日志里被打码
+func TestApiBuilder_RedactRotatedCredentials(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid key ` + r.Header.Get("Key") + `"}`))
+	}))
+	defer ts.Close()
+
+	var logs bytes.Buffer
+	provider := &rotatingCredentials{coinapi.Credentials{ApiKey: "firstkey123456", ApiSecretKey: "firstsecret123456"}}
+	api, err := NewApiBuilder().BaseUrl(ts.URL).Credentials(provider).Logger(coinapi.NewTextLogger(&logs, coinapi.LOG_DEBUG)).Build(coinapi.POLONIEX)
+	assert.NoError(t, err)
+	provider.credentials = coinapi.Credentials{ApiKey: "rotatedkey99999", ApiSecretKey: "rotatedsecret99999"}
+	_, err = api.GetAccount()
+	if assert.Error(t, err) {
+		assert.NotContains(t, err.Error(), "rotatedkey99999")
+		assert.Contains(t, err.Error(), coinapi.REDACTED)
+	}
+	coinapi.DefaultLogger = coinapi.NewTextLogger(&logs, coinapi.LOG_DEBUG)
+	defer func() { coinapi.DefaultLogger = coinapi.NopLogger{} }()
+	coinapi.DefaultLogger.Warn("request failed", "err", err, "secret", "rotatedsecret99999 and firstsecret123456")
+	assert.NotContains(t, logs.String(), "rotatedkey99999")
+	assert.NotContains(t, logs.String(), "rotatedsecret99999")
+	assert.NotContains(t, logs.String(), "firstsecret123456")
+	assert.Equal(t, "*** and ***", coinapi.Redact("rotatedsecret99999 and firstsecret123456"))
+}
+
+//请求日志带上adapter方法名和 command, http 200 但交易所返回错误的调用按失败记录
+func TestApiBuilder_LogApiMethod(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"error":"Invalid API key/secret pair."}`))
+	}))
+	defer ts.Close()
+
+	var logs bytes.Buffer
+	api, err := NewApiBuilder().BaseUrl(ts.URL).ApiKey("logkey").ApiSecretKey("logsecret").
+		Logger(coinapi.NewTextLogger(&logs, coinapi.LOG_DEBUG)).Build(coinapi.POLONIEX)
+	assert.NoError(t, err)
+	_, err = api.GetAccount()
+	assert.Error(t, err)
+
+	assert.Contains(t, logs.String(), `msg=request exchange=poloniex.com method=GetAccount endpoint=returnCompleteBalances `)
+	assert.Contains(t, logs.String(), `level=warn msg="api call failed" exchange=poloniex.com method=GetAccount `)
+}
+
+//包装后的api仍然实现 TransferApi, UnwrapApi 取回具体的adapter; 限频等待时间按方法记录
+func TestApiBuilder_MetricsKeepsTransferApi(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"asks":[["0.0076",1.5]],"bids":[["0.0075",2]],"isFrozen":"0","seq":1}`))
+	}))
+	defer ts.Close()
+
+	registry := coinapi.NewRegistry()
+	api, err := NewApiBuilder().BaseUrl(ts.URL).Metrics(registry).Build(coinapi.POLONIEX)
+	assert.NoError(t, err)
+	_, ok := api.(coinapi.TransferApi)
+	assert.True(t, ok)
+	_, ok = coinapi.UnwrapApi(api).(*poloniex.PoloApi)
+	assert.True(t, ok)
+
+	_, err = api.GetDepth(coinapi.NewCurrencyPair("ETH", "BTC"), 1)
+	assert.NoError(t, err)
+	var methods []string
+	for _, f := range registry.Gather() {
+		if f.Name != coinapi.METRIC_RATE_LIMIT_WAIT {
+			continue
+		}
+		for _, sample := range f.Samples {
+			if sample.Name == coinapi.METRIC_RATE_LIMIT_WAIT+"_count" {
+				assert.Equal(t, "poloniex.com", sample.Labels["exchange"])
+				methods = append(methods, sample.Labels["method"])
+			}
+		}
+	}
+	assert.Equal(t, []string{"GetDepth"}, methods)
 }
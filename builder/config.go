@@ -0,0 +1,293 @@
+package builder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+)
+
+//多账户配置文件, 支持json和yaml. 字符串中的 ${VAR} 和 ${VAR:-default} 会替换成环境变量
+//
+//	credentials:
+//	  okcn-main:
+//	    api_key: ${OKCN_KEY}
+//	    api_secret_key: ${OKCN_SECRET}
+//	accounts:
+//	  okcn:
+//	    exchange: okcoin.cn
+//	    credentials: okcn-main
+//	    timeout: 10s
+//	    rate_limit:
+//	      rate: 5
+//	      burst: 10
+//	    pairs: [BTC_CNY, LTC_CNY]
+type Config struct {
+	Credentials map[string]CredentialConfig `json:"credentials"`
+	Accounts    map[string]AccountConfig    `json:"accounts"`
+}
+
+//直接写key(可配合 ${VAR} 从环境变量读取), 或者引用key文件、加密的keystore中的一项
+type CredentialConfig struct {
+	ApiKey       string `json:"api_key"`
+	ApiSecretKey string `json:"api_secret_key"`
+	File         string `json:"file"`       //见 coinapi.FileCredentials
+	Keystore     string `json:"keystore"`   //keystore文件路径
+	Entry        string `json:"entry"`      //keystore中的名称
+	Passphrase   string `json:"passphrase"` //keystore口令, 建议写成 ${VAR}
+}
+
+func (c CredentialConfig) provider() (CredentialProvider, error) {
+	switch {
+	case c.Keystore != "":
+		keystore, err := OpenKeystore(c.Keystore, c.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return keystore.Provider(c.Entry), nil
+	case c.File != "":
+		return NewFileCredentials(c.File), nil
+	default:
+		return StaticCredentials{ApiKey: c.ApiKey, ApiSecretKey: c.ApiSecretKey}, nil
+	}
+}
+
+type AccountConfig struct {
+	Exchange     string           `json:"exchange"`
+	Future       bool             `json:"future"`      //为true时构建 FutureApi
+	Credentials  string           `json:"credentials"` //引用 Config.Credentials 中的一项, 为空时使用 api_key/api_secret_key
+	ApiKey       string           `json:"api_key"`
+	ApiSecretKey string           `json:"api_secret_key"`
+	BaseUrl      string           `json:"base_url"`
+	UserAgent    string           `json:"user_agent"`
+	Proxy        string           `json:"proxy"`
+	Timeout      Duration         `json:"timeout"`
+	RateLimit    *RateLimitPolicy `json:"rate_limit"`
+	Pairs        []string         `json:"pairs"` //如 BTC_CNY
+}
+
+//json中可以写成 "10s" 这样的字符串, 或者秒数
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch value := v.(type) {
+	case nil:
+		*d = 0
+	case float64:
+		*d = Duration(value * float64(time.Second))
+	case string:
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*d = Duration(duration)
+	default:
+		return fmt.Errorf("invalid duration %s", data)
+	}
+	return nil
+}
+
+//按扩展名(.json/.yaml/.yml)解析配置文件
+func LoadConfig(file string) (*Config, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	switch ext := strings.ToLower(filepath.Ext(file)); ext {
+	case ".json":
+		return ParseConfig(data, "json")
+	case ".yaml", ".yml":
+		return ParseConfig(data, "yaml")
+	default:
+		return nil, fmt.Errorf("unsupported config format: %s", ext)
+	}
+}
+
+//format 为 json 或 yaml
+func ParseConfig(data []byte, format string) (*Config, error) {
+	var tree interface{}
+	switch format {
+	case "json":
+		if err := json.Unmarshal(data, &tree); err != nil {
+			return nil, err
+		}
+	case "yaml":
+		var err error
+		if tree, err = parseYAML(data); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config format: %s", format)
+	}
+
+	tree, err := expandTree(tree)
+	if err != nil {
+		return nil, err
+	}
+	//两种格式统一转成json再解到结构体里
+	normalized, err := json.Marshal(tree)
+	if err != nil {
+		return nil, err
+	}
+	config := new(Config)
+	if err := json.Unmarshal(normalized, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+var envPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+//替换 ${VAR}/${VAR:-default}, 变量未设置且没有默认值时报错
+func expandEnv(s string) (string, error) {
+	var err error
+	expanded := envPattern.ReplaceAllStringFunc(s, func(m string) string {
+		sub := envPattern.FindStringSubmatch(m)
+		if v, ok := os.LookupEnv(sub[1]); ok {
+			return v
+		}
+		if sub[2] != "" {
+			return sub[3]
+		}
+		if err == nil {
+			err = fmt.Errorf("environment variable %s is not set", sub[1])
+		}
+		return m
+	})
+	return expanded, err
+}
+
+func expandTree(v interface{}) (interface{}, error) {
+	switch value := v.(type) {
+	case string:
+		return expandEnv(value)
+	case map[string]interface{}:
+		for k, item := range value {
+			expanded, err := expandTree(item)
+			if err != nil {
+				return nil, err
+			}
+			value[k] = expanded
+		}
+	case []interface{}:
+		for i, item := range value {
+			expanded, err := expandTree(item)
+			if err != nil {
+				return nil, err
+			}
+			value[i] = expanded
+		}
+	}
+	return v, nil
+}
+
+//按账户名构建好的api
+type Accounts struct {
+	Apis       map[string]Api
+	FutureApis map[string]FutureApi
+	Pairs      map[string][]CurrencyPair
+}
+
+func LoadAccounts(file string) (*Accounts, error) {
+	config, err := LoadConfig(file)
+	if err != nil {
+		return nil, err
+	}
+	return config.Build()
+}
+
+//为每个账户单独创建一个 ApiBuilder, 账户之间不共享http连接池
+func (c *Config) Build() (*Accounts, error) {
+	accounts := &Accounts{
+		Apis:       map[string]Api{},
+		FutureApis: map[string]FutureApi{},
+		Pairs:      map[string][]CurrencyPair{}}
+
+	names := make([]string, 0, len(c.Accounts))
+	for name := range c.Accounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		account := c.Accounts[name]
+		b, err := c.builder(account)
+		if err != nil {
+			return nil, fmt.Errorf("account %s: %v", name, err)
+		}
+
+		pairs, err := parsePairs(account.Pairs)
+		if err != nil {
+			return nil, fmt.Errorf("account %s: %v", name, err)
+		}
+		accounts.Pairs[name] = pairs
+
+		if account.Future {
+			api, err := b.BuildFutureApi(account.Exchange)
+			if err != nil {
+				return nil, fmt.Errorf("account %s: %w", name, err)
+			}
+			accounts.FutureApis[name] = api
+		} else {
+			api, err := b.Build(account.Exchange)
+			if err != nil {
+				return nil, fmt.Errorf("account %s: %w", name, err)
+			}
+			accounts.Apis[name] = api
+		}
+	}
+	return accounts, nil
+}
+
+func (c *Config) builder(account AccountConfig) (*ApiBuilder, error) {
+	if account.Exchange == "" {
+		return nil, fmt.Errorf("exchange is required")
+	}
+	var credentials CredentialProvider = StaticCredentials{ApiKey: account.ApiKey, ApiSecretKey: account.ApiSecretKey}
+	if account.Credentials != "" {
+		credential, ok := c.Credentials[account.Credentials]
+		if !ok {
+			return nil, fmt.Errorf("unknown credentials %q", account.Credentials)
+		}
+		var err error
+		if credentials, err = credential.provider(); err != nil {
+			return nil, err
+		}
+	}
+
+	profile := DefaultTransportProfile
+	profile.ProxyUrl = account.Proxy
+	b := NewApiBuilder().
+		Credentials(credentials).
+		BaseUrl(account.BaseUrl).
+		UserAgent(account.UserAgent).
+		HttpTimeout(time.Duration(account.Timeout)).
+		Transport(profile)
+	if account.RateLimit != nil {
+		b.RateLimit(*account.RateLimit)
+	}
+	return b, nil
+}
+
+func parsePairs(symbols []string) ([]CurrencyPair, error) {
+	pairs := make([]CurrencyPair, 0, len(symbols))
+	for _, symbol := range symbols {
+		pair := StringToCurrencyPair(strings.ToUpper(symbol), "_")
+		if pair.BaseCurrency == "" || pair.CounterCurrency == "" {
+			return nil, fmt.Errorf("invalid pair %q, expected BASE_COUNTER", symbol)
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs, nil
+}
@@ -0,0 +1,159 @@
+package builder
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/qct/cryptocurrency-exchange-api"
+	"github.com/stretchr/testify/assert"
+)
+
+const yamlConfig = `
+# 两个现货账户和一个期货账户
+credentials:
+  okcn-main:
+    api_key: ${TEST_OKCN_KEY}
+    api_secret_key: "${TEST_OKCN_SECRET:-default-secret}"
+accounts:
+  okcn:
+    exchange: okcoin.cn
+    credentials: okcn-main
+    timeout: 10s
+    rate_limit:
+      rate: 5
+      burst: 10
+      weights:
+        trade.do: 2
+    pairs: [btc_cny, LTC_CNY]
+  polo:
+    exchange: poloniex.com
+    api_key: 'polo-key'
+    api_secret_key: polo-secret # 行尾注释
+    base_url: http://127.0.0.1:8080
+    pairs:
+      - ETH_BTC
+  okex:
+    exchange: okex.com
+    future: true
+    timeout: 5
+`
+
+const jsonConfig = `{
+  "credentials": {"okcn-main": {"api_key": "${TEST_OKCN_KEY}", "api_secret_key": "${TEST_OKCN_SECRET:-default-secret}"}},
+  "accounts": {
+    "okcn": {"exchange": "okcoin.cn", "credentials": "okcn-main", "timeout": "10s",
+      "rate_limit": {"rate": 5, "burst": 10, "weights": {"trade.do": 2}}, "pairs": ["btc_cny", "LTC_CNY"]},
+    "polo": {"exchange": "poloniex.com", "api_key": "polo-key", "api_secret_key": "polo-secret",
+      "base_url": "http://127.0.0.1:8080", "pairs": ["ETH_BTC"]},
+    "okex": {"exchange": "okex.com", "future": true, "timeout": 5}
+  }
+}`
+
+func TestParseConfig(t *testing.T) {
+	os.Setenv("TEST_OKCN_KEY", "okcn-key")
+	defer os.Unsetenv("TEST_OKCN_KEY")
+
+	fromYaml, err := ParseConfig([]byte(yamlConfig), "yaml")
+	assert.NoError(t, err)
+	fromJson, err := ParseConfig([]byte(jsonConfig), "json")
+	assert.NoError(t, err)
+	assert.Equal(t, fromJson, fromYaml)
+
+	assert.Equal(t, CredentialConfig{ApiKey: "okcn-key", ApiSecretKey: "default-secret"}, fromYaml.Credentials["okcn-main"])
+	okcn := fromYaml.Accounts["okcn"]
+	assert.Equal(t, Duration(10*time.Second), okcn.Timeout)
+	assert.Equal(t, 2, okcn.RateLimit.Weight("trade.do"))
+	assert.Equal(t, Duration(5*time.Second), fromYaml.Accounts["okex"].Timeout)
+	assert.Equal(t, "polo-secret", fromYaml.Accounts["polo"].ApiSecretKey)
+}
+
+func TestParseConfig_MissingEnv(t *testing.T) {
+	os.Unsetenv("TEST_OKCN_KEY")
+	_, err := ParseConfig([]byte(yamlConfig), "yaml")
+	assert.EqualError(t, err, "environment variable TEST_OKCN_KEY is not set")
+}
+
+func TestLoadAccounts(t *testing.T) {
+	os.Setenv("TEST_OKCN_KEY", "okcn-key")
+	defer os.Unsetenv("TEST_OKCN_KEY")
+	file := filepath.Join(t.TempDir(), "accounts.yml")
+	assert.NoError(t, os.WriteFile(file, []byte(yamlConfig), 0600))
+
+	accounts, err := LoadAccounts(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "okcoin.cn", accounts.Apis["okcn"].GetExchangeName())
+	assert.Equal(t, "poloniex.com", accounts.Apis["polo"].GetExchangeName())
+	assert.Equal(t, "okex.com", accounts.FutureApis["okex"].GetExchangeName())
+	assert.Equal(t, []coinapi.CurrencyPair{coinapi.NewCurrencyPair("BTC", "CNY"), coinapi.NewCurrencyPair("LTC", "CNY")}, accounts.Pairs["okcn"])
+
+	_, err = (&Config{Accounts: map[string]AccountConfig{"x": {Exchange: "okcoin.cn", Credentials: "missing"}}}).Build()
+	assert.EqualError(t, err, `account x: unknown credentials "missing"`)
+}
+
+func TestParseYAML(t *testing.T) {
+	v, err := parseYAML([]byte(`
+list:
+- name: a
+  tags: [x, "y, z"]
+- name: b
+nested:
+  - - 1
+    - 2.5
+empty:
+url: "http://a#b"
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"list": []interface{}{
+			map[string]interface{}{"name": "a", "tags": []interface{}{"x", "y, z"}},
+			map[string]interface{}{"name": "b"},
+		},
+		"nested": []interface{}{[]interface{}{1, 2.5}},
+		"empty":  nil,
+		"url":    "http://a#b",
+	}, v)
+
+	_, err = parseYAML([]byte("a: 1\n  b: 2\n"))
+	assert.Error(t, err)
+	_, err = parseYAML([]byte("1: a\n"))
+	assert.Error(t, err)
+	v, err = parseYAML([]byte("a: |\n  text\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"a": "text\n"}, v)
+}
+
+//账户配置的 rate_limit 用在这个账户的请求上, 同一个key后加载的配置覆盖之前的
+func TestLoadAccounts_RateLimit(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"asks":[["0.0076",1.5]],"bids":[["0.0075",2]],"isFrozen":"0","seq":1}`))
+	}))
+	defer ts.Close()
+
+	elapsed := func(apiKey, rateLimit string) time.Duration {
+		config, err := ParseConfig([]byte(`
+accounts:
+  polo:
+    exchange: poloniex.com
+    api_key: `+apiKey+`
+    base_url: `+ts.URL+`
+    rate_limit: `+rateLimit), "yaml")
+		assert.NoError(t, err)
+		accounts, err := config.Build()
+		assert.NoError(t, err)
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			_, err := accounts.Apis["polo"].GetDepth(coinapi.NewCurrencyPair("ETH", "BTC"), 1)
+			assert.NoError(t, err)
+		}
+		return time.Since(start)
+	}
+	//默认策略的桶容量为6, 三个请求不需要等待. 同一个apiKey共用第一次配置的限频器, 所以用不同的apiKey
+	slow := elapsed("config-rate-limit-slow", "{rate: 10, burst: 1}")
+	assert.True(t, slow >= 180*time.Millisecond, "elapsed %v", slow)
+	fast := elapsed("config-rate-limit-fast", "{rate: 1000, burst: 10}")
+	assert.True(t, fast < 100*time.Millisecond, "elapsed %v", fast)
+}
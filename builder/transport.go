@@ -0,0 +1,73 @@
+package builder
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+//http传输层配置, 每个 ApiBuilder 按它创建自己的 Transport, 不会修改 http.DefaultClient
+type TransportProfile struct {
+	ProxyUrl            string      //http://、https://、socks5:// 或 socks5h://, 可带 user:password@
+	LocalAddr           string      //出口ip, 多网卡或多ip时指定
+	TLSConfig           *tls.Config //为nil时使用系统默认
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	IdleConnTimeout     time.Duration
+	DisableHTTP2        bool
+}
+
+var DefaultTransportProfile = TransportProfile{
+	MaxIdleConns:    10,
+	IdleConnTimeout: 4 * time.Second,
+}
+
+//timeout 同时用作建连、TLS握手和等待响应头的超时, 为0时不限制
+func (p TransportProfile) NewTransport(timeout time.Duration) (*http.Transport, error) {
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+	if p.LocalAddr != "" {
+		ip := net.ParseIP(p.LocalAddr)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid local address: %s", p.LocalAddr)
+		}
+		dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       p.TLSConfig,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConns:          p.MaxIdleConns,
+		MaxIdleConnsPerHost:   p.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       p.MaxConnsPerHost,
+		IdleConnTimeout:       p.IdleConnTimeout,
+		ForceAttemptHTTP2:     !p.DisableHTTP2,
+	}
+	if p.TLSConfig != nil {
+		transport.TLSClientConfig = p.TLSConfig.Clone()
+	}
+	if p.DisableHTTP2 {
+		//非nil的空map会关闭自动升级到HTTP/2
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	if p.ProxyUrl != "" {
+		proxy, err := url.Parse(p.ProxyUrl)
+		if err != nil {
+			return nil, err
+		}
+		switch proxy.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme: %s", proxy.Scheme)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	return transport, nil
+}
@@ -0,0 +1,48 @@
+package builder
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+//解析成和 encoding/json 一样的 map[string]interface{} 结构, 之后和json配置走同一套处理
+func parseYAML(data []byte) (interface{}, error) {
+	var tree interface{}
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	if tree == nil {
+		return map[string]interface{}{}, nil
+	}
+	return stringKeys(tree)
+}
+
+//yaml.v2 把map解成 map[interface{}]interface{}, json.Marshal 不支持
+func stringKeys(v interface{}) (interface{}, error) {
+	switch value := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			key, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("yaml: unsupported key %v, keys must be strings", k)
+			}
+			converted, err := stringKeys(item)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = converted
+		}
+		return m, nil
+	case []interface{}:
+		for i, item := range value {
+			converted, err := stringKeys(item)
+			if err != nil {
+				return nil, err
+			}
+			value[i] = converted
+		}
+	}
+	return v, nil
+}
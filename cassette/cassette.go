@@ -0,0 +1,258 @@
+package cassette
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+)
+
+//录制/回放http请求, 用于离线测试交易所适配器.
+//录制时把真实的请求和响应去掉敏感信息后写入json文件, 回放时按请求匹配返回录制的响应, 不访问网络
+
+const (
+	MODE_REPLAY = iota
+	MODE_RECORD
+)
+
+type Mode int
+
+//设置了环境变量 CASSETTE_RECORD=1 时为录制模式, 否则回放
+func ModeFromEnv() Mode {
+	if os.Getenv("CASSETTE_RECORD") == "1" {
+		return MODE_RECORD
+	}
+	return MODE_REPLAY
+}
+
+//匹配请求时忽略的参数: 签名、nonce和key每次都不一样
+var IgnoredParams = []string{"sign", "nonce", "reqTime", "apiKey", "api_key", "accesskey"}
+
+//录制的响应头, 其余的(Set-Cookie等)不写入文件
+var RecordedHeaders = []string{"Content-Type", "Retry-After", "Date"}
+
+type Request struct {
+	Method string `json:"method"`
+	Url    string `json:"url"`
+	Body   string `json:"body,omitempty"`
+}
+
+type Response struct {
+	StatusCode int               `json:"status_code"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       string            `json:"body"`
+}
+
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+//实现 http.RoundTripper
+type Recorder struct {
+	file string
+	mode Mode
+	real http.RoundTripper
+	//录制时对写入文件的url、请求体、响应体打码, 可以用 AddSecret 登记录制用的key
+	Redactor *Redactor
+
+	mu       sync.Mutex
+	cassette Cassette
+	used     []bool
+}
+
+//回放模式下读取file; 录制模式下通过real发出请求, real为nil时使用 http.DefaultTransport
+func New(file string, mode Mode, real http.RoundTripper) (*Recorder, error) {
+	if real == nil {
+		real = http.DefaultTransport
+	}
+	r := &Recorder{file: file, mode: mode, real: real, Redactor: &Redactor{RedactAddresses: true}}
+	if mode == MODE_RECORD {
+		return r, nil
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &r.cassette); err != nil {
+		return nil, fmt.Errorf("cassette %s: %v", file, err)
+	}
+	r.used = make([]bool, len(r.cassette.Interactions))
+	return r, nil
+}
+
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	if r.mode == MODE_RECORD {
+		return r.record(req, body)
+	}
+	return r.replay(req, body)
+}
+
+//按录制顺序返回第一个未用过的匹配项, 同一个请求可以录制多次
+func (r *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, interaction := range r.cassette.Interactions {
+		if !r.used[i] && matches(interaction.Request, req.Method, req.URL, string(body)) {
+			r.used[i] = true
+			return newResponse(req, interaction.Response), nil
+		}
+	}
+	return nil, fmt.Errorf("cassette %s: no recorded interaction for %s %s %s", filepath.Base(r.file), req.Method, r.Redactor.Redact(req.URL.String()), r.Redactor.Redact(string(body)))
+}
+
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	resp, err := r.real.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+	resp.ContentLength = int64(len(respBody))
+
+	headers := map[string]string{}
+	for _, name := range RecordedHeaders {
+		if v := resp.Header.Get(name); v != "" {
+			headers[name] = v
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, Interaction{
+		Request:  Request{req.Method, r.Redactor.Redact(req.URL.String()), r.Redactor.Redact(string(body))},
+		Response: Response{resp.StatusCode, headers, r.Redactor.Redact(string(respBody))},
+	})
+	return resp, nil
+}
+
+//录制模式下写入文件, 回放模式下检查是否所有录制的请求都被用到
+func (r *Recorder) Stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.mode == MODE_RECORD {
+		data, err := json.MarshalIndent(r.cassette, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(r.file), 0755); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(r.file, append(data, '\n'), 0644)
+	}
+	for i, used := range r.used {
+		if !used {
+			req := r.cassette.Interactions[i].Request
+			return fmt.Errorf("cassette %s: interaction %d (%s %s) was not replayed", filepath.Base(r.file), i, req.Method, req.Url)
+		}
+	}
+	return nil
+}
+
+//gzip响应解压后再记录, 文件里保存明文方便查看和修改
+func readBody(resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+	if !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return ioutil.ReadAll(resp.Body)
+	}
+	gzReader, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer gzReader.Close()
+	resp.Header.Del("Content-Encoding")
+	return ioutil.ReadAll(gzReader)
+}
+
+func newResponse(req *http.Request, recorded Response) *http.Response {
+	header := http.Header{}
+	for k, v := range recorded.Headers {
+		header.Set(k, v)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(recorded.Body)),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       req,
+	}
+}
+
+//方法和路径相同, 查询串和表单参数去掉 IgnoredParams 后相同; 录制时被打码的参数可以匹配任意值
+func matches(recorded Request, method string, u *url.URL, body string) bool {
+	if recorded.Method != method {
+		return false
+	}
+	recordedUrl, err := url.Parse(recorded.Url)
+	if err != nil || recordedUrl.Scheme != u.Scheme || recordedUrl.Host != u.Host || recordedUrl.Path != u.Path {
+		return false
+	}
+	return matchParams(recordedUrl.RawQuery, u.RawQuery) && matchParams(recorded.Body, body)
+}
+
+func matchParams(recorded, actual string) bool {
+	recordedValues, err := parseParams(recorded)
+	if err != nil {
+		return recorded == actual
+	}
+	actualValues, err := parseParams(actual)
+	if err != nil || len(recordedValues) != len(actualValues) {
+		return false
+	}
+	for k, values := range recordedValues {
+		if len(values) != len(actualValues[k]) {
+			return false
+		}
+		for i, v := range values {
+			if v != REDACTED && v != actualValues[k][i] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func parseParams(encoded string) (url.Values, error) {
+	values, err := url.ParseQuery(encoded)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range IgnoredParams {
+		values.Del(name)
+	}
+	return values, nil
+}
@@ -0,0 +1,70 @@
+package cassette
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=abc")
+		w.Write([]byte(`{"order_id":` + r.Form.Get("amount") + `,"api_key":"live-key"}`))
+	}))
+	defer ts.Close()
+
+	file := filepath.Join(t.TempDir(), "trade.json")
+	recorder, err := New(file, MODE_RECORD, nil)
+	assert.NoError(t, err)
+	recorder.Redactor.AddSecret("live-secret")
+
+	form := url.Values{"amount": {"1"}, "withdraw_address": {"1BoatSLRHtKNngkdXEeobR76b53LETtpyT"}, "sign": {"live-secret"}, "nonce": {"1"}}
+	resp, err := recorder.Client().PostForm(ts.URL+"/trade.do?api_key=live-key", form)
+	assert.NoError(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, `{"order_id":1,"api_key":"live-key"}`, string(body), "recording must not change the live response")
+	form.Set("amount", "2")
+	_, err = recorder.Client().PostForm(ts.URL+"/trade.do?api_key=live-key", form)
+	assert.NoError(t, err)
+	assert.NoError(t, recorder.Stop())
+
+	data, err := ioutil.ReadFile(file)
+	assert.NoError(t, err)
+	for _, secret := range []string{"live-key", "live-secret", "1BoatSLR", "session=abc"} {
+		assert.False(t, strings.Contains(string(data), secret), "cassette contains %s", secret)
+	}
+
+	//签名、nonce不同, 打码的地址不同, 都能匹配; 相同请求按录制顺序返回
+	replayer, err := New(file, MODE_REPLAY, nil)
+	assert.NoError(t, err)
+	form = url.Values{"amount": {"2"}, "withdraw_address": {"another"}, "sign": {"x"}, "nonce": {"99"}}
+	resp, err = replayer.Client().PostForm(ts.URL+"/trade.do?api_key=other", form)
+	assert.NoError(t, err)
+	body, _ = ioutil.ReadAll(resp.Body)
+	assert.Equal(t, `{"order_id":2,"api_key":"***"}`, string(body))
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	err = replayer.Stop()
+	assert.Error(t, err, "the first interaction was not replayed")
+
+	form.Set("amount", "3")
+	_, err = replayer.Client().PostForm(ts.URL+"/trade.do", form)
+	assert.Error(t, err)
+	form.Set("amount", "1")
+	_, err = replayer.Client().PostForm(ts.URL+"/trade.do", form)
+	assert.NoError(t, err)
+	assert.NoError(t, replayer.Stop())
+}
+
+func TestReplayMissingCassette(t *testing.T) {
+	_, err := New(filepath.Join(t.TempDir(), "missing.json"), MODE_REPLAY, nil)
+	assert.Error(t, err)
+}
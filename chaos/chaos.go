@@ -0,0 +1,283 @@
+//在http请求链路中按概率注入故障, 用于离线验证策略和重试、错误处理在交易所出问题时的表现.
+//可以注入延迟、超时、连接被重置、5xx、429、响应体被截断和不完整的json, 每个接口可以单独配置概率
+package chaos
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+)
+
+const (
+	FAULT_LATENCY        = iota //请求前等待 Config.Latency, 之后正常发出
+	FAULT_TIMEOUT               //等待 Config.Timeout 后返回超时错误, 请求不会发出
+	FAULT_RESET                 //请求发出后丢弃响应, 返回连接被重置; 交易所可能已经处理了请求
+	FAULT_SERVER_ERROR          //不发出请求, 返回 Config.ServerErrorStatus
+	FAULT_RATE_LIMIT            //不发出请求, 返回429和 Retry-After
+	FAULT_TRUNCATED_BODY        //响应体只返回一半, 读取时返回 io.ErrUnexpectedEOF
+	FAULT_MALFORMED_JSON        //状态码为200, 响应体替换为不完整的json对象 MALFORMED_BODY, 读取时没有错误
+)
+
+type Fault int
+
+func (f Fault) String() string {
+	switch f {
+	case FAULT_LATENCY:
+		return "LATENCY"
+	case FAULT_TIMEOUT:
+		return "TIMEOUT"
+	case FAULT_RESET:
+		return "RESET"
+	case FAULT_SERVER_ERROR:
+		return "SERVER_ERROR"
+	case FAULT_RATE_LIMIT:
+		return "RATE_LIMIT"
+	case FAULT_TRUNCATED_BODY:
+		return "TRUNCATED_BODY"
+	case FAULT_MALFORMED_JSON:
+		return "MALFORMED_JSON"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+//各种故障的概率, 0~1. 延迟独立抽取, 可以和其他故障同时发生; 其余故障互斥, 概率之和不应超过1
+type Rates struct {
+	Latency       float64
+	Timeout       float64
+	Reset         float64
+	ServerError   float64
+	RateLimit     float64
+	TruncatedBody float64
+	MalformedJSON float64
+}
+
+//所有互斥的故障都按 rate 注入
+func Uniform(rate float64) Rates {
+	return Rates{Timeout: rate, Reset: rate, ServerError: rate, RateLimit: rate, TruncatedBody: rate, MalformedJSON: rate}
+}
+
+type Config struct {
+	Default   Rates
+	Endpoints map[string]Rates //按接口覆盖 Default, key见 RequestEndpoint(如 trade.do、poloniex 的 returnBalances), 与 RateLimitPolicy.Weights 一致
+
+	Latency           time.Duration //FAULT_LATENCY 的等待时间
+	Timeout           time.Duration //FAULT_TIMEOUT 返回错误前的等待时间, 请求的 context 先结束时返回 context 的错误
+	ServerErrorStatus int           //FAULT_SERVER_ERROR 的状态码, 默认503
+	RetryAfter        time.Duration //FAULT_RATE_LIMIT 的 Retry-After, 为0时不带这个响应头
+
+	Seed    int64                          //随机数种子, 相同的种子和请求顺序注入相同的故障; 为0时按当前时间
+	OnFault func(endpoint string, f Fault) //每次注入故障时回调
+}
+
+type Injector struct {
+	config Config
+
+	mu     sync.Mutex
+	rand   *rand.Rand
+	counts map[Fault]int
+}
+
+func New(config Config) *Injector {
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	if config.ServerErrorStatus == 0 {
+		config.ServerErrorStatus = http.StatusServiceUnavailable
+	}
+	return &Injector{config: config, rand: rand.New(rand.NewSource(seed)), counts: map[Fault]int{}}
+}
+
+//已注入的故障次数
+func (i *Injector) Count(f Fault) int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.counts[f]
+}
+
+func (i *Injector) rates(endpoint string) Rates {
+	if rates, ok := i.config.Endpoints[endpoint]; ok {
+		return rates
+	}
+	return i.config.Default
+}
+
+//按概率抽取本次请求的故障, 没有互斥故障时 fault 为-1
+func (i *Injector) draw(endpoint string) (latency bool, fault Fault) {
+	rates := i.rates(endpoint)
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	latency = i.rand.Float64() < rates.Latency
+	if latency {
+		i.counts[FAULT_LATENCY]++
+	}
+	r, cumulative := i.rand.Float64(), 0.0
+	for _, candidate := range []struct {
+		fault Fault
+		rate  float64
+	}{
+		{FAULT_TIMEOUT, rates.Timeout},
+		{FAULT_RESET, rates.Reset},
+		{FAULT_SERVER_ERROR, rates.ServerError},
+		{FAULT_RATE_LIMIT, rates.RateLimit},
+		{FAULT_TRUNCATED_BODY, rates.TruncatedBody},
+		{FAULT_MALFORMED_JSON, rates.MalformedJSON},
+	} {
+		cumulative += candidate.rate
+		if r < cumulative {
+			i.counts[candidate.fault]++
+			return latency, candidate.fault
+		}
+	}
+	return latency, -1
+}
+
+func (i *Injector) notify(endpoint string, f Fault) {
+	if i.config.OnFault != nil {
+		i.config.OnFault(endpoint, f)
+	}
+}
+
+//注入故障的中间件, 一般放在中间件链的最后, 紧挨着真实的 Transport
+func (i *Injector) Middleware() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return i.roundTrip(next, req)
+		})
+	}
+}
+
+//返回挂载了故障注入的新client, 传入的client不会被修改
+func (i *Injector) Client(client *http.Client) *http.Client {
+	return WithMiddleware(client, i.Middleware())
+}
+
+func (i *Injector) roundTrip(next http.RoundTripper, req *http.Request) (*http.Response, error) {
+	endpoint := RequestEndpoint(req)
+	latency, fault := i.draw(endpoint)
+	if latency {
+		i.notify(endpoint, FAULT_LATENCY)
+		if err := sleep(req.Context(), i.config.Latency); err != nil {
+			return nil, err
+		}
+	}
+	if fault < 0 {
+		return next.RoundTrip(req)
+	}
+	i.notify(endpoint, fault)
+
+	switch fault {
+	case FAULT_TIMEOUT:
+		if err := sleep(req.Context(), i.config.Timeout); err != nil {
+			return nil, err
+		}
+		return nil, timeoutError{}
+	case FAULT_SERVER_ERROR:
+		return response(req, i.config.ServerErrorStatus, nil, `{"error":"chaos: injected server error"}`), nil
+	case FAULT_RATE_LIMIT:
+		header := http.Header{}
+		if i.config.RetryAfter > 0 {
+			header.Set("Retry-After", strconv.Itoa(int((i.config.RetryAfter+time.Second-1)/time.Second)))
+		}
+		return response(req, http.StatusTooManyRequests, header, `{"error":"chaos: too many requests"}`), nil
+	}
+
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	switch fault {
+	case FAULT_RESET:
+		resp.Body.Close()
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	case FAULT_TRUNCATED_BODY:
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body[:len(body)/2]), errorReader{io.ErrUnexpectedEOF}))
+		resp.ContentLength = -1
+		resp.Header.Del("Content-Length")
+	case FAULT_MALFORMED_JSON:
+		resp.Body.Close()
+		resp.Body = ioutil.NopCloser(bytes.NewReader([]byte(MALFORMED_BODY)))
+		resp.ContentLength = int64(len(MALFORMED_BODY))
+		resp.Header.Set("Content-Type", "application/json")
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.StatusCode, resp.Status = http.StatusOK, "200 OK"
+	}
+	return resp, nil
+}
+
+//FAULT_MALFORMED_JSON 返回的响应体, 模拟交易所返回了被截断的json: 完整读取后解析失败
+const MALFORMED_BODY = `{"result":true,"data":{"price":"100","amount":`
+
+func response(req *http.Request, status int, header http.Header, body string) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Content-Type", "application/json")
+	return &http.Response{
+		StatusCode:    status,
+		Status:        strconv.Itoa(status) + " " + http.StatusText(status),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader([]byte(body))),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//实现 net.Error, ClassifyError 归为 ERR_KIND_NETWORK
+type timeoutError struct{}
+
+func (timeoutError) Error() string {
+	return "chaos: injected timeout"
+}
+
+func (timeoutError) Timeout() bool {
+	return true
+}
+
+func (timeoutError) Temporary() bool {
+	return true
+}
+
+type errorReader struct {
+	err error
+}
+
+func (r errorReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
@@ -0,0 +1,185 @@
+package chaos
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+	"github.com/qct/cryptocurrency-exchange-api/okcoin/okcointest"
+	"github.com/stretchr/testify/assert"
+)
+
+//返回固定json并记录收到的请求数
+func newTestServer() (*httptest.Server, *int32) {
+	var hits int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"result":true,"ticker":{"last":"100"}}`))
+	}))
+	return s, &hits
+}
+
+func TestInjector_Faults(t *testing.T) {
+	s, hits := newTestServer()
+	defer s.Close()
+
+	for _, c := range []struct {
+		rates     Rates
+		kind      ErrorKind
+		delivered bool
+	}{
+		{Rates{Timeout: 1}, ERR_KIND_NETWORK, false},
+		{Rates{Reset: 1}, ERR_KIND_NETWORK, true},
+		{Rates{ServerError: 1}, ERR_KIND_SERVER, false},
+		{Rates{RateLimit: 1}, ERR_KIND_RATE_LIMIT, false},
+		{Rates{TruncatedBody: 1}, ERR_KIND_NETWORK, true},
+	} {
+		atomic.StoreInt32(hits, 0)
+		injector := New(Config{Default: c.rates, RetryAfter: 2 * time.Second, Seed: 1})
+		_, err := HttpGetBytes(injector.Client(s.Client()), s.URL+"/api/v1/ticker.do")
+		assert.Error(t, err)
+		assert.Equal(t, c.kind, ClassifyError(err), "%+v: %v", c.rates, err)
+		assert.Equal(t, c.delivered, atomic.LoadInt32(hits) == 1, "%+v", c.rates)
+	}
+
+	//429 带上 Retry-After
+	injector := New(Config{Default: Rates{RateLimit: 1}, RetryAfter: 2 * time.Second})
+	_, err := HttpGetBytes(injector.Client(s.Client()), s.URL+"/api/v1/ticker.do")
+	var httpErr *HttpError
+	if assert.True(t, errors.As(err, &httpErr)) {
+		assert.Equal(t, 2*time.Second, httpErr.RetryAfter)
+	}
+
+	//不完整的json完整读取后在解析时报错
+	injector = New(Config{Default: Rates{MalformedJSON: 1}})
+	body, err := HttpGetBytes(injector.Client(s.Client()), s.URL+"/api/v1/ticker.do")
+	assert.NoError(t, err)
+	assert.Equal(t, MALFORMED_BODY, string(body))
+	var decodeErr *DecodeError
+	assert.True(t, errors.As(DecodeJSON(body, &struct{}{}), &decodeErr))
+	assert.Equal(t, 1, injector.Count(FAULT_MALFORMED_JSON))
+}
+
+func TestInjector_LatencyAndTimeout(t *testing.T) {
+	s, _ := newTestServer()
+	defer s.Close()
+
+	var faults []Fault
+	injector := New(Config{
+		Default: Rates{Latency: 1},
+		Latency: 50 * time.Millisecond,
+		OnFault: func(endpoint string, f Fault) {
+			assert.Equal(t, "ticker.do", endpoint)
+			faults = append(faults, f)
+		},
+	})
+	start := time.Now()
+	_, err := HttpGetBytes(injector.Client(s.Client()), s.URL+"/api/v1/ticker.do")
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+	assert.Equal(t, []Fault{FAULT_LATENCY}, faults)
+
+	//请求的 context 先于 Timeout 结束
+	injector = New(Config{Default: Rates{Timeout: 1}, Timeout: time.Minute})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequest("GET", s.URL+"/api/v1/ticker.do", nil)
+	_, err = injector.Client(s.Client()).Do(req.WithContext(ctx))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "%v", err)
+}
+
+func TestInjector_PerEndpointRates(t *testing.T) {
+	s, _ := newTestServer()
+	defer s.Close()
+
+	injector := New(Config{Default: Rates{ServerError: 1}, Endpoints: map[string]Rates{"ticker.do": {}}})
+	client := injector.Client(s.Client())
+	_, err := HttpGetBytes(client, s.URL+"/api/v1/ticker.do")
+	assert.NoError(t, err)
+	_, err = HttpGetBytes(client, s.URL+"/api/v1/trade.do")
+	assert.Equal(t, ErrorKind(ERR_KIND_SERVER), ClassifyError(err))
+	assert.Equal(t, 1, injector.Count(FAULT_SERVER_ERROR))
+}
+
+//poloniex 所有接口共用一个路径, 按 command 参数区分
+func TestInjector_PerCommandRates(t *testing.T) {
+	s, _ := newTestServer()
+	defer s.Close()
+
+	var endpoints []string
+	injector := New(Config{
+		Default:   Rates{},
+		Endpoints: map[string]Rates{"returnOrderBook": {ServerError: 1}, "buy": {ServerError: 1}},
+		OnFault: func(endpoint string, f Fault) {
+			endpoints = append(endpoints, endpoint)
+		},
+	})
+	client := injector.Client(s.Client())
+	_, err := HttpGetBytes(client, s.URL+"/public?command=returnTicker")
+	assert.NoError(t, err)
+	_, err = HttpGetBytes(client, s.URL+"/public?command=returnOrderBook&currencyPair=USDT_BTC")
+	assert.Equal(t, ErrorKind(ERR_KIND_SERVER), ClassifyError(err))
+	_, err = HttpPostForm(client, s.URL+"/tradingApi", url.Values{"command": {"returnBalances"}})
+	assert.NoError(t, err)
+	_, err = HttpPostForm(client, s.URL+"/tradingApi", url.Values{"command": {"buy"}, "rate": {"100"}})
+	assert.Equal(t, ErrorKind(ERR_KIND_SERVER), ClassifyError(err))
+	assert.Equal(t, []string{"returnOrderBook", "buy"}, endpoints)
+}
+
+//相同的种子注入相同的故障序列, 按概率注入的故障可以被重试恢复
+func TestInjector_SeedAndRetry(t *testing.T) {
+	s, _ := newTestServer()
+	defer s.Close()
+
+	outcomes := func() []ErrorKind {
+		injector := New(Config{Default: Uniform(0.1), Seed: 42})
+		var kinds []ErrorKind
+		for i := 0; i < 50; i++ {
+			_, err := HttpGetBytes(injector.Client(s.Client()), s.URL+"/api/v1/ticker.do")
+			kinds = append(kinds, ClassifyError(err))
+		}
+		return kinds
+	}
+	first := outcomes()
+	assert.Equal(t, first, outcomes())
+	assert.Contains(t, first, ErrorKind(ERR_KIND_SERVER))
+
+	injector := New(Config{Default: Rates{ServerError: 0.5, Reset: 0.3}, Seed: 7})
+	client := injector.Client(s.Client())
+	policy := RetryPolicy{MaxAttempts: 20, InitialInterval: time.Millisecond, MaxInterval: time.Millisecond, Multiplier: 1, Idempotent: true}
+	for i := 0; i < 10; i++ {
+		err := Retry(context.Background(), policy, func() error {
+			_, err := HttpGetBytes(client, s.URL+"/api/v1/ticker.do")
+			return err
+		})
+		assert.NoError(t, err)
+	}
+	assert.True(t, injector.Count(FAULT_SERVER_ERROR) > 0)
+}
+
+//通过注册表构建的适配器使用注入故障的client
+func TestInjector_Adapter(t *testing.T) {
+	s := okcointest.NewServer("key", "secret")
+	defer s.Close()
+	s.SetPrice("btc_cny", 28000, 28010)
+
+	injector := New(Config{Default: Rates{RateLimit: 1}, Endpoints: map[string]Rates{"depth.do": {}}})
+	driver, err := LookupApi(OK_CN)
+	assert.NoError(t, err)
+	api, err := driver.New(ApiConfig{HttpClient: injector.Client(s.Client()), ApiKey: "key", ApiSecretKey: "secret", BaseUrl: s.URL})
+	assert.NoError(t, err)
+
+	cp := NewCurrencyPair("BTC", "CNY")
+	_, err = api.GetTicker(cp)
+	assert.True(t, IsRetryable(err))
+	assert.Equal(t, ErrorKind(ERR_KIND_RATE_LIMIT), ClassifyError(err))
+	_, err = api.GetDepth(cp, 5)
+	assert.NoError(t, err)
+}
@@ -1,11 +1,11 @@
 package chbtc
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	. "github.com/qct/cryptocurrency-exchange-api"
-	"log"
 	"net/http"
 	"net/url"
 	"sort"
@@ -28,38 +28,80 @@ const (
 	CANCEL_WITHDRAW_API       = "cancelWithdraw"
 )
 
+//单个apiKey每秒最多10次请求
+var DefaultRateLimitPolicy = RateLimitPolicy{
+	Rate:  10,
+	Burst: 10,
+	Weights: map[string]int{
+		GET_UNFINISHED_ORDERS_API: 2,
+		WITHDRAW_API:              5,
+		CANCEL_WITHDRAW_API:       5,
+	},
+}
+
+const (
+	CODE_SUCCESS         = 1000
+	CODE_ORDER_NOT_FOUND = 3001
+)
+
+type chbtcResult struct {
+	Code    *JsonInt64 `json:"code"`
+	Message string     `json:"message"`
+	Id      string     `json:"id"`
+}
+
+type chbtcOrder struct {
+	Id          string      `json:"id"`
+	TotalAmount JsonFloat64 `json:"total_amount"`
+	TradeAmount JsonFloat64 `json:"trade_amount"`
+	TradeMoney  JsonFloat64 `json:"trade_money"`
+	Price       JsonFloat64 `json:"price"`
+	Fees        JsonFloat64 `json:"fees"`
+	TradeDate   JsonInt64   `json:"trade_date"`
+	Type        JsonInt64   `json:"type"`
+	Status      JsonInt64   `json:"status"`
+}
+
 type ChbtcApi struct {
 	httpClient *http.Client
-	accessKey,
-	secretKey string
+	signer     Signer
+	marketUrl  string
+	tradeUrl   string
+	clock      Clock
+}
+
+//行情和交易是两个域名, 指定BaseUrl时两者都指向它
+func init() {
+	RegisterApi(CHBTC, ApiDriver{
+		New: func(config ApiConfig) (Api, error) {
+			nonce := config.Nonce
+			if nonce == nil {
+				nonce = SharedNonceProvider(CHBTC, config.ApiKey)
+			}
+			signer := &ApiSigner{Credentials: config.CredentialProvider(), Nonce: nonce}
+			return &ChbtcApi{config.HttpClient, signer, ResolveBaseUrl(MARKET_URL, config.BaseUrl), ResolveBaseUrl(TRADE_URL, config.BaseUrl), ExchangeClock(CHBTC, config.BaseUrl)}, nil
+		},
+		DefaultRateLimit: DefaultRateLimitPolicy,
+		ServerTime:       ServerTime,
+	})
 }
 
 func NewApi(httpClient *http.Client, accessKey, secretKey string) *ChbtcApi {
-	return &ChbtcApi{httpClient, accessKey, secretKey}
+	return NewApiWithNonce(httpClient, accessKey, secretKey, SharedNonceProvider(CHBTC, accessKey))
+}
+
+func NewApiWithNonce(httpClient *http.Client, accessKey, secretKey string, nonce NonceProvider) *ChbtcApi {
+	return &ChbtcApi{httpClient, &ApiSigner{Credentials: StaticCredentials{ApiKey: accessKey, ApiSecretKey: secretKey}, Nonce: nonce}, MARKET_URL, TRADE_URL, ExchangeClock(CHBTC, "")}
 }
 
 func (c *ChbtcApi) GetDepth(cp CurrencyPair, size int) (*Depth, error) {
-	resp, err := HttpGet(c.httpClient, MARKET_URL+fmt.Sprintf(DEPTH_API, cp.CustomSymbol("_", true), size))
+	resp, err := HttpGetBytes(c.httpClient, c.marketUrl+fmt.Sprintf(DEPTH_API, cp.CustomSymbol("_", true), size))
 	if err != nil {
 		return nil, err
 	}
-	asks := resp["asks"].([]interface{})
-	bids := resp["bids"].([]interface{})
-
-	depth := new(Depth)
-	for _, e := range bids {
-		var r DepthRecord
-		ee := e.([]interface{})
-		r.Amount = ee[1].(float64)
-		r.Price = ee[0].(float64)
-		depth.BidList = append(depth.BidList, r)
-	}
-	for _, e := range asks {
-		var r DepthRecord
-		ee := e.([]interface{})
-		r.Amount = ee[1].(float64)
-		r.Price = ee[0].(float64)
-		depth.AskList = append(depth.AskList, r)
+	depth, err := parseDepth(resp)
+	if err != nil {
+		return nil, err
 	}
 	sort.Sort(depth.AskList)
 	return depth, nil
@@ -74,11 +116,11 @@ func (c *ChbtcApi) LimitSell(amount, price string, cp CurrencyPair) (*Order, err
 }
 
 func (c *ChbtcApi) MarketBuy(amount, price string, cp CurrencyPair) (*Order, error) {
-	panic("unsupported the market order")
+	return nil, NewUnsupportedError(CHBTC, "MarketBuy")
 }
 
 func (c *ChbtcApi) MarketSell(amount, price string, cp CurrencyPair) (*Order, error) {
-	panic("unsupported the market order")
+	return nil, NewUnsupportedError(CHBTC, "MarketSell")
 }
 
 func (c *ChbtcApi) CancelOrder(orderId string, cp CurrencyPair) (bool, error) {
@@ -86,24 +128,16 @@ func (c *ChbtcApi) CancelOrder(orderId string, cp CurrencyPair) (bool, error) {
 	params.Set("method", "cancelOrder")
 	params.Set("id", orderId)
 	params.Set("currency", cp.CustomSymbol("_", true))
-	c.buildPostForm(&params)
-	resp, err := HttpPostForm(c.httpClient, TRADE_URL+CANCEL_ORDER_API, params)
+	resp, err := c.signedPost(c.tradeUrl+CANCEL_ORDER_API, params)
 	if err != nil {
-		log.Println(err)
 		return false, err
 	}
 
-	respMap := make(map[string]interface{})
-	err = json.Unmarshal(resp, &respMap)
+	_, err = parseResult(resp)
 	if err != nil {
-		log.Println(err)
 		return false, err
 	}
-	code := respMap["code"].(float64)
-	if code == 1000 {
-		return true, nil
-	}
-	return false, errors.New(fmt.Sprintf("%.0f", code))
+	return true, nil
 }
 
 func (c *ChbtcApi) GetOneOrder(orderId string, cp CurrencyPair) (*Order, error) {
@@ -111,22 +145,16 @@ func (c *ChbtcApi) GetOneOrder(orderId string, cp CurrencyPair) (*Order, error)
 	params.Set("method", "getOrder")
 	params.Set("id", orderId)
 	params.Set("currency", cp.CustomSymbol("_", true))
-	c.buildPostForm(&params)
-	resp, err := HttpPostForm(c.httpClient, TRADE_URL+GET_ORDER_API, params)
+	resp, err := c.signedPost(c.tradeUrl+GET_ORDER_API, params)
 	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
 
-	orderMap := make(map[string]interface{})
-	err = json.Unmarshal(resp, &orderMap)
+	order, err := parseOneOrder(resp)
 	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
-	order := new(Order)
 	order.CurrencyPair = cp.CustomSymbol("_", true)
-	parseOrder(order, orderMap)
 	return order, nil
 }
 
@@ -136,32 +164,17 @@ func (c *ChbtcApi) GetUnfinishedOrders(cp CurrencyPair) ([]Order, error) {
 	params.Set("currency", cp.CustomSymbol("_", true))
 	params.Set("pageIndex", "1")
 	params.Set("pageSize", "100")
-	c.buildPostForm(&params)
-	resp, err := HttpPostForm(c.httpClient, TRADE_URL+GET_UNFINISHED_ORDERS_API, params)
+	resp, err := c.signedPost(c.tradeUrl+GET_UNFINISHED_ORDERS_API, params)
 	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
-	respStr := string(resp)
-	if strings.Contains(respStr, "\"code\":3001") {
-		log.Println(respStr)
-		return nil, nil
-	}
 
-	var respArr []interface{}
-	err = json.Unmarshal(resp, &respArr)
+	orders, err := parseOrders(resp)
 	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
-
-	var orders []Order
-	for _, v := range respArr {
-		orderMap := v.(map[string]interface{})
-		order := Order{}
-		order.CurrencyPair = cp.CustomSymbol("_", true)
-		parseOrder(&order, orderMap)
-		orders = append(orders, order)
+	for i := range orders {
+		orders[i].CurrencyPair = cp.CustomSymbol("_", true)
 	}
 	return orders, nil
 }
@@ -169,59 +182,19 @@ func (c *ChbtcApi) GetUnfinishedOrders(cp CurrencyPair) ([]Order, error) {
 func (c *ChbtcApi) GetAccount() (*Account, error) {
 	params := url.Values{}
 	params.Set("method", "getAccountInfo")
-	c.buildPostForm(&params)
-	resp, err := HttpPostForm(c.httpClient, TRADE_URL+GET_ACCOUNT_API, params)
-	if err != nil {
-		return nil, err
-	}
-
-	var respMap map[string]interface{}
-	err = json.Unmarshal(resp, &respMap)
+	resp, err := c.signedPost(c.tradeUrl+GET_ACCOUNT_API, params)
 	if err != nil {
-		log.Println("json unmarshal error")
 		return nil, err
 	}
-	if respMap["code"] != nil && respMap["code"].(float64) != 1000 {
-		return nil, errors.New(string(resp))
-	}
-
-	acc := new(Account)
-	acc.Exchange = CHBTC
-	acc.SubAccounts = make(map[string]SubAccount)
-	resultMap := respMap["result"].(map[string]interface{})
-	balanceMap := resultMap["balance"].(map[string]interface{})
-	frozenMap := resultMap["frozen"].(map[string]interface{})
-	p2pMap := resultMap["p2p"].(map[string]interface{})
-	acc.NetAsset = ToFloat64(resultMap["netAssets"])
-	acc.Asset = ToFloat64(resultMap["totalAssets"])
-	for t, v := range balanceMap {
-		vv := v.(map[string]interface{})
-		frozen := frozenMap["CNY"].(map[string]interface{})
-		subAcc := SubAccount{}
-		subAcc.Amount = ToFloat64(vv["amount"])
-		subAcc.FrozenAmount = ToFloat64(frozen["amount"])
-		subAcc.LoanAmount = ToFloat64(p2pMap[fmt.Sprintf("in%s", t)])
-		subAcc.Currency = t
-		acc.SubAccounts[subAcc.Currency] = subAcc
-	}
-	return acc, nil
+	return parseAccount(resp)
 }
 
 func (c *ChbtcApi) GetTicker(cp CurrencyPair) (*Ticker, error) {
-	resp, err := HttpGet(c.httpClient, MARKET_URL+fmt.Sprintf(TICKER_API, cp.CustomSymbol("_", true)))
+	resp, err := HttpGetBytes(c.httpClient, c.marketUrl+fmt.Sprintf(TICKER_API, cp.CustomSymbol("_", true)))
 	if err != nil {
 		return nil, err
 	}
-	tickerMap := resp["ticker"].(map[string]interface{})
-	ticker := new(Ticker)
-	ticker.Date, _ = strconv.ParseUint(resp["date"].(string), 10, 64)
-	ticker.Buy, _ = strconv.ParseFloat(tickerMap["buy"].(string), 64)
-	ticker.Sell, _ = strconv.ParseFloat(tickerMap["sell"].(string), 64)
-	ticker.Last, _ = strconv.ParseFloat(tickerMap["last"].(string), 64)
-	ticker.High, _ = strconv.ParseFloat(tickerMap["high"].(string), 64)
-	ticker.Low, _ = strconv.ParseFloat(tickerMap["low"].(string), 64)
-	ticker.Vol, _ = strconv.ParseFloat(tickerMap["vol"].(string), 64)
-	return ticker, nil
+	return parseTicker(resp)
 }
 
 func (c *ChbtcApi) Withdraw(amount, currency, fees, receiveAddr, memo, safePwd string) (string, error) {
@@ -232,23 +205,16 @@ func (c *ChbtcApi) Withdraw(amount, currency, fees, receiveAddr, memo, safePwd s
 	params.Set("fees", fees)
 	params.Set("receiveAddr", receiveAddr)
 	params.Set("safePwd", safePwd)
-	c.buildPostForm(&params)
-	resp, err := HttpPostForm(c.httpClient, TRADE_URL+WITHDRAW_API, params)
+	resp, err := c.signedPost(c.tradeUrl+WITHDRAW_API, params)
 	if err != nil {
-		log.Println("withdraw failed.", err)
 		return "", err
 	}
 
-	respMap := make(map[string]interface{})
-	err = json.Unmarshal(resp, &respMap)
+	result, err := parseResult(resp)
 	if err != nil {
-		log.Println(err, string(resp))
 		return "", err
 	}
-	if respMap["code"].(float64) == 1000 {
-		return respMap["id"].(string), nil
-	}
-	return "", errors.New(string(resp))
+	return result.Id, nil
 }
 
 func (c *ChbtcApi) GetExchangeName() string {
@@ -256,15 +222,15 @@ func (c *ChbtcApi) GetExchangeName() string {
 }
 
 func (c *ChbtcApi) GetKlineRecords(cp CurrencyPair, period string, size, since int) ([]Kline, error) {
-	return nil, nil
+	return nil, NewUnsupportedError(CHBTC, "GetKlineRecords")
 }
 
 func (c *ChbtcApi) GetOrderHistory(cp CurrencyPair, currentPage, pageSize int) ([]Order, error) {
-	return nil, nil
+	return nil, NewUnsupportedError(CHBTC, "GetOrderHistory")
 }
 
 func (c *ChbtcApi) GetTrades(cp CurrencyPair, since int64) ([]Trade, error) {
-	panic("unsupported")
+	return nil, NewUnsupportedError(CHBTC, "GetTrades")
 }
 
 func (c *ChbtcApi) CancelWithdraw(id, currency, safePwd string) (bool, error) {
@@ -273,73 +239,49 @@ func (c *ChbtcApi) CancelWithdraw(id, currency, safePwd string) (bool, error) {
 	params.Set("currency", strings.ToLower(currency))
 	params.Set("downloadId", id)
 	params.Set("safePwd", safePwd)
-	c.buildPostForm(&params)
-	resp, err := HttpPostForm(c.httpClient, TRADE_URL+CANCEL_WITHDRAW_API, params)
+	resp, err := c.signedPost(c.tradeUrl+CANCEL_WITHDRAW_API, params)
 	if err != nil {
-		log.Println("cancel withdraw fail.", err)
 		return false, err
 	}
 
-	respMap := make(map[string]interface{})
-	err = json.Unmarshal(resp, &respMap)
+	_, err = parseResult(resp)
 	if err != nil {
-		log.Println(err, string(resp))
 		return false, err
 	}
-
-	if respMap["code"].(float64) == 1000 {
-		return true, nil
-	}
-	return false, errors.New(string(resp))
+	return true, nil
 }
 
-func (c *ChbtcApi) buildPostForm(postForm *url.Values) error {
-	postForm.Set("accesskey", c.accessKey)
-	payload := postForm.Encode()
-	secretKeySha, _ := GetSHA(c.secretKey)
-	sign, err := GetParamHmacMD5Sign(secretKeySha, payload)
-	if err != nil {
-		return err
+//用 ticker 返回的 date(毫秒) 作为服务端时间
+func ServerTime(client *http.Client, baseUrl string) ServerTimeFunc {
+	reqUrl := ResolveBaseUrl(MARKET_URL, baseUrl) + fmt.Sprintf(TICKER_API, "btc_cny")
+	return func() (time.Time, error) {
+		body, err := HttpGetBytes(client, reqUrl)
+		if err != nil {
+			return time.Time{}, err
+		}
+		var resp struct {
+			Date JsonInt64 `json:"date"`
+		}
+		if err := decodeResponse(body, &resp); err != nil {
+			return time.Time{}, err
+		}
+		if resp.Date == 0 {
+			return time.Time{}, &DecodeError{Err: errors.New("missing date"), Body: body}
+		}
+		return time.Unix(0, int64(resp.Date)*int64(time.Millisecond)), nil
 	}
-	postForm.Set("sign", sign)
-	postForm.Set("reqTime", fmt.Sprintf("%d", time.Now().UnixNano()/1000000))
-	return nil
 }
 
-func parseOrder(order *Order, orderMap map[string]interface{}) {
-	order.OrderID, _ = strconv.Atoi(orderMap["id"].(string))
-	order.Amount = orderMap["total_amount"].(float64)
-	order.DealAmount = orderMap["trade_amount"].(float64)
-	order.Price = orderMap["price"].(float64)
-	order.Fee = orderMap["fees"].(float64)
-	if order.DealAmount > 0 {
-		order.AvgPrice = orderMap["trade_money"].(float64) / order.DealAmount
-	} else {
-		order.AvgPrice = 0
-	}
-
-	order.OrderTime = int(orderMap["trade_date"].(float64))
-	orType := orderMap["type"].(float64)
-	switch orType {
-	case 0:
-		order.Side = SELL
-	case 1:
-		order.Side = BUY
-	default:
-		log.Printf("unknown order type %f", orType)
+func (c *ChbtcApi) signedPost(reqUrl string, params url.Values) ([]byte, error) {
+	u, err := url.Parse(reqUrl)
+	if err != nil {
+		return nil, err
 	}
-
-	status := TradeStatus(orderMap["status"].(float64))
-	switch status {
-	case 0:
-		order.Status = ORDER_UNFINISHED
-	case 1:
-		order.Status = ORDER_CANCEL
-	case 2:
-		order.Status = ORDER_FINISH
-	case 3:
-		order.Status = ORDER_PART_FINISH
+	signed, err := c.signer.Sign("POST", u.Path, params, c.clock.Now())
+	if err != nil {
+		return nil, err
 	}
+	return HttpPostForm2(c.httpClient, reqUrl, signed.Params, signed.Headers)
 }
 
 func (c *ChbtcApi) placeOrder(amount, price string, cp CurrencyPair, tradeType int) (*Order, error) {
@@ -349,33 +291,23 @@ func (c *ChbtcApi) placeOrder(amount, price string, cp CurrencyPair, tradeType i
 	params.Set("amount", amount)
 	params.Set("currency", cp.CustomSymbol("_", true))
 	params.Set("tradeType", fmt.Sprintf("%d", tradeType))
-	c.buildPostForm(&params)
-	resp, err := HttpPostForm(c.httpClient, TRADE_URL+PLACE_ORDER_API, params)
+	resp, err := c.signedPost(c.tradeUrl+PLACE_ORDER_API, params)
 	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
 
-	respMap := make(map[string]interface{})
-	err = json.Unmarshal(resp, &respMap)
+	result, err := parseResult(resp)
 	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
-	code := respMap["code"].(float64)
-	if code != 1000 {
-		log.Println(string(resp))
-		return nil, errors.New(fmt.Sprintf("%.0f", code))
-	}
 
-	id := respMap["id"].(string)
 	order := new(Order)
 	order.Amount, _ = strconv.ParseFloat(amount, 64)
 	order.Price, _ = strconv.ParseFloat(price, 64)
 	order.Status = ORDER_UNFINISHED
 	order.CurrencyPair = cp.CustomSymbol("_", true)
 	order.OrderTime = int(time.Now().UnixNano() / 1000000)
-	order.OrderID, _ = strconv.Atoi(id)
+	order.OrderID, _ = strconv.Atoi(result.Id)
 	switch tradeType {
 	case 0:
 		order.Side = SELL
@@ -384,3 +316,220 @@ func (c *ChbtcApi) placeOrder(amount, price string, cp CurrencyPair, tradeType i
 	}
 	return order, nil
 }
+
+func errorKind(code int64) ErrorKind {
+	switch {
+	case code == 1002:
+		return ERR_KIND_SERVER
+	case code == 1003 || code == 3006 || code == 4001:
+		return ERR_KIND_AUTH
+	case code >= 2001 && code <= 2009:
+		return ERR_KIND_INSUFFICIENT_FUNDS
+	case code == 4002:
+		return ERR_KIND_RATE_LIMIT
+	case code >= 3001 && code <= 3005:
+		return ERR_KIND_INVALID_REQUEST
+	}
+	return ERR_KIND_UNKNOWN
+}
+
+//交易接口成功时 code 为1000; 查询接口成功时直接返回数据, 没有 code 字段
+func checkError(body []byte) error {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return &DecodeError{Err: errors.New("empty response"), Body: body}
+	}
+	if body[0] != '{' {
+		return nil
+	}
+
+	var r chbtcResult
+	if err := json.Unmarshal(body, &r); err != nil {
+		return &DecodeError{Err: err, Body: body}
+	}
+	if r.Code != nil && *r.Code != CODE_SUCCESS {
+		return &ApiError{
+			Exchange: CHBTC,
+			Kind:     errorKind(int64(*r.Code)),
+			Code:     fmt.Sprintf("%d", *r.Code),
+			Message:  r.Message,
+		}
+	}
+	return nil
+}
+
+func decodeResponse(body []byte, result interface{}) error {
+	if err := checkError(body); err != nil {
+		return err
+	}
+	return DecodeJSON(body, result)
+}
+
+func parseResult(body []byte) (*chbtcResult, error) {
+	result := new(chbtcResult)
+	err := decodeResponse(body, result)
+	if err != nil {
+		return nil, err
+	}
+	if result.Code == nil {
+		return nil, &DecodeError{Err: errors.New("missing code"), Body: body}
+	}
+	return result, nil
+}
+
+func parseDepth(body []byte) (*Depth, error) {
+	var resp struct {
+		Asks JsonDepthEntries `json:"asks"`
+		Bids JsonDepthEntries `json:"bids"`
+	}
+	err := decodeResponse(body, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	depth := new(Depth)
+	if depth.AskList, err = resp.Asks.DepthRecords(); err != nil {
+		return nil, &DecodeError{Err: err, Body: body}
+	}
+	if depth.BidList, err = resp.Bids.DepthRecords(); err != nil {
+		return nil, &DecodeError{Err: err, Body: body}
+	}
+	return depth, nil
+}
+
+func parseTicker(body []byte) (*Ticker, error) {
+	var resp struct {
+		Date   JsonInt64 `json:"date"`
+		Ticker *struct {
+			Buy  JsonFloat64 `json:"buy"`
+			Sell JsonFloat64 `json:"sell"`
+			Last JsonFloat64 `json:"last"`
+			High JsonFloat64 `json:"high"`
+			Low  JsonFloat64 `json:"low"`
+			Vol  JsonFloat64 `json:"vol"`
+		} `json:"ticker"`
+	}
+	err := decodeResponse(body, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Ticker == nil {
+		return nil, &DecodeError{Err: errors.New("missing ticker"), Body: body}
+	}
+
+	ticker := new(Ticker)
+	ticker.Date = uint64(resp.Date) / 1000 //毫秒转为秒
+	ticker.Buy = float64(resp.Ticker.Buy)
+	ticker.Sell = float64(resp.Ticker.Sell)
+	ticker.Last = float64(resp.Ticker.Last)
+	ticker.High = float64(resp.Ticker.High)
+	ticker.Low = float64(resp.Ticker.Low)
+	ticker.Vol = float64(resp.Ticker.Vol)
+	return ticker, nil
+}
+
+func parseAccount(body []byte) (*Account, error) {
+	var resp struct {
+		Result *struct {
+			Balance map[string]struct {
+				Amount JsonFloat64 `json:"amount"`
+			} `json:"balance"`
+			Frozen map[string]struct {
+				Amount JsonFloat64 `json:"amount"`
+			} `json:"frozen"`
+			P2p         map[string]JsonFloat64 `json:"p2p"`
+			NetAssets   JsonFloat64            `json:"netAssets"`
+			TotalAssets JsonFloat64            `json:"totalAssets"`
+		} `json:"result"`
+	}
+	err := decodeResponse(body, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Result == nil {
+		return nil, &DecodeError{Err: errors.New("missing result"), Body: body}
+	}
+
+	acc := new(Account)
+	acc.Exchange = CHBTC
+	acc.SubAccounts = make(map[string]SubAccount)
+	acc.NetAsset = float64(resp.Result.NetAssets)
+	acc.Asset = float64(resp.Result.TotalAssets)
+	for t, v := range resp.Result.Balance {
+		subAcc := SubAccount{}
+		subAcc.Amount = float64(v.Amount)
+		subAcc.FrozenAmount = float64(resp.Result.Frozen[t].Amount)
+		subAcc.LoanAmount = float64(resp.Result.P2p[fmt.Sprintf("in%s", t)])
+		subAcc.Currency = t
+		acc.SubAccounts[subAcc.Currency] = subAcc
+	}
+	return acc, nil
+}
+
+func parseOneOrder(body []byte) (*Order, error) {
+	var orderResp chbtcOrder
+	err := decodeResponse(body, &orderResp)
+	if err != nil {
+		return nil, err
+	}
+	if orderResp.Id == "" {
+		return nil, &DecodeError{Err: errors.New("missing order id"), Body: body}
+	}
+	order := new(Order)
+	parseOrder(order, &orderResp)
+	return order, nil
+}
+
+//没有未完成订单时返回 code 3001, 当作空列表处理
+func parseOrders(body []byte) ([]Order, error) {
+	var ordersResp []chbtcOrder
+	err := decodeResponse(body, &ordersResp)
+	if apiErr, ok := err.(*ApiError); ok && apiErr.Code == strconv.Itoa(CODE_ORDER_NOT_FOUND) {
+		return []Order{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	orders := []Order{}
+	for i := range ordersResp {
+		order := Order{}
+		parseOrder(&order, &ordersResp[i])
+		orders = append(orders, order)
+	}
+	return orders, nil
+}
+
+func parseOrder(order *Order, orderResp *chbtcOrder) {
+	order.OrderID, _ = strconv.Atoi(orderResp.Id)
+	order.Amount = float64(orderResp.TotalAmount)
+	order.DealAmount = float64(orderResp.TradeAmount)
+	order.Price = float64(orderResp.Price)
+	order.Fee = float64(orderResp.Fees)
+	if order.DealAmount > 0 {
+		order.AvgPrice = float64(orderResp.TradeMoney) / order.DealAmount
+	} else {
+		order.AvgPrice = 0
+	}
+
+	order.OrderTime = int(orderResp.TradeDate)
+	switch orderResp.Type {
+	case 0:
+		order.Side = SELL
+	case 1:
+		order.Side = BUY
+	default:
+		DefaultLogger.Warn("unknown order type", "exchange", CHBTC, "type", orderResp.Type)
+	}
+
+	switch orderResp.Status {
+	case 0:
+		order.Status = ORDER_UNFINISHED
+	case 1:
+		order.Status = ORDER_CANCEL
+	case 2:
+		order.Status = ORDER_FINISH
+	case 3:
+		order.Status = ORDER_PART_FINISH
+	}
+}
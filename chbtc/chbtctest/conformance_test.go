@@ -0,0 +1,20 @@
+package chbtctest
+
+import (
+	"testing"
+
+	"github.com/qct/cryptocurrency-exchange-api/apitest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_ApiConformance(t *testing.T) {
+	s := NewServer("key", "secret")
+	defer s.Close()
+	s.SetPrice("btc_cny", 28000, 28010)
+	s.SetBalance("cny", 100000)
+	s.SetBalance("btc", 1)
+	api, err := s.Api()
+	assert.NoError(t, err)
+
+	apitest.TestApi(t, apitest.Config{Api: api, Pair: btcCny, Amount: 0.1, SafePwd: s.SafePwd})
+}
@@ -0,0 +1,337 @@
+//chbtc 行情接口和交易接口的本地模拟, 用于不访问网络地测试 ChbtcApi.
+//服务端保存余额、挂单和提现记录, 校验 accesskey/sign 的HmacMD5签名, 并要求reqTime严格递增.
+//行情由测试通过 SetPrice 设置, 价格变化时撮合挂单
+package chbtctest
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+	_ "github.com/qct/cryptocurrency-exchange-api/chbtc"
+)
+
+const (
+	MARKET_PATH = "/data/v1/"
+	TRADE_PATH  = "/api/"
+)
+
+//返回码, 与交易所一致
+const (
+	CODE_SUCCESS         = 1000
+	CODE_SIGN_FAILED     = 1003 //校验不通过
+	CODE_WRONG_SAFE_PWD  = 1005 //资金安全密码错误
+	CODE_CNY_NOT_ENOUGH  = 2001
+	CODE_BTC_NOT_ENOUGH  = 2002
+	CODE_LTC_NOT_ENOUGH  = 2003
+	CODE_ETH_NOT_ENOUGH  = 2005
+	CODE_NOT_ENOUGH      = 2009 //账户余额不足
+	CODE_ORDER_NOT_FOUND = 3001
+	CODE_INVALID_AMOUNT  = 3002
+	CODE_INVALID_PARAMS  = 3005
+	CODE_REQUEST_EXPIRED = 3007 //请求时间已失效
+)
+
+var messages = map[int]string{
+	CODE_SUCCESS:         "操作成功",
+	CODE_SIGN_FAILED:     "校验不通过",
+	CODE_WRONG_SAFE_PWD:  "资金安全密码错误",
+	CODE_NOT_ENOUGH:      "账户余额不足",
+	CODE_ORDER_NOT_FOUND: "挂单没有找到",
+	CODE_INVALID_AMOUNT:  "无效的金额",
+	CODE_INVALID_PARAMS:  "无效的参数",
+	CODE_REQUEST_EXPIRED: "请求时间已失效",
+}
+
+//每档默认挂单量, 模拟盘口外的流动性
+const DEFAULT_LIQUIDITY = 1000
+
+type Server struct {
+	*httptest.Server
+	ApiKey    string
+	SecretKey string
+	SafePwd   string           //提现和撤销提现的资金密码, 默认 123456
+	MakerFee  float64          //挂单成交的手续费率, 从买到的资产中扣除
+	TakerFee  float64          //吃单成交的手续费率
+	Now       func() time.Time //订单时间, 默认 time.Now
+
+	mu          sync.Mutex
+	nextId      int64
+	lastReqTime int64
+	markets     map[string]*market //btc_cny
+	available   map[string]float64 //btc、cny
+	frozen      map[string]float64
+	orders      []*order
+	withdrawals []*withdrawal
+}
+
+type market struct {
+	bid, ask  float64
+	last      float64
+	high, low float64
+	vol       float64
+}
+
+type order struct {
+	id         int64
+	currency   string //btc_cny: 用cny买卖btc
+	tradeType  int    //1:买 0:卖
+	price      float64
+	amount     float64
+	dealAmount float64
+	dealMoney  float64
+	fees       float64
+	date       int64 //毫秒
+	status     int   //0:未成交 1:取消 2:完全成交 3:部分成交
+}
+
+type withdrawal struct {
+	id       int64
+	currency string
+	address  string
+	amount   float64
+	fees     float64
+	canceled bool
+}
+
+//启动模拟服务, 只接受用apiKey/secretKey签名的请求
+func NewServer(apiKey, secretKey string) *Server {
+	s := &Server{
+		ApiKey:    apiKey,
+		SecretKey: secretKey,
+		SafePwd:   "123456",
+		MakerFee:  0.001,
+		TakerFee:  0.002,
+		Now:       time.Now,
+		nextId:    30000,
+		markets:   map[string]*market{},
+		available: map[string]float64{},
+		frozen:    map[string]float64{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+//通过注册表构建指向模拟服务的 ChbtcApi, 行情和交易接口都指向模拟服务
+func (s *Server) Api() (Api, error) {
+	driver, err := LookupApi(CHBTC)
+	if err != nil {
+		return nil, err
+	}
+	return driver.New(ApiConfig{HttpClient: s.Client(), ApiKey: s.ApiKey, ApiSecretKey: s.SecretKey, BaseUrl: s.URL})
+}
+
+//设置可用余额, currency 如 btc
+func (s *Server) SetBalance(currency string, amount float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.available[strings.ToLower(currency)] = amount
+}
+
+//可用和挂单、提现冻结的余额
+func (s *Server) Balance(currency string) (available, frozen float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	currency = strings.ToLower(currency)
+	return s.available[currency], s.frozen[currency]
+}
+
+//设置交易对(如 btc_cny)的买一卖一价, 并撮合价格已经到达的挂单
+func (s *Server) SetPrice(currency string, bid, ask float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.markets[currency]
+	if !ok {
+		m = &market{last: (bid + ask) / 2, high: ask, low: bid}
+		s.markets[currency] = m
+	}
+	m.bid, m.ask = bid, ask
+	for _, o := range s.orders {
+		if o.currency == currency && o.open() {
+			s.matchOrder(o, false)
+		}
+	}
+}
+
+func (s *Server) newId() int64 {
+	s.nextId++
+	return s.nextId
+}
+
+func (s *Server) nowMs() int64 {
+	return s.Now().UnixNano() / int64(time.Millisecond)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var resp interface{}
+	switch {
+	case strings.HasPrefix(r.URL.Path, MARKET_PATH) && r.Method == "GET":
+		handler, ok := marketHandlers[strings.TrimPrefix(r.URL.Path, MARKET_PATH)]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		resp = handler(s, r.URL.Query())
+	case strings.HasPrefix(r.URL.Path, TRADE_PATH) && r.Method == "POST":
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp = s.trade(strings.TrimPrefix(r.URL.Path, TRADE_PATH), string(body))
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+type handler func(s *Server, params url.Values) interface{}
+
+var marketHandlers = map[string]handler{
+	"ticker": (*Server).ticker,
+	"depth":  (*Server).depth,
+}
+
+//交易接口的路径和 method 参数相同; 成功时返回数据或 code 1000, 出错时返回 code 和 message
+var tradeHandlers = map[string]handler{
+	"order":                              (*Server).placeOrder,
+	"cancelOrder":                        (*Server).cancelOrder,
+	"getOrder":                           (*Server).getOrder,
+	"getUnfinishedOrdersIgnoreTradeType": (*Server).getUnfinishedOrders,
+	"getAccountInfo":                     (*Server).getAccountInfo,
+	"withdraw":                           (*Server).withdraw,
+	"cancelWithdraw":                     (*Server).cancelWithdraw,
+}
+
+func result(code int) map[string]interface{} {
+	return map[string]interface{}{"code": code, "message": messages[code]}
+}
+
+//签名是以secretKey的sha1为密钥, 对去掉 sign、reqTime 的参数串做HmacMD5; reqTime必须大于之前所有请求的reqTime
+func (s *Server) trade(method, body string) interface{} {
+	params, err := url.ParseQuery(body)
+	if err != nil || params.Get("method") != method {
+		return result(CODE_INVALID_PARAMS)
+	}
+	handler, ok := tradeHandlers[method]
+	if !ok {
+		return result(CODE_INVALID_PARAMS)
+	}
+
+	sign, reqTime := params.Get("sign"), params.Get("reqTime")
+	unsigned := url.Values{}
+	for k, v := range params {
+		if k != "sign" && k != "reqTime" {
+			unsigned[k] = v
+		}
+	}
+	secretSha := sha1.Sum([]byte(s.SecretKey))
+	mac := hmac.New(md5.New, []byte(hex.EncodeToString(secretSha[:])))
+	mac.Write([]byte(unsigned.Encode()))
+	if params.Get("accesskey") != s.ApiKey || !hmac.Equal([]byte(sign), []byte(hex.EncodeToString(mac.Sum(nil)))) {
+		return result(CODE_SIGN_FAILED)
+	}
+	t, err := strconv.ParseInt(reqTime, 10, 64)
+	if err != nil || t <= s.lastReqTime {
+		return result(CODE_REQUEST_EXPIRED)
+	}
+	s.lastReqTime = t
+	return handler(s, params)
+}
+
+func (s *Server) ticker(params url.Values) interface{} {
+	m, ok := s.markets[params.Get("currency")]
+	if !ok {
+		return result(CODE_INVALID_PARAMS)
+	}
+	return map[string]interface{}{
+		"date": fmt.Sprintf("%d", s.nowMs()),
+		"ticker": map[string]string{
+			"buy":  formatFloat(m.bid),
+			"sell": formatFloat(m.ask),
+			"last": formatFloat(m.last),
+			"high": formatFloat(m.high),
+			"low":  formatFloat(m.low),
+			"vol":  formatFloat(m.vol),
+		},
+	}
+}
+
+//asks和bids都按价格从高到低; 盘口之外是挂单量为 DEFAULT_LIQUIDITY 的买一卖一, 加上账户自己的挂单
+func (s *Server) depth(params url.Values) interface{} {
+	currency := params.Get("currency")
+	m, ok := s.markets[currency]
+	if !ok {
+		return result(CODE_INVALID_PARAMS)
+	}
+	asks := map[float64]float64{m.ask: DEFAULT_LIQUIDITY}
+	bids := map[float64]float64{m.bid: DEFAULT_LIQUIDITY}
+	for _, o := range s.orders {
+		if o.currency != currency || !o.open() {
+			continue
+		}
+		if o.tradeType == 1 {
+			bids[o.price] += o.amount - o.dealAmount
+		} else {
+			asks[o.price] += o.amount - o.dealAmount
+		}
+	}
+	size, err := strconv.Atoi(params.Get("size"))
+	if err != nil || size <= 0 {
+		size = 50
+	}
+
+	//卖单取最低的size档, 再按从高到低返回
+	askLevels := bookLevels(asks, size, false)
+	for i, j := 0, len(askLevels)-1; i < j; i, j = i+1, j-1 {
+		askLevels[i], askLevels[j] = askLevels[j], askLevels[i]
+	}
+	return map[string]interface{}{
+		"asks":      askLevels,
+		"bids":      bookLevels(bids, size, true),
+		"timestamp": s.Now().Unix(),
+	}
+}
+
+func bookLevels(levels map[float64]float64, size int, desc bool) [][]float64 {
+	prices := make([]float64, 0, len(levels))
+	for price := range levels {
+		prices = append(prices, price)
+	}
+	if desc {
+		sort.Sort(sort.Reverse(sort.Float64Slice(prices)))
+	} else {
+		sort.Float64s(prices)
+	}
+	if len(prices) > size {
+		prices = prices[:size]
+	}
+
+	entries := make([][]float64, 0, len(prices))
+	for _, price := range prices {
+		entries = append(entries, []float64{price, levels[price]})
+	}
+	return entries
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,133 @@
+package chbtctest
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+	"github.com/qct/cryptocurrency-exchange-api/chbtc"
+	"github.com/stretchr/testify/assert"
+)
+
+var btcCny = NewCurrencyPair("BTC", "CNY")
+
+func assertErrorCode(t *testing.T, err error, code int) {
+	var apiErr *ApiError
+	if assert.True(t, errors.As(err, &apiErr), "expected ApiError, got %v", err) {
+		assert.Equal(t, fmt.Sprintf("%d", code), apiErr.Code, apiErr.Message)
+	}
+}
+
+//每次都返回同一个值, 用来模拟reqTime重复
+type fixedNonce int64
+
+func (n fixedNonce) Next(min int64) (int64, error) {
+	return int64(n), nil
+}
+
+func TestServer_Trading(t *testing.T) {
+	s := NewServer("key", "secret")
+	defer s.Close()
+	s.SetPrice("btc_cny", 28000, 28010)
+	s.SetBalance("cny", 10000)
+	api, err := s.Api()
+	assert.NoError(t, err)
+
+	//卖单按从低到高返回
+	depth, err := api.GetDepth(btcCny, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, DepthRecords{{Price: 28010, Amount: DEFAULT_LIQUIDITY}}, depth.AskList)
+
+	//低于卖一的买单挂在盘口上, 冻结cny
+	order, err := api.LimitBuy("0.2", "27000", btcCny)
+	assert.NoError(t, err)
+	available, frozen := s.Balance("cny")
+	assert.InDelta(t, 4600, available, 1e-9)
+	assert.InDelta(t, 5400, frozen, 1e-9)
+	unfinished, err := api.GetUnfinishedOrders(btcCny)
+	assert.NoError(t, err)
+	if assert.Len(t, unfinished, 1) {
+		assert.Equal(t, order.OrderID, unfinished[0].OrderID)
+	}
+
+	//价格穿过挂单后按挂单价成交, 扣挂单手续费
+	s.SetPrice("btc_cny", 26500, 26900)
+	filled, err := api.GetOneOrder(fmtId(order), btcCny)
+	assert.NoError(t, err)
+	assert.Equal(t, TradeStatus(ORDER_FINISH), filled.Status)
+	assert.Equal(t, 0.2, filled.DealAmount)
+	assert.Equal(t, 27000.0, filled.AvgPrice)
+	available, _ = s.Balance("btc")
+	assert.InDelta(t, 0.2*(1-s.MakerFee), available, 1e-9)
+	_, frozen = s.Balance("cny")
+	assert.InDelta(t, 0, frozen, 1e-9)
+
+	//没有未完成订单时交易所返回 3001, 适配器当作空列表
+	unfinished, err = api.GetUnfinishedOrders(btcCny)
+	assert.NoError(t, err)
+	assert.Empty(t, unfinished)
+
+	_, err = api.LimitSell("1", "26000", btcCny)
+	assertErrorCode(t, err, CODE_BTC_NOT_ENOUGH)
+	_, err = api.LimitBuy("1", "0", btcCny)
+	assertErrorCode(t, err, CODE_INVALID_AMOUNT)
+}
+
+func TestServer_Withdraw(t *testing.T) {
+	s := NewServer("key", "secret")
+	defer s.Close()
+	s.SetBalance("btc", 1)
+	api, err := s.Api()
+	assert.NoError(t, err)
+	ch := api.(*chbtc.ChbtcApi)
+
+	_, err = ch.Withdraw("0.5", "btc", "0.001", "1BoatSLRHtKNngkdXEeobR76b53LETtpyT", "", "wrong")
+	assertErrorCode(t, err, CODE_WRONG_SAFE_PWD)
+	_, err = ch.Withdraw("2", "btc", "0.001", "1BoatSLRHtKNngkdXEeobR76b53LETtpyT", "", s.SafePwd)
+	assertErrorCode(t, err, CODE_BTC_NOT_ENOUGH)
+
+	id, err := ch.Withdraw("0.5", "btc", "0.001", "1BoatSLRHtKNngkdXEeobR76b53LETtpyT", "", s.SafePwd)
+	assert.NoError(t, err)
+	available, frozen := s.Balance("btc")
+	assert.InDelta(t, 0.499, available, 1e-9)
+	assert.InDelta(t, 0.501, frozen, 1e-9)
+
+	ok, err := ch.CancelWithdraw(id, "btc", s.SafePwd)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	available, frozen = s.Balance("btc")
+	assert.InDelta(t, 1, available, 1e-9)
+	assert.InDelta(t, 0, frozen, 1e-9)
+
+	//已撤销的提现不能再撤销
+	_, err = ch.CancelWithdraw(id, "btc", s.SafePwd)
+	assertErrorCode(t, err, CODE_INVALID_PARAMS)
+}
+
+func TestServer_VerifySignature(t *testing.T) {
+	s := NewServer("key", "secret")
+	defer s.Close()
+	s.SetBalance("cny", 1)
+	driver, err := LookupApi(CHBTC)
+	assert.NoError(t, err)
+
+	api, err := driver.New(ApiConfig{HttpClient: s.Client(), ApiKey: "key", ApiSecretKey: "wrong", BaseUrl: s.URL})
+	assert.NoError(t, err)
+	_, err = api.GetAccount()
+	assertErrorCode(t, err, CODE_SIGN_FAILED)
+	assert.Equal(t, ErrorKind(ERR_KIND_AUTH), ClassifyError(err))
+
+	//重复的reqTime被拒绝
+	api, err = driver.New(ApiConfig{HttpClient: s.Client(), ApiKey: "key", ApiSecretKey: "secret", BaseUrl: s.URL, Nonce: fixedNonce(1)})
+	assert.NoError(t, err)
+	acc, err := api.GetAccount()
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, acc.SubAccounts["CNY"].Amount)
+	_, err = api.GetAccount()
+	assertErrorCode(t, err, CODE_REQUEST_EXPIRED)
+}
+
+func fmtId(order *Order) string {
+	return fmt.Sprintf("%d", order.OrderID)
+}
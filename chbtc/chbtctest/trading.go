@@ -0,0 +1,281 @@
+package chbtctest
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+//比较金额时容忍的浮点误差
+const epsilon = 1e-9
+
+//btc_cny => btc(交易的币), cny(计价)
+func splitCurrency(currency string) (coin, money string) {
+	i := strings.Index(currency, "_")
+	if i < 0 {
+		return currency, ""
+	}
+	return currency[:i], currency[i+1:]
+}
+
+//各币种余额不足的返回码
+func notEnough(currency string) int {
+	switch currency {
+	case "cny":
+		return CODE_CNY_NOT_ENOUGH
+	case "btc":
+		return CODE_BTC_NOT_ENOUGH
+	case "ltc":
+		return CODE_LTC_NOT_ENOUGH
+	case "eth":
+		return CODE_ETH_NOT_ENOUGH
+	}
+	return CODE_NOT_ENOUGH
+}
+
+func parseAmount(params url.Values, name string) (float64, bool) {
+	amount, err := strconv.ParseFloat(params.Get(name), 64)
+	return amount, err == nil && amount > 0
+}
+
+func (o *order) open() bool {
+	return o.status == 0 || o.status == 3
+}
+
+func (o *order) json() map[string]interface{} {
+	return map[string]interface{}{
+		"currency":     o.currency,
+		"id":           fmt.Sprintf("%d", o.id),
+		"type":         o.tradeType,
+		"price":        o.price,
+		"total_amount": o.amount,
+		"trade_amount": o.dealAmount,
+		"trade_money":  o.dealMoney,
+		"fees":         o.fees,
+		"trade_date":   o.date,
+		"status":       o.status,
+	}
+}
+
+//冻结资金后立即按盘口撮合, 没成交的挂在服务端等 SetPrice
+func (s *Server) placeOrder(params url.Values) interface{} {
+	currency := params.Get("currency")
+	if _, ok := s.markets[currency]; !ok {
+		return result(CODE_INVALID_PARAMS)
+	}
+	tradeType, err := strconv.Atoi(params.Get("tradeType"))
+	if err != nil || (tradeType != 0 && tradeType != 1) {
+		return result(CODE_INVALID_PARAMS)
+	}
+	price, ok := parseAmount(params, "price")
+	if !ok {
+		return result(CODE_INVALID_AMOUNT)
+	}
+	amount, ok := parseAmount(params, "amount")
+	if !ok {
+		return result(CODE_INVALID_AMOUNT)
+	}
+
+	coin, money := splitCurrency(currency)
+	if tradeType == 1 {
+		if s.available[money]+epsilon < price*amount {
+			return result(notEnough(money))
+		}
+		s.available[money] -= price * amount
+		s.frozen[money] += price * amount
+	} else {
+		if s.available[coin]+epsilon < amount {
+			return result(notEnough(coin))
+		}
+		s.available[coin] -= amount
+		s.frozen[coin] += amount
+	}
+
+	o := &order{id: s.newId(), currency: currency, tradeType: tradeType, price: price, amount: amount, date: s.nowMs()}
+	s.orders = append(s.orders, o)
+	s.matchOrder(o, true)
+	resp := result(CODE_SUCCESS)
+	resp["id"] = fmt.Sprintf("%d", o.id)
+	return resp
+}
+
+//taker为true时是新下的单, 按对手价成交并收 TakerFee; 否则是挂单被价格穿过, 按挂单价成交并收 MakerFee.
+//手续费从买到的资产中扣除, 挂单全部成交
+func (s *Server) matchOrder(o *order, taker bool) {
+	m := s.markets[o.currency]
+	price, fee := o.price, s.MakerFee
+	remaining := o.amount - o.dealAmount
+	coin, money := splitCurrency(o.currency)
+	switch {
+	case o.tradeType == 1 && m.ask > 0 && o.price >= m.ask:
+		if taker {
+			price, fee = m.ask, s.TakerFee
+		}
+		s.frozen[money] -= o.price * remaining
+		s.available[money] += (o.price - price) * remaining
+		s.available[coin] += remaining * (1 - fee)
+		o.fees += remaining * fee
+	case o.tradeType == 0 && m.bid > 0 && o.price <= m.bid:
+		if taker {
+			price, fee = m.bid, s.TakerFee
+		}
+		s.frozen[coin] -= remaining
+		s.available[money] += price * remaining * (1 - fee)
+		o.fees += price * remaining * fee
+	default:
+		return
+	}
+
+	o.dealAmount += remaining
+	o.dealMoney += price * remaining
+	o.status = 2
+	m.last = price
+	if price > m.high {
+		m.high = price
+	}
+	if price < m.low {
+		m.low = price
+	}
+	m.vol += remaining
+}
+
+func (s *Server) findOrder(params url.Values) *order {
+	for _, o := range s.orders {
+		if fmt.Sprintf("%d", o.id) == params.Get("id") && o.currency == params.Get("currency") {
+			return o
+		}
+	}
+	return nil
+}
+
+//撤单后解冻未成交部分
+func (s *Server) cancelOrder(params url.Values) interface{} {
+	o := s.findOrder(params)
+	if o == nil || !o.open() {
+		return result(CODE_ORDER_NOT_FOUND)
+	}
+	remaining := o.amount - o.dealAmount
+	coin, money := splitCurrency(o.currency)
+	if o.tradeType == 1 {
+		s.frozen[money] -= o.price * remaining
+		s.available[money] += o.price * remaining
+	} else {
+		s.frozen[coin] -= remaining
+		s.available[coin] += remaining
+	}
+	o.status = 1
+	return result(CODE_SUCCESS)
+}
+
+func (s *Server) getOrder(params url.Values) interface{} {
+	o := s.findOrder(params)
+	if o == nil {
+		return result(CODE_ORDER_NOT_FOUND)
+	}
+	return o.json()
+}
+
+//没有未完成订单时与交易所一样返回 code 3001
+func (s *Server) getUnfinishedOrders(params url.Values) interface{} {
+	currency := params.Get("currency")
+	if _, ok := s.markets[currency]; !ok {
+		return result(CODE_INVALID_PARAMS)
+	}
+	orders := []map[string]interface{}{}
+	for _, o := range s.orders {
+		if o.currency == currency && o.open() {
+			orders = append(orders, o.json())
+		}
+	}
+	if len(orders) == 0 {
+		return result(CODE_ORDER_NOT_FOUND)
+	}
+	return orders
+}
+
+//币种为大写; 总资产和净资产按 xxx_cny 的最新成交价折算成cny
+func (s *Server) getAccountInfo(params url.Values) interface{} {
+	currencies := map[string]bool{}
+	for _, balances := range []map[string]float64{s.available, s.frozen} {
+		for currency := range balances {
+			currencies[currency] = true
+		}
+	}
+
+	balance, frozen, p2p := map[string]interface{}{}, map[string]interface{}{}, map[string]interface{}{}
+	total := 0.0
+	for currency := range currencies {
+		symbol := strings.ToUpper(currency)
+		balance[symbol] = map[string]interface{}{"amount": s.available[currency], "currency": symbol}
+		frozen[symbol] = map[string]interface{}{"amount": s.frozen[currency], "currency": symbol}
+		p2p["in"+symbol], p2p["out"+symbol] = 0, 0
+
+		amount := s.available[currency] + s.frozen[currency]
+		if currency == "cny" {
+			total += amount
+		} else if m, ok := s.markets[currency+"_cny"]; ok {
+			total += amount * m.last
+		}
+	}
+	return map[string]interface{}{
+		"result": map[string]interface{}{
+			"balance":     balance,
+			"frozen":      frozen,
+			"p2p":         p2p,
+			"netAssets":   total,
+			"totalAssets": total,
+		},
+	}
+}
+
+//提现冻结数量和手续费, 撤销前一直处于待处理状态
+func (s *Server) withdraw(params url.Values) interface{} {
+	currency := params.Get("currency")
+	address := params.Get("receiveAddr")
+	if currency == "" || address == "" {
+		return result(CODE_INVALID_PARAMS)
+	}
+	if params.Get("safePwd") != s.SafePwd {
+		return result(CODE_WRONG_SAFE_PWD)
+	}
+	amount, ok := parseAmount(params, "amount")
+	if !ok {
+		return result(CODE_INVALID_AMOUNT)
+	}
+	fees, err := strconv.ParseFloat(params.Get("fees"), 64)
+	if err != nil || fees < 0 {
+		return result(CODE_INVALID_AMOUNT)
+	}
+	if s.available[currency]+epsilon < amount+fees {
+		return result(notEnough(currency))
+	}
+	s.available[currency] -= amount + fees
+	s.frozen[currency] += amount + fees
+
+	w := &withdrawal{id: s.newId(), currency: currency, address: address, amount: amount, fees: fees}
+	s.withdrawals = append(s.withdrawals, w)
+	resp := result(CODE_SUCCESS)
+	resp["id"] = fmt.Sprintf("%d", w.id)
+	return resp
+}
+
+//退回提现冻结的数量和手续费
+func (s *Server) cancelWithdraw(params url.Values) interface{} {
+	if params.Get("safePwd") != s.SafePwd {
+		return result(CODE_WRONG_SAFE_PWD)
+	}
+	for _, w := range s.withdrawals {
+		if fmt.Sprintf("%d", w.id) != params.Get("downloadId") || w.currency != params.Get("currency") {
+			continue
+		}
+		if w.canceled {
+			break
+		}
+		w.canceled = true
+		s.frozen[w.currency] -= w.amount + w.fees
+		s.available[w.currency] += w.amount + w.fees
+		return result(CODE_SUCCESS)
+	}
+	return result(CODE_INVALID_PARAMS)
+}
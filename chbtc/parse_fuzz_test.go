@@ -0,0 +1,63 @@
+package chbtc
+
+import "testing"
+
+func FuzzParseDepth(f *testing.F) {
+	f.Add([]byte(`{"asks":[[3848.5,0.1],[3847.19,0.02]],"bids":[[3826.94,0.2],[3826.2,1.5]],"timestamp":1472800466}`))
+	f.Add([]byte(`{"code":3005,"message":"bad params"}`))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		depth, err := parseDepth(body)
+		if err == nil && depth == nil {
+			t.Fatal("nil depth without error")
+		}
+	})
+}
+
+func FuzzParseTicker(f *testing.F) {
+	f.Add([]byte(`{"date":"1472800466093","ticker":{"buy":"3826.94","high":"3838.22","last":"3826.94","low":"3802.0","sell":"3828.25","vol":"90151.83"}}`))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		ticker, err := parseTicker(body)
+		if err == nil && ticker == nil {
+			t.Fatal("nil ticker without error")
+		}
+	})
+}
+
+func FuzzParseAccount(f *testing.F) {
+	f.Add([]byte(`{"result":{"balance":{"BTC":{"amount":1.5,"currency":"BTC"},"CNY":{"amount":"1000","currency":"CNY"}},"frozen":{"BTC":{"amount":0.5}},"p2p":{"inBTC":0,"inCNY":10},"netAssets":1000,"totalAssets":1010}}`))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		account, err := parseAccount(body)
+		if err == nil && account == nil {
+			t.Fatal("nil account without error")
+		}
+	})
+}
+
+func FuzzParseOneOrder(f *testing.F) {
+	f.Add([]byte(`{"currency":"btc","id":"20150928158614292","price":1560,"status":3,"total_amount":0.1,"trade_amount":0.05,"trade_date":1443410396717,"trade_money":78,"type":0,"fees":0}`))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		order, err := parseOneOrder(body)
+		if err == nil && order == nil {
+			t.Fatal("nil order without error")
+		}
+	})
+}
+
+func FuzzParseOrders(f *testing.F) {
+	f.Add([]byte(`[{"currency":"btc","id":"20150928158614292","price":1560,"status":0,"total_amount":0.1,"trade_amount":0,"trade_date":1443410396717,"trade_money":0,"type":1}]`))
+	f.Add([]byte(`{"code":3001,"message":"挂单没有找到"}`))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		parseOrders(body)
+	})
+}
+
+func FuzzParseResult(f *testing.F) {
+	f.Add([]byte(`{"code":1000,"message":"操作成功","id":"20131211109"}`))
+	f.Add([]byte(`{"code":2002,"message":"BTC余额不足"}`))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		result, err := parseResult(body)
+		if err == nil && result == nil {
+			t.Fatal("nil result without error")
+		}
+	})
+}
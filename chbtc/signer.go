@@ -0,0 +1,42 @@
+package chbtc
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+)
+
+//chbtc: 以secretKey的sha1作为密钥对参数串做HmacMD5; reqTime(毫秒)不参与签名, 但服务端要求递增
+type ApiSigner struct {
+	Credentials CredentialProvider
+	Nonce       NonceProvider //为nil时直接使用时间戳
+}
+
+func (s *ApiSigner) Sign(method, path string, params url.Values, timestamp time.Time) (*SignedRequest, error) {
+	credentials, err := s.Credentials.Credentials()
+	if err != nil {
+		return nil, err
+	}
+	signed := CopyValues(params)
+	signed.Set("accesskey", credentials.ApiKey)
+	payload := signed.Encode()
+	secretKeySha, err := GetSHA(credentials.ApiSecretKey)
+	if err != nil {
+		return nil, err
+	}
+	sign, err := GetParamHmacMD5Sign(secretKeySha, payload)
+	if err != nil {
+		return nil, err
+	}
+	reqTime := timestamp.UnixNano() / int64(time.Millisecond)
+	if s.Nonce != nil {
+		if reqTime, err = s.Nonce.Next(reqTime); err != nil {
+			return nil, err
+		}
+	}
+	signed.Set("sign", sign)
+	signed.Set("reqTime", fmt.Sprintf("%d", reqTime))
+	return &SignedRequest{Params: signed}, nil
+}
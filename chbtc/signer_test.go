@@ -0,0 +1,27 @@
+package chbtc
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+	"github.com/stretchr/testify/assert"
+)
+
+//CHBTC 的文档只有签名的示例代码, 没有公布签名结果. 这里按文档的步骤(sha1(secretKey) 作为密钥,
+//对 accesskey 在前的参数串做 HmacMD5)断言, sha1 和 HmacMD5 由 sign_util_test 中公布的向量验证
+func TestApiSigner_Sign(t *testing.T) {
+	params := url.Values{}
+	params.Set("method", "getAccountInfo")
+
+	signer := &ApiSigner{Credentials: StaticCredentials{ApiKey: "key", ApiSecretKey: "secret"}}
+	signed, err := signer.Sign("POST", "/api/getAccountInfo", params, time.Unix(1500000000, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, "key", signed.Params.Get("accesskey"))
+	secretSha, _ := GetSHA("secret")
+	expected, _ := GetParamHmacMD5Sign(secretSha, "accesskey=key&method=getAccountInfo")
+	assert.Equal(t, expected, signed.Params.Get("sign"))
+	assert.Equal(t, "1500000000000", signed.Params.Get("reqTime"))
+	assert.Empty(t, params.Get("sign"), "params must not be modified")
+}
@@ -0,0 +1,209 @@
+package coinapi
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+//时间源, 签名器用它给请求打时间戳
+type Clock interface {
+	Now() time.Time
+}
+
+type localClock struct{}
+
+func (localClock) Now() time.Time {
+	return time.Now()
+}
+
+var LocalClock Clock = localClock{}
+
+//获取交易所服务端当前时间
+type ServerTimeFunc func() (time.Time, error)
+
+//以交易所服务端时间为准的时钟, Now() = 本地时间 + 最近一次同步测得的偏移
+type ServerClock struct {
+	fetch ServerTimeFunc
+
+	mu       sync.RWMutex
+	offset   time.Duration
+	rtt      time.Duration
+	lastSync time.Time
+	lastErr  error
+	stop     chan struct{}
+}
+
+func NewServerClock(fetch ServerTimeFunc) *ServerClock {
+	return &ServerClock{fetch: fetch}
+}
+
+func (c *ServerClock) Now() time.Time {
+	return time.Now().Add(c.Offset())
+}
+
+//服务端时间 - 本地时间
+func (c *ServerClock) Offset() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.offset
+}
+
+//最近一次同步请求的往返耗时
+func (c *ServerClock) RTT() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.rtt
+}
+
+//最近一次同步成功的本地时间, 从未同步成功时为零值
+func (c *ServerClock) LastSync() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lastSync
+}
+
+//最近一次同步的错误, 同步成功后为nil. Start 在后台同步时通过它检查同步是否失败
+func (c *ServerClock) LastError() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lastErr
+}
+
+//测一次偏移, 假设服务端时间取自请求往返的中点
+func (c *ServerClock) Sync() error {
+	start := time.Now()
+	server, err := c.fetch()
+	if err != nil {
+		c.mu.Lock()
+		c.lastErr = err
+		c.mu.Unlock()
+		return err
+	}
+	end := time.Now()
+	rtt := end.Sub(start)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.offset = server.Sub(start.Add(rtt / 2))
+	c.rtt = rtt
+	c.lastSync = end
+	c.lastErr = nil
+	return nil
+}
+
+//立即同步一次, 之后每隔interval在后台同步; 已经在运行时不做任何事.
+//同步失败时保留上一次的偏移, 错误可通过 LastError 获取
+func (c *ServerClock) Start(interval time.Duration) {
+	c.mu.Lock()
+	if c.stop != nil {
+		c.mu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	c.stop = stop
+	c.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			c.Sync()
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func (c *ServerClock) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+}
+
+//只精确到秒的服务端时间(响应头 Date、ticker 的 date 等)取这一秒的中点, 补上平均被截掉的半秒
+func MidSecond(t time.Time) time.Time {
+	return t.Truncate(time.Second).Add(500 * time.Millisecond)
+}
+
+//没有专门的时间接口时, 用响应头 Date 作为服务端时间
+func HttpDateServerTime(client *http.Client, reqUrl string) ServerTimeFunc {
+	return func() (time.Time, error) {
+		resp, err := client.Get(reqUrl)
+		if err != nil {
+			return time.Time{}, err
+		}
+		resp.Body.Close()
+		date := resp.Header.Get("Date")
+		if date == "" {
+			return time.Time{}, errors.New("missing Date header")
+		}
+		t, err := http.ParseTime(date)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return MidSecond(t), nil
+	}
+}
+
+var (
+	serverClocksMu sync.Mutex
+	serverClocks   = map[string]*ServerClock{}
+)
+
+//服务端时钟按交易所和 BaseUrl 区分, 指向模拟服务的api不会和真实交易所共用一个时钟
+func serverClockKey(exchange, baseUrl string) string {
+	if baseUrl == "" {
+		return exchange
+	}
+	return exchange + "|" + baseUrl
+}
+
+//每个交易所、每个 BaseUrl(为空时为交易所的默认地址)一个服务端时钟, 已存在时忽略fetch
+func SharedServerClock(exchange, baseUrl string, fetch ServerTimeFunc) *ServerClock {
+	key := serverClockKey(exchange, baseUrl)
+	serverClocksMu.Lock()
+	defer serverClocksMu.Unlock()
+	if c, ok := serverClocks[key]; ok {
+		return c
+	}
+	c := NewServerClock(fetch)
+	serverClocks[key] = c
+	return c
+}
+
+//交易所的时钟, 没有注册服务端时钟时使用本地时间.
+//每次取时间时才查找, api 构建之后才注册的服务端时钟也能生效
+func ExchangeClock(exchange, baseUrl string) Clock {
+	return exchangeClock(serverClockKey(exchange, baseUrl))
+}
+
+type exchangeClock string
+
+func (key exchangeClock) Now() time.Time {
+	serverClocksMu.Lock()
+	c, ok := serverClocks[string(key)]
+	serverClocksMu.Unlock()
+	if !ok {
+		return time.Now()
+	}
+	return c.Now()
+}
+
+//所有已注册的服务端时钟, key 为交易所名称, 指定了 BaseUrl 的为 交易所|BaseUrl. 用于监控偏移和往返耗时
+func ServerClocks() map[string]*ServerClock {
+	serverClocksMu.Lock()
+	defer serverClocksMu.Unlock()
+	clocks := make(map[string]*ServerClock, len(serverClocks))
+	for k, v := range serverClocks {
+		clocks[k] = v
+	}
+	return clocks
+}
@@ -0,0 +1,82 @@
+package coinapi
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerClock_Sync(t *testing.T) {
+	clock := NewServerClock(func() (time.Time, error) {
+		time.Sleep(10 * time.Millisecond)
+		return time.Now().Add(3 * time.Second), nil
+	})
+	assert.NoError(t, clock.Sync())
+	assert.InDelta(t, float64(3*time.Second), float64(clock.Offset()), float64(50*time.Millisecond))
+	assert.True(t, clock.RTT() >= 10*time.Millisecond)
+	assert.InDelta(t, float64(time.Now().Add(3*time.Second).UnixNano()), float64(clock.Now().UnixNano()), float64(50*time.Millisecond))
+}
+
+func TestHttpDateServerTime(t *testing.T) {
+	serverTime := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", serverTime.Format(http.TimeFormat))
+	}))
+	defer ts.Close()
+
+	now, err := HttpDateServerTime(ts.Client(), ts.URL)()
+	assert.NoError(t, err)
+	assert.Equal(t, serverTime.Add(500*time.Millisecond), now)
+}
+
+func TestMidSecond(t *testing.T) {
+	second := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.Equal(t, second.Add(500*time.Millisecond), MidSecond(second))
+	//已经带毫秒的时间先截到整秒
+	assert.Equal(t, second.Add(500*time.Millisecond), MidSecond(second.Add(900*time.Millisecond)))
+}
+
+func TestServerClock_LastError(t *testing.T) {
+	var fail int32 = 1
+	clock := NewServerClock(func() (time.Time, error) {
+		if atomic.LoadInt32(&fail) == 1 {
+			return time.Time{}, errors.New("unreachable")
+		}
+		return time.Now(), nil
+	})
+	clock.Start(5 * time.Millisecond)
+	defer clock.Stop()
+	time.Sleep(20 * time.Millisecond)
+	assert.EqualError(t, clock.LastError(), "unreachable")
+	assert.True(t, clock.LastSync().IsZero())
+
+	atomic.StoreInt32(&fail, 0)
+	assert.NoError(t, clock.Sync())
+	assert.NoError(t, clock.LastError())
+}
+
+//不同 BaseUrl 的时钟各自同步, 已经构建的api在时钟注册后也使用它
+func TestSharedServerClock_BaseUrl(t *testing.T) {
+	exchange := "clock_test"
+	before := ExchangeClock(exchange, "http://127.0.0.1:1")
+	mock := SharedServerClock(exchange, "http://127.0.0.1:1", func() (time.Time, error) {
+		return time.Now().Add(time.Hour), nil
+	})
+	real := SharedServerClock(exchange, "", func() (time.Time, error) {
+		return time.Now(), nil
+	})
+	assert.True(t, mock != real)
+	assert.True(t, mock == SharedServerClock(exchange, "http://127.0.0.1:1", nil))
+	assert.NoError(t, mock.Sync())
+	assert.NoError(t, real.Sync())
+
+	assert.InDelta(t, float64(time.Hour), float64(before.Now().Sub(time.Now())), float64(time.Second))
+	assert.InDelta(t, 0, float64(ExchangeClock(exchange, "").Now().Sub(time.Now())), float64(time.Second))
+	assert.InDelta(t, 0, float64(ExchangeClock("clock_test_unknown", "").Now().Sub(time.Now())), float64(time.Second))
+	assert.Contains(t, ServerClocks(), exchange+"|http://127.0.0.1:1")
+}
@@ -94,3 +94,27 @@ func StringToTradeSide(s string) TradeSide {
 		return UNKNOWN
 	}
 }
+
+const (
+	ACCOUNT_SPOT    = 1 + iota //币币账户
+	ACCOUNT_MARGIN             //杠杆账户
+	ACCOUNT_FUTURES            //合约账户
+	ACCOUNT_LENDING            //借贷账户
+)
+
+type AccountType int
+
+func (at AccountType) String() string {
+	switch at {
+	case ACCOUNT_SPOT:
+		return "SPOT"
+	case ACCOUNT_MARGIN:
+		return "MARGIN"
+	case ACCOUNT_FUTURES:
+		return "FUTURES"
+	case ACCOUNT_LENDING:
+		return "LENDING"
+	default:
+		return "UNKNOWN"
+	}
+}
@@ -0,0 +1,82 @@
+package coinapi
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+type Credentials struct {
+	ApiKey       string `json:"api_key"`
+	ApiSecretKey string `json:"api_secret_key"`
+}
+
+//签名器每次签名都会调用 Credentials(), 实现可以随时返回新的key, 实现密钥轮换而不用重建api
+type CredentialProvider interface {
+	Credentials() (Credentials, error)
+}
+
+//固定的key
+type StaticCredentials Credentials
+
+func (c StaticCredentials) Credentials() (Credentials, error) {
+	return Credentials(c), nil
+}
+
+type envCredentials struct {
+	keyVar, secretVar string
+}
+
+//每次从环境变量读取
+func EnvCredentials(keyVar, secretVar string) CredentialProvider {
+	return envCredentials{keyVar, secretVar}
+}
+
+func (e envCredentials) Credentials() (Credentials, error) {
+	key, ok := os.LookupEnv(e.keyVar)
+	if !ok {
+		return Credentials{}, fmt.Errorf("environment variable %s is not set", e.keyVar)
+	}
+	secret, ok := os.LookupEnv(e.secretVar)
+	if !ok {
+		return Credentials{}, fmt.Errorf("environment variable %s is not set", e.secretVar)
+	}
+	return Credentials{key, secret}, nil
+}
+
+//从json文件读取 {"api_key": "...", "api_secret_key": "..."}, 文件修改后自动重新加载.
+//每次都读取文件, 按内容的哈希判断是否修改过, 修改时间精度内的同长度改写也能发现
+type FileCredentials struct {
+	file string
+
+	mu     sync.Mutex
+	hash   [sha256.Size]byte
+	cached *Credentials
+}
+
+func NewFileCredentials(file string) *FileCredentials {
+	return &FileCredentials{file: file}
+}
+
+func (f *FileCredentials) Credentials() (Credentials, error) {
+	data, err := ioutil.ReadFile(f.file)
+	if err != nil {
+		return Credentials{}, err
+	}
+	hash := sha256.Sum256(data)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.cached != nil && hash == f.hash {
+		return *f.cached, nil
+	}
+	var credentials Credentials
+	if err := json.Unmarshal(data, &credentials); err != nil {
+		return Credentials{}, fmt.Errorf("invalid credentials file %s: %v", f.file, err)
+	}
+	f.cached, f.hash = &credentials, hash
+	return credentials, nil
+}
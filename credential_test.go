@@ -0,0 +1,31 @@
+package coinapi
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//同样长度、同样修改时间的改写也要重新加载
+func TestFileCredentials_Reload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "credentials.json")
+	assert.NoError(t, os.WriteFile(file, []byte(`{"api_key":"key1","api_secret_key":"secret1"}`), 0600))
+	info, _ := os.Stat(file)
+
+	provider := NewFileCredentials(file)
+	credentials, err := provider.Credentials()
+	assert.NoError(t, err)
+	assert.Equal(t, Credentials{"key1", "secret1"}, credentials)
+
+	assert.NoError(t, os.WriteFile(file, []byte(`{"api_key":"key2","api_secret_key":"secret2"}`), 0600))
+	assert.NoError(t, os.Chtimes(file, info.ModTime(), info.ModTime()))
+	credentials, err = provider.Credentials()
+	assert.NoError(t, err)
+	assert.Equal(t, Credentials{"key2", "secret2"}, credentials)
+
+	assert.NoError(t, os.WriteFile(file, []byte(`{"api_key":`), 0600))
+	_, err = provider.Credentials()
+	assert.Error(t, err)
+}
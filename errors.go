@@ -0,0 +1,117 @@
+package coinapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+)
+
+const (
+	ERR_KIND_UNKNOWN            = iota
+	ERR_KIND_NETWORK            //连接失败、超时、连接被重置
+	ERR_KIND_SERVER             //交易所5xx
+	ERR_KIND_RATE_LIMIT         //触发限频
+	ERR_KIND_AUTH               //apiKey错误、签名错误、权限不足
+	ERR_KIND_INSUFFICIENT_FUNDS //余额不足
+	ERR_KIND_INVALID_REQUEST    //参数错误、订单不存在等
+	ERR_KIND_UNSUPPORTED        //交易所没有提供对应的接口
+)
+
+type ErrorKind int
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ERR_KIND_NETWORK:
+		return "NETWORK"
+	case ERR_KIND_SERVER:
+		return "SERVER"
+	case ERR_KIND_RATE_LIMIT:
+		return "RATE_LIMIT"
+	case ERR_KIND_AUTH:
+		return "AUTH"
+	case ERR_KIND_INSUFFICIENT_FUNDS:
+		return "INSUFFICIENT_FUNDS"
+	case ERR_KIND_INVALID_REQUEST:
+		return "INVALID_REQUEST"
+	case ERR_KIND_UNSUPPORTED:
+		return "UNSUPPORTED"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+//交易所返回的业务错误
+type ApiError struct {
+	Exchange string
+	Kind     ErrorKind
+	Code     string
+	Message  string
+}
+
+func (e *ApiError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s: error code %s (%s)", e.Exchange, e.Code, e.Kind)
+	}
+	return fmt.Sprintf("%s: error code %s (%s): %s", e.Exchange, e.Code, e.Kind, Redact(e.Message))
+}
+
+//适配器不支持的方法返回的错误, 不发出请求
+func NewUnsupportedError(exchange, method string) error {
+	return &ApiError{Exchange: exchange, Kind: ERR_KIND_UNSUPPORTED, Message: method + " is not supported"}
+}
+
+//错误分类, 未能识别的错误归为 ERR_KIND_UNKNOWN
+func ClassifyError(err error) ErrorKind {
+	if err == nil {
+		return ERR_KIND_UNKNOWN
+	}
+
+	var apiErr *ApiError
+	if errors.As(err, &apiErr) {
+		return apiErr.Kind
+	}
+	var httpErr *HttpError
+	if errors.As(err, &httpErr) {
+		return httpErr.Kind()
+	}
+	if errors.Is(err, ErrRateLimited) {
+		return ERR_KIND_RATE_LIMIT
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return ERR_KIND_NETWORK
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ERR_KIND_NETWORK
+	}
+	return ERR_KIND_UNKNOWN
+}
+
+//网络错误、5xx、限频可以重试; 鉴权失败、余额不足等重试也不会成功
+func IsRetryable(err error) bool {
+	switch ClassifyError(err) {
+	case ERR_KIND_NETWORK, ERR_KIND_SERVER, ERR_KIND_RATE_LIMIT:
+		return true
+	}
+	return false
+}
+
+//请求确定没有被交易所处理(连接没建立、被限频拒绝), 非幂等请求(如下单)也可以安全重试
+func IsNotDelivered(err error) bool {
+	if ClassifyError(err) == ERR_KIND_RATE_LIMIT {
+		return true //429和本地限频都不会被交易所处理
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
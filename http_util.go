@@ -2,18 +2,71 @@ package coinapi
 
 //http request 工具函数
 import (
+	"compress/gzip"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
+//响应体大小上限, 超过时返回 ErrResponseTooLarge
+var MaxResponseBodySize int64 = 8 << 20
+
+var ErrResponseTooLarge = errors.New("response body too large")
+
+//交易所返回了非2xx的状态码
+type HttpError struct {
+	StatusCode int
+	Status     string
+	RetryAfter time.Duration //响应头中的 Retry-After, 没有时为0
+	Body       []byte
+}
+
+func (e *HttpError) Error() string {
+	return fmt.Sprintf("http status %s: %s", e.Status, truncate(Redact(string(e.Body)), 256))
+}
+
+func (e *HttpError) Kind() ErrorKind {
+	switch {
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ERR_KIND_RATE_LIMIT
+	case e.StatusCode >= 500:
+		return ERR_KIND_SERVER
+	case e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden:
+		return ERR_KIND_AUTH
+	default:
+		return ERR_KIND_INVALID_REQUEST
+	}
+}
+
+//响应不是预期的json格式
+type DecodeError struct {
+	Err  error
+	Body []byte
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("decode response failed: %v: %s", e.Err, truncate(Redact(string(e.Body)), 256))
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
 func httpRequest(client *http.Client, reqType string, reqUrl string, postData url.Values, requstHeaders map[string]string) ([]byte, error) {
-	req, _ := http.NewRequest(reqType, reqUrl, strings.NewReader(postData.Encode()))
+	req, err := http.NewRequest(reqType, reqUrl, strings.NewReader(postData.Encode()))
+	if err != nil {
+		return nil, err
+	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 5.1) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/31.0.1650.63 Safari/537.36")
+	req.Header.Set("Accept-Encoding", "gzip")
 	if requstHeaders != nil {
 		for k, v := range requstHeaders {
 			req.Header.Add(k, v)
@@ -22,17 +75,83 @@ func httpRequest(client *http.Client, reqType string, reqUrl string, postData ur
 
 	resp, err := client.Do(req)
 	if err != nil {
+		//url.Error 会带上完整的请求地址, GET请求的参数里可能有key
+		if urlErr, ok := err.(*url.Error); ok {
+			urlErr.URL = Redact(urlErr.URL)
+		}
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	bodyData, err := ioutil.ReadAll(resp.Body)
+	bodyData, err := readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &HttpError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+			Body:       bodyData,
+		}
+	}
+	return bodyData, nil
+}
+
+func readBody(resp *http.Response) ([]byte, error) {
+	var reader io.Reader = resp.Body
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		gzReader, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer gzReader.Close()
+		reader = gzReader
+	}
+
+	bodyData, err := ioutil.ReadAll(io.LimitReader(reader, MaxResponseBodySize+1))
 	if err != nil {
 		return nil, err
 	}
+	if int64(len(bodyData)) > MaxResponseBodySize {
+		return nil, ErrResponseTooLarge
+	}
 	return bodyData, nil
 }
 
+//Retry-After 可以是秒数, 也可以是http时间
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if sec, err := strconv.Atoi(v); err == nil && sec > 0 {
+		return time.Duration(sec) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+//把响应反序列化到result, 失败时返回 *DecodeError
+func DecodeJSON(body []byte, result interface{}) error {
+	err := json.Unmarshal(body, result)
+	if err != nil {
+		return &DecodeError{Err: err, Body: body}
+	}
+	return nil
+}
+
 func HttpGet(client *http.Client, reqUrl string) (map[string]interface{}, error) {
 	respData, err := httpRequest(client, "GET", reqUrl, url.Values{}, nil)
 	if err != nil {
@@ -40,14 +159,26 @@ func HttpGet(client *http.Client, reqUrl string) (map[string]interface{}, error)
 	}
 
 	var bodyDataMap map[string]interface{}
-	err = json.Unmarshal(respData, &bodyDataMap)
+	err = DecodeJSON(respData, &bodyDataMap)
 	if err != nil {
-		log.Println(string(respData))
 		return nil, err
 	}
 	return bodyDataMap, nil
 }
 
+func HttpGetBytes(client *http.Client, reqUrl string) ([]byte, error) {
+	return httpRequest(client, "GET", reqUrl, url.Values{}, nil)
+}
+
+//GET请求并直接反序列化到result
+func HttpGetJSON(client *http.Client, reqUrl string, result interface{}) error {
+	respData, err := httpRequest(client, "GET", reqUrl, url.Values{}, nil)
+	if err != nil {
+		return err
+	}
+	return DecodeJSON(respData, result)
+}
+
 func HttpPostForm(client *http.Client, reqUrl string, postData url.Values) ([]byte, error) {
 	return httpRequest(client, "POST", reqUrl, postData, nil)
 }
@@ -55,3 +186,12 @@ func HttpPostForm(client *http.Client, reqUrl string, postData url.Values) ([]by
 func HttpPostForm2(client *http.Client, reqUrl string, postData url.Values, headers map[string]string) ([]byte, error) {
 	return httpRequest(client, "POST", reqUrl, postData, headers)
 }
+
+//POST表单并直接反序列化到result
+func HttpPostFormJSON(client *http.Client, reqUrl string, postData url.Values, headers map[string]string, result interface{}) error {
+	respData, err := httpRequest(client, "POST", reqUrl, postData, headers)
+	if err != nil {
+		return err
+	}
+	return DecodeJSON(respData, result)
+}
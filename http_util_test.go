@@ -0,0 +1,73 @@
+package coinapi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHttpGet_StatusError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":"too many requests"}`))
+	}))
+	defer ts.Close()
+
+	_, err := HttpGet(ts.Client(), ts.URL)
+	httpErr, ok := err.(*HttpError)
+	assert.True(t, ok)
+	assert.Equal(t, 429, httpErr.StatusCode)
+	assert.Equal(t, 3*time.Second, httpErr.RetryAfter)
+	assert.Equal(t, ErrorKind(ERR_KIND_RATE_LIMIT), ClassifyError(err))
+	assert.True(t, IsRetryable(err))
+}
+
+func TestHttpGetJSON_Gzip(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "gzip", r.Header.Get("Accept-Encoding"))
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write([]byte(`{"last":1.5,"vol":2}`))
+		gz.Close()
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(buf.Bytes())
+	}))
+	defer ts.Close()
+
+	var ticker Ticker
+	err := HttpGetJSON(ts.Client(), ts.URL, &ticker)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.5, ticker.Last)
+	assert.Equal(t, 2.0, ticker.Vol)
+}
+
+func TestHttpGet_BodyTooLarge(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bytes.Repeat([]byte("a"), 64))
+	}))
+	defer ts.Close()
+
+	old := MaxResponseBodySize
+	MaxResponseBodySize = 32
+	defer func() { MaxResponseBodySize = old }()
+
+	_, err := HttpGetBytes(ts.Client(), ts.URL)
+	assert.Equal(t, ErrResponseTooLarge, err)
+}
+
+func TestHttpGet_DecodeError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>maintenance</html>"))
+	}))
+	defer ts.Close()
+
+	_, err := HttpGet(ts.Client(), ts.URL)
+	_, ok := err.(*DecodeError)
+	assert.True(t, ok)
+}
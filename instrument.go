@@ -0,0 +1,401 @@
+package coinapi
+
+import (
+	"reflect"
+	"time"
+)
+
+//为api的每个方法记录调用次数、按 ErrorKind 分类的错误数和耗时
+func InstrumentApi(api Api, registry MetricsRegistry) Api {
+	return (&instrumentedApi{api: api, instruments: instruments{api.GetExchangeName(), registry, nil}}).wrap()
+}
+
+func InstrumentFutureApi(api FutureApi, registry MetricsRegistry) FutureApi {
+	return (&instrumentedFutureApi{api: api, instruments: instruments{api.GetExchangeName(), registry, nil}}).wrap()
+}
+
+//同 InstrumentApi, 但用 newApi 为每个方法单独构建一个adapter, 它发出的请求带上方法名(见 TagApiMethod),
+//请求日志和限频等待时间因此能按方法区分. logger 不为nil时每次调用再记一条日志, 包括http状态码为200
+//但交易所返回了错误码的调用; registry 也可以为nil. 各adapter共用 config 中的client、限频器、nonce和key
+func NewInstrumentedApi(newApi func(config ApiConfig) (Api, error), config ApiConfig, registry MetricsRegistry, logger Logger) (Api, error) {
+	api, err := newApi(config)
+	if err != nil {
+		return nil, err
+	}
+	a := &instrumentedApi{api: api, methods: map[string]Api{}, instruments: instruments{api.GetExchangeName(), registry, logger}}
+	for _, method := range methodNames(api, (*Api)(nil), (*TransferApi)(nil)) {
+		if a.methods[method], err = newApi(tagConfig(config, method)); err != nil {
+			return nil, err
+		}
+	}
+	return a.wrap(), nil
+}
+
+func NewInstrumentedFutureApi(newApi func(config ApiConfig) (FutureApi, error), config ApiConfig, registry MetricsRegistry, logger Logger) (FutureApi, error) {
+	api, err := newApi(config)
+	if err != nil {
+		return nil, err
+	}
+	a := &instrumentedFutureApi{api: api, methods: map[string]FutureApi{}, instruments: instruments{api.GetExchangeName(), registry, logger}}
+	for _, method := range methodNames(api, (*FutureApi)(nil), (*TransferApi)(nil)) {
+		if a.methods[method], err = newApi(tagConfig(config, method)); err != nil {
+			return nil, err
+		}
+	}
+	return a.wrap(), nil
+}
+
+func tagConfig(config ApiConfig, method string) ApiConfig {
+	config.HttpClient = WithMiddleware(config.HttpClient, TagApiMethod(method))
+	return config
+}
+
+//api 实现的 ifaces 中各接口的方法名, ifaces 为接口的nil指针, 如 (*Api)(nil)
+func methodNames(api interface{}, ifaces ...interface{}) []string {
+	var names []string
+	for _, iface := range ifaces {
+		t := reflect.TypeOf(iface).Elem()
+		if !reflect.TypeOf(api).Implements(t) {
+			continue
+		}
+		for i := 0; i < t.NumMethod(); i++ {
+			names = append(names, t.Method(i).Name)
+		}
+	}
+	return names
+}
+
+//返回被 InstrumentApi、NewInstrumentedApi 包装的api, 用于断言具体的adapter类型(如 *poloniex.PoloApi).
+//通过它发起的调用不再记录指标和日志; api 没有被包装时原样返回
+func UnwrapApi(api Api) Api {
+	for {
+		w, ok := api.(interface{ Unwrap() Api })
+		if !ok {
+			return api
+		}
+		api = w.Unwrap()
+	}
+}
+
+func UnwrapFutureApi(api FutureApi) FutureApi {
+	for {
+		w, ok := api.(interface{ Unwrap() FutureApi })
+		if !ok {
+			return api
+		}
+		api = w.Unwrap()
+	}
+}
+
+//限频等待时间, 配合 RateLimit 使用. method 为发起请求的adapter方法, 只有 NewInstrumentedApi 构建的api才有
+func RateLimitWaitObserver(exchange string, registry MetricsRegistry) RateLimitObserver {
+	return func(method, endpoint string, wait time.Duration) {
+		registry.Observe(METRIC_RATE_LIMIT_WAIT, Labels{"exchange": exchange, "method": method}, wait.Seconds())
+	}
+}
+
+type instruments struct {
+	exchange string
+	registry MetricsRegistry
+	logger   Logger
+}
+
+func (i instruments) observe(method string, start time.Time, err error) {
+	latency := time.Since(start)
+	if i.registry != nil {
+		labels := Labels{"exchange": i.exchange, "method": method}
+		i.registry.Add(METRIC_REQUESTS, labels, 1)
+		i.registry.Observe(METRIC_LATENCY, labels, latency.Seconds())
+		if err != nil {
+			i.registry.Add(METRIC_ERRORS, Labels{"exchange": i.exchange, "method": method, "kind": ClassifyError(err).String()}, 1)
+		}
+	}
+	if i.logger != nil {
+		fields := []interface{}{"exchange", i.exchange, "method", method, "latency", latency}
+		if err != nil {
+			i.logger.Warn("api call failed", append(fields, "kind", ClassifyError(err), "err", err)...)
+		} else {
+			i.logger.Debug("api call", fields...)
+		}
+	}
+}
+
+type instrumentedApi struct {
+	api     Api
+	methods map[string]Api //NewInstrumentedApi 按方法构建的adapter, 为nil时所有方法都调用api
+	instruments
+}
+
+func (a *instrumentedApi) method(name string) Api {
+	if api, ok := a.methods[name]; ok {
+		return api
+	}
+	return a.api
+}
+
+//被包装的api, 见 UnwrapApi
+func (a *instrumentedApi) Unwrap() Api {
+	return a.api
+}
+
+//api 实现了 TransferApi 时包装结果同样实现
+func (a *instrumentedApi) wrap() Api {
+	if _, ok := a.api.(TransferApi); ok {
+		return &instrumentedTransferApi{a}
+	}
+	return a
+}
+
+type instrumentedTransferApi struct {
+	*instrumentedApi
+}
+
+func (a *instrumentedTransferApi) Transfer(currency, amount string, from, to AccountType) (*TransferResult, error) {
+	start := time.Now()
+	result, err := a.method("Transfer").(TransferApi).Transfer(currency, amount, from, to)
+	a.observe("Transfer", start, err)
+	return result, err
+}
+
+func (a *instrumentedApi) GetDepth(cp CurrencyPair, size int) (*Depth, error) {
+	start := time.Now()
+	result, err := a.method("GetDepth").GetDepth(cp, size)
+	a.observe("GetDepth", start, err)
+	return result, err
+}
+
+func (a *instrumentedApi) LimitBuy(amount, price string, cp CurrencyPair) (*Order, error) {
+	start := time.Now()
+	result, err := a.method("LimitBuy").LimitBuy(amount, price, cp)
+	a.observe("LimitBuy", start, err)
+	return result, err
+}
+
+func (a *instrumentedApi) LimitSell(amount, price string, cp CurrencyPair) (*Order, error) {
+	start := time.Now()
+	result, err := a.method("LimitSell").LimitSell(amount, price, cp)
+	a.observe("LimitSell", start, err)
+	return result, err
+}
+
+func (a *instrumentedApi) MarketBuy(amount, price string, cp CurrencyPair) (*Order, error) {
+	start := time.Now()
+	result, err := a.method("MarketBuy").MarketBuy(amount, price, cp)
+	a.observe("MarketBuy", start, err)
+	return result, err
+}
+
+func (a *instrumentedApi) MarketSell(amount, price string, cp CurrencyPair) (*Order, error) {
+	start := time.Now()
+	result, err := a.method("MarketSell").MarketSell(amount, price, cp)
+	a.observe("MarketSell", start, err)
+	return result, err
+}
+
+func (a *instrumentedApi) CancelOrder(orderId string, cp CurrencyPair) (bool, error) {
+	start := time.Now()
+	result, err := a.method("CancelOrder").CancelOrder(orderId, cp)
+	a.observe("CancelOrder", start, err)
+	return result, err
+}
+
+func (a *instrumentedApi) GetOneOrder(orderId string, cp CurrencyPair) (*Order, error) {
+	start := time.Now()
+	result, err := a.method("GetOneOrder").GetOneOrder(orderId, cp)
+	a.observe("GetOneOrder", start, err)
+	return result, err
+}
+
+func (a *instrumentedApi) GetUnfinishedOrders(cp CurrencyPair) ([]Order, error) {
+	start := time.Now()
+	result, err := a.method("GetUnfinishedOrders").GetUnfinishedOrders(cp)
+	a.observe("GetUnfinishedOrders", start, err)
+	return result, err
+}
+
+func (a *instrumentedApi) GetAccount() (*Account, error) {
+	start := time.Now()
+	result, err := a.method("GetAccount").GetAccount()
+	a.observe("GetAccount", start, err)
+	return result, err
+}
+
+func (a *instrumentedApi) GetTicker(cp CurrencyPair) (*Ticker, error) {
+	start := time.Now()
+	result, err := a.method("GetTicker").GetTicker(cp)
+	a.observe("GetTicker", start, err)
+	return result, err
+}
+
+func (a *instrumentedApi) Withdraw(amount, currency, fees, receiveAddr, memo, safePwd string) (string, error) {
+	start := time.Now()
+	result, err := a.method("Withdraw").Withdraw(amount, currency, fees, receiveAddr, memo, safePwd)
+	a.observe("Withdraw", start, err)
+	return result, err
+}
+
+func (a *instrumentedApi) GetKlineRecords(cp CurrencyPair, period string, size, since int) ([]Kline, error) {
+	start := time.Now()
+	result, err := a.method("GetKlineRecords").GetKlineRecords(cp, period, size, since)
+	a.observe("GetKlineRecords", start, err)
+	return result, err
+}
+
+func (a *instrumentedApi) GetOrderHistory(cp CurrencyPair, currentPage, pageSize int) ([]Order, error) {
+	start := time.Now()
+	result, err := a.method("GetOrderHistory").GetOrderHistory(cp, currentPage, pageSize)
+	a.observe("GetOrderHistory", start, err)
+	return result, err
+}
+
+func (a *instrumentedApi) GetTrades(cp CurrencyPair, since int64) ([]Trade, error) {
+	start := time.Now()
+	result, err := a.method("GetTrades").GetTrades(cp, since)
+	a.observe("GetTrades", start, err)
+	return result, err
+}
+
+func (a *instrumentedApi) GetExchangeName() string {
+	return a.api.GetExchangeName()
+}
+
+type instrumentedFutureApi struct {
+	api     FutureApi
+	methods map[string]FutureApi
+	instruments
+}
+
+func (a *instrumentedFutureApi) method(name string) FutureApi {
+	if api, ok := a.methods[name]; ok {
+		return api
+	}
+	return a.api
+}
+
+func (a *instrumentedFutureApi) Unwrap() FutureApi {
+	return a.api
+}
+
+func (a *instrumentedFutureApi) wrap() FutureApi {
+	if _, ok := a.api.(TransferApi); ok {
+		return &instrumentedTransferFutureApi{a}
+	}
+	return a
+}
+
+type instrumentedTransferFutureApi struct {
+	*instrumentedFutureApi
+}
+
+func (a *instrumentedTransferFutureApi) Transfer(currency, amount string, from, to AccountType) (*TransferResult, error) {
+	start := time.Now()
+	result, err := a.method("Transfer").(TransferApi).Transfer(currency, amount, from, to)
+	a.observe("Transfer", start, err)
+	return result, err
+}
+
+func (a *instrumentedFutureApi) GetFutureEstimatedPrice(cp CurrencyPair) (float64, error) {
+	start := time.Now()
+	result, err := a.method("GetFutureEstimatedPrice").GetFutureEstimatedPrice(cp)
+	a.observe("GetFutureEstimatedPrice", start, err)
+	return result, err
+}
+
+func (a *instrumentedFutureApi) GetFutureTicker(cp CurrencyPair, contractType string) (*Ticker, error) {
+	start := time.Now()
+	result, err := a.method("GetFutureTicker").GetFutureTicker(cp, contractType)
+	a.observe("GetFutureTicker", start, err)
+	return result, err
+}
+
+func (a *instrumentedFutureApi) GetFutureDepth(cp CurrencyPair, contractType string, size int) (*Depth, error) {
+	start := time.Now()
+	result, err := a.method("GetFutureDepth").GetFutureDepth(cp, contractType, size)
+	a.observe("GetFutureDepth", start, err)
+	return result, err
+}
+
+func (a *instrumentedFutureApi) GetFutureIndex(cp CurrencyPair) (float64, error) {
+	start := time.Now()
+	result, err := a.method("GetFutureIndex").GetFutureIndex(cp)
+	a.observe("GetFutureIndex", start, err)
+	return result, err
+}
+
+func (a *instrumentedFutureApi) GetFutureUserInfo() (*FutureAccount, error) {
+	start := time.Now()
+	result, err := a.method("GetFutureUserInfo").GetFutureUserInfo()
+	a.observe("GetFutureUserInfo", start, err)
+	return result, err
+}
+
+func (a *instrumentedFutureApi) PlaceFutureOrder(cp CurrencyPair, contractType, price, amount string, openType, matchPrice, leverRate int) (string, error) {
+	start := time.Now()
+	result, err := a.method("PlaceFutureOrder").PlaceFutureOrder(cp, contractType, price, amount, openType, matchPrice, leverRate)
+	a.observe("PlaceFutureOrder", start, err)
+	return result, err
+}
+
+func (a *instrumentedFutureApi) FutureCancelOrder(cp CurrencyPair, contractType, orderId string) (bool, error) {
+	start := time.Now()
+	result, err := a.method("FutureCancelOrder").FutureCancelOrder(cp, contractType, orderId)
+	a.observe("FutureCancelOrder", start, err)
+	return result, err
+}
+
+func (a *instrumentedFutureApi) GetFuturePosition(cp CurrencyPair, contractType string) ([]FuturePosition, error) {
+	start := time.Now()
+	result, err := a.method("GetFuturePosition").GetFuturePosition(cp, contractType)
+	a.observe("GetFuturePosition", start, err)
+	return result, err
+}
+
+func (a *instrumentedFutureApi) GetFutureOrders(orderIds []string, cp CurrencyPair, contractType string) ([]FutureOrder, error) {
+	start := time.Now()
+	result, err := a.method("GetFutureOrders").GetFutureOrders(orderIds, cp, contractType)
+	a.observe("GetFutureOrders", start, err)
+	return result, err
+}
+
+func (a *instrumentedFutureApi) GetUnfinishedFutureOrders(cp CurrencyPair, contractType string) ([]FutureOrder, error) {
+	start := time.Now()
+	result, err := a.method("GetUnfinishedFutureOrders").GetUnfinishedFutureOrders(cp, contractType)
+	a.observe("GetUnfinishedFutureOrders", start, err)
+	return result, err
+}
+
+func (a *instrumentedFutureApi) GetFee() (float64, error) {
+	start := time.Now()
+	result, err := a.method("GetFee").GetFee()
+	a.observe("GetFee", start, err)
+	return result, err
+}
+
+func (a *instrumentedFutureApi) GetExchangeRate() (float64, error) {
+	start := time.Now()
+	result, err := a.method("GetExchangeRate").GetExchangeRate()
+	a.observe("GetExchangeRate", start, err)
+	return result, err
+}
+
+func (a *instrumentedFutureApi) GetContractValue(cp CurrencyPair) (float64, error) {
+	start := time.Now()
+	result, err := a.method("GetContractValue").GetContractValue(cp)
+	a.observe("GetContractValue", start, err)
+	return result, err
+}
+
+func (a *instrumentedFutureApi) GetKlineRecords(contractType string, cp CurrencyPair, period string, size, since int) ([]FutureKline, error) {
+	start := time.Now()
+	result, err := a.method("GetKlineRecords").GetKlineRecords(contractType, cp, period, size, since)
+	a.observe("GetKlineRecords", start, err)
+	return result, err
+}
+
+func (a *instrumentedFutureApi) GetDeliveryTime() (int, int, int, int) {
+	return a.api.GetDeliveryTime()
+}
+
+func (a *instrumentedFutureApi) GetExchangeName() string {
+	return a.api.GetExchangeName()
+}
@@ -0,0 +1,238 @@
+package coinapi
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+var ErrWrongPassphrase = errors.New("keystore: wrong passphrase or corrupted file")
+
+//新建或重写keystore时使用的scrypt参数N, 已有文件使用文件中记录的参数. 必须是 2^10 到 2^20 之间的2的幂
+var KeystoreScryptN = 1 << 15
+
+const (
+	keystoreVersion = 1
+	keystoreScryptR = 8
+	keystoreScryptP = 1
+
+	//文件中记录的scrypt参数的范围, 防止被篡改的文件让派生密钥耗尽内存或CPU
+	keystoreMinScryptN = 1 << 10
+	keystoreMaxScryptN = 1 << 20
+	keystoreMaxScryptR = 16
+	keystoreMaxScryptP = 16
+	keystoreMaxMemory  = 1 << 30 //scrypt 占用 128*N*r 字节
+)
+
+type keystoreFile struct {
+	Version    int    `json:"version"`
+	Kdf        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+//加密的本地密钥库, 一个文件保存多组key, 以名称区分.
+//密钥由口令经scrypt派生, 内容用AES-256-GCM加密; 文件被修改后(如另一个进程轮换了key)自动重新加载
+type Keystore struct {
+	file       string
+	passphrase string
+
+	mu      sync.Mutex
+	info    os.FileInfo //上次加载或保存时的文件信息, 每次保存都会rename出新文件
+	entries map[string]Credentials
+}
+
+//创建一个空的keystore, 文件已存在时报错
+func CreateKeystore(file, passphrase string) (*Keystore, error) {
+	if _, err := os.Stat(file); err == nil {
+		return nil, fmt.Errorf("keystore: %s already exists", file)
+	}
+	k := &Keystore{file: file, passphrase: passphrase, entries: map[string]Credentials{}}
+	if err := k.save(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func OpenKeystore(file, passphrase string) (*Keystore, error) {
+	k := &Keystore{file: file, passphrase: passphrase}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func (k *Keystore) Get(name string) (Credentials, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.reload(); err != nil {
+		return Credentials{}, err
+	}
+	credentials, ok := k.entries[name]
+	if !ok {
+		return Credentials{}, fmt.Errorf("keystore: no entry named %q", name)
+	}
+	return credentials, nil
+}
+
+//新增或轮换一组key, 立即写回文件; 通过 Provider 拿到的签名器下一次请求就会使用新key
+func (k *Keystore) Set(name string, credentials Credentials) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.reload(); err != nil {
+		return err
+	}
+	k.entries[name] = credentials
+	return k.save()
+}
+
+func (k *Keystore) Delete(name string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.reload(); err != nil {
+		return err
+	}
+	delete(k.entries, name)
+	return k.save()
+}
+
+func (k *Keystore) Names() ([]string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.reload(); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(k.entries))
+	for name := range k.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (k *Keystore) Provider(name string) CredentialProvider {
+	return keystoreEntry{k, name}
+}
+
+type keystoreEntry struct {
+	keystore *Keystore
+	name     string
+}
+
+func (e keystoreEntry) Credentials() (Credentials, error) {
+	return e.keystore.Get(e.name)
+}
+
+//调用方持有 k.mu
+func (k *Keystore) reload() error {
+	info, err := os.Stat(k.file)
+	if err != nil {
+		return err
+	}
+	if k.entries != nil && os.SameFile(info, k.info) && info.ModTime().Equal(k.info.ModTime()) {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(k.file)
+	if err != nil {
+		return err
+	}
+	var f keystoreFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("keystore: invalid file %s: %v", k.file, err)
+	}
+	if f.Version != keystoreVersion || f.Kdf != "scrypt" {
+		return fmt.Errorf("keystore: unsupported version %d/%s", f.Version, f.Kdf)
+	}
+
+	gcm, err := keystoreCipher(k.passphrase, f.Salt, f.N, f.R, f.P)
+	if err != nil {
+		return err
+	}
+	if len(f.Nonce) != gcm.NonceSize() {
+		return ErrWrongPassphrase
+	}
+	plaintext, err := gcm.Open(nil, f.Nonce, f.Ciphertext, nil)
+	if err != nil {
+		return ErrWrongPassphrase
+	}
+	entries := map[string]Credentials{}
+	if err := json.Unmarshal(plaintext, &entries); err != nil {
+		return ErrWrongPassphrase
+	}
+	k.entries, k.info = entries, info
+	return nil
+}
+
+//每次保存都换新的salt和nonce. 调用方持有 k.mu
+func (k *Keystore) save() error {
+	plaintext, err := json.Marshal(k.entries)
+	if err != nil {
+		return err
+	}
+	f := keystoreFile{
+		Version: keystoreVersion,
+		Kdf:     "scrypt",
+		N:       KeystoreScryptN,
+		R:       keystoreScryptR,
+		P:       keystoreScryptP,
+		Salt:    make([]byte, 32),
+	}
+	if _, err := rand.Read(f.Salt); err != nil {
+		return err
+	}
+	gcm, err := keystoreCipher(k.passphrase, f.Salt, f.N, f.R, f.P)
+	if err != nil {
+		return err
+	}
+	f.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(f.Nonce); err != nil {
+		return err
+	}
+	f.Ciphertext = gcm.Seal(nil, f.Nonce, plaintext, nil)
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(k.file, data, 0600); err != nil {
+		return err
+	}
+	info, err := os.Stat(k.file)
+	if err != nil {
+		return err
+	}
+	k.info = info
+	return nil
+}
+
+func keystoreCipher(passphrase string, salt []byte, N, r, p int) (cipher.AEAD, error) {
+	if N < keystoreMinScryptN || N > keystoreMaxScryptN || N&(N-1) != 0 ||
+		r < 1 || r > keystoreMaxScryptR || p < 1 || p > keystoreMaxScryptP || 128*N*r > keystoreMaxMemory {
+		return nil, fmt.Errorf("keystore: invalid scrypt parameters n=%d r=%d p=%d", N, r, p)
+	}
+	key, err := scrypt.Key([]byte(passphrase), salt, N, r, p, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
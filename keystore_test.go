@@ -0,0 +1,75 @@
+package coinapi
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeystore(t *testing.T) {
+	defer func(n int) { KeystoreScryptN = n }(KeystoreScryptN)
+	KeystoreScryptN = 1 << 10
+
+	file := filepath.Join(t.TempDir(), "keys.json")
+	keystore, err := CreateKeystore(file, "correct horse")
+	assert.NoError(t, err)
+	assert.NoError(t, keystore.Set("okcn", Credentials{"okcn-key", "okcn-secret"}))
+
+	data, _ := ioutil.ReadFile(file)
+	assert.False(t, strings.Contains(string(data), "okcn-secret"), "keystore must not contain plaintext secrets")
+
+	_, err = OpenKeystore(file, "wrong")
+	assert.Equal(t, ErrWrongPassphrase, err)
+
+	//另一个实例轮换key后, 已有的provider读到新key
+	provider := keystore.Provider("okcn")
+	other, err := OpenKeystore(file, "correct horse")
+	assert.NoError(t, err)
+	assert.NoError(t, other.Set("okcn", Credentials{"okcn-key2", "okcn-secret2"}))
+	credentials, err := provider.Credentials()
+	assert.NoError(t, err)
+	assert.Equal(t, Credentials{"okcn-key2", "okcn-secret2"}, credentials)
+
+	_, err = keystore.Provider("missing").Credentials()
+	assert.Error(t, err)
+}
+
+//被篡改的scrypt参数在派生密钥之前就报错, 不会耗尽内存
+func TestKeystore_InvalidScryptParams(t *testing.T) {
+	defer func(n int) { KeystoreScryptN = n }(KeystoreScryptN)
+	KeystoreScryptN = 1 << 10
+
+	file := filepath.Join(t.TempDir(), "keys.json")
+	_, err := CreateKeystore(file, "correct horse")
+	assert.NoError(t, err)
+	data, _ := ioutil.ReadFile(file)
+	var f keystoreFile
+	assert.NoError(t, json.Unmarshal(data, &f))
+
+	for _, params := range [][3]int{
+		{1 << 30, 8, 1},
+		{1000, 8, 1},
+		{16, 8, 1},
+		{1 << 10, 0, 1},
+		{1 << 10, 1024, 1},
+		{1 << 10, 8, 1000000},
+		{1 << 20, 16, 1},
+	} {
+		f.N, f.R, f.P = params[0], params[1], params[2]
+		tampered, _ := json.Marshal(f)
+		assert.NoError(t, ioutil.WriteFile(file, tampered, 0600))
+		_, err = OpenKeystore(file, "correct horse")
+		if assert.Error(t, err, "%v", params) {
+			assert.Contains(t, err.Error(), "invalid scrypt parameters")
+		}
+	}
+
+	//N 不在范围内时也不能新建
+	KeystoreScryptN = 1 << 21
+	_, err = CreateKeystore(filepath.Join(t.TempDir(), "big.json"), "correct horse")
+	assert.Error(t, err)
+}
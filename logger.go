@@ -0,0 +1,135 @@
+package coinapi
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	LOG_DEBUG = iota
+	LOG_INFO
+	LOG_WARN
+	LOG_ERROR
+)
+
+type LogLevel int
+
+func (l LogLevel) String() string {
+	switch l {
+	case LOG_DEBUG:
+		return "debug"
+	case LOG_INFO:
+		return "info"
+	case LOG_WARN:
+		return "warn"
+	case LOG_ERROR:
+		return "error"
+	}
+	return fmt.Sprintf("LogLevel(%d)", int(l))
+}
+
+//带级别和字段的日志接口, keyvals 为交替的 key、value
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+	//返回一个每条日志都带上keyvals的Logger
+	With(keyvals ...interface{}) Logger
+}
+
+//什么都不输出, 库的默认值
+type NopLogger struct{}
+
+func (NopLogger) Debug(msg string, keyvals ...interface{}) {}
+func (NopLogger) Info(msg string, keyvals ...interface{})  {}
+func (NopLogger) Warn(msg string, keyvals ...interface{})  {}
+func (NopLogger) Error(msg string, keyvals ...interface{}) {}
+func (n NopLogger) With(keyvals ...interface{}) Logger     { return n }
+
+//没有接收者的辅助函数(如 CancelAllUnfinishedOrders)使用的Logger
+var DefaultLogger Logger = NopLogger{}
+
+//输出 logfmt 风格的一行文本: time=... level=info msg="..." k=v, 字段值会经过 Redact 打码
+type TextLogger struct {
+	mu      *sync.Mutex
+	w       io.Writer
+	level   LogLevel
+	keyvals []interface{}
+}
+
+//低于level的日志不输出
+func NewTextLogger(w io.Writer, level LogLevel) *TextLogger {
+	return &TextLogger{mu: &sync.Mutex{}, w: w, level: level}
+}
+
+func (l *TextLogger) Debug(msg string, keyvals ...interface{}) { l.log(LOG_DEBUG, msg, keyvals) }
+func (l *TextLogger) Info(msg string, keyvals ...interface{})  { l.log(LOG_INFO, msg, keyvals) }
+func (l *TextLogger) Warn(msg string, keyvals ...interface{})  { l.log(LOG_WARN, msg, keyvals) }
+func (l *TextLogger) Error(msg string, keyvals ...interface{}) { l.log(LOG_ERROR, msg, keyvals) }
+
+func (l *TextLogger) With(keyvals ...interface{}) Logger {
+	child := *l
+	child.keyvals = append(l.keyvals[:len(l.keyvals):len(l.keyvals)], keyvals...)
+	return &child
+}
+
+func (l *TextLogger) log(level LogLevel, msg string, keyvals []interface{}) {
+	if level < l.level {
+		return
+	}
+	var b strings.Builder
+	b.WriteString("time=")
+	b.WriteString(time.Now().Format(time.RFC3339Nano))
+	b.WriteString(" level=")
+	b.WriteString(level.String())
+	b.WriteString(" msg=")
+	b.WriteString(logfmtValue(msg))
+	all := append(l.keyvals[:len(l.keyvals):len(l.keyvals)], keyvals...)
+	if len(all)%2 != 0 {
+		all = append(all, "(MISSING)")
+	}
+	for i := 0; i < len(all); i += 2 {
+		b.WriteByte(' ')
+		b.WriteString(fmt.Sprint(all[i]))
+		b.WriteByte('=')
+		b.WriteString(logfmtValue(Redact(fmt.Sprint(all[i+1]))))
+	}
+	b.WriteByte('\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	io.WriteString(l.w, b.String())
+}
+
+func logfmtValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+		return fmt.Sprintf("%q", s)
+	}
+	return s
+}
+
+//每个http请求记一条日志: exchange、method(api方法名, 见 ApiMethod)、endpoint(见 RequestEndpoint)、status、latency.
+//2xx 为 debug, 其余状态码和网络错误为 warn. 状态码为200但交易所返回错误码的请求由 NewInstrumentedApi 的调用日志记录
+func LogRequests(logger Logger, exchange string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+			fields := []interface{}{"exchange", exchange, "method", ApiMethod(req.Context()), "endpoint", RequestEndpoint(req), "latency", time.Since(start)}
+			switch {
+			case err != nil:
+				logger.Warn("request failed", append(fields, "err", err)...)
+			case resp.StatusCode/100 != 2:
+				logger.Warn("request failed", append(fields, "status", resp.StatusCode)...)
+			default:
+				logger.Debug("request", append(fields, "status", resp.StatusCode)...)
+			}
+			return resp, err
+		})
+	}
+}
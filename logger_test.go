@@ -0,0 +1,43 @@
+package coinapi
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTextLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewTextLogger(&buf, LOG_INFO).With("exchange", "okcoin.cn")
+	logger.Debug("hidden")
+	logger.Warn("order failed", "method", "LimitBuy", "err", "invalid apiKey=abcdef123")
+
+	line := buf.String()
+	assert.False(t, strings.Contains(line, "hidden"))
+	assert.Contains(t, line, `level=warn msg="order failed" exchange=okcoin.cn method=LimitBuy err="invalid apiKey=***"`)
+}
+
+func TestLogRequests(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	client := WithMiddleware(ts.Client(), TagApiMethod("GetTicker"), LogRequests(NewTextLogger(&buf, LOG_DEBUG), "poloniex.com"))
+	HttpGetBytes(client, ts.URL+"/public?command=returnTicker")
+
+	line := buf.String()
+	assert.Contains(t, line, `level=warn msg="request failed" exchange=poloniex.com method=GetTicker endpoint=returnTicker latency=`)
+	assert.Contains(t, line, "status=502")
+
+	//交易接口的 command 在POST表单里, 路径都是 /tradingApi
+	buf.Reset()
+	HttpPostForm(client, ts.URL+"/tradingApi", url.Values{"command": {"returnBalances"}})
+	assert.Contains(t, buf.String(), "endpoint=returnBalances ")
+}
@@ -0,0 +1,106 @@
+//币本位合约一个合约的多空持仓记账, 模拟交易所、回测和测试用的模拟服务共用.
+//盈亏和保证金以币计, 每张合约面值 ContractValue 美元. 保证金在开仓时按成交价和杠杆固定, 平仓时按比例释放
+package margin
+
+import (
+	. "github.com/qct/cryptocurrency-exchange-api"
+)
+
+//比较张数时容忍的浮点误差
+const epsilon = 1e-9
+
+type Position struct {
+	ContractValue float64
+	LeverRate     int
+
+	BuyAmount, BuyPriceAvg, BuyMargin, BuyProfitReal     float64
+	SellAmount, SellPriceAvg, SellMargin, SellProfitReal float64
+}
+
+//开多和平空在买方向成交
+func IsBuy(otype int) bool {
+	return otype == OPEN_BUY || otype == CLOSE_SELL
+}
+
+func IsOpen(otype int) bool {
+	return otype == OPEN_BUY || otype == OPEN_SELL
+}
+
+//按price开amount张合约需要的保证金
+func Deposit(amount, contractValue, price float64, leverRate int) float64 {
+	return amount * contractValue / price / float64(leverRate)
+}
+
+func (p *Position) Empty() bool {
+	return p.BuyAmount+p.SellAmount <= epsilon
+}
+
+//持仓占用的保证金
+func (p *Position) Margin() float64 {
+	return p.BuyMargin + p.SellMargin
+}
+
+//平仓单 CLOSE_BUY/CLOSE_SELL 能平的持仓, 不扣除已经挂出的平仓单
+func (p *Position) Held(otype int) float64 {
+	if otype == CLOSE_BUY {
+		return p.BuyAmount
+	}
+	return p.SellAmount
+}
+
+//多头按long, 空头按short计算的未实现盈亏
+func (p *Position) ProfitUnreal(long, short float64) float64 {
+	profit := 0.0
+	if p.BuyAmount > epsilon {
+		profit += p.BuyAmount * p.ContractValue * (1/p.BuyPriceAvg - 1/long)
+	}
+	if p.SellAmount > epsilon {
+		profit += p.SellAmount * p.ContractValue * (1/short - 1/p.SellPriceAvg)
+	}
+	return profit
+}
+
+//按price成交amount张otype的订单, 返回平仓实现的盈亏, 开仓返回0.
+//开仓按张数加权调和平均计算持仓均价; 平仓按均价结算盈亏, 没有对应持仓时忽略
+func (p *Position) Fill(otype int, price, amount float64, leverRate int) float64 {
+	cv := p.ContractValue
+	switch otype {
+	case OPEN_BUY:
+		p.LeverRate = leverRate
+		p.BuyPriceAvg = (p.BuyAmount + amount) / (p.BuyAmount/nonZero(p.BuyPriceAvg) + amount/price)
+		p.BuyAmount += amount
+		p.BuyMargin += Deposit(amount, cv, price, leverRate)
+	case OPEN_SELL:
+		p.LeverRate = leverRate
+		p.SellPriceAvg = (p.SellAmount + amount) / (p.SellAmount/nonZero(p.SellPriceAvg) + amount/price)
+		p.SellAmount += amount
+		p.SellMargin += Deposit(amount, cv, price, leverRate)
+	case CLOSE_BUY:
+		if p.BuyAmount <= epsilon {
+			return 0
+		}
+		profit := amount * cv * (1/p.BuyPriceAvg - 1/price)
+		p.BuyMargin -= p.BuyMargin * amount / p.BuyAmount
+		p.BuyAmount -= amount
+		p.BuyProfitReal += profit
+		return profit
+	case CLOSE_SELL:
+		if p.SellAmount <= epsilon {
+			return 0
+		}
+		profit := amount * cv * (1/price - 1/p.SellPriceAvg)
+		p.SellMargin -= p.SellMargin * amount / p.SellAmount
+		p.SellAmount -= amount
+		p.SellProfitReal += profit
+		return profit
+	}
+	return 0
+}
+
+//没有持仓时均价为0, 避免除0
+func nonZero(v float64) float64 {
+	if v == 0 {
+		return 1
+	}
+	return v
+}
@@ -0,0 +1,58 @@
+package margin
+
+import (
+	"testing"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPosition_OpenAndClose(t *testing.T) {
+	p := &Position{ContractValue: 100}
+	assert.True(t, p.Empty())
+
+	//均价按张数加权调和平均: 2张@4000和2张@5000
+	assert.Equal(t, 0.0, p.Fill(OPEN_BUY, 4000, 2, 10))
+	assert.Equal(t, 0.0, p.Fill(OPEN_BUY, 5000, 2, 10))
+	assert.InDelta(t, 4/(2.0/4000+2.0/5000), p.BuyPriceAvg, 1e-9)
+	assert.InDelta(t, 2*100/4000.0/10+2*100/5000.0/10, p.Margin(), 1e-12)
+	assert.Equal(t, 10, p.LeverRate)
+	assert.Equal(t, 4.0, p.Held(CLOSE_BUY))
+	assert.Equal(t, 0.0, p.Held(CLOSE_SELL))
+
+	//平掉一半, 释放一半保证金
+	margin, avg := p.BuyMargin, p.BuyPriceAvg
+	profit := p.Fill(CLOSE_BUY, 5000, 2, 10)
+	assert.InDelta(t, 2*100*(1/avg-1/5000.0), profit, 1e-12)
+	assert.InDelta(t, profit, p.BuyProfitReal, 1e-12)
+	assert.InDelta(t, margin/2, p.BuyMargin, 1e-12)
+	assert.Equal(t, 2.0, p.BuyAmount)
+	assert.False(t, p.Empty())
+}
+
+func TestPosition_Short(t *testing.T) {
+	p := &Position{ContractValue: 10}
+	p.Fill(OPEN_SELL, 300, 5, 20)
+	assert.InDelta(t, 5*10/300.0/20, p.SellMargin, 1e-12)
+
+	//价格下跌时空头盈利
+	assert.InDelta(t, 5*10*(1/250.0-1/300.0), p.ProfitUnreal(0, 250), 1e-12)
+	profit := p.Fill(CLOSE_SELL, 250, 5, 20)
+	assert.InDelta(t, 5*10*(1/250.0-1/300.0), profit, 1e-12)
+	assert.InDelta(t, 0, p.SellMargin, 1e-12)
+	assert.True(t, p.Empty())
+	assert.Equal(t, 0.0, p.ProfitUnreal(0, 250))
+
+	//没有持仓时平仓被忽略
+	assert.Equal(t, 0.0, p.Fill(CLOSE_BUY, 250, 1, 20))
+	assert.Equal(t, 0.0, p.BuyAmount)
+}
+
+func TestIsBuy(t *testing.T) {
+	assert.True(t, IsBuy(OPEN_BUY))
+	assert.True(t, IsBuy(CLOSE_SELL))
+	assert.False(t, IsBuy(OPEN_SELL))
+	assert.False(t, IsBuy(CLOSE_BUY))
+	assert.True(t, IsOpen(OPEN_SELL))
+	assert.False(t, IsOpen(CLOSE_SELL))
+}
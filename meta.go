@@ -141,3 +141,12 @@ type FuturePosition struct {
 	ContractId     int64
 	ForceLiquPrice float64 //预估爆仓价
 }
+
+//-------------------------- Transfer ------------------------------------
+//okex、poloniex 的划转接口都不返回划转编号
+type TransferResult struct {
+	Currency string
+	Amount   float64
+	From     AccountType
+	To       AccountType
+}
@@ -0,0 +1,260 @@
+package coinapi
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//内置指标, 标签均带 exchange
+const (
+	METRIC_REQUESTS        = "coinapi_requests_total"           //exchange, method
+	METRIC_ERRORS          = "coinapi_errors_total"             //exchange, method, kind(见 ErrorKind)
+	METRIC_LATENCY         = "coinapi_request_duration_seconds" //exchange, method
+	METRIC_RATE_LIMIT_WAIT = "coinapi_rate_limit_wait_seconds"  //exchange, method
+)
+
+const (
+	METRIC_COUNTER   = "counter"
+	METRIC_HISTOGRAM = "histogram"
+)
+
+var DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type Labels map[string]string
+
+//指标注册表, 可以替换成对接其他监控系统的实现
+type MetricsRegistry interface {
+	Add(name string, labels Labels, delta float64)
+	Observe(name string, labels Labels, value float64)
+	Gather() []MetricFamily
+}
+
+//一个指标的所有样本, 直方图展开成 _bucket、_sum、_count
+type MetricFamily struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+type Sample struct {
+	Name   string
+	Labels Labels
+	Value  float64
+}
+
+//内存中的注册表
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*metricFamily
+}
+
+type metricFamily struct {
+	help    string
+	typ     string
+	buckets []float64
+	series  map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labels Labels
+	value  float64  //counter
+	counts []uint64 //histogram, 每个桶的累计数
+	sum    float64
+	count  uint64
+}
+
+//已注册内置指标的注册表
+func NewRegistry() *Registry {
+	r := &Registry{families: map[string]*metricFamily{}}
+	r.Register(METRIC_REQUESTS, "Api calls by exchange and method.", METRIC_COUNTER, nil)
+	r.Register(METRIC_ERRORS, "Failed api calls by exchange, method and error kind.", METRIC_COUNTER, nil)
+	r.Register(METRIC_LATENCY, "Api call latency in seconds.", METRIC_HISTOGRAM, DefaultLatencyBuckets)
+	r.Register(METRIC_RATE_LIMIT_WAIT, "Time spent waiting for the rate limiter in seconds.", METRIC_HISTOGRAM, DefaultLatencyBuckets)
+	return r
+}
+
+//重复注册同名指标时保留已有的样本
+func (r *Registry) Register(name, help, typ string, buckets []float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f, ok := r.families[name]; ok {
+		f.help = help
+		return
+	}
+	if typ == METRIC_HISTOGRAM && len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	r.families[name] = &metricFamily{help: help, typ: typ, buckets: buckets, series: map[string]*metricSeries{}}
+}
+
+//未注册的name自动注册为counter
+func (r *Registry) Add(name string, labels Labels, delta float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := r.family(name, METRIC_COUNTER)
+	f.get(labels).value += delta
+}
+
+//未注册的name自动注册为使用默认分桶的histogram
+func (r *Registry) Observe(name string, labels Labels, value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := r.family(name, METRIC_HISTOGRAM)
+	s := f.get(labels)
+	if f.typ != METRIC_HISTOGRAM {
+		s.value += value
+		return
+	}
+	for i, upper := range f.buckets {
+		if value <= upper {
+			s.counts[i]++
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+func (r *Registry) Gather() []MetricFamily {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	families := make([]MetricFamily, 0, len(names))
+	for _, name := range names {
+		f := r.families[name]
+		mf := MetricFamily{Name: name, Help: f.help, Type: f.typ}
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := f.series[key]
+			if f.typ != METRIC_HISTOGRAM {
+				mf.Samples = append(mf.Samples, Sample{name, s.labels, s.value})
+				continue
+			}
+			for i, upper := range f.buckets {
+				mf.Samples = append(mf.Samples, Sample{name + "_bucket", withLabel(s.labels, "le", formatFloat(upper)), float64(s.counts[i])})
+			}
+			mf.Samples = append(mf.Samples,
+				Sample{name + "_bucket", withLabel(s.labels, "le", "+Inf"), float64(s.count)},
+				Sample{name + "_sum", s.labels, s.sum},
+				Sample{name + "_count", s.labels, float64(s.count)})
+		}
+		families = append(families, mf)
+	}
+	return families
+}
+
+//调用方持有 r.mu
+func (r *Registry) family(name, typ string) *metricFamily {
+	f, ok := r.families[name]
+	if !ok {
+		f = &metricFamily{typ: typ, series: map[string]*metricSeries{}}
+		if typ == METRIC_HISTOGRAM {
+			f.buckets = DefaultLatencyBuckets
+		}
+		r.families[name] = f
+	}
+	return f
+}
+
+func (f *metricFamily) get(labels Labels) *metricSeries {
+	key := labelString(labels)
+	s, ok := f.series[key]
+	if !ok {
+		copied := make(Labels, len(labels))
+		for k, v := range labels {
+			copied[k] = v
+		}
+		s = &metricSeries{labels: copied}
+		if f.typ == METRIC_HISTOGRAM {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func withLabel(labels Labels, name, value string) Labels {
+	l := make(Labels, len(labels)+1)
+	for k, v := range labels {
+		l[k] = v
+	}
+	l[name] = value
+	return l
+}
+
+//按标签名排序的 {a="x",b="y"}, 没有标签时为空串
+func labelString(labels Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + `="` + escapeLabelValue(labels[name]) + `"`
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+//按 Prometheus 文本格式(0.0.4)输出
+func WritePrometheus(w io.Writer, registry MetricsRegistry) error {
+	for _, f := range registry.Gather() {
+		if f.Help != "" {
+			help := strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(f.Help)
+			if _, err := fmt.Fprintf(w, "# HELP %s %s\n", f.Name, help); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "# TYPE %s %s\n", f.Name, f.Type); err != nil {
+			return err
+		}
+		for _, s := range f.Samples {
+			if _, err := fmt.Fprintf(w, "%s%s %s\n", s.Name, labelString(s.Labels), formatFloat(s.Value)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//可以挂到 /metrics 上的handler
+func PrometheusHandler(registry MetricsRegistry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WritePrometheus(w, registry)
+	})
+}
@@ -0,0 +1,68 @@
+package coinapi
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type stubApi struct {
+	Api
+	err error
+}
+
+func (s *stubApi) GetExchangeName() string {
+	return "stub.com"
+}
+
+func (s *stubApi) GetTicker(cp CurrencyPair) (*Ticker, error) {
+	return &Ticker{Last: 1}, s.err
+}
+
+func TestInstrumentApi(t *testing.T) {
+	registry := NewRegistry()
+	stub := &stubApi{}
+	api := InstrumentApi(stub, registry)
+	api.GetTicker(NewCurrencyPair("BTC", "CNY"))
+	stub.err = &ApiError{Exchange: "stub.com", Kind: ERR_KIND_AUTH, Code: "10005"}
+	api.GetTicker(NewCurrencyPair("BTC", "CNY"))
+	stub.err = errors.New("boom")
+	api.GetTicker(NewCurrencyPair("BTC", "CNY"))
+	RateLimitWaitObserver("stub.com", registry)("GetTicker", "ticker.do", 20*time.Millisecond)
+
+	ts := httptest.NewServer(PrometheusHandler(registry))
+	defer ts.Close()
+	resp, err := ts.Client().Get(ts.URL)
+	assert.NoError(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	text := string(body)
+
+	assert.Contains(t, resp.Header.Get("Content-Type"), "version=0.0.4")
+	assert.Contains(t, text, "# TYPE coinapi_requests_total counter\n")
+	assert.Contains(t, text, `coinapi_requests_total{exchange="stub.com",method="GetTicker"} 3`+"\n")
+	assert.Contains(t, text, `coinapi_errors_total{exchange="stub.com",kind="AUTH",method="GetTicker"} 1`+"\n")
+	assert.Contains(t, text, `coinapi_errors_total{exchange="stub.com",kind="UNKNOWN",method="GetTicker"} 1`+"\n")
+	assert.Contains(t, text, "# TYPE coinapi_request_duration_seconds histogram\n")
+	assert.Contains(t, text, `coinapi_request_duration_seconds_bucket{exchange="stub.com",le="+Inf",method="GetTicker"} 3`+"\n")
+	assert.Contains(t, text, `coinapi_request_duration_seconds_count{exchange="stub.com",method="GetTicker"} 3`+"\n")
+	assert.Contains(t, text, `coinapi_rate_limit_wait_seconds_bucket{exchange="stub.com",le="0.025",method="GetTicker"} 1`+"\n")
+	assert.Contains(t, text, `coinapi_rate_limit_wait_seconds_bucket{exchange="stub.com",le="0.01",method="GetTicker"} 0`+"\n")
+}
+
+func TestRegistry_EscapeLabels(t *testing.T) {
+	registry := NewRegistry()
+	registry.Add("custom_total", Labels{"v": "a\"b\\c\nd"}, 2)
+	for _, f := range registry.Gather() {
+		if f.Name == "custom_total" {
+			assert.Equal(t, METRIC_COUNTER, f.Type)
+			assert.Equal(t, `{v="a\"b\\c\nd"}`, labelString(f.Samples[0].Labels))
+			return
+		}
+	}
+	t.Fatal("custom_total not gathered")
+}
@@ -0,0 +1,89 @@
+package coinapi
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+)
+
+//http请求中间件, 所有交易所的请求都经过 Chain 组合出来的 RoundTripper
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+//按顺序组合中间件, 第一个中间件最先拿到请求、最后拿到响应
+func Chain(base http.RoundTripper, middlewares ...Middleware) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		base = middlewares[i](base)
+	}
+	return base
+}
+
+//返回挂载了中间件的新client, 传入的client不会被修改
+func WithMiddleware(client *http.Client, middlewares ...Middleware) *http.Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if len(middlewares) == 0 {
+		return client
+	}
+	c := *client
+	c.Transport = Chain(client.Transport, middlewares...)
+	return &c
+}
+
+type apiMethodKey struct{}
+
+//给请求带上所属的api方法名, 之后的中间件通过 ApiMethod 读取. 见 NewInstrumentedApi
+func TagApiMethod(method string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return next.RoundTrip(req.WithContext(context.WithValue(req.Context(), apiMethodKey{}, method)))
+		})
+	}
+}
+
+//请求所属的api方法名(如 LimitBuy), 请求不是经由 NewInstrumentedApi 构建的api发出时为空
+func ApiMethod(ctx context.Context) string {
+	method, _ := ctx.Value(apiMethodKey{}).(string)
+	return method
+}
+
+//请求的接口名, 用于限频权重、日志和故障注入. 一般是路径的最后一段(如 trade.do);
+//所有接口共用一个路径、以 command 参数区分的交易所(如 poloniex 的 tradingApi)取 command 的值
+func RequestEndpoint(req *http.Request) string {
+	if command := req.URL.Query().Get("command"); command != "" {
+		return command
+	}
+	if req.Method == "POST" && req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			data, _ := ioutil.ReadAll(io.LimitReader(body, 64<<10))
+			body.Close()
+			if form, err := url.ParseQuery(string(data)); err == nil && form.Get("command") != "" {
+				return form.Get("command")
+			}
+		}
+	}
+	return path.Base(req.URL.Path)
+}
+
+//替换请求的 User-Agent
+func UserAgent(userAgent string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			req.Header.Set("User-Agent", userAgent)
+			return next.RoundTrip(req)
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package coinapi
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//记录经过的顺序, 请求前记 name+">", 响应后记 "<"+name
+func recordMiddleware(name string, trace *[]string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			*trace = append(*trace, name+">")
+			resp, err := next.RoundTrip(req)
+			*trace = append(*trace, "<"+name)
+			return resp, err
+		})
+	}
+}
+
+type okTransport struct {
+	trace *[]string
+}
+
+func (o *okTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	*o.trace = append(*o.trace, "base")
+	return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader("")), Request: req}, nil
+}
+
+func TestChain_Order(t *testing.T) {
+	var trace []string
+	rt := Chain(&okTransport{&trace}, recordMiddleware("a", &trace), recordMiddleware("b", &trace))
+	req, _ := http.NewRequest("GET", "https://example.com/api/v1/ticker.do", nil)
+	_, err := rt.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a>", "b>", "base", "<b", "<a"}, trace)
+}
+
+func TestRequestEndpoint(t *testing.T) {
+	req, _ := http.NewRequest("GET", "https://www.okcoin.cn/api/v1/ticker.do?symbol=btc_cny", nil)
+	assert.Equal(t, "ticker.do", RequestEndpoint(req))
+
+	req, _ = http.NewRequest("GET", "https://poloniex.com/public?command=returnOrderBook&currencyPair=BTC_ETH", nil)
+	assert.Equal(t, "returnOrderBook", RequestEndpoint(req))
+
+	//command 在POST body里, 读取之后body仍然可以正常发送
+	body := "command=returnBalances&nonce=1"
+	req, _ = http.NewRequest("POST", "https://poloniex.com/tradingApi", strings.NewReader(body))
+	assert.Equal(t, "returnBalances", RequestEndpoint(req))
+	data, err := ioutil.ReadAll(req.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, body, string(data))
+	again, err := req.GetBody()
+	assert.NoError(t, err)
+	data, _ = ioutil.ReadAll(again)
+	assert.Equal(t, body, string(data))
+
+	//没有 command 的POST取路径最后一段
+	req, _ = http.NewRequest("POST", "https://www.okcoin.cn/api/v1/trade.do", strings.NewReader("api_key=k&sign=s"))
+	assert.Equal(t, "trade.do", RequestEndpoint(req))
+}
+
+func TestWithMiddleware_DoesNotModifyClient(t *testing.T) {
+	var trace []string
+	base := &okTransport{&trace}
+	client := &http.Client{Transport: base}
+	wrapped := WithMiddleware(client, recordMiddleware("a", &trace))
+	assert.True(t, wrapped != client)
+	assert.True(t, client.Transport == base)
+
+	_, err := client.Get("https://example.com/a")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"base"}, trace)
+
+	trace = nil
+	_, err = wrapped.Get("https://example.com/a")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a>", "base", "<a"}, trace)
+
+	//没有中间件时原样返回
+	assert.True(t, WithMiddleware(client) == client)
+}
@@ -0,0 +1,83 @@
+package coinapi
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//nonce生成器, 返回值严格递增且不小于min.
+//min 一般由签名器根据请求时间算出(如毫秒时间戳), 保证nonce与时间大致同步
+type NonceProvider interface {
+	Next(min int64) (int64, error)
+}
+
+//并发安全的单调递增nonce, 设置了file时每次分配后都会持久化, 重启后从上次的值继续
+type MonotonicNonce struct {
+	mu   sync.Mutex
+	last int64
+	file string
+}
+
+func NewMonotonicNonce() *MonotonicNonce {
+	return &MonotonicNonce{}
+}
+
+//从file读取上次分配的nonce, 文件不存在时从0开始
+func NewFileNonce(file string) (*MonotonicNonce, error) {
+	n := &MonotonicNonce{file: file}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return n, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s := strings.TrimSpace(string(data)); s != "" {
+		n.last, err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+func (n *MonotonicNonce) Next(min int64) (int64, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	next := n.last + 1
+	if min > next {
+		next = min
+	}
+	if n.file != "" {
+		if err := n.persist(next); err != nil {
+			return 0, err
+		}
+	}
+	n.last = next
+	return next, nil
+}
+
+func (n *MonotonicNonce) persist(nonce int64) error {
+	return writeFileAtomic(n.file, []byte(strconv.FormatInt(nonce, 10)), 0600)
+}
+
+var (
+	sharedNoncesMu sync.Mutex
+	sharedNonces   = map[string]NonceProvider{}
+)
+
+//同一交易所、同一apiKey共用一个nonce序列, 否则多个api实例并发签名时nonce会冲突
+func SharedNonceProvider(exchange, apiKey string) NonceProvider {
+	key := exchange + "|" + apiKey
+	sharedNoncesMu.Lock()
+	defer sharedNoncesMu.Unlock()
+	if n, ok := sharedNonces[key]; ok {
+		return n
+	}
+	n := NewMonotonicNonce()
+	sharedNonces[key] = n
+	return n
+}
@@ -0,0 +1,53 @@
+package coinapi
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMonotonicNonce_Concurrent(t *testing.T) {
+	nonce := NewMonotonicNonce()
+	var mu sync.Mutex
+	seen := map[int64]bool{}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				n, err := nonce.Next(1000)
+				assert.NoError(t, err)
+				mu.Lock()
+				assert.False(t, seen[n], "duplicate nonce %d", n)
+				seen[n] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, seen, 800)
+
+	n, _ := nonce.Next(5000)
+	assert.Equal(t, int64(5000), n)
+	n, _ = nonce.Next(10)
+	assert.Equal(t, int64(5001), n)
+}
+
+func TestFileNonce_Persist(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "nonce")
+	nonce, err := NewFileNonce(file)
+	assert.NoError(t, err)
+	n, err := nonce.Next(100)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100), n)
+
+	//重启后本地时钟回拨, 仍然要比上次的nonce大
+	restarted, err := NewFileNonce(file)
+	assert.NoError(t, err)
+	n, err = restarted.Next(50)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(101), n)
+}
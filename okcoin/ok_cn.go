@@ -1,14 +1,12 @@
 package okcoin
 
 import (
-	"encoding/json"
-	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	. "github.com/qct/cryptocurrency-exchange-api"
 	"sort"
@@ -32,57 +30,53 @@ const (
 	WITHDRAW          = "withdraw.do"
 )
 
+//交易类接口限制为每个用户2秒20次, 这里按每秒10次、允许突发20次
+var DefaultRateLimitPolicy = RateLimitPolicy{
+	Rate:  10,
+	Burst: 20,
+	Weights: map[string]int{
+		URL_ORDERS_INFO:   2,
+		ORDER_HISTORY_URI: 2,
+		TRADE_URI:         2,
+		WITHDRAW:          5,
+		"kline.do":        2,
+	},
+}
+
 type OkCNApi struct {
-	client    *http.Client
-	apiKey    string
-	secretKey string
-	baseUrl   string
+	client  *http.Client
+	signer  Signer
+	baseUrl string
+	clock   Clock
+}
+
+func init() {
+	RegisterApi(OK_CN, ApiDriver{
+		New: func(config ApiConfig) (Api, error) {
+			return &OkCNApi{config.HttpClient, &CNSigner{Credentials: config.CredentialProvider()}, ResolveBaseUrl(URL_BASE, config.BaseUrl), ExchangeClock(OK_CN, config.BaseUrl)}, nil
+		},
+		DefaultRateLimit: DefaultRateLimitPolicy,
+		ServerTime:       ServerTime,
+	})
 }
 
 func NewOkCNApi(client *http.Client, apiKey, secretKey string) *OkCNApi {
-	return &OkCNApi{client, apiKey, secretKey, URL_BASE}
+	return &OkCNApi{client, &CNSigner{Credentials: StaticCredentials{ApiKey: apiKey, ApiSecretKey: secretKey}}, URL_BASE, ExchangeClock(OK_CN, "")}
 }
 
 func (o *OkCNApi) GetDepth(cp CurrencyPair, size int) (*Depth, error) {
-	var depth Depth
 	url := o.baseUrl + URL_DEPTH + "?symbol=" + cp.CustomSymbol("_", true) + "&size=" + strconv.Itoa(size)
-	bodyDataMap, err := HttpGet(o.client, url)
+	body, err := HttpGetBytes(o.client, url)
 	if err != nil {
 		return nil, err
 	}
 
-	if bodyDataMap["result"] != nil && !bodyDataMap["result"].(bool) {
-		return nil, errors.New(fmt.Sprintf("%.0f", bodyDataMap["error_code"].(float64)))
-	}
-
-	for _, v := range bodyDataMap["asks"].([]interface{}) {
-		var dr DepthRecord
-		for i, vv := range v.([]interface{}) {
-			switch i {
-			case 0:
-				dr.Price = vv.(float64)
-			case 1:
-				dr.Amount = vv.(float64)
-			}
-		}
-		depth.AskList = append(depth.AskList, dr)
-	}
-
-	for _, v := range bodyDataMap["bids"].([]interface{}) {
-		var dr DepthRecord
-		for i, vv := range v.([]interface{}) {
-			switch i {
-			case 0:
-				dr.Price = vv.(float64)
-			case 1:
-				dr.Amount = vv.(float64)
-			}
-		}
-		depth.BidList = append(depth.BidList, dr)
+	depth, err := parseDepth(o.GetExchangeName(), body)
+	if err != nil {
+		return nil, err
 	}
-
 	sort.Sort(depth.AskList)
-	return &depth, nil
+	return depth, nil
 }
 
 func (o *OkCNApi) LimitBuy(amount, price string, cp CurrencyPair) (*Order, error) {
@@ -105,22 +99,15 @@ func (o *OkCNApi) CancelOrder(orderId string, cp CurrencyPair) (bool, error) {
 	postData := url.Values{}
 	postData.Set("order_id", orderId)
 	postData.Set("symbol", cp.CustomSymbol("_", true))
-	o.buildPostForm(&postData)
-
-	body, err := HttpPostForm(o.client, o.baseUrl+URL_CANCEL_ORDER, postData)
+	body, err := o.signedPost(o.baseUrl+URL_CANCEL_ORDER, postData)
 	if err != nil {
 		return false, err
 	}
 
-	var respMap map[string]interface{}
-	err = json.Unmarshal(body, &respMap)
+	err = checkError(o.GetExchangeName(), body)
 	if err != nil {
 		return false, err
 	}
-	if !respMap["result"].(bool) {
-		return false, errors.New(string(body))
-	}
-
 	return true, nil
 }
 
@@ -130,7 +117,7 @@ func (o *OkCNApi) GetOneOrder(orderId string, cp CurrencyPair) (*Order, error) {
 		return nil, err
 	}
 	if len(orderAr) == 0 {
-		return nil, nil
+		return nil, &ApiError{Exchange: o.GetExchangeName(), Kind: ERR_KIND_INVALID_REQUEST, Message: "order " + orderId + " not found"}
 	}
 	return &orderAr[0], nil
 }
@@ -141,106 +128,20 @@ func (o *OkCNApi) GetUnfinishedOrders(cp CurrencyPair) ([]Order, error) {
 
 func (o *OkCNApi) GetAccount() (*Account, error) {
 	postData := url.Values{}
-	err := o.buildPostForm(&postData)
+	body, err := o.signedPost(o.baseUrl+URL_USERINFO, postData)
 	if err != nil {
 		return nil, err
 	}
-	body, err := HttpPostForm(o.client, o.baseUrl+URL_USERINFO, postData)
-	if err != nil {
-		return nil, err
-	}
-
-	var respMap map[string]interface{}
-	err = json.Unmarshal(body, &respMap)
-	if err != nil {
-		return nil, err
-	}
-	if !respMap["result"].(bool) {
-		errCode := strconv.FormatFloat(respMap["error_code"].(float64), 'f', 0, 64)
-		return nil, errors.New(errCode)
-	}
-
-	info, ok := respMap["info"].(map[string]interface{})
-	if !ok {
-		return nil, errors.New(string(body))
-	}
-
-	funds := info["funds"].(map[string]interface{})
-	asset := funds["asset"].(map[string]interface{})
-	free := funds["free"].(map[string]interface{})
-	freezed := funds["freezed"].(map[string]interface{})
-
-	account := new(Account)
-	account.Exchange = o.GetExchangeName()
-	account.Asset, _ = strconv.ParseFloat(asset["total"].(string), 64)
-	account.NetAsset, _ = strconv.ParseFloat(asset["net"].(string), 64)
-
-	var btcSubAccount SubAccount
-	var ltcSubAccount SubAccount
-	var cnySubAccount SubAccount
-	var ethSubAccount SubAccount
-	var etcSubAccount SubAccount
-	var bccSubAccount SubAccount
-
-	btcSubAccount.Currency = "BTC"
-	btcSubAccount.Amount, _ = strconv.ParseFloat(free["btc"].(string), 64)
-	btcSubAccount.LoanAmount = 0
-	btcSubAccount.FrozenAmount, _ = strconv.ParseFloat(freezed["btc"].(string), 64)
-
-	ltcSubAccount.Currency = "LTC"
-	ltcSubAccount.Amount, _ = strconv.ParseFloat(free["ltc"].(string), 64)
-	ltcSubAccount.LoanAmount = 0
-	ltcSubAccount.FrozenAmount, _ = strconv.ParseFloat(freezed["ltc"].(string), 64)
-
-	ethSubAccount.Currency = "ETH"
-	ethSubAccount.Amount, _ = strconv.ParseFloat(free["eth"].(string), 64)
-	ethSubAccount.LoanAmount = 0
-	ethSubAccount.FrozenAmount, _ = strconv.ParseFloat(freezed["eth"].(string), 64)
-
-	etcSubAccount.Currency = "ETC"
-	etcSubAccount.Amount = ToFloat64(free["etc"])
-	etcSubAccount.LoanAmount = 0
-	etcSubAccount.FrozenAmount = ToFloat64(freezed["etc"])
-
-	bccSubAccount.Currency = "BCC"
-	bccSubAccount.Amount = ToFloat64(free["bcc"])
-	bccSubAccount.LoanAmount = 0
-	bccSubAccount.FrozenAmount = ToFloat64(freezed["bcc"])
-
-	cnySubAccount.Currency = "CNY"
-	cnySubAccount.Amount, _ = strconv.ParseFloat(free["cny"].(string), 64)
-	cnySubAccount.LoanAmount = 0
-	cnySubAccount.FrozenAmount, _ = strconv.ParseFloat(freezed["cny"].(string), 64)
-
-	account.SubAccounts = make(map[string]SubAccount, 6)
-	account.SubAccounts["BTC"] = btcSubAccount
-	account.SubAccounts["LTC"] = ltcSubAccount
-	account.SubAccounts["ETH"] = ethSubAccount
-	account.SubAccounts["ETC"] = etcSubAccount
-	account.SubAccounts["BCC"] = bccSubAccount
-	account.SubAccounts["CNY"] = cnySubAccount
-	return account, nil
+	return parseAccount(o.GetExchangeName(), body)
 }
 
 func (o *OkCNApi) GetTicker(cp CurrencyPair) (*Ticker, error) {
 	url := o.baseUrl + URL_TICKER + "?symbol=" + cp.CustomSymbol("_", true)
-	bodyDataMap, err := HttpGet(o.client, url)
+	body, err := HttpGetBytes(o.client, url)
 	if err != nil {
 		return nil, err
 	}
-
-	var tickerMap map[string]interface{}
-	var ticker Ticker
-	tickerMap = bodyDataMap["ticker"].(map[string]interface{})
-	ticker.Date, _ = strconv.ParseUint(bodyDataMap["date"].(string), 10, 64)
-	ticker.Last, _ = strconv.ParseFloat(tickerMap["last"].(string), 64)
-	ticker.Buy, _ = strconv.ParseFloat(tickerMap["buy"].(string), 64)
-	ticker.Sell, _ = strconv.ParseFloat(tickerMap["sell"].(string), 64)
-	ticker.Low, _ = strconv.ParseFloat(tickerMap["low"].(string), 64)
-	ticker.High, _ = strconv.ParseFloat(tickerMap["high"].(string), 64)
-	ticker.Vol, _ = strconv.ParseFloat(tickerMap["vol"].(string), 64)
-
-	return &ticker, nil
+	return parseTicker(o.GetExchangeName(), body)
 }
 
 func (o *OkCNApi) Withdraw(amount, currency, fees, receiveAddr, memo, safePwd string) (string, error) {
@@ -251,27 +152,19 @@ func (o *OkCNApi) Withdraw(amount, currency, fees, receiveAddr, memo, safePwd st
 	postData.Set("chargefee", fees)
 	postData.Set("withdraw_address", receiveAddr)
 	postData.Set("trade_pwd", safePwd)
-	err := o.buildPostForm(&postData)
-	if err != nil {
-		return "", err
-	}
-	body, err := HttpPostForm(o.client, tradeUrl, postData)
+	body, err := o.signedPost(tradeUrl, postData)
 	if err != nil {
-		fmt.Println("WITHDRAW fail.", err)
 		return "", err
 	}
 
-	respMap := make(map[string]interface{})
-	err = json.Unmarshal(body, &respMap)
+	var resp struct {
+		WithdrawId JsonFloat64 `json:"withdraw_id"`
+	}
+	err = decodeResponse(o.GetExchangeName(), body, &resp)
 	if err != nil {
-		fmt.Println(err, string(body))
 		return "", err
 	}
-
-	if respMap["result"].(bool) {
-		return fmt.Sprintf("%.6f", respMap["withdraw_id"].(float64)), nil
-	}
-	return "", errors.New(string(body))
+	return fmt.Sprintf("%.6f", resp.WithdrawId), nil
 }
 
 func (o *OkCNApi) GetExchangeName() string {
@@ -280,15 +173,12 @@ func (o *OkCNApi) GetExchangeName() string {
 
 func (o *OkCNApi) GetKlineRecords(cp CurrencyPair, period string, size, since int) ([]Kline, error) {
 	klineUrl := o.baseUrl + fmt.Sprintf(URL_KLINE, cp.CustomSymbol("_", true), period, size, since)
-	resp, err := http.Get(klineUrl)
+	body, err := HttpGetBytes(o.client, klineUrl)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
-	var kLines [][]interface{}
-	err = json.Unmarshal(body, &kLines)
+	kLines, err := parseKlines(o.GetExchangeName(), body)
 	if err != nil {
 		return nil, err
 	}
@@ -296,22 +186,12 @@ func (o *OkCNApi) GetKlineRecords(cp CurrencyPair, period string, size, since in
 	var klineRecords []Kline
 	for _, record := range kLines {
 		r := Kline{}
-		for i, e := range record {
-			switch i {
-			case 0:
-				r.Timestamp = int64(e.(float64)) / 1000 //to unix timestramp
-			case 1:
-				r.Open = e.(float64)
-			case 2:
-				r.High = e.(float64)
-			case 3:
-				r.Low = e.(float64)
-			case 4:
-				r.Close = e.(float64)
-			case 5:
-				r.Vol = e.(float64)
-			}
-		}
+		r.Timestamp = int64(record[0]) / 1000 //to unix timestramp
+		r.Open = float64(record[1])
+		r.High = float64(record[2])
+		r.Low = float64(record[3])
+		r.Close = float64(record[4])
+		r.Vol = float64(record[5])
 		klineRecords = append(klineRecords, r)
 	}
 	return klineRecords, nil
@@ -325,52 +205,11 @@ func (o *OkCNApi) GetOrderHistory(cp CurrencyPair, currentPage, pageSize int) ([
 	postData.Set("current_page", fmt.Sprintf("%d", currentPage))
 	postData.Set("page_length", fmt.Sprintf("%d", pageSize))
 
-	err := o.buildPostForm(&postData)
+	body, err := o.signedPost(orderHistoryUrl, postData)
 	if err != nil {
 		return nil, err
 	}
-	body, err := HttpPostForm(o.client, orderHistoryUrl, postData)
-	if err != nil {
-		return nil, err
-	}
-	var respMap map[string]interface{}
-	err = json.Unmarshal(body, &respMap)
-	if err != nil {
-		return nil, err
-	}
-	if !respMap["result"].(bool) {
-		return nil, errors.New(string(body))
-	}
-
-	orders := respMap["orders"].([]interface{})
-	var orderAr []Order
-	for _, v := range orders {
-		orderMap := v.(map[string]interface{})
-		var order Order
-		order.CurrencyPair = cp.CustomSymbol("_", true)
-		order.OrderID = int(orderMap["order_id"].(float64))
-		order.Amount = orderMap["amount"].(float64)
-		order.Price = orderMap["price"].(float64)
-		order.DealAmount = orderMap["deal_amount"].(float64)
-		order.AvgPrice = orderMap["avg_price"].(float64)
-		order.OrderTime = int(orderMap["create_date"].(float64))
-		//status:-1:已撤销  0:未成交  1:部分成交  2:完全成交 4:撤单处理中
-		switch int(orderMap["status"].(float64)) {
-		case -1:
-			order.Status = ORDER_CANCEL
-		case 0:
-			order.Status = ORDER_UNFINISHED
-		case 1:
-			order.Status = ORDER_PART_FINISH
-		case 2:
-			order.Status = ORDER_FINISH
-		case 4:
-			order.Status = ORDER_CANCELING
-		}
-		order.Side = StringToTradeSide(strings.ToUpper(orderMap["type"].(string)))
-		orderAr = append(orderAr, order)
-	}
-	return orderAr, nil
+	return parseOrders(o.GetExchangeName(), body, cp)
 }
 
 func (o *OkCNApi) GetTrades(cp CurrencyPair, since int64) ([]Trade, error) {
@@ -378,85 +217,50 @@ func (o *OkCNApi) GetTrades(cp CurrencyPair, since int64) ([]Trade, error) {
 	postData := url.Values{}
 	postData.Set("symbol", cp.CustomSymbol("_", true))
 	postData.Set("since", fmt.Sprintf("%d", since))
-	err := o.buildPostForm(&postData)
-	if err != nil {
-		return nil, err
-	}
-	body, err := HttpPostForm(o.client, tradeUrl, postData)
-	if err != nil {
-		return nil, err
-	}
-
-	var trades []Trade
-	err = json.Unmarshal(body, &trades)
+	body, err := o.signedPost(tradeUrl, postData)
 	if err != nil {
 		return nil, err
 	}
-	return trades, nil
+	return parseTrades(o.GetExchangeName(), body)
 }
 
 func (o *OkCNApi) getOrders(orderId string, cp CurrencyPair) ([]Order, error) {
 	postData := url.Values{}
 	postData.Set("order_id", orderId)
 	postData.Set("symbol", cp.CustomSymbol("_", true))
-	o.buildPostForm(&postData)
-
-	body, err := HttpPostForm(o.client, o.baseUrl+URL_ORDER_INFO, postData)
-	if err != nil {
-		return nil, err
-	}
-
-	var respMap map[string]interface{}
-	err = json.Unmarshal(body, &respMap)
+	body, err := o.signedPost(o.baseUrl+URL_ORDER_INFO, postData)
 	if err != nil {
 		return nil, err
 	}
-	if !respMap["result"].(bool) {
-		return nil, errors.New(string(body))
-	}
+	return parseOrders(o.GetExchangeName(), body, cp)
+}
 
-	orders := respMap["orders"].([]interface{})
-	var orderAr []Order
-	for _, v := range orders {
-		orderMap := v.(map[string]interface{})
-		var order Order
-		order.CurrencyPair = cp.CustomSymbol("_", true)
-		order.OrderID = int(orderMap["order_id"].(float64))
-		order.Amount = orderMap["amount"].(float64)
-		order.Price = orderMap["price"].(float64)
-		order.DealAmount = orderMap["deal_amount"].(float64)
-		order.AvgPrice = orderMap["avg_price"].(float64)
-		order.OrderTime = int(orderMap["create_date"].(float64))
-
-		//status:-1:已撤销  0:未成交  1:部分成交  2:完全成交 4:撤单处理中
-		switch int(orderMap["status"].(float64)) {
-		case -1:
-			order.Status = ORDER_CANCEL
-		case 0:
-			order.Status = ORDER_UNFINISHED
-		case 1:
-			order.Status = ORDER_PART_FINISH
-		case 2:
-			order.Status = ORDER_FINISH
-		case 4:
-			order.Status = ORDER_CANCELING
+//用 ticker.do 返回的 date(秒) 作为服务端时间, 取这一秒的中点
+func ServerTime(client *http.Client, baseUrl string) ServerTimeFunc {
+	reqUrl := ResolveBaseUrl(URL_BASE, baseUrl) + URL_TICKER + "?symbol=btc_cny"
+	return func() (time.Time, error) {
+		body, err := HttpGetBytes(client, reqUrl)
+		if err != nil {
+			return time.Time{}, err
 		}
-		order.Side = StringToTradeSide(strings.ToUpper(orderMap["type"].(string)))
-		orderAr = append(orderAr, order)
+		ticker, err := parseTicker(OK_CN, body)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return MidSecond(time.Unix(int64(ticker.Date), 0)), nil
 	}
-	return orderAr, nil
 }
 
-func (o *OkCNApi) buildPostForm(postForm *url.Values) error {
-	postForm.Set("apiKey", o.apiKey)
-	payload := postForm.Encode()
-	payload = payload + "&secretKey=" + o.secretKey
-	sign, err := GetParamMD5Sign(o.secretKey, payload)
+func (o *OkCNApi) signedPost(reqUrl string, postData url.Values) ([]byte, error) {
+	u, err := url.Parse(reqUrl)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	postForm.Set("sign", strings.ToUpper(sign))
-	return nil
+	signed, err := o.signer.Sign("POST", u.Path, postData, o.clock.Now())
+	if err != nil {
+		return nil, err
+	}
+	return HttpPostForm2(o.client, reqUrl, signed.Params, signed.Headers)
 }
 
 func (o *OkCNApi) placeOrder(side TradeSide, amount, price string, cp CurrencyPair) (*Order, error) {
@@ -469,27 +273,21 @@ func (o *OkCNApi) placeOrder(side TradeSide, amount, price string, cp CurrencyPa
 	if side != SELL_MARKET {
 		postData.Set("price", price)
 	}
-	err := o.buildPostForm(&postData)
+	body, err := o.signedPost(o.baseUrl+URL_TRADE, postData)
 	if err != nil {
 		return nil, err
 	}
 
-	body, err := HttpPostForm(o.client, o.baseUrl+URL_TRADE, postData)
-	if err != nil {
-		return nil, err
+	var resp struct {
+		OrderId JsonInt64 `json:"order_id"`
 	}
-
-	var respMap map[string]interface{}
-	err = json.Unmarshal(body, &respMap)
+	err = decodeResponse(o.GetExchangeName(), body, &resp)
 	if err != nil {
 		return nil, err
 	}
-	if !respMap["result"].(bool) {
-		return nil, errors.New(string(body))
-	}
 
 	order := new(Order)
-	order.OrderID = int(respMap["order_id"].(float64))
+	order.OrderID = int(resp.OrderId)
 	order.Price, _ = strconv.ParseFloat(price, 64)
 	order.Amount, _ = strconv.ParseFloat(amount, 64)
 	order.CurrencyPair = cp.CustomSymbol("_", true)
@@ -497,3 +295,123 @@ func (o *OkCNApi) placeOrder(side TradeSide, amount, price string, cp CurrencyPa
 	order.Side = side
 	return order, nil
 }
+
+type okAccountResponse struct {
+	Info *struct {
+		Funds struct {
+			Asset struct {
+				Net   JsonFloat64 `json:"net"`
+				Total JsonFloat64 `json:"total"`
+			} `json:"asset"`
+			Free    map[string]JsonFloat64 `json:"free"`
+			Freezed map[string]JsonFloat64 `json:"freezed"`
+		} `json:"funds"`
+	} `json:"info"`
+}
+
+func parseAccount(exchange string, body []byte) (*Account, error) {
+	var resp okAccountResponse
+	err := decodeResponse(exchange, body, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Info == nil {
+		return nil, &DecodeError{Err: fmt.Errorf("missing info"), Body: body}
+	}
+	funds := resp.Info.Funds
+
+	account := new(Account)
+	account.Exchange = exchange
+	account.Asset = float64(funds.Asset.Total)
+	account.NetAsset = float64(funds.Asset.Net)
+	account.SubAccounts = make(map[string]SubAccount, len(funds.Free))
+	for currency, free := range funds.Free {
+		var subAccount SubAccount
+		subAccount.Currency = strings.ToUpper(currency)
+		subAccount.Amount = float64(free)
+		subAccount.LoanAmount = 0
+		subAccount.FrozenAmount = float64(funds.Freezed[currency])
+		account.SubAccounts[subAccount.Currency] = subAccount
+	}
+	return account, nil
+}
+
+type okOrder struct {
+	OrderId    JsonInt64   `json:"order_id"`
+	Amount     JsonFloat64 `json:"amount"`
+	Price      JsonFloat64 `json:"price"`
+	DealAmount JsonFloat64 `json:"deal_amount"`
+	AvgPrice   JsonFloat64 `json:"avg_price"`
+	CreateDate JsonInt64   `json:"create_date"`
+	Status     JsonInt64   `json:"status"`
+	Type       string      `json:"type"`
+}
+
+func parseOrders(exchange string, body []byte, cp CurrencyPair) ([]Order, error) {
+	var resp struct {
+		Orders []okOrder `json:"orders"`
+	}
+	err := decodeResponse(exchange, body, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	orderAr := []Order{}
+	for _, v := range resp.Orders {
+		var order Order
+		order.CurrencyPair = cp.CustomSymbol("_", true)
+		order.OrderID = int(v.OrderId)
+		order.Amount = float64(v.Amount)
+		order.Price = float64(v.Price)
+		order.DealAmount = float64(v.DealAmount)
+		order.AvgPrice = float64(v.AvgPrice)
+		order.OrderTime = int(v.CreateDate)
+		order.Status = orderStatus(int(v.Status))
+		order.Side = StringToTradeSide(strings.ToUpper(v.Type))
+		orderAr = append(orderAr, order)
+	}
+	return orderAr, nil
+}
+
+//status:-1:已撤销  0:未成交  1:部分成交  2:完全成交 4:撤单处理中
+func orderStatus(status int) TradeStatus {
+	switch status {
+	case -1:
+		return ORDER_CANCEL
+	case 0:
+		return ORDER_UNFINISHED
+	case 1:
+		return ORDER_PART_FINISH
+	case 2:
+		return ORDER_FINISH
+	case 4:
+		return ORDER_CANCELING
+	}
+	return 0
+}
+
+func parseTrades(exchange string, body []byte) ([]Trade, error) {
+	var resp []struct {
+		Tid    JsonInt64   `json:"tid"`
+		Type   string      `json:"type"`
+		Amount JsonFloat64 `json:"amount"`
+		Price  JsonFloat64 `json:"price"`
+		DateMs JsonInt64   `json:"date_ms"`
+	}
+	err := decodeResponse(exchange, body, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	trades := make([]Trade, 0, len(resp))
+	for _, v := range resp {
+		trades = append(trades, Trade{
+			Tid:    int64(v.Tid),
+			Type:   v.Type,
+			Amount: float64(v.Amount),
+			Price:  float64(v.Price),
+			Date:   int64(v.DateMs),
+		})
+	}
+	return trades, nil
+}
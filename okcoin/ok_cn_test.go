@@ -0,0 +1,176 @@
+package okcoin
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+	"github.com/qct/cryptocurrency-exchange-api/cassette"
+	"github.com/stretchr/testify/assert"
+)
+
+//回放 testdata/cassettes 下的请求. 现有的cassette是按接口文档手写的合成数据, 设置 CASSETTE_RECORD=1 和 OKCOIN_API_KEY/OKCOIN_SECRET_KEY 时对真实接口录制并覆盖
+
+var btcCny = NewCurrencyPair("BTC", "CNY")
+
+func replayClient(t *testing.T, name string) *http.Client {
+	recorder, err := cassette.New(filepath.Join("testdata", "cassettes", name+".json"), cassette.ModeFromEnv(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder.Redactor.AddSecret(os.Getenv("OKCOIN_API_KEY"), os.Getenv("OKCOIN_SECRET_KEY"))
+	t.Cleanup(func() {
+		assert.NoError(t, recorder.Stop())
+	})
+	return recorder.Client()
+}
+
+func newTestCNApi(t *testing.T, name string) *OkCNApi {
+	return NewOkCNApi(replayClient(t, name), os.Getenv("OKCOIN_API_KEY"), os.Getenv("OKCOIN_SECRET_KEY"))
+}
+
+func TestOkCNApi_GetTicker(t *testing.T) {
+	ticker, err := newTestCNApi(t, "OkCN_GetTicker").GetTicker(btcCny)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1506787200), ticker.Date)
+	assert.Equal(t, 28500.01, ticker.Buy)
+	assert.Equal(t, 28501.0, ticker.Sell)
+	assert.Equal(t, 28500.5, ticker.Last)
+	assert.Equal(t, 29000.0, ticker.High)
+	assert.Equal(t, 27800.0, ticker.Low)
+	assert.Equal(t, 12345.678, ticker.Vol)
+}
+
+//ticker 的 date 只精确到秒, 服务端时间取这一秒的中点
+func TestServerTime(t *testing.T) {
+	now, err := ServerTime(replayClient(t, "OkCN_GetTicker"), "")()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Unix(1506787200, 500*int64(time.Millisecond)), now)
+}
+
+func TestOkCNApi_GetDepth(t *testing.T) {
+	depth, err := newTestCNApi(t, "OkCN_GetDepth").GetDepth(btcCny, 3)
+	assert.NoError(t, err)
+	assert.Len(t, depth.AskList, 3)
+	assert.Len(t, depth.BidList, 3)
+	assert.Equal(t, 28501.0, depth.AskList[0].Price, "asks sorted by price")
+	assert.Equal(t, 28500.01, depth.BidList[0].Price)
+	assert.Equal(t, 2.0, depth.BidList[0].Amount)
+}
+
+func TestOkCNApi_GetKlineRecords(t *testing.T) {
+	klines, err := newTestCNApi(t, "OkCN_GetKlineRecords").GetKlineRecords(btcCny, "1min", 2, 1506787200000)
+	assert.NoError(t, err)
+	assert.Len(t, klines, 2)
+	assert.Equal(t, Kline{Timestamp: 1506787200, Open: 28400, High: 28450, Low: 28390, Close: 28420, Vol: 12.5}, klines[0])
+	assert.Equal(t, int64(1506787260), klines[1].Timestamp)
+}
+
+func TestOkCNApi_LimitBuy(t *testing.T) {
+	order, err := newTestCNApi(t, "OkCN_LimitBuy").LimitBuy("0.01", "28000", btcCny)
+	assert.NoError(t, err)
+	assert.Equal(t, 10001, order.OrderID)
+	assert.Equal(t, TradeSide(BUY), order.Side)
+	assert.Equal(t, 28000.0, order.Price)
+	assert.Equal(t, 0.01, order.Amount)
+	assert.Equal(t, TradeStatus(ORDER_UNFINISHED), order.Status)
+	assert.Equal(t, "btc_cny", order.CurrencyPair)
+}
+
+func TestOkCNApi_LimitSell(t *testing.T) {
+	order, err := newTestCNApi(t, "OkCN_LimitSell").LimitSell("0.01", "29000", btcCny)
+	assert.NoError(t, err)
+	assert.Equal(t, 10002, order.OrderID)
+	assert.Equal(t, TradeSide(SELL), order.Side)
+}
+
+func TestOkCNApi_MarketBuy(t *testing.T) {
+	order, err := newTestCNApi(t, "OkCN_MarketBuy").MarketBuy("", "100", btcCny)
+	assert.NoError(t, err)
+	assert.Equal(t, 10003, order.OrderID)
+	assert.Equal(t, TradeSide(BUY_MARKET), order.Side)
+}
+
+func TestOkCNApi_MarketSell(t *testing.T) {
+	order, err := newTestCNApi(t, "OkCN_MarketSell").MarketSell("0.01", "", btcCny)
+	assert.NoError(t, err)
+	assert.Equal(t, 10004, order.OrderID)
+	assert.Equal(t, TradeSide(SELL_MARKET), order.Side)
+}
+
+func TestOkCNApi_CancelOrder(t *testing.T) {
+	api := newTestCNApi(t, "OkCN_CancelOrder")
+	ok, err := api.CancelOrder("10001", btcCny)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = api.CancelOrder("404", btcCny)
+	assert.False(t, ok)
+	var apiErr *ApiError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, "10009", apiErr.Code)
+	assert.Equal(t, ErrorKind(ERR_KIND_INVALID_REQUEST), apiErr.Kind)
+}
+
+func TestOkCNApi_GetOneOrder(t *testing.T) {
+	order, err := newTestCNApi(t, "OkCN_GetOneOrder").GetOneOrder("10002", btcCny)
+	assert.NoError(t, err)
+	assert.Equal(t, 10002, order.OrderID)
+	assert.Equal(t, TradeSide(SELL), order.Side)
+	assert.Equal(t, TradeStatus(ORDER_PART_FINISH), order.Status)
+	assert.Equal(t, 0.004, order.DealAmount)
+	assert.Equal(t, 29000.0, order.AvgPrice)
+	assert.Equal(t, 1506787300000, order.OrderTime)
+}
+
+func TestOkCNApi_GetUnfinishedOrders(t *testing.T) {
+	orders, err := newTestCNApi(t, "OkCN_GetUnfinishedOrders").GetUnfinishedOrders(btcCny)
+	assert.NoError(t, err)
+	assert.Len(t, orders, 2)
+	assert.Equal(t, 10001, orders[0].OrderID)
+	assert.Equal(t, TradeStatus(ORDER_UNFINISHED), orders[0].Status)
+	assert.Equal(t, TradeSide(BUY), orders[0].Side)
+	assert.Equal(t, 10002, orders[1].OrderID)
+}
+
+func TestOkCNApi_GetOrderHistory(t *testing.T) {
+	orders, err := newTestCNApi(t, "OkCN_GetOrderHistory").GetOrderHistory(btcCny, 1, 20)
+	assert.NoError(t, err)
+	assert.Len(t, orders, 1)
+	assert.Equal(t, TradeStatus(ORDER_FINISH), orders[0].Status)
+	assert.Equal(t, 0.01, orders[0].DealAmount)
+}
+
+func TestOkCNApi_GetAccount(t *testing.T) {
+	account, err := newTestCNApi(t, "OkCN_GetAccount").GetAccount()
+	assert.NoError(t, err)
+	assert.Equal(t, EXCHANGE_NAME_CN, account.Exchange)
+	assert.Equal(t, 3020.5, account.Asset)
+	assert.Equal(t, 3010.5, account.NetAsset)
+	assert.Len(t, account.SubAccounts, 3)
+	assert.Equal(t, SubAccount{Currency: "BTC", Amount: 0.1, FrozenAmount: 0.01}, account.SubAccounts["BTC"])
+	assert.Equal(t, 150.25, account.SubAccounts["CNY"].Amount)
+}
+
+func TestOkCNApi_GetTrades(t *testing.T) {
+	trades, err := newTestCNApi(t, "OkCN_GetTrades").GetTrades(btcCny, 5000)
+	assert.NoError(t, err)
+	assert.Equal(t, []Trade{
+		{Tid: 5001, Type: "buy", Amount: 0.02, Price: 28500.5, Date: 1506787200123},
+		{Tid: 5002, Type: "sell", Amount: 0.5, Price: 28499, Date: 1506787201456},
+	}, trades)
+}
+
+func TestOkCNApi_Withdraw(t *testing.T) {
+	id, err := newTestCNApi(t, "OkCN_Withdraw").Withdraw("0.1", "BTC", "0.0001", "1BoatSLRHtKNngkdXEeobR76b53LETtpyT", "", "123456")
+	assert.NoError(t, err)
+	assert.Equal(t, "301.000000", id)
+}
+
+func TestOkCNApi_GetExchangeName(t *testing.T) {
+	assert.Equal(t, EXCHANGE_NAME_CN, NewOkCNApi(http.DefaultClient, "", "").GetExchangeName())
+}
@@ -0,0 +1,128 @@
+package okcoin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+)
+
+//okcoin v1 接口的通用返回字段, 出错时 result 为 false 并带 error_code
+type okResult struct {
+	Result    *bool     `json:"result"`
+	ErrorCode JsonInt64 `json:"error_code"`
+}
+
+func errorKind(code int64) ErrorKind {
+	switch code {
+	case 10005, 10006, 10007, 10017, 20001, 20002, 20003:
+		return ERR_KIND_AUTH
+	case 10010, 10016:
+		return ERR_KIND_INSUFFICIENT_FUNDS
+	case 10000, 10008, 10009, 10011, 10024, 20007, 20009, 20015, 20016:
+		return ERR_KIND_INVALID_REQUEST
+	}
+	return ERR_KIND_UNKNOWN
+}
+
+//检查响应是否为错误, 数组格式的响应(kline等)不是错误
+func checkError(exchange string, body []byte) error {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return &DecodeError{Err: fmt.Errorf("empty response"), Body: body}
+	}
+	if body[0] != '{' {
+		return nil
+	}
+
+	var r okResult
+	if err := json.Unmarshal(body, &r); err != nil {
+		return &DecodeError{Err: err, Body: body}
+	}
+	if r.ErrorCode != 0 || (r.Result != nil && !*r.Result) {
+		return &ApiError{
+			Exchange: exchange,
+			Kind:     errorKind(int64(r.ErrorCode)),
+			Code:     fmt.Sprintf("%d", r.ErrorCode),
+			Message:  string(body),
+		}
+	}
+	return nil
+}
+
+//先检查错误, 再反序列化到result
+func decodeResponse(exchange string, body []byte, result interface{}) error {
+	if err := checkError(exchange, body); err != nil {
+		return err
+	}
+	return DecodeJSON(body, result)
+}
+
+type okDepthResponse struct {
+	Asks JsonDepthEntries `json:"asks"`
+	Bids JsonDepthEntries `json:"bids"`
+}
+
+func parseDepth(exchange string, body []byte) (*Depth, error) {
+	var resp okDepthResponse
+	if err := decodeResponse(exchange, body, &resp); err != nil {
+		return nil, err
+	}
+
+	var err error
+	depth := new(Depth)
+	if depth.AskList, err = resp.Asks.DepthRecords(); err != nil {
+		return nil, &DecodeError{Err: err, Body: body}
+	}
+	if depth.BidList, err = resp.Bids.DepthRecords(); err != nil {
+		return nil, &DecodeError{Err: err, Body: body}
+	}
+	return depth, nil
+}
+
+type okTickerResponse struct {
+	Date   JsonInt64 `json:"date"`
+	Ticker *struct {
+		Buy  JsonFloat64 `json:"buy"`
+		Sell JsonFloat64 `json:"sell"`
+		Last JsonFloat64 `json:"last"`
+		High JsonFloat64 `json:"high"`
+		Low  JsonFloat64 `json:"low"`
+		Vol  JsonFloat64 `json:"vol"`
+	} `json:"ticker"`
+}
+
+func parseTicker(exchange string, body []byte) (*Ticker, error) {
+	var resp okTickerResponse
+	if err := decodeResponse(exchange, body, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Ticker == nil {
+		return nil, &DecodeError{Err: fmt.Errorf("missing ticker"), Body: body}
+	}
+
+	ticker := new(Ticker)
+	ticker.Date = uint64(resp.Date)
+	ticker.Buy = float64(resp.Ticker.Buy)
+	ticker.Sell = float64(resp.Ticker.Sell)
+	ticker.Last = float64(resp.Ticker.Last)
+	ticker.High = float64(resp.Ticker.High)
+	ticker.Low = float64(resp.Ticker.Low)
+	ticker.Vol = float64(resp.Ticker.Vol)
+	return ticker, nil
+}
+
+//[[时间戳(毫秒), 开, 高, 低, 收, 量, (币量)], ...]
+func parseKlines(exchange string, body []byte) ([][]JsonFloat64, error) {
+	var kLines [][]JsonFloat64
+	if err := decodeResponse(exchange, body, &kLines); err != nil {
+		return nil, err
+	}
+	for _, record := range kLines {
+		if len(record) < 6 {
+			return nil, &DecodeError{Err: fmt.Errorf("invalid kline record %v", record), Body: body}
+		}
+	}
+	return kLines, nil
+}
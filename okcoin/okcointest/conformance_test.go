@@ -0,0 +1,39 @@
+package okcointest
+
+import (
+	"testing"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+	"github.com/qct/cryptocurrency-exchange-api/apitest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_ApiConformance(t *testing.T) {
+	s := NewServer("key", "secret")
+	defer s.Close()
+	s.SetPrice("btc_cny", 28000, 28010)
+	s.SetBalance("cny", 100000)
+	s.SetBalance("btc", 1)
+	api, err := s.Api()
+	assert.NoError(t, err)
+
+	apitest.TestApi(t, apitest.Config{Api: api, Pair: btcCny, Amount: 0.1, SafePwd: "123456"})
+}
+
+func TestServer_FutureApiConformance(t *testing.T) {
+	s := NewServer("key", "secret")
+	defer s.Close()
+	s.SetFuturePrice("btc_usd", THIS_WEEK_CONTRACT, 4000, 4001)
+	s.SetFutureIndex("btc_usd", 4000.5)
+	s.SetFutureBalance("btc", 1)
+	api, err := s.FutureApi()
+	assert.NoError(t, err)
+
+	apitest.TestFutureApi(t, apitest.FutureConfig{
+		Api:          api,
+		Pair:         btcUsd,
+		ContractType: THIS_WEEK_CONTRACT,
+		Amount:       10,
+		LeverRate:    10,
+	})
+}
@@ -0,0 +1,481 @@
+package okcointest
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+
+	"github.com/qct/cryptocurrency-exchange-api/margin"
+)
+
+//币本位合约: 每张合约面值 btc 100美元, 其他币种10美元, 盈亏和保证金以币计
+type futureFund struct {
+	balance    float64 //静态权益, 包含已实现盈亏
+	profitReal float64
+}
+
+type position struct {
+	margin.Position
+	symbol, contractType string
+	contractId           int64
+	createDate           int64
+}
+
+type futureOrder struct {
+	id                   int64
+	symbol, contractType string
+	otype                int //1:开多 2:开空 3:平多 4:平空
+	price                float64
+	amount               float64
+	dealAmount           float64
+	avgPrice             float64
+	leverRate            int
+	matchPrice           bool
+	status               int
+	createDate           int64
+}
+
+func futureKey(symbol, contractType string) string {
+	return symbol + "/" + contractType
+}
+
+func contractValue(symbol string) float64 {
+	if strings.HasPrefix(symbol, "btc_") {
+		return 100
+	}
+	return 10
+}
+
+func (o *futureOrder) open() bool {
+	return o.status == 0 || o.status == 1
+}
+
+func (o *futureOrder) isBuy() bool {
+	return margin.IsBuy(o.otype)
+}
+
+func (o *futureOrder) json() map[string]interface{} {
+	base, _ := splitSymbol(o.symbol)
+	return map[string]interface{}{
+		"order_id":      o.id,
+		"symbol":        o.symbol,
+		"contract_name": strings.ToUpper(base) + "_" + o.contractType,
+		"type":          o.otype,
+		"price":         o.price,
+		"amount":        o.amount,
+		"deal_amount":   o.dealAmount,
+		"price_avg":     o.avgPrice,
+		"fee":           0,
+		"lever_rate":    o.leverRate,
+		"status":        o.status,
+		"create_date":   o.createDate,
+		"unit_amount":   contractValue(o.symbol),
+	}
+}
+
+//设置合约账户的权益, currency 如 btc
+func (s *Server) SetFutureBalance(currency string, amount float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fund(strings.ToLower(currency)).balance = amount
+}
+
+//合约账户权益, 包含未实现盈亏
+func (s *Server) FutureRights(currency string) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	currency = strings.ToLower(currency)
+	return s.fund(currency).balance + s.profitUnreal(currency)
+}
+
+//设置合约(如 btc_usd, this_week)的买一卖一价, 并撮合价格已经到达的挂单
+func (s *Server) SetFuturePrice(symbol, contractType string, bid, ask float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setMarket(futureKey(symbol, contractType), bid, ask)
+	for _, o := range s.futures {
+		if o.symbol == symbol && o.contractType == contractType && o.open() {
+			s.matchFutureOrder(o, false)
+		}
+	}
+}
+
+func (s *Server) fund(currency string) *futureFund {
+	f, ok := s.futureFunds[currency]
+	if !ok {
+		f = &futureFund{}
+		s.futureFunds[currency] = f
+	}
+	return f
+}
+
+func (s *Server) position(symbol, contractType string) *position {
+	key := futureKey(symbol, contractType)
+	p, ok := s.positions[key]
+	if !ok {
+		p = &position{
+			Position:     margin.Position{ContractValue: contractValue(symbol)},
+			symbol:       symbol,
+			contractType: contractType,
+			contractId:   s.markets[key].contractId,
+			createDate:   s.nowMs(),
+		}
+		s.positions[key] = p
+	}
+	return p
+}
+
+//持仓保证金加上开仓挂单冻结的保证金
+func (s *Server) keepDeposit(currency string) float64 {
+	deposit := 0.0
+	for _, p := range s.positions {
+		if base, _ := splitSymbol(p.symbol); base == currency {
+			deposit += p.Margin()
+		}
+	}
+	for _, o := range s.futures {
+		if base, _ := splitSymbol(o.symbol); base == currency && o.open() && margin.IsOpen(o.otype) {
+			deposit += s.orderMargin(o)
+		}
+	}
+	return deposit
+}
+
+func (s *Server) orderMargin(o *futureOrder) float64 {
+	price := o.price
+	if o.matchPrice || price == 0 {
+		m := s.markets[futureKey(o.symbol, o.contractType)]
+		if price = m.bid; o.isBuy() {
+			price = m.ask
+		}
+	}
+	return margin.Deposit(o.amount-o.dealAmount, contractValue(o.symbol), price, o.leverRate)
+}
+
+//按平仓能成交的价格(多头买一, 空头卖一)计算未实现盈亏
+func (s *Server) profitUnreal(currency string) float64 {
+	profit := 0.0
+	for key, p := range s.positions {
+		if base, _ := splitSymbol(p.symbol); base != currency {
+			continue
+		}
+		m := s.markets[key]
+		profit += p.ProfitUnreal(m.bid, m.ask)
+	}
+	return profit
+}
+
+//未完成平仓单剩余的张数, 从 buy_available/sell_available 中扣除
+func (s *Server) pendingClose(symbol, contractType string, otype int) float64 {
+	pending := 0.0
+	for _, o := range s.futures {
+		if o.symbol == symbol && o.contractType == contractType && o.otype == otype && o.open() {
+			pending += o.amount - o.dealAmount
+		}
+	}
+	return pending
+}
+
+func (s *Server) futureMarket(params url.Values) (*market, int) {
+	m, ok := s.markets[futureKey(params.Get("symbol"), params.Get("contract_type"))]
+	if !ok {
+		return nil, ERR_INVALID_PARAMS
+	}
+	return m, 0
+}
+
+func (s *Server) futureTicker(params url.Values) (interface{}, int) {
+	m, code := s.futureMarket(params)
+	if code != 0 {
+		return nil, code
+	}
+	resp := tickerResponse(s.Now().Unix(), m)
+	ticker := resp["ticker"].(map[string]interface{})
+	ticker["contract_id"] = m.contractId
+	ticker["unit_amount"] = contractValue(params.Get("symbol"))
+	return resp, 0
+}
+
+//设置 future_index.do 返回的指数(如 btc_usd), 交割预估价也取这个值
+func (s *Server) SetFutureIndex(symbol string, index float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.indexes[symbol] = index
+}
+
+func (s *Server) futureIndex(params url.Values) (interface{}, int) {
+	index, ok := s.indexes[params.Get("symbol")]
+	if !ok {
+		return nil, ERR_INVALID_PARAMS
+	}
+	return map[string]interface{}{"future_index": index}, 0
+}
+
+//交割前一小时才有真实的预估价, 模拟服务一直按指数返回
+func (s *Server) futureEstimatedPrice(params url.Values) (interface{}, int) {
+	index, ok := s.indexes[params.Get("symbol")]
+	if !ok {
+		return nil, ERR_INVALID_PARAMS
+	}
+	return map[string]interface{}{"forecast_price": index}, 0
+}
+
+func (s *Server) exchangeRate(params url.Values) (interface{}, int) {
+	return map[string]interface{}{"rate": s.ExchangeRate}, 0
+}
+
+//[[时间(毫秒), 开, 高, 低, 收, 成交量(张), 成交量(币)], ...]
+func (s *Server) futureKline(params url.Values) (interface{}, int) {
+	m, code := s.futureMarket(params)
+	if code != 0 {
+		return nil, code
+	}
+	candles, code := s.klines(m, params)
+	if code != 0 {
+		return nil, code
+	}
+	cv := contractValue(params.Get("symbol"))
+	records := [][]float64{}
+	for _, c := range candles {
+		records = append(records, []float64{float64(c.timestamp), c.open, c.high, c.low, c.close, c.vol, c.coinVol * cv})
+	}
+	return records, 0
+}
+
+func (s *Server) futureDepth(params url.Values) (interface{}, int) {
+	m, code := s.futureMarket(params)
+	if code != 0 {
+		return nil, code
+	}
+	symbol, contractType := params.Get("symbol"), params.Get("contract_type")
+	asks := map[float64]float64{m.ask: DEFAULT_LIQUIDITY}
+	bids := map[float64]float64{m.bid: DEFAULT_LIQUIDITY}
+	for _, o := range s.futures {
+		if o.symbol != symbol || o.contractType != contractType || !o.open() || o.matchPrice {
+			continue
+		}
+		if o.isBuy() {
+			bids[o.price] += o.amount - o.dealAmount
+		} else {
+			asks[o.price] += o.amount - o.dealAmount
+		}
+	}
+	size := parseInt(params, "size", 200)
+	return map[string]interface{}{
+		"asks": depthLevels(asks, size, true),
+		"bids": depthLevels(bids, size, false),
+	}, 0
+}
+
+func (s *Server) futureUserInfo(params url.Values) (interface{}, int) {
+	info := map[string]interface{}{}
+	for currency, f := range s.futureFunds {
+		deposit, unreal := s.keepDeposit(currency), s.profitUnreal(currency)
+		rights := f.balance + unreal
+		riskRate := 10000.0
+		if deposit > 0 {
+			riskRate = rights / deposit
+		}
+		info[currency] = map[string]float64{
+			"account_rights": rights,
+			"keep_deposit":   deposit,
+			"profit_real":    f.profitReal,
+			"profit_unreal":  unreal,
+			"risk_rate":      riskRate,
+		}
+	}
+	return map[string]interface{}{"result": true, "info": info}, 0
+}
+
+//开仓检查可用保证金, 平仓检查可平数量; match_price=1 时按对手价立即成交
+func (s *Server) futureTrade(params url.Values) (interface{}, int) {
+	m, code := s.futureMarket(params)
+	if code != 0 {
+		return nil, code
+	}
+	o := &futureOrder{
+		id:           s.newId(),
+		symbol:       params.Get("symbol"),
+		contractType: params.Get("contract_type"),
+		otype:        parseInt(params, "type", 0),
+		leverRate:    parseInt(params, "lever_rate", 10),
+		matchPrice:   params.Get("match_price") == "1",
+		createDate:   s.nowMs(),
+	}
+	if o.amount, code = parseAmount(params, "amount"); code != 0 {
+		return nil, code
+	}
+	if o.amount != math.Trunc(o.amount) || (o.leverRate != 10 && o.leverRate != 20) {
+		return nil, ERR_INVALID_PARAMS
+	}
+	if !o.matchPrice {
+		if o.price, code = parseAmount(params, "price"); code != 0 {
+			return nil, code
+		}
+	}
+
+	base, _ := splitSymbol(o.symbol)
+	switch o.otype {
+	case 1, 2:
+		if m.bid <= 0 || m.ask <= 0 {
+			return nil, ERR_INVALID_PARAMS
+		}
+		if s.fund(base).balance-s.keepDeposit(base)+epsilon < s.orderMargin(o) {
+			return nil, ERR_INSUFFICIENT_BALANCE
+		}
+	case 3, 4:
+		held := 0.0
+		if p := s.positions[futureKey(o.symbol, o.contractType)]; p != nil {
+			held = p.Held(o.otype)
+		}
+		if o.amount > held-s.pendingClose(o.symbol, o.contractType, o.otype)+epsilon {
+			return nil, ERR_FUTURE_CLOSE_AMOUNT
+		}
+	default:
+		return nil, ERR_INVALID_PARAMS
+	}
+
+	s.futures = append(s.futures, o)
+	s.matchFutureOrder(o, true)
+	return map[string]interface{}{"result": true, "order_id": o.id}, 0
+}
+
+func (s *Server) matchFutureOrder(o *futureOrder, taker bool) {
+	m := s.markets[futureKey(o.symbol, o.contractType)]
+	switch {
+	case o.isBuy() && m.ask > 0 && (o.matchPrice || o.price >= m.ask):
+		price := o.price
+		if taker || o.matchPrice {
+			price = m.ask
+		}
+		s.fillFutureOrder(o, price)
+	case !o.isBuy() && m.bid > 0 && (o.matchPrice || o.price <= m.bid):
+		price := o.price
+		if taker || o.matchPrice {
+			price = m.bid
+		}
+		s.fillFutureOrder(o, price)
+	}
+}
+
+func (s *Server) fillFutureOrder(o *futureOrder, price float64) {
+	base, _ := splitSymbol(o.symbol)
+	f, p := s.fund(base), s.position(o.symbol, o.contractType)
+	n := o.amount - o.dealAmount
+	profit := p.Fill(o.otype, price, n, o.leverRate)
+	f.balance += profit
+	f.profitReal += profit
+
+	o.avgPrice = price
+	o.dealAmount = o.amount
+	o.status = 2
+	s.markets[futureKey(o.symbol, o.contractType)].trade(price, n, s.nowMs())
+}
+
+func (s *Server) findFutureOrder(symbol, contractType, id string) *futureOrder {
+	for _, o := range s.futures {
+		if o.symbol == symbol && o.contractType == contractType && fmt.Sprintf("%d", o.id) == id {
+			return o
+		}
+	}
+	return nil
+}
+
+func (s *Server) futureCancel(params url.Values) (interface{}, int) {
+	o := s.findFutureOrder(params.Get("symbol"), params.Get("contract_type"), params.Get("order_id"))
+	if o == nil || !o.open() {
+		return nil, ERR_FUTURE_NOT_EXIST
+	}
+	o.status = -1
+	return map[string]interface{}{"result": true, "order_id": fmt.Sprintf("%d", o.id)}, 0
+}
+
+//order_id 为-1时按 status(1:未完成 2:已完成) 分页查询
+func (s *Server) futureOrderInfo(params url.Values) (interface{}, int) {
+	symbol, contractType, id := params.Get("symbol"), params.Get("contract_type"), params.Get("order_id")
+	if id != "-1" {
+		return s.futureOrdersInfo(params)
+	}
+
+	unfinished := params.Get("status") != "2"
+	var matched []*futureOrder
+	for i := len(s.futures) - 1; i >= 0; i-- {
+		if o := s.futures[i]; o.symbol == symbol && o.contractType == contractType && o.open() == unfinished {
+			matched = append(matched, o)
+		}
+	}
+	page, pageLength := parseInt(params, "current_page", 1), parseInt(params, "page_length", 50)
+	if page < 1 || pageLength < 1 || pageLength > 50 {
+		return nil, ERR_INVALID_PARAMS
+	}
+	orders := []map[string]interface{}{}
+	for i := (page - 1) * pageLength; i < len(matched) && i < page*pageLength; i++ {
+		orders = append(orders, matched[i].json())
+	}
+	return map[string]interface{}{"result": true, "orders": orders}, 0
+}
+
+//order_id 为逗号分隔的多个订单号
+func (s *Server) futureOrdersInfo(params url.Values) (interface{}, int) {
+	symbol, contractType := params.Get("symbol"), params.Get("contract_type")
+	orders := []map[string]interface{}{}
+	for _, id := range strings.Split(params.Get("order_id"), ",") {
+		if o := s.findFutureOrder(symbol, contractType, id); o != nil {
+			orders = append(orders, o.json())
+		}
+	}
+	return map[string]interface{}{"result": true, "orders": orders}, 0
+}
+
+func (s *Server) futurePosition(params url.Values) (interface{}, int) {
+	symbol, contractType := params.Get("symbol"), params.Get("contract_type")
+	holding := []map[string]interface{}{}
+	if p, ok := s.positions[futureKey(symbol, contractType)]; ok && !p.Empty() {
+		holding = append(holding, map[string]interface{}{
+			"symbol":           p.symbol,
+			"contract_type":    p.contractType,
+			"contract_id":      p.contractId,
+			"lever_rate":       p.LeverRate,
+			"create_date":      p.createDate,
+			"buy_amount":       p.BuyAmount,
+			"buy_available":    p.BuyAmount - s.pendingClose(symbol, contractType, 3),
+			"buy_price_avg":    p.BuyPriceAvg,
+			"buy_price_cost":   p.BuyPriceAvg,
+			"buy_profit_real":  p.BuyProfitReal,
+			"sell_amount":      p.SellAmount,
+			"sell_available":   p.SellAmount - s.pendingClose(symbol, contractType, 4),
+			"sell_price_avg":   p.SellPriceAvg,
+			"sell_price_cost":  p.SellPriceAvg,
+			"sell_profit_real": p.SellProfitReal,
+		})
+	}
+	return map[string]interface{}{"result": true, "force_liqu_price": "0.00", "holding": holding}, 0
+}
+
+//type 1:币币转合约 2:合约转币币, 转出不能超过可用保证金
+func (s *Server) futureDevolve(params url.Values) (interface{}, int) {
+	base, _ := splitSymbol(params.Get("symbol"))
+	amount, code := parseAmount(params, "amount")
+	if code != 0 {
+		return nil, code
+	}
+	f := s.fund(base)
+	switch params.Get("type") {
+	case "1":
+		if s.free[base]+epsilon < amount {
+			return nil, ERR_INSUFFICIENT_COIN
+		}
+		s.free[base] -= amount
+		f.balance += amount
+	case "2":
+		if f.balance-s.keepDeposit(base)+math.Min(0, s.profitUnreal(base))+epsilon < amount {
+			return nil, ERR_INSUFFICIENT_BALANCE
+		}
+		f.balance -= amount
+		s.free[base] += amount
+	default:
+		return nil, ERR_INVALID_PARAMS
+	}
+	return map[string]interface{}{"result": true}, 0
+}
@@ -0,0 +1,395 @@
+//okcoin v1 rest接口的本地模拟, 用于不访问网络地测试 OkCNApi/OkExApi 和上层策略.
+//服务端保存余额、挂单和成交, 按交易所的算法校验md5签名; 行情由测试通过 SetPrice/SetFuturePrice 设置,
+//价格变化时撮合挂单
+package okcointest
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+	_ "github.com/qct/cryptocurrency-exchange-api/okcoin"
+)
+
+const API_PATH = "/api/v1/"
+
+//返回的错误码, 与交易所一致
+const (
+	ERR_PARAMS_EMPTY         = 10000 //必选参数不能为空
+	ERR_API_KEY_NOT_EXIST    = 10006 //apiKey不存在
+	ERR_SIGN_MISMATCH        = 10007 //签名不匹配
+	ERR_INVALID_PARAMS       = 10008 //非法参数
+	ERR_ORDER_NOT_EXIST      = 10009 //订单不存在
+	ERR_INSUFFICIENT_BALANCE = 10010 //余额不足
+	ERR_INSUFFICIENT_COIN    = 10016 //币数量不足
+	ERR_FUTURE_NOT_EXIST     = 20015 //合约订单不存在
+	ERR_FUTURE_CLOSE_AMOUNT  = 20016 //平仓数量大于可平仓数量
+)
+
+//每档默认挂单量, 模拟盘口外的流动性
+const DEFAULT_LIQUIDITY = 1000
+
+type Server struct {
+	*httptest.Server
+	ApiKey    string
+	SecretKey string
+	Now       func() time.Time //订单和成交时间, 默认 time.Now
+	//exchange_rate.do 返回的美元人民币汇率
+	ExchangeRate float64
+
+	mu          sync.Mutex
+	nextId      int64
+	markets     map[string]*market //spot: btc_cny; future: btc_usd/this_week
+	free        map[string]float64
+	frozen      map[string]float64
+	orders      []*order
+	fills       []fill
+	futureFunds map[string]*futureFund
+	positions   map[string]*position
+	futures     []*futureOrder
+	indexes     map[string]float64 //future_index.do 的指数, key 为 btc_usd
+	withdrawals []withdrawal
+}
+
+type market struct {
+	bid, ask   float64
+	last       float64
+	high, low  float64
+	vol        float64
+	contractId int64
+	ticks      []tick //所有成交, 用于生成K线
+}
+
+type tick struct {
+	dateMs        int64
+	price, amount float64
+}
+
+type order struct {
+	id         int64
+	symbol     string
+	side       string //buy, sell, buy_market, sell_market
+	price      float64
+	amount     float64
+	dealAmount float64
+	avgPrice   float64
+	status     int //-1:已撤销 0:未成交 1:部分成交 2:完全成交
+	createDate int64
+}
+
+type fill struct {
+	tid    int64
+	symbol string
+	side   string
+	price  float64
+	amount float64
+	dateMs int64
+}
+
+type withdrawal struct {
+	id       int64
+	currency string
+	address  string
+	amount   float64
+	fee      float64
+}
+
+//启动模拟服务, 只接受用apiKey/secretKey签名的请求
+func NewServer(apiKey, secretKey string) *Server {
+	s := &Server{
+		ApiKey:       apiKey,
+		SecretKey:    secretKey,
+		Now:          time.Now,
+		ExchangeRate: 6.5,
+		nextId:       1000,
+		markets:      map[string]*market{},
+		free:         map[string]float64{},
+		frozen:       map[string]float64{},
+		futureFunds:  map[string]*futureFund{},
+		positions:    map[string]*position{},
+		indexes:      map[string]float64{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+//通过注册表构建指向模拟服务的 OkCNApi
+func (s *Server) Api() (Api, error) {
+	driver, err := LookupApi(OK_CN)
+	if err != nil {
+		return nil, err
+	}
+	return driver.New(s.config())
+}
+
+//通过注册表构建指向模拟服务的 OkExApi
+func (s *Server) FutureApi() (FutureApi, error) {
+	driver, err := LookupFutureApi(OK_EX)
+	if err != nil {
+		return nil, err
+	}
+	return driver.New(s.config())
+}
+
+func (s *Server) config() ApiConfig {
+	return ApiConfig{HttpClient: s.Client(), ApiKey: s.ApiKey, ApiSecretKey: s.SecretKey, BaseUrl: s.URL}
+}
+
+//设置币币账户的可用余额, currency 如 cny、btc
+func (s *Server) SetBalance(currency string, amount float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.free[strings.ToLower(currency)] = amount
+}
+
+//币币账户的可用和冻结余额
+func (s *Server) Balance(currency string) (free, frozen float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	currency = strings.ToLower(currency)
+	return s.free[currency], s.frozen[currency]
+}
+
+//设置现货买一卖一价(如 btc_cny), 并撮合价格已经到达的挂单
+func (s *Server) SetPrice(symbol string, bid, ask float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setMarket(symbol, bid, ask)
+	for _, o := range s.orders {
+		if o.symbol == symbol && o.open() {
+			s.matchOrder(o, false)
+		}
+	}
+}
+
+func (s *Server) setMarket(key string, bid, ask float64) *market {
+	m, ok := s.markets[key]
+	if !ok {
+		m = &market{high: ask, low: bid, contractId: s.newId()}
+		s.markets[key] = m
+	}
+	m.bid, m.ask = bid, ask
+	if m.last == 0 {
+		m.last = (bid + ask) / 2
+	}
+	return m
+}
+
+//成交后更新最新价、最高最低价和成交量, 并记录到K线
+func (m *market) trade(price, amount float64, dateMs int64) {
+	m.ticks = append(m.ticks, tick{dateMs, price, amount})
+	m.last = price
+	if price > m.high {
+		m.high = price
+	}
+	if price < m.low {
+		m.low = price
+	}
+	m.vol += amount
+}
+
+func (s *Server) newId() int64 {
+	s.nextId++
+	return s.nextId
+}
+
+func (s *Server) nowMs() int64 {
+	return s.Now().UnixNano() / int64(time.Millisecond)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, API_PATH) {
+		http.NotFound(w, r)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	endpoint := strings.TrimPrefix(r.URL.Path, API_PATH)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var resp interface{}
+	var code int
+	if handler, ok := publicHandlers[endpoint]; ok && r.Method == "GET" {
+		resp, code = handler(s, r.Form)
+	} else if handler, ok := privateHandlers[endpoint]; ok && r.Method == "POST" {
+		if code = s.verify(endpoint, r.PostForm); code == 0 {
+			resp, code = handler(s, r.PostForm)
+		}
+	} else {
+		http.NotFound(w, r)
+		return
+	}
+
+	if code != 0 {
+		resp = map[string]interface{}{"result": false, "error_code": code}
+	}
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	json.NewEncoder(w).Encode(resp)
+}
+
+type handler func(s *Server, params url.Values) (interface{}, int)
+
+var publicHandlers = map[string]handler{
+	"ticker.do":                 (*Server).ticker,
+	"depth.do":                  (*Server).depth,
+	"kline.do":                  (*Server).kline,
+	"future_ticker.do":          (*Server).futureTicker,
+	"future_depth.do":           (*Server).futureDepth,
+	"future_kline.do":           (*Server).futureKline,
+	"future_index.do":           (*Server).futureIndex,
+	"future_estimated_price.do": (*Server).futureEstimatedPrice,
+	"exchange_rate.do":          (*Server).exchangeRate,
+}
+
+var privateHandlers = map[string]handler{
+	"userinfo.do":           (*Server).userInfo,
+	"trade.do":              (*Server).trade,
+	"cancel_order.do":       (*Server).cancelOrder,
+	"order_info.do":         (*Server).orderInfo,
+	"order_history.do":      (*Server).orderHistory,
+	"trade_history.do":      (*Server).tradeHistory,
+	"withdraw.do":           (*Server).withdraw,
+	"future_userinfo.do":    (*Server).futureUserInfo,
+	"future_trade.do":       (*Server).futureTrade,
+	"future_cancel.do":      (*Server).futureCancel,
+	"future_order_info.do":  (*Server).futureOrderInfo,
+	"future_orders_info.do": (*Server).futureOrdersInfo,
+	"future_position.do":    (*Server).futurePosition,
+	"future_devolve.do":     (*Server).futureDevolve,
+}
+
+//okcoin.cn 的接口用 apiKey/secretKey, okex 的 future_* 接口用 api_key/secret_key 并对未转义的参数串签名
+func (s *Server) verify(endpoint string, params url.Values) int {
+	keyParam, secretParam, unescape := "apiKey", "secretKey", false
+	if strings.HasPrefix(endpoint, "future_") {
+		keyParam, secretParam, unescape = "api_key", "secret_key", true
+	}
+	if params.Get(keyParam) != s.ApiKey {
+		return ERR_API_KEY_NOT_EXIST
+	}
+
+	signed := url.Values{}
+	for k, v := range params {
+		if k != "sign" {
+			signed[k] = v
+		}
+	}
+	payload := signed.Encode() + "&" + secretParam + "=" + s.SecretKey
+	if unescape {
+		var err error
+		if payload, err = url.QueryUnescape(payload); err != nil {
+			return ERR_SIGN_MISMATCH
+		}
+	}
+	sum := md5.Sum([]byte(payload))
+	if !strings.EqualFold(hex.EncodeToString(sum[:]), params.Get("sign")) {
+		return ERR_SIGN_MISMATCH
+	}
+	return 0
+}
+
+//depth.do 的 [[价格, 数量], ...], 买卖盘都按价格从高到低, 各取最靠近盘口的size档
+func depthLevels(levels map[float64]float64, size int, asks bool) [][]float64 {
+	prices := make([]float64, 0, len(levels))
+	for price := range levels {
+		prices = append(prices, price)
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(prices)))
+	if size > 0 && len(prices) > size {
+		if asks {
+			prices = prices[len(prices)-size:]
+		} else {
+			prices = prices[:size]
+		}
+	}
+
+	entries := make([][]float64, 0, len(prices))
+	for _, price := range prices {
+		entries = append(entries, []float64{price, levels[price]})
+	}
+	return entries
+}
+
+func tickerResponse(date int64, m *market) map[string]interface{} {
+	return map[string]interface{}{
+		"date": fmt.Sprintf("%d", date),
+		"ticker": map[string]interface{}{
+			"buy":  m.bid,
+			"sell": m.ask,
+			"last": m.last,
+			"high": m.high,
+			"low":  m.low,
+			"vol":  m.vol,
+		},
+	}
+}
+
+//K线周期的长度(秒)
+var klinePeriods = map[string]int64{
+	"1min": 60, "3min": 180, "5min": 300, "15min": 900, "30min": 1800,
+	"1hour": 3600, "2hour": 7200, "4hour": 14400, "6hour": 21600, "12hour": 43200,
+	"1day": 86400, "3day": 259200, "1week": 604800,
+}
+
+type candle struct {
+	timestamp              int64 //周期开始时间(毫秒)
+	open, high, low, close float64
+	vol                    float64
+	coinVol                float64 //按成交价折算的币数量 amount/price, 合约K线乘以面值后返回
+}
+
+//按 type 把成交聚合成K线, 返回开始时间不早于 since(毫秒) 的最近 size 根. 没有成交时返回当前周期按最新价的一根
+func (s *Server) klines(m *market, params url.Values) ([]candle, int) {
+	period, ok := klinePeriods[params.Get("type")]
+	if !ok {
+		return nil, ERR_INVALID_PARAMS
+	}
+	periodMs := period * 1000
+	ticks := m.ticks
+	if len(ticks) == 0 {
+		ticks = []tick{{dateMs: s.nowMs(), price: m.last}}
+	}
+
+	var candles []candle
+	for _, t := range ticks {
+		start := t.dateMs - t.dateMs%periodMs
+		if n := len(candles); n == 0 || candles[n-1].timestamp != start {
+			candles = append(candles, candle{timestamp: start, open: t.price, high: t.price, low: t.price})
+		}
+		c := &candles[len(candles)-1]
+		c.high = math.Max(c.high, t.price)
+		c.low = math.Min(c.low, t.price)
+		c.close = t.price
+		c.vol += t.amount
+		if t.price > 0 {
+			c.coinVol += t.amount / t.price
+		}
+	}
+
+	since, _ := strconv.ParseInt(params.Get("since"), 10, 64)
+	for len(candles) > 0 && candles[0].timestamp < since {
+		candles = candles[1:]
+	}
+	if size := parseInt(params, "size", 0); size > 0 && len(candles) > size {
+		candles = candles[len(candles)-size:]
+	}
+	return candles, 0
+}
+
+func formatFloat(v float64) string {
+	return fmt.Sprintf("%.8f", v)
+}
@@ -0,0 +1,294 @@
+package okcointest
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+	"github.com/stretchr/testify/assert"
+)
+
+var btcCny = NewCurrencyPair("BTC", "CNY")
+var btcUsd = NewCurrencyPair("BTC", "USD")
+
+func assertApiError(t *testing.T, err error, code string) {
+	var apiErr *ApiError
+	if assert.True(t, errors.As(err, &apiErr), "expected ApiError, got %v", err) {
+		assert.Equal(t, code, apiErr.Code)
+	}
+}
+
+func TestServer_SpotTrading(t *testing.T) {
+	s := NewServer("key", "secret")
+	defer s.Close()
+	s.SetPrice("btc_cny", 28000, 28010)
+	s.SetBalance("cny", 10000)
+	s.SetBalance("btc", 1)
+	api, err := s.Api()
+	assert.NoError(t, err)
+
+	ticker, err := api.GetTicker(btcCny)
+	assert.NoError(t, err)
+	assert.Equal(t, 28000.0, ticker.Buy)
+	assert.Equal(t, 28010.0, ticker.Sell)
+
+	//低于卖一的买单挂在盘口上, 冻结资金
+	order, err := api.LimitBuy("0.1", "27900", btcCny)
+	assert.NoError(t, err)
+	free, frozen := s.Balance("cny")
+	assert.InDelta(t, 7210, free, 1e-6)
+	assert.InDelta(t, 2790, frozen, 1e-6)
+	orders, err := api.GetUnfinishedOrders(btcCny)
+	assert.NoError(t, err)
+	assert.Len(t, orders, 1)
+	depth, err := api.GetDepth(btcCny, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.1, depth.BidList[1].Amount)
+
+	//价格穿过挂单后按挂单价成交
+	s.SetPrice("btc_cny", 27800, 27890)
+	filled, err := api.GetOneOrder(fmtId(order), btcCny)
+	assert.NoError(t, err)
+	assert.Equal(t, TradeStatus(ORDER_FINISH), filled.Status)
+	assert.Equal(t, 27900.0, filled.AvgPrice)
+	free, frozen = s.Balance("btc")
+	assert.InDelta(t, 1.1, free, 1e-9)
+	_, frozen = s.Balance("cny")
+	assert.InDelta(t, 0, frozen, 1e-6)
+
+	//可以立即成交的卖单按买一成交
+	_, err = api.LimitSell("0.5", "27700", btcCny)
+	assert.NoError(t, err)
+	free, _ = s.Balance("cny")
+	assert.InDelta(t, 7210+0.5*27800, free, 1e-6)
+
+	_, err = api.LimitSell("2", "27700", btcCny)
+	assertApiError(t, err, "10016")
+	assert.Equal(t, ErrorKind(ERR_KIND_INSUFFICIENT_FUNDS), ClassifyError(err))
+
+	//撤单解冻
+	order, err = api.LimitSell("0.1", "30000", btcCny)
+	assert.NoError(t, err)
+	ok, err := api.CancelOrder(fmtId(order), btcCny)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	free, frozen = s.Balance("btc")
+	assert.InDelta(t, 0.6, free, 1e-9)
+	assert.InDelta(t, 0, frozen, 1e-9)
+	_, err = api.CancelOrder(fmtId(order), btcCny)
+	assertApiError(t, err, "10009")
+
+	_, err = api.MarketBuy("", "2789", btcCny)
+	assert.NoError(t, err)
+	free, _ = s.Balance("btc")
+	assert.InDelta(t, 0.7, free, 1e-9)
+
+	trades, err := api.GetTrades(btcCny, 0)
+	assert.NoError(t, err)
+	assert.Len(t, trades, 3)
+	assert.Equal(t, "sell", trades[1].Type)
+	assert.Equal(t, 27800.0, trades[1].Price)
+
+	history, err := api.GetOrderHistory(btcCny, 1, 10)
+	assert.NoError(t, err)
+	assert.Len(t, history, 4)
+	assert.Equal(t, TradeStatus(ORDER_FINISH), history[0].Status, "newest first")
+	assert.Equal(t, TradeStatus(ORDER_CANCEL), history[1].Status)
+
+	account, err := api.GetAccount()
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.7, account.SubAccounts["BTC"].Amount, 1e-8)
+	cny, _ := s.Balance("cny")
+	assert.InDelta(t, cny+0.7*27890, account.Asset, 1e-4)
+}
+
+func TestServer_VerifySignature(t *testing.T) {
+	s := NewServer("key", "secret")
+	defer s.Close()
+
+	driver, err := LookupApi(OK_CN)
+	assert.NoError(t, err)
+	api, err := driver.New(ApiConfig{HttpClient: s.Client(), ApiKey: "key", ApiSecretKey: "wrong", BaseUrl: s.URL})
+	assert.NoError(t, err)
+	_, err = api.GetAccount()
+	assertApiError(t, err, "10007")
+	assert.Equal(t, ErrorKind(ERR_KIND_AUTH), ClassifyError(err))
+
+	api, err = driver.New(ApiConfig{HttpClient: s.Client(), ApiKey: "other", ApiSecretKey: "secret", BaseUrl: s.URL})
+	assert.NoError(t, err)
+	_, err = api.GetAccount()
+	assertApiError(t, err, "10006")
+
+	future, err := LookupFutureApi(OK_EX)
+	assert.NoError(t, err)
+	futureApi, err := future.New(ApiConfig{HttpClient: s.Client(), ApiKey: "key", ApiSecretKey: "wrong", BaseUrl: s.URL})
+	assert.NoError(t, err)
+	_, err = futureApi.GetFutureUserInfo()
+	assertApiError(t, err, "10007")
+}
+
+func TestServer_FutureTrading(t *testing.T) {
+	s := NewServer("key", "secret")
+	defer s.Close()
+	s.SetFuturePrice("btc_usd", THIS_WEEK_CONTRACT, 4000, 4001)
+	s.SetBalance("btc", 1)
+	api, err := s.FutureApi()
+	assert.NoError(t, err)
+
+	transfer := api.(TransferApi)
+	_, err = transfer.Transfer("btc", "1", ACCOUNT_SPOT, ACCOUNT_FUTURES)
+	assert.NoError(t, err)
+	free, _ := s.Balance("btc")
+	assert.InDelta(t, 0, free, 1e-9)
+
+	//对手价开多10张
+	_, err = api.PlaceFutureOrder(btcUsd, THIS_WEEK_CONTRACT, "", "10", OPEN_BUY, 1, 10)
+	assert.NoError(t, err)
+	positions, err := api.GetFuturePosition(btcUsd, THIS_WEEK_CONTRACT)
+	assert.NoError(t, err)
+	assert.Len(t, positions, 1)
+	assert.Equal(t, 10.0, positions[0].BuyAmount)
+	assert.Equal(t, 4001.0, positions[0].BuyPriceAvg)
+
+	s.SetFuturePrice("btc_usd", THIS_WEEK_CONTRACT, 4400, 4401)
+	account, err := api.GetFutureUserInfo()
+	assert.NoError(t, err)
+	unreal := 10 * 100 * (1/4001.0 - 1/4400.0)
+	assert.InDelta(t, 1+unreal, account.FutureSubAccounts["BTC"].AccountRights, 1e-9)
+	assert.InDelta(t, 10*100/4001.0/10, account.FutureSubAccounts["BTC"].KeepDeposit, 1e-9)
+
+	//平多按买一成交, 盈利计入已实现盈亏
+	_, err = api.PlaceFutureOrder(btcUsd, THIS_WEEK_CONTRACT, "4300", "10", CLOSE_BUY, 0, 10)
+	assert.NoError(t, err)
+	account, err = api.GetFutureUserInfo()
+	assert.NoError(t, err)
+	assert.InDelta(t, unreal, account.FutureSubAccounts["BTC"].ProfitReal, 1e-9)
+	assert.InDelta(t, 0, account.FutureSubAccounts["BTC"].KeepDeposit, 1e-9)
+	positions, err = api.GetFuturePosition(btcUsd, THIS_WEEK_CONTRACT)
+	assert.NoError(t, err)
+	assert.Empty(t, positions)
+
+	_, err = api.PlaceFutureOrder(btcUsd, THIS_WEEK_CONTRACT, "4300", "1", CLOSE_BUY, 0, 10)
+	assertApiError(t, err, "20016")
+	_, err = api.PlaceFutureOrder(btcUsd, THIS_WEEK_CONTRACT, "4400", "100000", OPEN_BUY, 0, 10)
+	assertApiError(t, err, "10010")
+
+	//高于买一的开空单挂着, 撤单后不再占用保证金
+	orderId, err := api.PlaceFutureOrder(btcUsd, THIS_WEEK_CONTRACT, "4500", "5", OPEN_SELL, 0, 20)
+	assert.NoError(t, err)
+	orders, err := api.GetUnfinishedFutureOrders(btcUsd, THIS_WEEK_CONTRACT)
+	assert.NoError(t, err)
+	assert.Len(t, orders, 1)
+	assert.Equal(t, OPEN_SELL, orders[0].OType)
+	ok, err := api.FutureCancelOrder(btcUsd, THIS_WEEK_CONTRACT, orderId)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	_, err = api.FutureCancelOrder(btcUsd, THIS_WEEK_CONTRACT, orderId)
+	assertApiError(t, err, "20015")
+	orders, err = api.GetFutureOrders([]string{orderId}, btcUsd, THIS_WEEK_CONTRACT)
+	assert.NoError(t, err)
+	assert.Equal(t, TradeStatus(ORDER_CANCEL), orders[0].Status)
+
+	_, err = transfer.Transfer("btc", "1", ACCOUNT_FUTURES, ACCOUNT_SPOT)
+	assert.NoError(t, err)
+	free, _ = s.Balance("btc")
+	assert.Equal(t, 1.0, free)
+	assert.InDelta(t, unreal, s.FutureRights("btc"), 1e-9)
+}
+
+//K线由成交聚合, 同一分钟内的成交合并成一根
+func TestServer_Klines(t *testing.T) {
+	s := NewServer("key", "secret")
+	defer s.Close()
+	now := time.Unix(1506787230, 0)
+	s.Now = func() time.Time { return now }
+	s.SetPrice("btc_cny", 28000, 28010)
+	s.SetBalance("cny", 100000)
+	api, err := s.Api()
+	assert.NoError(t, err)
+
+	//没有成交时按最新价返回当前周期
+	klines, err := api.GetKlineRecords(btcCny, "1min", 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []Kline{{Timestamp: 1506787200, Open: 28005, High: 28005, Low: 28005, Close: 28005}}, klines)
+
+	api.LimitBuy("0.1", "28010", btcCny)
+	s.SetPrice("btc_cny", 28100, 28110)
+	api.LimitBuy("0.2", "28110", btcCny)
+	now = now.Add(time.Minute)
+	api.LimitBuy("0.3", "28110", btcCny)
+	klines, err = api.GetKlineRecords(btcCny, "1min", 10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, klines, 2) {
+		k := klines[0]
+		assert.Equal(t, []float64{28010, 28110, 28010, 28110}, []float64{k.Open, k.High, k.Low, k.Close})
+		assert.InDelta(t, 0.3, k.Vol, 1e-9)
+		assert.Equal(t, int64(1506787260), klines[1].Timestamp)
+	}
+	klines, err = api.GetKlineRecords(btcCny, "1min", 1, 0)
+	assert.NoError(t, err)
+	assert.Len(t, klines, 1)
+	_, err = api.GetKlineRecords(btcCny, "2min", 10, 0)
+	assertApiError(t, err, "10008")
+
+	s.SetFuturePrice("btc_usd", THIS_WEEK_CONTRACT, 4000, 4000)
+	s.SetFutureBalance("btc", 1)
+	futureApi, err := s.FutureApi()
+	assert.NoError(t, err)
+	_, err = futureApi.PlaceFutureOrder(btcUsd, THIS_WEEK_CONTRACT, "", "10", OPEN_BUY, 1, 10)
+	assert.NoError(t, err)
+	futureKlines, err := futureApi.GetKlineRecords(THIS_WEEK_CONTRACT, btcUsd, "1min", 10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, futureKlines, 1) {
+		assert.Equal(t, 10.0, futureKlines[0].Vol)
+		assert.InDelta(t, 10*100/4000.0, futureKlines[0].Vol2, 1e-9)
+	}
+}
+
+func TestServer_FutureMarketData(t *testing.T) {
+	s := NewServer("key", "secret")
+	defer s.Close()
+	api, err := s.FutureApi()
+	assert.NoError(t, err)
+
+	_, err = api.GetFutureIndex(btcUsd)
+	assertApiError(t, err, "10008")
+	s.SetFutureIndex("btc_usd", 4002.5)
+	index, err := api.GetFutureIndex(btcUsd)
+	assert.NoError(t, err)
+	assert.Equal(t, 4002.5, index)
+	price, err := api.GetFutureEstimatedPrice(btcUsd)
+	assert.NoError(t, err)
+	assert.Equal(t, 4002.5, price)
+
+	s.ExchangeRate = 6.8
+	rate, err := api.GetExchangeRate()
+	assert.NoError(t, err)
+	assert.Equal(t, 6.8, rate)
+}
+
+//提现数量和手续费都从可用余额扣除
+func TestServer_Withdraw(t *testing.T) {
+	s := NewServer("key", "secret")
+	defer s.Close()
+	s.SetBalance("btc", 1)
+	api, err := s.Api()
+	assert.NoError(t, err)
+
+	id, err := api.Withdraw("0.5", "BTC", "0.001", "1BoatSLRHtKNngkdXEeobR76b53LETtpyT", "", "123456")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, id)
+	free, _ := s.Balance("btc")
+	assert.InDelta(t, 0.499, free, 1e-9)
+
+	_, err = api.Withdraw("0.5", "BTC", "0.001", "1BoatSLRHtKNngkdXEeobR76b53LETtpyT", "", "123456")
+	assertApiError(t, err, "10016")
+	_, err = api.Withdraw("0.1", "BTC", "0.001", "", "", "123456")
+	assertApiError(t, err, "10000")
+}
+
+func fmtId(order *Order) string {
+	return fmt.Sprintf("%d", order.OrderID)
+}
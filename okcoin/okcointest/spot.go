@@ -0,0 +1,379 @@
+package okcointest
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+//比较金额时容忍的浮点误差
+const epsilon = 1e-9
+
+func (o *order) open() bool {
+	return o.status == 0 || o.status == 1
+}
+
+func (o *order) isBuy() bool {
+	return strings.HasPrefix(o.side, "buy")
+}
+
+func (o *order) json() map[string]interface{} {
+	return map[string]interface{}{
+		"order_id":    o.id,
+		"orders_id":   o.id,
+		"symbol":      o.symbol,
+		"type":        o.side,
+		"price":       o.price,
+		"amount":      o.amount,
+		"deal_amount": o.dealAmount,
+		"avg_price":   o.avgPrice,
+		"status":      o.status,
+		"create_date": o.createDate,
+	}
+}
+
+//btc_cny => btc, cny
+func splitSymbol(symbol string) (base, counter string) {
+	i := strings.Index(symbol, "_")
+	if i < 0 {
+		return symbol, ""
+	}
+	return symbol[:i], symbol[i+1:]
+}
+
+func parseAmount(params url.Values, name string) (float64, int) {
+	v := params.Get(name)
+	if v == "" {
+		return 0, ERR_PARAMS_EMPTY
+	}
+	amount, err := strconv.ParseFloat(v, 64)
+	if err != nil || amount <= 0 {
+		return 0, ERR_INVALID_PARAMS
+	}
+	return amount, 0
+}
+
+func parseInt(params url.Values, name string, defaultValue int) int {
+	v, err := strconv.Atoi(params.Get(name))
+	if err != nil {
+		return defaultValue
+	}
+	return v
+}
+
+func (s *Server) ticker(params url.Values) (interface{}, int) {
+	m, ok := s.markets[params.Get("symbol")]
+	if !ok {
+		return nil, ERR_INVALID_PARAMS
+	}
+	return tickerResponse(s.Now().Unix(), m), 0
+}
+
+//[[时间(毫秒), 开, 高, 低, 收, 成交量], ...]
+func (s *Server) kline(params url.Values) (interface{}, int) {
+	m, ok := s.markets[params.Get("symbol")]
+	if !ok {
+		return nil, ERR_INVALID_PARAMS
+	}
+	candles, code := s.klines(m, params)
+	if code != 0 {
+		return nil, code
+	}
+	records := [][]float64{}
+	for _, c := range candles {
+		records = append(records, []float64{float64(c.timestamp), c.open, c.high, c.low, c.close, c.vol})
+	}
+	return records, 0
+}
+
+//盘口之外是挂单量为 DEFAULT_LIQUIDITY 的买一卖一, 加上账户自己的挂单
+func (s *Server) depth(params url.Values) (interface{}, int) {
+	symbol := params.Get("symbol")
+	m, ok := s.markets[symbol]
+	if !ok {
+		return nil, ERR_INVALID_PARAMS
+	}
+	asks := map[float64]float64{m.ask: DEFAULT_LIQUIDITY}
+	bids := map[float64]float64{m.bid: DEFAULT_LIQUIDITY}
+	for _, o := range s.orders {
+		if o.symbol != symbol || !o.open() {
+			continue
+		}
+		if o.isBuy() {
+			bids[o.price] += o.amount - o.dealAmount
+		} else {
+			asks[o.price] += o.amount - o.dealAmount
+		}
+	}
+	size := parseInt(params, "size", 200)
+	return map[string]interface{}{
+		"asks": depthLevels(asks, size, true),
+		"bids": depthLevels(bids, size, false),
+	}, 0
+}
+
+//总资产按各币种最新成交价折合成cny
+func (s *Server) userInfo(params url.Values) (interface{}, int) {
+	currencies := map[string]bool{"btc": true, "ltc": true, "cny": true}
+	for currency := range s.free {
+		currencies[currency] = true
+	}
+	for currency := range s.frozen {
+		currencies[currency] = true
+	}
+
+	free, freezed := map[string]string{}, map[string]string{}
+	total := 0.0
+	for currency := range currencies {
+		free[currency] = formatFloat(s.free[currency])
+		freezed[currency] = formatFloat(s.frozen[currency])
+		amount := s.free[currency] + s.frozen[currency]
+		if currency == "cny" {
+			total += amount
+		} else if m, ok := s.markets[currency+"_cny"]; ok {
+			total += amount * m.last
+		}
+	}
+	return map[string]interface{}{
+		"result": true,
+		"info": map[string]interface{}{
+			"funds": map[string]interface{}{
+				"asset":   map[string]string{"net": formatFloat(total), "total": formatFloat(total)},
+				"free":    free,
+				"freezed": freezed,
+			},
+		},
+	}, 0
+}
+
+//限价单冻结资金后立即按盘口撮合, 没成交的挂在服务端等 SetPrice; 市价单按买一卖一全部成交
+func (s *Server) trade(params url.Values) (interface{}, int) {
+	symbol := params.Get("symbol")
+	m, ok := s.markets[symbol]
+	if !ok {
+		return nil, ERR_INVALID_PARAMS
+	}
+	base, counter := splitSymbol(symbol)
+	o := &order{id: s.newId(), symbol: symbol, side: params.Get("type"), createDate: s.nowMs()}
+
+	var code int
+	switch o.side {
+	case "buy":
+		if o.price, code = parseAmount(params, "price"); code != 0 {
+			return nil, code
+		}
+		if o.amount, code = parseAmount(params, "amount"); code != 0 {
+			return nil, code
+		}
+		cost := o.price * o.amount
+		if s.free[counter]+epsilon < cost {
+			return nil, ERR_INSUFFICIENT_BALANCE
+		}
+		s.free[counter] -= cost
+		s.frozen[counter] += cost
+	case "sell":
+		if o.price, code = parseAmount(params, "price"); code != 0 {
+			return nil, code
+		}
+		if o.amount, code = parseAmount(params, "amount"); code != 0 {
+			return nil, code
+		}
+		if s.free[base]+epsilon < o.amount {
+			return nil, ERR_INSUFFICIENT_COIN
+		}
+		s.free[base] -= o.amount
+		s.frozen[base] += o.amount
+	case "buy_market":
+		//price 为买入的总金额
+		if o.price, code = parseAmount(params, "price"); code != 0 {
+			return nil, code
+		}
+		if s.free[counter]+epsilon < o.price {
+			return nil, ERR_INSUFFICIENT_BALANCE
+		}
+		o.amount = o.price / m.ask
+		s.free[counter] -= o.price
+		s.free[base] += o.amount
+		s.recordFill(o, m.ask, o.amount)
+	case "sell_market":
+		if o.amount, code = parseAmount(params, "amount"); code != 0 {
+			return nil, code
+		}
+		if s.free[base]+epsilon < o.amount {
+			return nil, ERR_INSUFFICIENT_COIN
+		}
+		s.free[base] -= o.amount
+		s.free[counter] += o.amount * m.bid
+		s.recordFill(o, m.bid, o.amount)
+	default:
+		return nil, ERR_INVALID_PARAMS
+	}
+
+	s.orders = append(s.orders, o)
+	if o.open() {
+		s.matchOrder(o, true)
+	}
+	return map[string]interface{}{"result": true, "order_id": o.id}, 0
+}
+
+//taker为true时是新下的单, 按对手价成交; 否则是挂单被价格穿过, 按挂单价成交
+func (s *Server) matchOrder(o *order, taker bool) {
+	m := s.markets[o.symbol]
+	switch {
+	case o.side == "buy" && m.ask > 0 && o.price >= m.ask:
+		price := o.price
+		if taker {
+			price = m.ask
+		}
+		base, counter := splitSymbol(o.symbol)
+		remaining := o.amount - o.dealAmount
+		s.frozen[counter] -= o.price * remaining
+		s.free[counter] += (o.price - price) * remaining
+		s.free[base] += remaining
+		s.recordFill(o, price, remaining)
+	case o.side == "sell" && m.bid > 0 && o.price <= m.bid:
+		price := o.price
+		if taker {
+			price = m.bid
+		}
+		base, counter := splitSymbol(o.symbol)
+		remaining := o.amount - o.dealAmount
+		s.frozen[base] -= remaining
+		s.free[counter] += price * remaining
+		s.recordFill(o, price, remaining)
+	}
+}
+
+func (s *Server) recordFill(o *order, price, amount float64) {
+	o.avgPrice = (o.avgPrice*o.dealAmount + price*amount) / (o.dealAmount + amount)
+	o.dealAmount += amount
+	o.status = 2
+
+	now := s.nowMs()
+	s.markets[o.symbol].trade(price, amount, now)
+
+	side := "buy"
+	if !o.isBuy() {
+		side = "sell"
+	}
+	s.fills = append(s.fills, fill{tid: s.newId(), symbol: o.symbol, side: side, price: price, amount: amount, dateMs: now})
+}
+
+func (s *Server) findOrder(symbol, id string) *order {
+	for _, o := range s.orders {
+		if o.symbol == symbol && fmt.Sprintf("%d", o.id) == id {
+			return o
+		}
+	}
+	return nil
+}
+
+//撤单后解冻未成交部分
+func (s *Server) cancelOrder(params url.Values) (interface{}, int) {
+	o := s.findOrder(params.Get("symbol"), params.Get("order_id"))
+	if o == nil || !o.open() {
+		return nil, ERR_ORDER_NOT_EXIST
+	}
+	base, counter := splitSymbol(o.symbol)
+	remaining := o.amount - o.dealAmount
+	if o.isBuy() {
+		s.frozen[counter] -= o.price * remaining
+		s.free[counter] += o.price * remaining
+	} else {
+		s.frozen[base] -= remaining
+		s.free[base] += remaining
+	}
+	o.status = -1
+	return map[string]interface{}{"result": true, "order_id": fmt.Sprintf("%d", o.id)}, 0
+}
+
+//order_id 为-1时返回所有未完成订单
+func (s *Server) orderInfo(params url.Values) (interface{}, int) {
+	symbol, id := params.Get("symbol"), params.Get("order_id")
+	orders := []map[string]interface{}{}
+	for _, o := range s.orders {
+		if o.symbol != symbol {
+			continue
+		}
+		if (id == "-1" && o.open()) || fmt.Sprintf("%d", o.id) == id {
+			orders = append(orders, o.json())
+		}
+	}
+	return map[string]interface{}{"result": true, "orders": orders}, 0
+}
+
+//status 0:未完成 1:已完成(成交或撤销), 按下单时间倒序分页
+func (s *Server) orderHistory(params url.Values) (interface{}, int) {
+	symbol, finished := params.Get("symbol"), params.Get("status") == "1"
+	var matched []*order
+	for i := len(s.orders) - 1; i >= 0; i-- {
+		if o := s.orders[i]; o.symbol == symbol && o.open() != finished {
+			matched = append(matched, o)
+		}
+	}
+
+	page, pageLength := parseInt(params, "current_page", 1), parseInt(params, "page_length", 200)
+	if page < 1 || pageLength < 1 || pageLength > 200 {
+		return nil, ERR_INVALID_PARAMS
+	}
+	orders := []map[string]interface{}{}
+	for i := (page - 1) * pageLength; i < len(matched) && i < page*pageLength; i++ {
+		orders = append(orders, matched[i].json())
+	}
+	return map[string]interface{}{
+		"result":        true,
+		"total":         len(matched),
+		"currency_page": page,
+		"page_length":   pageLength,
+		"orders":        orders,
+	}, 0
+}
+
+//tid 大于since的成交, 最多600条
+func (s *Server) tradeHistory(params url.Values) (interface{}, int) {
+	symbol := params.Get("symbol")
+	since, _ := strconv.ParseInt(params.Get("since"), 10, 64)
+	trades := []map[string]interface{}{}
+	for _, f := range s.fills {
+		if f.symbol != symbol || f.tid <= since {
+			continue
+		}
+		trades = append(trades, map[string]interface{}{
+			"tid":     f.tid,
+			"type":    f.side,
+			"price":   formatFloat(f.price),
+			"amount":  formatFloat(f.amount),
+			"date":    f.dateMs / 1000,
+			"date_ms": f.dateMs,
+		})
+		if len(trades) == 600 {
+			break
+		}
+	}
+	return trades, 0
+}
+
+//提现立即完成, 提现数量和手续费 chargefee 都从可用余额扣除. symbol 为币种(如 btc)或交易对(如 btc_cny)
+func (s *Server) withdraw(params url.Values) (interface{}, int) {
+	currency, _ := splitSymbol(strings.ToLower(params.Get("symbol")))
+	address := params.Get("withdraw_address")
+	if currency == "" || address == "" || params.Get("trade_pwd") == "" {
+		return nil, ERR_PARAMS_EMPTY
+	}
+	amount, code := parseAmount(params, "withdraw_amount")
+	if code != 0 {
+		return nil, code
+	}
+	fee, err := strconv.ParseFloat(params.Get("chargefee"), 64)
+	if err != nil || fee < 0 {
+		return nil, ERR_INVALID_PARAMS
+	}
+	if s.free[currency]+epsilon < amount+fee {
+		return nil, ERR_INSUFFICIENT_COIN
+	}
+	s.free[currency] -= amount + fee
+	w := withdrawal{id: s.newId(), currency: currency, address: address, amount: amount, fee: fee}
+	s.withdrawals = append(s.withdrawals, w)
+	return map[string]interface{}{"result": true, "withdraw_id": w.id}, 0
+}
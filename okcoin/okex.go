@@ -1,17 +1,15 @@
 package okcoin
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	. "github.com/qct/cryptocurrency-exchange-api"
-	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -26,172 +24,159 @@ const (
 	FUTURE_POSITION_URI    = "future_position.do"
 	FUTURE_TRADE_URI       = "future_trade.do"
 	FUTURE_ESTIMATED_PRICE = "future_estimated_price.do?symbol=%s"
+	FUTURE_INDEX_URI       = "future_index.do?symbol=%s"
 	FUTURE_GET_KLINE_URI   = "future_kline.do"
 	EXCHANGE_RATE_URI      = "exchange_rate.do"
+	FUTURE_DEVOLVE_URI     = "future_devolve.do"
 )
 
+var DefaultFutureRateLimitPolicy = RateLimitPolicy{
+	Rate:  10,
+	Burst: 20,
+	Weights: map[string]int{
+		FUTURE_ORDERS_INFO_URI: 2,
+		FUTURE_GET_KLINE_URI:   2,
+		FUTURE_DEVOLVE_URI:     5,
+	},
+}
+
 type futureUserInfoResponse struct {
-	Info struct {
-		Btc map[string]float64 `json:btc`
-		Ltc map[string]float64 `json:ltc`
-	} `json:info`
-	Result bool `json:"result,bool"`
+	Info map[string]struct {
+		AccountRights JsonFloat64 `json:"account_rights"`
+		KeepDeposit   JsonFloat64 `json:"keep_deposit"`
+		ProfitReal    JsonFloat64 `json:"profit_real"`
+		ProfitUnreal  JsonFloat64 `json:"profit_unreal"`
+		RiskRate      JsonFloat64 `json:"risk_rate"`
+	} `json:"info"`
+}
+
+type futurePositionResponse struct {
+	ForceLiquPrice JsonFloat64 `json:"force_liqu_price"`
+	Holding        []struct {
+		BuyAmount      JsonFloat64 `json:"buy_amount"`
+		BuyAvailable   JsonFloat64 `json:"buy_available"`
+		BuyPriceAvg    JsonFloat64 `json:"buy_price_avg"`
+		BuyPriceCost   JsonFloat64 `json:"buy_price_cost"`
+		BuyProfitReal  JsonFloat64 `json:"buy_profit_real"`
+		ContractId     JsonInt64   `json:"contract_id"`
+		ContractType   string      `json:"contract_type"`
+		CreateDate     JsonInt64   `json:"create_date"`
+		LeverRate      JsonInt64   `json:"lever_rate"`
+		SellAmount     JsonFloat64 `json:"sell_amount"`
+		SellAvailable  JsonFloat64 `json:"sell_available"`
+		SellPriceAvg   JsonFloat64 `json:"sell_price_avg"`
+		SellPriceCost  JsonFloat64 `json:"sell_price_cost"`
+		SellProfitReal JsonFloat64 `json:"sell_profit_real"`
+	} `json:"holding"`
+}
+
+type futureOrdersResponse struct {
+	Orders []struct {
+		OrderId      JsonInt64   `json:"order_id"`
+		Amount       JsonFloat64 `json:"amount"`
+		Price        JsonFloat64 `json:"price"`
+		PriceAvg     JsonFloat64 `json:"price_avg"`
+		DealAmount   JsonFloat64 `json:"deal_amount"`
+		Fee          JsonFloat64 `json:"fee"`
+		Type         JsonInt64   `json:"type"`
+		CreateDate   JsonInt64   `json:"create_date"`
+		LeverRate    JsonInt64   `json:"lever_rate"`
+		ContractName string      `json:"contract_name"`
+		Status       JsonInt64   `json:"status"`
+	} `json:"orders"`
 }
 
 type OkExApi struct {
-	apiKey       string
-	apiSecretKey string
-	client       *http.Client
+	signer  Signer
+	client  *http.Client
+	baseUrl string
+	clock   Clock
+}
+
+func init() {
+	RegisterFutureApi(OK_EX, FutureApiDriver{
+		New: func(config ApiConfig) (FutureApi, error) {
+			return &OkExApi{&ExSigner{Credentials: config.CredentialProvider()}, config.HttpClient, ResolveBaseUrl(FUTURE_API_BASE_URL, config.BaseUrl), ExchangeClock(OK_EX, config.BaseUrl)}, nil
+		},
+		DefaultRateLimit: DefaultFutureRateLimitPolicy,
+		ServerTime:       FutureServerTime,
+	})
 }
 
 func NewOkExApi(client *http.Client, apiKey, secretKey string) *OkExApi {
-	return &OkExApi{apiKey: apiKey, apiSecretKey: secretKey, client: client}
+	return &OkExApi{&ExSigner{Credentials: StaticCredentials{ApiKey: apiKey, ApiSecretKey: secretKey}}, client, FUTURE_API_BASE_URL, ExchangeClock(OK_EX, "")}
 }
 
 func (o *OkExApi) GetFutureEstimatedPrice(cp CurrencyPair) (float64, error) {
-	resp, err := o.client.Get(fmt.Sprintf(FUTURE_API_BASE_URL+FUTURE_ESTIMATED_PRICE, cp.CustomSymbol("_", true)))
+	body, err := HttpGetBytes(o.client, fmt.Sprintf(o.baseUrl+FUTURE_ESTIMATED_PRICE, cp.CustomSymbol("_", true)))
 	if err != nil {
 		return 0, err
 	}
-	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return 0, err
+	var resp struct {
+		ForecastPrice *JsonFloat64 `json:"forecast_price"`
 	}
-
-	bodyMap := make(map[string]interface{})
-	err = json.Unmarshal(body, &bodyMap)
+	err = decodeResponse(o.GetExchangeName(), body, &resp)
 	if err != nil {
 		return 0, err
 	}
-	return bodyMap["forecast_price"].(float64), nil
+	if resp.ForecastPrice == nil {
+		return 0, &DecodeError{Err: errors.New("missing forecast_price"), Body: body}
+	}
+	return float64(*resp.ForecastPrice), nil
 }
 
 func (o *OkExApi) GetFutureTicker(cp CurrencyPair, contractType string) (*Ticker, error) {
-	url := FUTURE_API_BASE_URL + FUTURE_TICKER_URI
-	resp, err := o.client.Get(fmt.Sprintf(url, cp.CustomSymbol("_", true), contractType))
+	url := o.baseUrl + FUTURE_TICKER_URI
+	body, err := HttpGetBytes(o.client, fmt.Sprintf(url, cp.CustomSymbol("_", true), contractType))
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	return parseTicker(o.GetExchangeName(), body)
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
+func (o *OkExApi) GetFutureDepth(cp CurrencyPair, contractType string, size int) (*Depth, error) {
+	url := o.baseUrl + FUTURE_DEPTH_URI
+	body, err := HttpGetBytes(o.client, fmt.Sprintf(url, cp.CustomSymbol("_", true), contractType, size))
 	if err != nil {
 		return nil, err
 	}
-	bodyMap := make(map[string]interface{})
-	err = json.Unmarshal(body, &bodyMap)
+
+	depth, err := parseDepth(o.GetExchangeName(), body)
 	if err != nil {
 		return nil, err
 	}
-
-	if bodyMap["result"] != nil && !bodyMap["result"].(bool) {
-		return nil, errors.New(string(body))
-	}
-	tickerMap := bodyMap["ticker"].(map[string]interface{})
-	ticker := new(Ticker)
-	ticker.Date, _ = strconv.ParseUint(bodyMap["date"].(string), 10, 64)
-	ticker.Buy = tickerMap["buy"].(float64)
-	ticker.Sell = tickerMap["sell"].(float64)
-	ticker.Last = tickerMap["last"].(float64)
-	ticker.High = tickerMap["high"].(float64)
-	ticker.Low = tickerMap["low"].(float64)
-	ticker.Vol = tickerMap["vol"].(float64)
-	return ticker, nil
+	sort.Sort(depth.AskList)
+	return depth, nil
 }
 
-func (o *OkExApi) GetFutureDepth(cp CurrencyPair, contractType string, size int) (*Depth, error) {
-	url := FUTURE_API_BASE_URL + FUTURE_DEPTH_URI
-	resp, err := o.client.Get(fmt.Sprintf(url, cp.CustomSymbol("_", true), contractType, size))
+func (o *OkExApi) GetFutureIndex(cp CurrencyPair) (float64, error) {
+	body, err := HttpGetBytes(o.client, fmt.Sprintf(o.baseUrl+FUTURE_INDEX_URI, cp.CustomSymbol("_", true)))
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	var resp struct {
+		FutureIndex *JsonFloat64 `json:"future_index"`
 	}
-	bodyMap := make(map[string]interface{})
-	err = json.Unmarshal(body, &bodyMap)
+	err = decodeResponse(o.GetExchangeName(), body, &resp)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	if bodyMap["error_code"] != nil {
-		log.Println(bodyMap)
-		return nil, errors.New(string(body))
-	}
-
-	depth := new(Depth)
-	for _, v := range bodyMap["asks"].([]interface{}) {
-		var dr DepthRecord
-		for i, vv := range v.([]interface{}) {
-			switch i {
-			case 0:
-				dr.Price = vv.(float64)
-			case 1:
-				dr.Amount = vv.(float64)
-			}
-		}
-		depth.AskList = append(depth.AskList, dr)
-	}
-	for _, v := range bodyMap["bids"].([]interface{}) {
-		var dr DepthRecord
-		for i, vv := range v.([]interface{}) {
-			switch i {
-			case 0:
-				dr.Price = vv.(float64)
-			case 1:
-				dr.Amount = vv.(float64)
-			}
-		}
-		depth.BidList = append(depth.BidList, dr)
+	if resp.FutureIndex == nil {
+		return 0, &DecodeError{Err: errors.New("missing future_index"), Body: body}
 	}
-	sort.Sort(depth.AskList)
-	return depth, nil
-}
-
-func (o *OkExApi) GetFutureIndex(cp CurrencyPair) (float64, error) {
-	return 0, nil
+	return float64(*resp.FutureIndex), nil
 }
 
 func (o *OkExApi) GetFutureUserInfo() (*FutureAccount, error) {
-	userInfoUrl := FUTURE_API_BASE_URL + FUTURE_USERINFO_URI
+	userInfoUrl := o.baseUrl + FUTURE_USERINFO_URI
 	postData := url.Values{}
-	o.buildPostForm(&postData)
-	body, err := HttpPostForm(o.client, userInfoUrl, postData)
+	body, err := o.signedPost(userInfoUrl, postData)
 	if err != nil {
 		return nil, err
 	}
-	resp := futureUserInfoResponse{}
-	err = json.Unmarshal(body, &resp)
-	if err != nil {
-		return nil, err
-	}
-	if !resp.Result {
-		return nil, errors.New(string(body))
-	}
-
-	account := new(FutureAccount)
-	account.FutureSubAccounts = make(map[string]FutureSubAccount, 2)
-	btcMap := resp.Info.Btc
-	ltcMap := resp.Info.Ltc
-	account.FutureSubAccounts["BTC"] = FutureSubAccount{Currency: "BTC",
-		AccountRights: btcMap["account_rights"],
-		KeepDeposit:   btcMap["keep_deposit"],
-		ProfitReal:    btcMap["profit_real"],
-		ProfitUnreal:  btcMap["profit_unreal"],
-		RiskRate:      btcMap["risk_rate"],
-	}
-	account.FutureSubAccounts["LTC"] = FutureSubAccount{Currency: "LTC",
-		AccountRights: ltcMap["account_rights"],
-		KeepDeposit:   ltcMap["keep_deposit"],
-		ProfitReal:    ltcMap["profit_real"],
-		ProfitUnreal:  ltcMap["profit_unreal"],
-		RiskRate:      ltcMap["risk_rate"],
-	}
-	return account, nil
+	return parseFutureUserInfo(o.GetExchangeName(), body)
 }
 
 func (o *OkExApi) PlaceFutureOrder(cp CurrencyPair, contractType, price, amount string, openType, matchPrice, leverRate int) (string, error) {
@@ -203,21 +188,19 @@ func (o *OkExApi) PlaceFutureOrder(cp CurrencyPair, contractType, price, amount
 	postData.Set("type", strconv.Itoa(openType))
 	postData.Set("lever_rate", strconv.Itoa(leverRate))
 	postData.Set("match_price", strconv.Itoa(matchPrice))
-	o.buildPostForm(&postData)
-	placeOrderUrl := FUTURE_API_BASE_URL + FUTURE_TRADE_URI
-	body, err := HttpPostForm(o.client, placeOrderUrl, postData)
+	body, err := o.signedPost(o.baseUrl+FUTURE_TRADE_URI, postData)
 	if err != nil {
 		return "", err
 	}
-	respMap := make(map[string]interface{})
-	err = json.Unmarshal(body, &respMap)
+
+	var resp struct {
+		OrderId JsonInt64 `json:"order_id"`
+	}
+	err = decodeResponse(o.GetExchangeName(), body, &resp)
 	if err != nil {
 		return "", err
 	}
-	if !respMap["result"].(bool) {
-		return "", errors.New(string(body))
-	}
-	return fmt.Sprintf("%.0f", respMap["order_id"].(float64)), nil
+	return fmt.Sprintf("%d", resp.OrderId), nil
 }
 
 func (o *OkExApi) FutureCancelOrder(cp CurrencyPair, contractType, orderId string) (bool, error) {
@@ -225,69 +208,28 @@ func (o *OkExApi) FutureCancelOrder(cp CurrencyPair, contractType, orderId strin
 	postData.Set("symbol", cp.CustomSymbol("_", true))
 	postData.Set("order_id", orderId)
 	postData.Set("contract_type", contractType)
-	o.buildPostForm(&postData)
-	cancelUrl := FUTURE_API_BASE_URL + FUTURE_CANCEL_URI
-	body, err := HttpPostForm(o.client, cancelUrl, postData)
+	body, err := o.signedPost(o.baseUrl+FUTURE_CANCEL_URI, postData)
 	if err != nil {
 		return false, err
 	}
-	respMap := make(map[string]interface{})
-	err = json.Unmarshal(body, &respMap)
+
+	err = checkError(o.GetExchangeName(), body)
 	if err != nil {
 		return false, err
 	}
-	if respMap["result"] != nil && !respMap["result"].(bool) {
-		return false, errors.New(string(body))
-	}
 	return true, nil
 }
 
 func (o *OkExApi) GetFuturePosition(cp CurrencyPair, contractType string) ([]FuturePosition, error) {
-	positionUrl := FUTURE_API_BASE_URL + FUTURE_POSITION_URI
+	positionUrl := o.baseUrl + FUTURE_POSITION_URI
 	postData := url.Values{}
 	postData.Set("contract_type", contractType)
 	postData.Set("symbol", cp.CustomSymbol("_", true))
-	o.buildPostForm(&postData)
-	body, err := HttpPostForm(o.client, positionUrl, postData)
+	body, err := o.signedPost(positionUrl, postData)
 	if err != nil {
 		return nil, err
 	}
-	respMap := make(map[string]interface{})
-	err = json.Unmarshal(body, &respMap)
-	if err != nil {
-		return nil, err
-	}
-	if !respMap["result"].(bool) {
-		return nil, errors.New(string(body))
-	}
-
-	var posAr []FuturePosition
-	forceLiquPriceStr := respMap["force_liqu_price"].(string)
-	forceLiquPriceStr = strings.Replace(forceLiquPriceStr, ",", "", 1)
-	forceLiquPrice, err := strconv.ParseFloat(forceLiquPriceStr, 64)
-	holdings := respMap["holding"].([]interface{})
-	for _, v := range holdings {
-		holdingMap := v.(map[string]interface{})
-		pos := FuturePosition{}
-		pos.ForceLiquPrice = forceLiquPrice
-		pos.LeverRate = int(holdingMap["lever_rate"].(float64))
-		pos.ContractType = holdingMap["contract_type"].(string)
-		pos.ContractId = int64(holdingMap["contract_id"].(float64))
-		pos.BuyAmount = holdingMap["buy_amount"].(float64)
-		pos.BuyAvailable = holdingMap["buy_available"].(float64)
-		pos.BuyPriceAvg = holdingMap["buy_price_avg"].(float64)
-		pos.BuyPriceCost = holdingMap["buy_price_cost"].(float64)
-		pos.BuyProfitReal = holdingMap["buy_profit_real"].(float64)
-		pos.SellAmount = holdingMap["sell_amount"].(float64)
-		pos.SellAvailable = holdingMap["sell_available"].(float64)
-		pos.SellPriceAvg = holdingMap["sell_price_avg"].(float64)
-		pos.SellPriceCost = holdingMap["sell_price_cost"].(float64)
-		pos.SellProfitReal = holdingMap["sell_profit_real"].(float64)
-		pos.CreateDate = int64(holdingMap["create_date"].(float64))
-		pos.Symbol = cp.CustomSymbol("_", true)
-		posAr = append(posAr, pos)
-	}
-	return posAr, nil
+	return parseFuturePosition(o.GetExchangeName(), body, cp)
 }
 
 func (o *OkExApi) GetFutureOrders(orderIds []string, cp CurrencyPair, contractType string) ([]FutureOrder, error) {
@@ -295,12 +237,19 @@ func (o *OkExApi) GetFutureOrders(orderIds []string, cp CurrencyPair, contractTy
 	postData.Set("order_id", strings.Join(orderIds, ","))
 	postData.Set("contract_type", contractType)
 	postData.Set("symbol", cp.CustomSymbol("_", true))
-	o.buildPostForm(&postData)
-	body, err := HttpPostForm(o.client, FUTURE_API_BASE_URL+FUTURE_ORDERS_INFO_URI, postData)
+	body, err := o.signedPost(o.baseUrl+FUTURE_ORDERS_INFO_URI, postData)
+	if err != nil {
+		return nil, err
+	}
+	orders, err := parseFutureOrders(o.GetExchangeName(), body, cp)
 	if err != nil {
 		return nil, err
 	}
-	return o.parseOrders(body, cp)
+	//查询不到的订单不会返回错误码, 只是不在结果里
+	if len(orders) < len(orderIds) {
+		return nil, &ApiError{Exchange: o.GetExchangeName(), Kind: ERR_KIND_INVALID_REQUEST, Message: "orders " + strings.Join(orderIds, ",") + " not found"}
+	}
+	return orders, nil
 }
 
 func (o *OkExApi) GetUnfinishedFutureOrders(cp CurrencyPair, contractType string) ([]FutureOrder, error) {
@@ -311,12 +260,11 @@ func (o *OkExApi) GetUnfinishedFutureOrders(cp CurrencyPair, contractType string
 	postData.Set("status", "1")
 	postData.Set("current_page", "1")
 	postData.Set("page_length", "50")
-	o.buildPostForm(&postData)
-	body, err := HttpPostForm(o.client, FUTURE_API_BASE_URL+FUTURE_ORDER_INFO_URI, postData)
+	body, err := o.signedPost(o.baseUrl+FUTURE_ORDER_INFO_URI, postData)
 	if err != nil {
 		return nil, err
 	}
-	return o.parseOrders(body, cp)
+	return parseFutureOrders(o.GetExchangeName(), body, cp)
 }
 
 func (o *OkExApi) GetFee() (float64, error) {
@@ -324,16 +272,22 @@ func (o *OkExApi) GetFee() (float64, error) {
 }
 
 func (o *OkExApi) GetExchangeRate() (float64, error) {
-	respMap, err := HttpGet(o.client, FUTURE_API_BASE_URL+EXCHANGE_RATE_URI)
+	body, err := HttpGetBytes(o.client, o.baseUrl+EXCHANGE_RATE_URI)
+	if err != nil {
+		return -1, err
+	}
+
+	var resp struct {
+		Rate *JsonFloat64 `json:"rate"`
+	}
+	err = decodeResponse(o.GetExchangeName(), body, &resp)
 	if err != nil {
-		log.Println(respMap)
 		return -1, err
 	}
-	if respMap["rate"] == nil {
-		log.Println(respMap)
-		return -1, errors.New("error")
+	if resp.Rate == nil {
+		return -1, &DecodeError{Err: errors.New("missing rate"), Body: body}
 	}
-	return respMap["rate"].(float64), nil
+	return float64(*resp.Rate), nil
 }
 
 func (o *OkExApi) GetContractValue(cp CurrencyPair) (float64, error) {
@@ -357,44 +311,27 @@ func (o *OkExApi) GetKlineRecords(contract_type string, cp CurrencyPair, period
 	params.Set("contract_type", contract_type)
 	params.Set("size", fmt.Sprintf("%d", size))
 	params.Set("since", fmt.Sprintf("%d", since))
-	resp, err := o.client.Get(FUTURE_API_BASE_URL + FUTURE_GET_KLINE_URI + "?" + params.Encode())
+	body, err := HttpGetBytes(o.client, o.baseUrl+FUTURE_GET_KLINE_URI+"?"+params.Encode())
 	if err != nil {
-		log.Println(err)
-		return nil, err
-	}
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
 
-	var kLines [][]interface{}
-	err = json.Unmarshal(body, &kLines)
+	kLines, err := parseKlines(o.GetExchangeName(), body)
 	if err != nil {
-		log.Println(string(body))
 		return nil, err
 	}
 	var klineRecords []FutureKline
 	for _, record := range kLines {
 		r := FutureKline{}
 		r.Kline = new(Kline)
-		for i, e := range record {
-			switch i {
-			case 0:
-				r.Timestamp = int64(e.(float64)) / 1000 //to unix timestramp
-			case 1:
-				r.Open = e.(float64)
-			case 2:
-				r.High = e.(float64)
-			case 3:
-				r.Low = e.(float64)
-			case 4:
-				r.Close = e.(float64)
-			case 5:
-				r.Vol = e.(float64)
-			case 6:
-				r.Vol2 = e.(float64)
-			}
+		r.Timestamp = int64(record[0]) / 1000 //to unix timestramp
+		r.Open = float64(record[1])
+		r.High = float64(record[2])
+		r.Low = float64(record[3])
+		r.Close = float64(record[4])
+		r.Vol = float64(record[5])
+		if len(record) > 6 {
+			r.Vol2 = float64(record[6])
 		}
 		klineRecords = append(klineRecords, r)
 	}
@@ -406,68 +343,146 @@ func (o *OkExApi) GetExchangeName() string {
 }
 
 func (o *OkExApi) GetTrades(cp CurrencyPair, since int64) ([]Trade, error) {
-	panic("unsupported")
+	return nil, NewUnsupportedError(FUTURE_EXCHANGE_NAME, "GetTrades")
 }
 
-func (o *OkExApi) parseOrders(body []byte, cp CurrencyPair) ([]FutureOrder, error) {
-	respMap := make(map[string]interface{})
-	err := json.Unmarshal(body, &respMap)
+//币币账户与合约账户之间划转; type 1:币币转合约 2:合约转币币
+func (o *OkExApi) Transfer(currency, amount string, from, to AccountType) (*TransferResult, error) {
+	var devolveType string
+	switch {
+	case from == ACCOUNT_SPOT && to == ACCOUNT_FUTURES:
+		devolveType = "1"
+	case from == ACCOUNT_FUTURES && to == ACCOUNT_SPOT:
+		devolveType = "2"
+	default:
+		return nil, NewUnsupportedError(FUTURE_EXCHANGE_NAME, fmt.Sprintf("transfer from %s to %s", from, to))
+	}
+
+	postData := url.Values{}
+	postData.Set("symbol", strings.ToLower(currency)+"_usd")
+	postData.Set("type", devolveType)
+	postData.Set("amount", amount)
+	body, err := o.signedPost(o.baseUrl+FUTURE_DEVOLVE_URI, postData)
 	if err != nil {
 		return nil, err
 	}
-	if !respMap["result"].(bool) {
-		return nil, errors.New(string(body))
+	err = checkError(o.GetExchangeName(), body)
+	if err != nil {
+		return nil, err
 	}
 
-	var orders []interface{}
-	orders = respMap["orders"].([]interface{})
-	var futureOrders []FutureOrder
-	for _, v := range orders {
-		vv := v.(map[string]interface{})
-		futureOrder := FutureOrder{}
-		futureOrder.OrderID = int64(vv["order_id"].(float64))
-		futureOrder.Amount = vv["amount"].(float64)
-		futureOrder.Price = vv["price"].(float64)
-		futureOrder.AvgPrice = vv["price_avg"].(float64)
-		futureOrder.DealAmount = vv["deal_amount"].(float64)
-		futureOrder.Fee = vv["fee"].(float64)
-		futureOrder.OType = int(vv["type"].(float64))
-		futureOrder.OrderTime = int64(vv["create_date"].(float64))
-		futureOrder.LeverRate = int(vv["lever_rate"].(float64))
-		futureOrder.ContractName = vv["contract_name"].(string)
-		futureOrder.Currency = cp.CustomSymbol("_", true)
-		st := int(vv["status"].(float64))
-		switch st {
-		case 0:
-			futureOrder.Status = ORDER_UNFINISHED
-		case 1:
-			futureOrder.Status = ORDER_PART_FINISH
-		case 2:
-			futureOrder.Status = ORDER_FINISH
-		case 4:
-			futureOrder.Status = ORDER_CANCELING
-		case -1:
-			futureOrder.Status = ORDER_CANCEL
+	transfer := new(TransferResult)
+	transfer.Currency = strings.ToUpper(currency)
+	transfer.Amount, _ = strconv.ParseFloat(amount, 64)
+	transfer.From = from
+	transfer.To = to
+	return transfer, nil
+}
+
+//用 future_ticker.do 返回的 date(秒) 作为服务端时间, 取这一秒的中点
+func FutureServerTime(client *http.Client, baseUrl string) ServerTimeFunc {
+	reqUrl := ResolveBaseUrl(FUTURE_API_BASE_URL, baseUrl) + fmt.Sprintf(FUTURE_TICKER_URI, "btc_usd", THIS_WEEK_CONTRACT)
+	return func() (time.Time, error) {
+		body, err := HttpGetBytes(client, reqUrl)
+		if err != nil {
+			return time.Time{}, err
 		}
-		futureOrders = append(futureOrders, futureOrder)
+		ticker, err := parseTicker(OK_EX, body)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return MidSecond(time.Unix(int64(ticker.Date), 0)), nil
 	}
-	return futureOrders, nil
 }
 
-func (o *OkExApi) buildPostForm(postForm *url.Values) error {
-	postForm.Set("api_key", o.apiKey)
-	//postForm.Set("secretKey", ctx.secretKey)
+func (o *OkExApi) signedPost(reqUrl string, postData url.Values) ([]byte, error) {
+	u, err := url.Parse(reqUrl)
+	if err != nil {
+		return nil, err
+	}
+	signed, err := o.signer.Sign("POST", u.Path, postData, o.clock.Now())
+	if err != nil {
+		return nil, err
+	}
+	return HttpPostForm2(o.client, reqUrl, signed.Params, signed.Headers)
+}
 
-	payload := postForm.Encode()
-	payload = payload + "&secret_key=" + o.apiSecretKey
-	payload2, _ := url.QueryUnescape(payload) // can't escape for sign
-	sign, err := GetParamMD5Sign(o.apiSecretKey, payload2)
+func parseFutureUserInfo(exchange string, body []byte) (*FutureAccount, error) {
+	var resp futureUserInfoResponse
+	err := decodeResponse(exchange, body, &resp)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	account := new(FutureAccount)
+	account.FutureSubAccounts = make(map[string]FutureSubAccount, len(resp.Info))
+	for currency, v := range resp.Info {
+		currency = strings.ToUpper(currency)
+		account.FutureSubAccounts[currency] = FutureSubAccount{Currency: currency,
+			AccountRights: float64(v.AccountRights),
+			KeepDeposit:   float64(v.KeepDeposit),
+			ProfitReal:    float64(v.ProfitReal),
+			ProfitUnreal:  float64(v.ProfitUnreal),
+			RiskRate:      float64(v.RiskRate),
+		}
 	}
+	return account, nil
+}
 
-	postForm.Set("sign", strings.ToUpper(sign))
-	//postForm.Del("secretKey")
-	//fmt.Println(postForm)
-	return nil
+func parseFuturePosition(exchange string, body []byte, cp CurrencyPair) ([]FuturePosition, error) {
+	var resp futurePositionResponse
+	err := decodeResponse(exchange, body, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	var posAr []FuturePosition
+	for _, v := range resp.Holding {
+		pos := FuturePosition{}
+		pos.ForceLiquPrice = float64(resp.ForceLiquPrice)
+		pos.LeverRate = int(v.LeverRate)
+		pos.ContractType = v.ContractType
+		pos.ContractId = int64(v.ContractId)
+		pos.BuyAmount = float64(v.BuyAmount)
+		pos.BuyAvailable = float64(v.BuyAvailable)
+		pos.BuyPriceAvg = float64(v.BuyPriceAvg)
+		pos.BuyPriceCost = float64(v.BuyPriceCost)
+		pos.BuyProfitReal = float64(v.BuyProfitReal)
+		pos.SellAmount = float64(v.SellAmount)
+		pos.SellAvailable = float64(v.SellAvailable)
+		pos.SellPriceAvg = float64(v.SellPriceAvg)
+		pos.SellPriceCost = float64(v.SellPriceCost)
+		pos.SellProfitReal = float64(v.SellProfitReal)
+		pos.CreateDate = int64(v.CreateDate)
+		pos.Symbol = cp.CustomSymbol("_", true)
+		posAr = append(posAr, pos)
+	}
+	return posAr, nil
+}
+
+func parseFutureOrders(exchange string, body []byte, cp CurrencyPair) ([]FutureOrder, error) {
+	var resp futureOrdersResponse
+	err := decodeResponse(exchange, body, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	futureOrders := []FutureOrder{}
+	for _, v := range resp.Orders {
+		futureOrder := FutureOrder{}
+		futureOrder.OrderID = int64(v.OrderId)
+		futureOrder.Amount = float64(v.Amount)
+		futureOrder.Price = float64(v.Price)
+		futureOrder.AvgPrice = float64(v.PriceAvg)
+		futureOrder.DealAmount = float64(v.DealAmount)
+		futureOrder.Fee = float64(v.Fee)
+		futureOrder.OType = int(v.Type)
+		futureOrder.OrderTime = int64(v.CreateDate)
+		futureOrder.LeverRate = int(v.LeverRate)
+		futureOrder.ContractName = v.ContractName
+		futureOrder.Currency = cp.CustomSymbol("_", true)
+		futureOrder.Status = orderStatus(int(v.Status))
+		futureOrders = append(futureOrders, futureOrder)
+	}
+	return futureOrders, nil
 }
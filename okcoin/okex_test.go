@@ -0,0 +1,167 @@
+package okcoin
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+	"github.com/qct/cryptocurrency-exchange-api/apitest"
+	"github.com/stretchr/testify/assert"
+)
+
+var btcUsd = NewCurrencyPair("BTC", "USD")
+
+func newTestExApi(t *testing.T, name string) *OkExApi {
+	return NewOkExApi(replayClient(t, name), os.Getenv("OKCOIN_API_KEY"), os.Getenv("OKCOIN_SECRET_KEY"))
+}
+
+func TestOkExApi_GetFutureTicker(t *testing.T) {
+	ticker, err := newTestExApi(t, "OkEx_GetFutureTicker").GetFutureTicker(btcUsd, THIS_WEEK_CONTRACT)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1506787200), ticker.Date)
+	assert.Equal(t, 4301.0, ticker.Last)
+	assert.Equal(t, 4300.5, ticker.Buy)
+	assert.Equal(t, 4301.5, ticker.Sell)
+	assert.Equal(t, 500000.0, ticker.Vol)
+}
+
+func TestFutureServerTime(t *testing.T) {
+	now, err := FutureServerTime(replayClient(t, "OkEx_GetFutureTicker"), "")()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Unix(1506787200, 500*int64(time.Millisecond)), now)
+}
+
+func TestOkExApi_GetFutureDepth(t *testing.T) {
+	depth, err := newTestExApi(t, "OkEx_GetFutureDepth").GetFutureDepth(btcUsd, THIS_WEEK_CONTRACT, 2)
+	assert.NoError(t, err)
+	assert.Len(t, depth.AskList, 2)
+	assert.Equal(t, 4301.5, depth.AskList[0].Price, "asks sorted by price")
+	assert.Equal(t, 4300.5, depth.BidList[0].Price)
+}
+
+func TestOkExApi_GetFutureIndex(t *testing.T) {
+	index, err := newTestExApi(t, "OkEx_GetFutureIndex").GetFutureIndex(btcUsd)
+	assert.NoError(t, err)
+	assert.Equal(t, 4302.37, index)
+}
+
+func TestOkExApi_GetFutureEstimatedPrice(t *testing.T) {
+	price, err := newTestExApi(t, "OkEx_GetFutureEstimatedPrice").GetFutureEstimatedPrice(btcUsd)
+	assert.NoError(t, err)
+	assert.Equal(t, 4305.12, price)
+}
+
+func TestOkExApi_GetExchangeRate(t *testing.T) {
+	rate, err := newTestExApi(t, "OkEx_GetExchangeRate").GetExchangeRate()
+	assert.NoError(t, err)
+	assert.Equal(t, 6.6542, rate)
+}
+
+func TestOkExApi_GetKlineRecords(t *testing.T) {
+	klines, err := newTestExApi(t, "OkEx_GetKlineRecords").GetKlineRecords(THIS_WEEK_CONTRACT, btcUsd, "1min", 2, 1506787200000)
+	assert.NoError(t, err)
+	assert.Len(t, klines, 2)
+	assert.Equal(t, Kline{Timestamp: 1506787200, Open: 4300, High: 4310, Low: 4295, Close: 4305, Vol: 1200}, *klines[0].Kline)
+	assert.Equal(t, 27.88, klines[0].Vol2)
+}
+
+func TestOkExApi_GetFutureUserInfo(t *testing.T) {
+	account, err := newTestExApi(t, "OkEx_GetFutureUserInfo").GetFutureUserInfo()
+	assert.NoError(t, err)
+	assert.Len(t, account.FutureSubAccounts, 2)
+	assert.Equal(t, FutureSubAccount{Currency: "BTC", AccountRights: 1.5, KeepDeposit: 0.2, ProfitReal: 0.01, ProfitUnreal: -0.005, RiskRate: 7.5},
+		account.FutureSubAccounts["BTC"])
+}
+
+func TestOkExApi_PlaceFutureOrder(t *testing.T) {
+	orderId, err := newTestExApi(t, "OkEx_PlaceFutureOrder").PlaceFutureOrder(btcUsd, THIS_WEEK_CONTRACT, "4300", "2", OPEN_BUY, 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, "20001", orderId)
+}
+
+func TestOkExApi_FutureCancelOrder(t *testing.T) {
+	api := newTestExApi(t, "OkEx_FutureCancelOrder")
+	ok, err := api.FutureCancelOrder(btcUsd, THIS_WEEK_CONTRACT, "20001")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = api.FutureCancelOrder(btcUsd, THIS_WEEK_CONTRACT, "404")
+	assert.False(t, ok)
+	var apiErr *ApiError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, "20015", apiErr.Code)
+}
+
+func TestOkExApi_GetFuturePosition(t *testing.T) {
+	positions, err := newTestExApi(t, "OkEx_GetFuturePosition").GetFuturePosition(btcUsd, THIS_WEEK_CONTRACT)
+	assert.NoError(t, err)
+	assert.Len(t, positions, 1)
+	pos := positions[0]
+	assert.Equal(t, 3900.5, pos.ForceLiquPrice)
+	assert.Equal(t, 10, pos.LeverRate)
+	assert.Equal(t, THIS_WEEK_CONTRACT, pos.ContractType)
+	assert.Equal(t, int64(201710060000013), pos.ContractId)
+	assert.Equal(t, 2.0, pos.BuyAmount)
+	assert.Equal(t, 4300.0, pos.BuyPriceAvg)
+	assert.Equal(t, "btc_usd", pos.Symbol)
+}
+
+func TestOkExApi_GetFutureOrders(t *testing.T) {
+	orders, err := newTestExApi(t, "OkEx_GetFutureOrders").GetFutureOrders([]string{"20001", "20002"}, btcUsd, THIS_WEEK_CONTRACT)
+	assert.NoError(t, err)
+	assert.Len(t, orders, 2)
+	assert.Equal(t, int64(20001), orders[0].OrderID)
+	assert.Equal(t, TradeStatus(ORDER_PART_FINISH), orders[0].Status)
+	assert.Equal(t, OPEN_BUY, orders[0].OType)
+	assert.Equal(t, 4299.5, orders[0].AvgPrice)
+	assert.Equal(t, -0.0001, orders[0].Fee)
+	assert.Equal(t, "BTC1006", orders[0].ContractName)
+	assert.Equal(t, OPEN_SELL, orders[1].OType)
+}
+
+func TestOkExApi_GetUnfinishedFutureOrders(t *testing.T) {
+	orders, err := newTestExApi(t, "OkEx_GetUnfinishedFutureOrders").GetUnfinishedFutureOrders(btcUsd, THIS_WEEK_CONTRACT)
+	assert.NoError(t, err)
+	assert.Len(t, orders, 1)
+	assert.Equal(t, int64(20002), orders[0].OrderID)
+	assert.Equal(t, TradeStatus(ORDER_UNFINISHED), orders[0].Status)
+}
+
+func TestOkExApi_Transfer(t *testing.T) {
+	api := newTestExApi(t, "OkEx_Transfer")
+	transfer, err := api.Transfer("BTC", "0.5", ACCOUNT_SPOT, ACCOUNT_FUTURES)
+	assert.NoError(t, err)
+	assert.Equal(t, &TransferResult{Currency: "BTC", Amount: 0.5, From: ACCOUNT_SPOT, To: ACCOUNT_FUTURES}, transfer)
+
+	_, err = api.Transfer("BTC", "0.5", ACCOUNT_SPOT, ACCOUNT_MARGIN)
+	apitest.AssertErrorKind(t, err, ERR_KIND_UNSUPPORTED)
+	assert.Contains(t, err.Error(), "transfer from SPOT to MARGIN")
+}
+
+//不访问网络的方法
+func TestOkExApi_Constants(t *testing.T) {
+	api := NewOkExApi(http.DefaultClient, "", "")
+	assert.Equal(t, FUTURE_EXCHANGE_NAME, api.GetExchangeName())
+
+	fee, err := api.GetFee()
+	assert.NoError(t, err)
+	assert.Equal(t, 0.03, fee)
+
+	value, err := api.GetContractValue(btcUsd)
+	assert.NoError(t, err)
+	assert.Equal(t, 100.0, value)
+	_, err = api.GetContractValue(NewCurrencyPair("ETH", "USD"))
+	assert.Error(t, err)
+
+	weekday, hour, minute, second := api.GetDeliveryTime()
+	assert.Equal(t, []int{4, 16, 0, 0}, []int{weekday, hour, minute, second})
+
+	_, err = api.GetTrades(btcUsd, 0)
+	var apiErr *ApiError
+	if assert.True(t, errors.As(err, &apiErr), "expected ApiError, got %v", err) {
+		assert.Equal(t, ErrorKind(ERR_KIND_UNSUPPORTED), apiErr.Kind)
+	}
+}
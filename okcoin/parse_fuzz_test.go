@@ -0,0 +1,99 @@
+package okcoin
+
+import (
+	"testing"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+)
+
+var fuzzPair = NewCurrencyPair("BTC", "CNY")
+
+func FuzzParseDepth(f *testing.F) {
+	f.Add([]byte(`{"asks":[[792,5],[789.68,0.018]],"bids":[[787.1,0.35],[787,12.071]]}`))
+	f.Add([]byte(`{"result":false,"error_code":10001}`))
+	f.Add([]byte(`{"asks":[["1,792.5"]],"bids":null}`))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		depth, err := parseDepth(EXCHANGE_NAME_CN, body)
+		if err == nil && depth == nil {
+			t.Fatal("nil depth without error")
+		}
+	})
+}
+
+func FuzzParseTicker(f *testing.F) {
+	f.Add([]byte(`{"date":"1410431279","ticker":{"buy":"33.15","high":"34.15","last":"33.15","low":"32.05","sell":"33.16","vol":"10532696.39199642"}}`))
+	f.Add([]byte(`{"date":"1411627632","ticker":{"last":409.2,"buy":408.23,"sell":409.18,"high":432,"low":405.71,"vol":55168}}`))
+	f.Add([]byte(`{"ticker":"x"}`))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		ticker, err := parseTicker(EXCHANGE_NAME_CN, body)
+		if err == nil && ticker == nil {
+			t.Fatal("nil ticker without error")
+		}
+	})
+}
+
+func FuzzParseKlines(f *testing.F) {
+	f.Add([]byte(`[[1417536000000,2370.16,2380,2352,2367.37,17259.83,728.81]]`))
+	f.Add([]byte(`[[1417536000000]]`))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		kLines, err := parseKlines(FUTURE_EXCHANGE_NAME, body)
+		if err != nil {
+			return
+		}
+		for _, record := range kLines {
+			if len(record) < 6 {
+				t.Fatalf("short kline record %v", record)
+			}
+		}
+	})
+}
+
+func FuzzParseAccount(f *testing.F) {
+	f.Add([]byte(`{"info":{"funds":{"asset":{"net":"3.1","total":"3.1"},"free":{"btc":"0.5","cny":"100"},"freezed":{"btc":"0.1","cny":"0"}}},"result":true}`))
+	f.Add([]byte(`{"result":true,"info":{"funds":7}}`))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		account, err := parseAccount(EXCHANGE_NAME_CN, body)
+		if err == nil && account == nil {
+			t.Fatal("nil account without error")
+		}
+	})
+}
+
+func FuzzParseOrders(f *testing.F) {
+	f.Add([]byte(`{"result":true,"orders":[{"amount":0.1,"avg_price":0,"create_date":1418008467000,"deal_amount":0,"order_id":10000591,"price":500,"status":0,"symbol":"btc_cny","type":"sell"}]}`))
+	f.Add([]byte(`{"result":true,"orders":[{"order_id":"x"}]}`))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		parseOrders(EXCHANGE_NAME_CN, body, fuzzPair)
+	})
+}
+
+func FuzzParseTrades(f *testing.F) {
+	f.Add([]byte(`[{"amount":"0.01","date":1367130137,"date_ms":1367130137000,"price":"787.71","tid":230433,"type":"sell"}]`))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		parseTrades(EXCHANGE_NAME_CN, body)
+	})
+}
+
+func FuzzParseFutureUserInfo(f *testing.F) {
+	f.Add([]byte(`{"info":{"btc":{"account_rights":1,"keep_deposit":0,"profit_real":3.33,"profit_unreal":0,"risk_rate":10000}},"result":true}`))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		account, err := parseFutureUserInfo(FUTURE_EXCHANGE_NAME, body)
+		if err == nil && account == nil {
+			t.Fatal("nil account without error")
+		}
+	})
+}
+
+func FuzzParseFuturePosition(f *testing.F) {
+	f.Add([]byte(`{"force_liqu_price":"1,220.07","holding":[{"buy_amount":1,"buy_available":0,"buy_price_avg":422.78,"buy_price_cost":422.78,"buy_profit_real":-0.00007096,"contract_id":20141219012,"contract_type":"this_week","create_date":1418113356000,"lever_rate":10,"sell_amount":0,"sell_available":0,"sell_price_avg":0,"sell_price_cost":0,"sell_profit_real":0,"symbol":"btc_usd"}],"result":true}`))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		parseFuturePosition(FUTURE_EXCHANGE_NAME, body, fuzzPair)
+	})
+}
+
+func FuzzParseFutureOrders(f *testing.F) {
+	f.Add([]byte(`{"orders":[{"amount":111,"contract_name":"LTC0934","create_date":1408076414000,"deal_amount":1,"fee":0,"order_id":106837,"price":1111,"price_avg":0,"status":"0","symbol":"ltc_usd","type":"1","unit_amount":100,"lever_rate":10}],"result":true}`))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		parseFutureOrders(FUTURE_EXCHANGE_NAME, body, fuzzPair)
+	})
+}
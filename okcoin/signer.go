@@ -0,0 +1,55 @@
+package okcoin
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+)
+
+//okcoin.cn: 参数按key排序后拼接 &secretKey=xxx, md5后转大写
+type CNSigner struct {
+	Credentials CredentialProvider
+}
+
+func (s *CNSigner) Sign(method, path string, params url.Values, timestamp time.Time) (*SignedRequest, error) {
+	credentials, err := s.Credentials.Credentials()
+	if err != nil {
+		return nil, err
+	}
+	signed := CopyValues(params)
+	signed.Set("apiKey", credentials.ApiKey)
+	payload := signed.Encode() + "&secretKey=" + credentials.ApiSecretKey
+	sign, err := GetParamMD5Sign(credentials.ApiSecretKey, payload)
+	if err != nil {
+		return nil, err
+	}
+	signed.Set("sign", strings.ToUpper(sign))
+	return &SignedRequest{Params: signed}, nil
+}
+
+//okex.com: 同 CNSigner, 但参数名为 api_key/secret_key, 且对未转义的参数串签名
+type ExSigner struct {
+	Credentials CredentialProvider
+}
+
+func (s *ExSigner) Sign(method, path string, params url.Values, timestamp time.Time) (*SignedRequest, error) {
+	credentials, err := s.Credentials.Credentials()
+	if err != nil {
+		return nil, err
+	}
+	signed := CopyValues(params)
+	signed.Set("api_key", credentials.ApiKey)
+	payload := signed.Encode() + "&secret_key=" + credentials.ApiSecretKey
+	payload, err = url.QueryUnescape(payload) // can't escape for sign
+	if err != nil {
+		return nil, err
+	}
+	sign, err := GetParamMD5Sign(credentials.ApiSecretKey, payload)
+	if err != nil {
+		return nil, err
+	}
+	signed.Set("sign", strings.ToUpper(sign))
+	return &SignedRequest{Params: signed}, nil
+}
@@ -0,0 +1,61 @@
+package okcoin
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+	"github.com/stretchr/testify/assert"
+)
+
+//参数取自 OKCoin REST API 文档的签名示例. 文档只给出了排序、拼接 secret_key 的步骤, 没有公布签名结果,
+//所以这里断言签名串与文档的步骤一致; md5 本身由 sign_util_test 中 RFC 1321 的向量验证
+const DOC_API_KEY = "c821db84-6fbd-11e4-a9e3-c86000d26d7c"
+
+func docParams() url.Values {
+	params := url.Values{}
+	params.Set("symbol", "btc_usd")
+	params.Set("type", "buy")
+	params.Set("price", "680")
+	params.Set("amount", "1.0")
+	return params
+}
+
+func upperMD5(t *testing.T, payload string) string {
+	sign, err := GetParamMD5Sign("", payload)
+	assert.NoError(t, err)
+	return strings.ToUpper(sign)
+}
+
+func TestCNSigner_Sign(t *testing.T) {
+	params := docParams()
+	signer := &CNSigner{Credentials: StaticCredentials{ApiKey: DOC_API_KEY, ApiSecretKey: "secretKey"}}
+	signed, err := signer.Sign("POST", "/api/v1/trade.do", params, time.Unix(0, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, DOC_API_KEY, signed.Params.Get("apiKey"))
+	//okcoin.cn 的参数名为 apiKey/secretKey
+	payload := "amount=1.0&apiKey=" + DOC_API_KEY + "&price=680&symbol=btc_usd&type=buy&secretKey=secretKey"
+	assert.Equal(t, upperMD5(t, payload), signed.Params.Get("sign"))
+	assert.Empty(t, params.Get("sign"), "params must not be modified")
+}
+
+func TestExSigner_Sign(t *testing.T) {
+	params := docParams()
+	signer := &ExSigner{Credentials: StaticCredentials{ApiKey: DOC_API_KEY, ApiSecretKey: "secretKey"}}
+	signed, err := signer.Sign("POST", "/api/v1/trade.do", params, time.Unix(0, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, DOC_API_KEY, signed.Params.Get("api_key"))
+	payload := "amount=1.0&api_key=" + DOC_API_KEY + "&price=680&symbol=btc_usd&type=buy&secret_key=secretKey"
+	assert.Equal(t, upperMD5(t, payload), signed.Params.Get("sign"))
+	assert.Empty(t, params.Get("api_key"), "params must not be modified")
+
+	//对未转义的参数串签名
+	params.Set("contract_type", "this_week")
+	params.Set("order_id", "1,2")
+	signed, err = signer.Sign("POST", "/api/v1/future_orders_info.do", params, time.Unix(0, 0))
+	assert.NoError(t, err)
+	payload = "amount=1.0&api_key=" + DOC_API_KEY + "&contract_type=this_week&order_id=1,2&price=680&symbol=btc_usd&type=buy&secret_key=secretKey"
+	assert.Equal(t, upperMD5(t, payload), signed.Params.Get("sign"))
+}
@@ -0,0 +1,27 @@
+package paper
+
+import (
+	"testing"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+	"github.com/qct/cryptocurrency-exchange-api/apitest"
+)
+
+func TestExchange_ApiConformance(t *testing.T) {
+	ex, _ := newTestExchange()
+	ex.ValuationCurrency = "USDT"
+
+	apitest.TestApi(t, apitest.Config{Api: ex, Pair: btcUsdt, Amount: 0.5})
+}
+
+func TestFutureExchange_ApiConformance(t *testing.T) {
+	ex, _, _ := newTestFutureExchange()
+
+	apitest.TestFutureApi(t, apitest.FutureConfig{
+		Api:          ex,
+		Pair:         btcUsd,
+		ContractType: THIS_WEEK_CONTRACT,
+		Amount:       10,
+		LeverRate:    10,
+	})
+}
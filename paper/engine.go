@@ -0,0 +1,296 @@
+package paper
+
+import (
+	"reflect"
+	"sort"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+)
+
+type order struct {
+	Order
+	pair  CurrencyPair
+	funds float64 //市价买单还没花掉的计价币
+}
+
+func (o *order) isBuy() bool {
+	return o.Side == BUY || o.Side == BUY_MARKET
+}
+
+func (o *order) isMarket() bool {
+	return o.Side == BUY_MARKET || o.Side == SELL_MARKET
+}
+
+func (o *order) open() bool {
+	return o.Status == ORDER_UNFINISHED || o.Status == ORDER_PART_FINISH
+}
+
+func (o *order) remaining() float64 {
+	return o.Amount - o.DealAmount
+}
+
+//按price成交时最多还能成交的数量
+func (o *order) capacity(price float64) float64 {
+	if o.Side == BUY_MARKET {
+		return o.funds / price
+	}
+	return o.remaining()
+}
+
+//限价单能否按price成交
+func (o *order) crosses(price float64) bool {
+	switch o.Side {
+	case BUY:
+		return price <= o.Price+epsilon
+	case SELL:
+		return price >= o.Price-epsilon
+	}
+	return true
+}
+
+func (o *order) copy() *Order {
+	order := o.Order
+	return &order
+}
+
+//一个交易对的撮合簿: 账户自己的挂单和 Feed 最近一次的盘口
+type book struct {
+	pair    CurrencyPair
+	bids    []*order //价格从高到低, 同价按下单先后
+	asks    []*order //价格从低到高, 同价按下单先后
+	depth   *Depth
+	askUsed map[float64]float64 //当前盘口中已经被吃掉的数量
+	bidUsed map[float64]float64
+}
+
+func (b *book) add(o *order) {
+	if o.isBuy() {
+		b.bids = append(b.bids, o)
+		sort.SliceStable(b.bids, func(i, j int) bool { return b.bids[i].Price > b.bids[j].Price })
+	} else {
+		b.asks = append(b.asks, o)
+		sort.SliceStable(b.asks, func(i, j int) bool { return b.asks[i].Price < b.asks[j].Price })
+	}
+}
+
+func (b *book) remove(o *order) {
+	b.bids = removeOrder(b.bids, o)
+	b.asks = removeOrder(b.asks, o)
+}
+
+func removeOrder(orders []*order, o *order) []*order {
+	for i := range orders {
+		if orders[i] == o {
+			return append(orders[:i], orders[i+1:]...)
+		}
+	}
+	return orders
+}
+
+//去掉已经完成的挂单
+func (b *book) prune() {
+	for _, side := range []*[]*order{&b.bids, &b.asks} {
+		open := (*side)[:0]
+		for _, o := range *side {
+			if o.open() {
+				open = append(open, o)
+			}
+		}
+		*side = open
+	}
+}
+
+//Feed 的盘口扣掉已经被吃掉的部分再加上自己的挂单, asks从低到高, bids从高到低
+func (b *book) snapshot(size int) *Depth {
+	asks, bids := map[float64]float64{}, map[float64]float64{}
+	for _, o := range b.asks {
+		asks[o.Price] += o.remaining()
+	}
+	for _, o := range b.bids {
+		bids[o.Price] += o.remaining()
+	}
+	return b.merge(asks, bids, size)
+}
+
+//把 Feed 盘口中没被吃掉的部分合并到asks和bids中
+func (b *book) merge(asks, bids map[float64]float64, size int) *Depth {
+	for _, r := range b.depth.AskList {
+		asks[r.Price] += r.Amount - b.askUsed[r.Price]
+	}
+	for _, r := range b.depth.BidList {
+		bids[r.Price] += r.Amount - b.bidUsed[r.Price]
+	}
+
+	depth := &Depth{AskList: depthRecords(asks), BidList: depthRecords(bids)}
+	sort.Sort(depth.AskList)
+	sort.Sort(sort.Reverse(depth.BidList))
+	depth.AskList = truncate(depth.AskList, size)
+	depth.BidList = truncate(depth.BidList, size)
+	return depth
+}
+
+func depthRecords(levels map[float64]float64) DepthRecords {
+	records := DepthRecords{}
+	for price, amount := range levels {
+		if amount > epsilon {
+			records = append(records, DepthRecord{Price: price, Amount: amount})
+		}
+	}
+	return records
+}
+
+//从 Feed 获取最新盘口, 然后撮合被行情穿过的挂单
+func (e *Exchange) refresh(cp CurrencyPair) (*book, error) {
+	b, ok := e.books[cp.Symbol()]
+	if !ok {
+		b = &book{pair: cp}
+		e.books[cp.Symbol()] = b
+	}
+	depth, err := e.Feed.GetDepth(cp, e.DepthSize)
+	if err != nil {
+		return nil, err
+	}
+	b.update(depth)
+
+	//挂单按价格优先、时间优先吃 Feed 的流动性, 按挂单价成交
+	for _, o := range append(append([]*order{}, b.bids...), b.asks...) {
+		for e.takeFeed(b, o, false) {
+		}
+	}
+	b.prune()
+	return b, nil
+}
+
+//盘口变化后之前吃掉的流动性恢复
+func (b *book) update(depth *Depth) {
+	sort.Sort(depth.AskList)
+	sort.Sort(sort.Reverse(depth.BidList))
+	if !reflect.DeepEqual(depth, b.depth) {
+		b.depth = depth
+		b.askUsed, b.bidUsed = map[float64]float64{}, map[float64]float64{}
+	}
+}
+
+//买入(buy为true)时对手盘上第一个还有流动性的档位, 价格不满足crosses时ok为false
+func (b *book) bestLevel(buy bool, crosses func(price float64) bool) (price, available float64, ok bool) {
+	levels, used := b.depth.AskList, b.askUsed
+	if !buy {
+		levels, used = b.depth.BidList, b.bidUsed
+	}
+	for _, level := range levels {
+		if available = level.Amount - used[level.Price]; available > epsilon {
+			return level.Price, available, crosses(level.Price)
+		}
+	}
+	return 0, 0, false
+}
+
+func (b *book) consume(buy bool, price, amount float64) {
+	if buy {
+		b.askUsed[price] += amount
+	} else {
+		b.bidUsed[price] += amount
+	}
+}
+
+//o 吃 Feed 盘口中价格能成交的第一档, 返回是否有成交
+func (e *Exchange) takeFeed(b *book, o *order, taker bool) bool {
+	if !o.open() {
+		return false
+	}
+	level, available, ok := b.bestLevel(o.isBuy(), o.crosses)
+	if !ok {
+		return false
+	}
+	price, fee := o.Price, e.MakerFee
+	if taker {
+		price, fee = level, e.TakerFee
+	}
+	amount := o.capacity(price)
+	if amount > available {
+		amount = available
+	}
+	if amount <= epsilon {
+		return false
+	}
+	b.consume(o.isBuy(), level, amount)
+	e.fill(o, price, amount, fee)
+	e.recordTrade(b.pair, o, price, amount)
+	return true
+}
+
+//新订单按价格优先吃 Feed 的盘口. 账户只有一个, 盘口上的挂单都是自己的, 下一笔会和自己的挂单成交时
+//停止撮合并返回true(自成交保护), 由调用方撤销没成交的部分; 同价时自己的挂单优先, 也算自成交
+func (e *Exchange) take(b *book, taker *order) (selfTrade bool) {
+	for taker.open() {
+		makers := b.asks
+		if !taker.isBuy() {
+			makers = b.bids
+		}
+		if len(makers) > 0 && taker.crosses(makers[0].Price) && !e.feedBetter(b, taker, makers[0].Price) {
+			return true
+		}
+		if !e.takeFeed(b, taker, true) {
+			return false
+		}
+	}
+	return false
+}
+
+//Feed 盘口中是否有比price更优的、还没被吃掉的档位
+func (e *Exchange) feedBetter(b *book, taker *order, price float64) bool {
+	_, _, ok := b.bestLevel(taker.isBuy(), func(level float64) bool {
+		if taker.isBuy() {
+			return level < price
+		}
+		return level > price
+	})
+	return ok
+}
+
+//按price成交amount, 更新余额和订单. 手续费从收到的币中扣除
+func (e *Exchange) fill(o *order, price, amount, feeRate float64) {
+	base, counter := e.account(o.pair.BaseCurrency), e.account(o.pair.CounterCurrency)
+	var fee float64
+	switch o.Side {
+	case BUY:
+		counter.FrozenAmount -= o.Price * amount
+		counter.Amount += (o.Price - price) * amount
+		fee = amount * feeRate
+		base.Amount += amount - fee
+	case BUY_MARKET:
+		counter.FrozenAmount -= price * amount
+		o.funds -= price * amount
+		fee = amount * feeRate
+		base.Amount += amount - fee
+	default:
+		base.FrozenAmount -= amount
+		fee = price * amount * feeRate
+		counter.Amount += price*amount - fee
+	}
+
+	o.AvgPrice = (o.AvgPrice*o.DealAmount + price*amount) / (o.DealAmount + amount)
+	o.DealAmount += amount
+	o.Fee += fee
+	switch {
+	case o.Side == BUY_MARKET:
+		if o.funds <= epsilon {
+			o.Status = ORDER_FINISH
+		} else {
+			o.Status = ORDER_PART_FINISH
+		}
+	case o.remaining() <= epsilon:
+		o.Status = ORDER_FINISH
+	default:
+		o.Status = ORDER_PART_FINISH
+	}
+}
+
+func (e *Exchange) recordTrade(cp CurrencyPair, taker *order, price, amount float64) {
+	side := "buy"
+	if !taker.isBuy() {
+		side = "sell"
+	}
+	e.nextId++
+	e.trades[cp.Symbol()] = append(e.trades[cp.Symbol()], Trade{Tid: int64(e.nextId), Type: side, Amount: amount, Price: price, Date: int64(e.nowMs())})
+}
@@ -0,0 +1,403 @@
+//模拟交易所, 实现了 Api, 策略可以不改代码地在实盘和模拟盘之间切换.
+//行情来自 Feed, 它的盘口作为外部流动性; 账户自己的挂单按价格优先、时间优先撮合,
+//支持部分成交、手续费和冻结资金. 新订单不会和自己的挂单成交(自成交保护), 会撤销没成交的部分
+package paper
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+)
+
+const EXCHANGE_NAME = "paper"
+
+//比较数量时容忍的浮点误差
+const epsilon = 1e-9
+
+type Exchange struct {
+	Name              string
+	Feed              Feed
+	MakerFee          float64          //挂单成交的手续费率, 从收到的币中扣除
+	TakerFee          float64          //吃单成交的手续费率
+	DepthSize         int              //每次从 Feed 获取的盘口档数
+	ValuationCurrency Currency         //不为空时 GetAccount 按 Feed 的最新成交价把总资产折合成该币种
+	Now               func() time.Time //下单和成交时间, 默认 time.Now
+
+	mu          sync.Mutex
+	nextId      int
+	balances    map[Currency]*SubAccount
+	books       map[string]*book
+	orders      []*order
+	trades      map[string][]Trade
+	withdrawals int
+}
+
+func NewExchange(feed Feed) *Exchange {
+	return &Exchange{
+		Name:      EXCHANGE_NAME,
+		Feed:      feed,
+		MakerFee:  0.001,
+		TakerFee:  0.002,
+		DepthSize: 200,
+		Now:       time.Now,
+		balances:  map[Currency]*SubAccount{},
+		books:     map[string]*book{},
+		trades:    map[string][]Trade{},
+	}
+}
+
+//增加可用余额
+func (e *Exchange) Deposit(currency Currency, amount float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.account(currency).Amount += amount
+}
+
+//可用和冻结的余额
+func (e *Exchange) Balance(currency Currency) SubAccount {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return *e.account(currency)
+}
+
+//按最新行情撮合 cp 的挂单, 用于行情变化后主动推进模拟
+func (e *Exchange) Match(cp CurrencyPair) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err := e.refresh(cp)
+	return err
+}
+
+func (e *Exchange) account(currency Currency) *SubAccount {
+	currency = Currency(strings.ToUpper(string(currency)))
+	acc, ok := e.balances[currency]
+	if !ok {
+		acc = &SubAccount{Currency: string(currency)}
+		e.balances[currency] = acc
+	}
+	return acc
+}
+
+func (e *Exchange) nowMs() int {
+	return int(e.Now().UnixNano() / int64(time.Millisecond))
+}
+
+func (e *Exchange) error(kind int, format string, args ...interface{}) error {
+	return &ApiError{Exchange: e.Name, Kind: ErrorKind(kind), Message: fmt.Sprintf(format, args...)}
+}
+
+func (e *Exchange) parseAmount(name, value string) (float64, error) {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil || v <= 0 {
+		return 0, e.error(ERR_KIND_INVALID_REQUEST, "invalid %s %q", name, value)
+	}
+	return v, nil
+}
+
+func (e *Exchange) GetExchangeName() string {
+	return e.Name
+}
+
+func (e *Exchange) GetTicker(cp CurrencyPair) (*Ticker, error) {
+	return e.Feed.GetTicker(cp)
+}
+
+//Feed 的盘口扣掉已经被吃掉的部分, 再加上账户自己的挂单
+func (e *Exchange) GetDepth(cp CurrencyPair, size int) (*Depth, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	b, err := e.refresh(cp)
+	if err != nil {
+		return nil, err
+	}
+	return b.snapshot(size), nil
+}
+
+func (e *Exchange) LimitBuy(amount, price string, cp CurrencyPair) (*Order, error) {
+	return e.placeOrder(BUY, amount, price, cp)
+}
+
+func (e *Exchange) LimitSell(amount, price string, cp CurrencyPair) (*Order, error) {
+	return e.placeOrder(SELL, amount, price, cp)
+}
+
+//与 OkCNApi 一致, price 为买入花费的计价币总额, amount 被忽略
+func (e *Exchange) MarketBuy(amount, price string, cp CurrencyPair) (*Order, error) {
+	return e.placeOrder(BUY_MARKET, amount, price, cp)
+}
+
+//price 被忽略
+func (e *Exchange) MarketSell(amount, price string, cp CurrencyPair) (*Order, error) {
+	return e.placeOrder(SELL_MARKET, amount, price, cp)
+}
+
+//冻结资金后立即撮合, 限价单没成交的部分挂在盘口上, 市价单没成交的部分撤销
+func (e *Exchange) placeOrder(side TradeSide, amount, price string, cp CurrencyPair) (*Order, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	o := &order{pair: cp}
+	o.Side = side
+	o.CurrencyPair = cp.Symbol()
+	var err error
+	if side != BUY_MARKET {
+		if o.Amount, err = e.parseAmount("amount", amount); err != nil {
+			return nil, err
+		}
+	}
+	if side != SELL_MARKET {
+		if o.Price, err = e.parseAmount("price", price); err != nil {
+			return nil, err
+		}
+	}
+
+	base, counter := e.account(cp.BaseCurrency), e.account(cp.CounterCurrency)
+	switch side {
+	case BUY, BUY_MARKET:
+		cost := o.Price
+		if side == BUY {
+			cost *= o.Amount
+		}
+		if counter.Amount+epsilon < cost {
+			return nil, e.error(ERR_KIND_INSUFFICIENT_FUNDS, "insufficient %s: need %v, available %v", counter.Currency, cost, counter.Amount)
+		}
+		counter.Amount -= cost
+		counter.FrozenAmount += cost
+		if side == BUY_MARKET {
+			o.funds = cost
+		}
+	default:
+		if base.Amount+epsilon < o.Amount {
+			return nil, e.error(ERR_KIND_INSUFFICIENT_FUNDS, "insufficient %s: need %v, available %v", base.Currency, o.Amount, base.Amount)
+		}
+		base.Amount -= o.Amount
+		base.FrozenAmount += o.Amount
+	}
+
+	b, err := e.refresh(cp)
+	if err != nil {
+		e.unfreeze(o)
+		return nil, err
+	}
+
+	e.nextId++
+	o.OrderID = e.nextId
+	o.OrderTime = e.nowMs()
+	o.Status = ORDER_UNFINISHED
+	e.orders = append(e.orders, o)
+	selfTrade := e.take(b, o)
+
+	//市价单和触发自成交保护的订单不挂到盘口上, 撤销没成交的部分
+	if o.isMarket() || selfTrade {
+		if o.Side == BUY_MARKET {
+			o.Amount = o.DealAmount
+		}
+		if e.unfreeze(o) {
+			o.Status = ORDER_CANCEL
+		} else {
+			o.Status = ORDER_FINISH
+		}
+	} else if o.open() {
+		b.add(o)
+	}
+	return o.copy(), nil
+}
+
+//解冻订单剩余部分, 返回是否有剩余
+func (e *Exchange) unfreeze(o *order) bool {
+	base, counter := e.account(o.pair.BaseCurrency), e.account(o.pair.CounterCurrency)
+	var frozen float64
+	switch o.Side {
+	case BUY:
+		frozen = o.Price * o.remaining()
+		counter.FrozenAmount -= frozen
+		counter.Amount += frozen
+	case BUY_MARKET:
+		frozen = o.funds
+		counter.FrozenAmount -= frozen
+		counter.Amount += frozen
+		o.funds = 0
+	default:
+		frozen = o.remaining()
+		base.FrozenAmount -= frozen
+		base.Amount += frozen
+	}
+	return frozen > epsilon
+}
+
+func (e *Exchange) findOrder(orderId string, cp CurrencyPair) (*order, error) {
+	id, err := strconv.Atoi(orderId)
+	if err != nil {
+		return nil, e.error(ERR_KIND_INVALID_REQUEST, "invalid order id %q", orderId)
+	}
+	for _, o := range e.orders {
+		if o.OrderID == id && o.CurrencyPair == cp.Symbol() {
+			return o, nil
+		}
+	}
+	return nil, e.error(ERR_KIND_INVALID_REQUEST, "order %s not found", orderId)
+}
+
+//先按最新行情撮合, 已经完成的订单不能撤销
+func (e *Exchange) CancelOrder(orderId string, cp CurrencyPair) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	b, err := e.refresh(cp)
+	if err != nil {
+		return false, err
+	}
+	o, err := e.findOrder(orderId, cp)
+	if err != nil {
+		return false, err
+	}
+	if !o.open() {
+		return false, e.error(ERR_KIND_INVALID_REQUEST, "order %s is %s", orderId, o.Status)
+	}
+	e.unfreeze(o)
+	o.Status = ORDER_CANCEL
+	b.remove(o)
+	return true, nil
+}
+
+func (e *Exchange) GetOneOrder(orderId string, cp CurrencyPair) (*Order, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, err := e.refresh(cp); err != nil {
+		return nil, err
+	}
+	o, err := e.findOrder(orderId, cp)
+	if err != nil {
+		return nil, err
+	}
+	return o.copy(), nil
+}
+
+//按下单时间排序
+func (e *Exchange) GetUnfinishedOrders(cp CurrencyPair) ([]Order, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, err := e.refresh(cp); err != nil {
+		return nil, err
+	}
+	orders := []Order{}
+	for _, o := range e.orders {
+		if o.CurrencyPair == cp.Symbol() && o.open() {
+			orders = append(orders, *o.copy())
+		}
+	}
+	return orders, nil
+}
+
+//已完成和已撤销的订单, 按下单时间倒序分页, currentPage 从1开始
+func (e *Exchange) GetOrderHistory(cp CurrencyPair, currentPage, pageSize int) ([]Order, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if currentPage < 1 || pageSize < 1 {
+		return nil, e.error(ERR_KIND_INVALID_REQUEST, "invalid page %d/%d", currentPage, pageSize)
+	}
+	if _, err := e.refresh(cp); err != nil {
+		return nil, err
+	}
+	orders := []Order{}
+	skip := (currentPage - 1) * pageSize
+	for i := len(e.orders) - 1; i >= 0 && len(orders) < pageSize; i-- {
+		o := e.orders[i]
+		if o.CurrencyPair != cp.Symbol() || o.open() {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		orders = append(orders, *o.copy())
+	}
+	return orders, nil
+}
+
+//先撮合所有有挂单的交易对, 设置了 ValuationCurrency 时计算总资产
+func (e *Exchange) GetAccount() (*Account, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, b := range e.books {
+		if len(b.bids)+len(b.asks) == 0 {
+			continue
+		}
+		if _, err := e.refresh(b.pair); err != nil {
+			return nil, err
+		}
+	}
+
+	acc := &Account{Exchange: e.Name, SubAccounts: make(map[string]SubAccount, len(e.balances))}
+	for currency, sub := range e.balances {
+		acc.SubAccounts[string(currency)] = *sub
+		if e.ValuationCurrency == "" {
+			continue
+		}
+		total := sub.Amount + sub.FrozenAmount
+		if currency == e.ValuationCurrency || total == 0 {
+			acc.Asset += total
+			continue
+		}
+		ticker, err := e.Feed.GetTicker(NewCurrencyPair(currency, e.ValuationCurrency))
+		if err != nil {
+			return nil, err
+		}
+		acc.Asset += total * ticker.Last
+	}
+	acc.NetAsset = acc.Asset
+	return acc, nil
+}
+
+//立即完成, amount 和 fees 都从可用余额中扣除, 返回提现编号
+func (e *Exchange) Withdraw(amount, currency, fees, receiveAddr, memo, safePwd string) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if receiveAddr == "" {
+		return "", e.error(ERR_KIND_INVALID_REQUEST, "empty withdraw address")
+	}
+	v, err := e.parseAmount("amount", amount)
+	if err != nil {
+		return "", err
+	}
+	fee := 0.0
+	if fees != "" {
+		if fee, err = strconv.ParseFloat(fees, 64); err != nil || fee < 0 {
+			return "", e.error(ERR_KIND_INVALID_REQUEST, "invalid fees %q", fees)
+		}
+	}
+	acc := e.account(Currency(currency))
+	if acc.Amount+epsilon < v+fee {
+		return "", e.error(ERR_KIND_INSUFFICIENT_FUNDS, "insufficient %s: need %v, available %v", acc.Currency, v+fee, acc.Amount)
+	}
+	acc.Amount -= v + fee
+	e.withdrawals++
+	return strconv.Itoa(e.withdrawals), nil
+}
+
+//Feed 也提供K线时转发给 Feed
+func (e *Exchange) GetKlineRecords(cp CurrencyPair, period string, size, since int) ([]Kline, error) {
+	feed, ok := e.Feed.(interface {
+		GetKlineRecords(cp CurrencyPair, period string, size, since int) ([]Kline, error)
+	})
+	if !ok {
+		return nil, e.error(ERR_KIND_UNSUPPORTED, "feed does not provide klines")
+	}
+	return feed.GetKlineRecords(cp, period, size, since)
+}
+
+//模拟盘内的成交, Type 为吃单方向, 只返回 Tid 大于since的成交
+func (e *Exchange) GetTrades(cp CurrencyPair, since int64) ([]Trade, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	trades := []Trade{}
+	for _, t := range e.trades[cp.Symbol()] {
+		if t.Tid > since {
+			trades = append(trades, t)
+		}
+	}
+	return trades, nil
+}
@@ -0,0 +1,317 @@
+package paper
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+	"github.com/qct/cryptocurrency-exchange-api/apitest"
+	"github.com/qct/cryptocurrency-exchange-api/okcoin/okcointest"
+	"github.com/stretchr/testify/assert"
+)
+
+var btcUsdt = NewCurrencyPair("BTC", "USDT")
+
+func newTestExchange() (*Exchange, *StaticFeed) {
+	feed := NewStaticFeed()
+	feed.SetDepth(btcUsdt, Depth{
+		AskList: DepthRecords{{Price: 100, Amount: 1}, {Price: 101, Amount: 2}},
+		BidList: DepthRecords{{Price: 99, Amount: 1}, {Price: 98, Amount: 2}},
+	})
+	ex := NewExchange(feed)
+	ex.MakerFee, ex.TakerFee = 0.001, 0.002
+	ex.Deposit("USDT", 1000)
+	ex.Deposit("BTC", 5)
+	return ex, feed
+}
+
+func fmtId(order *Order) string {
+	return fmt.Sprintf("%d", order.OrderID)
+}
+
+func TestExchange_LimitOrderPartialFill(t *testing.T) {
+	ex, feed := newTestExchange()
+
+	//吃掉两档卖盘
+	order, err := ex.LimitBuy("2", "101", btcUsdt)
+	assert.NoError(t, err)
+	assert.Equal(t, TradeStatus(ORDER_FINISH), order.Status)
+	assert.Equal(t, 100.5, order.AvgPrice)
+	assert.InDelta(t, 2*0.002, order.Fee, 1e-12)
+	usdt, btc := ex.Balance("USDT"), ex.Balance("BTC")
+	assert.InDelta(t, 799, usdt.Amount, 1e-9)
+	assert.InDelta(t, 0, usdt.FrozenAmount, 1e-9)
+	assert.InDelta(t, 7-0.004, btc.Amount, 1e-9)
+
+	//盘口没变时吃掉的流动性不会恢复, 没成交的部分挂在盘口上
+	order, err = ex.LimitBuy("2", "101", btcUsdt)
+	assert.NoError(t, err)
+	assert.Equal(t, TradeStatus(ORDER_PART_FINISH), order.Status)
+	assert.Equal(t, 1.0, order.DealAmount)
+	assert.InDelta(t, 101, ex.Balance("USDT").FrozenAmount, 1e-9)
+	depth, err := ex.GetDepth(btcUsdt, 5)
+	assert.NoError(t, err)
+	assert.Empty(t, depth.AskList)
+	assert.Equal(t, DepthRecord{Price: 101, Amount: 1}, depth.BidList[0])
+
+	//行情穿过挂单后按挂单价成交, 收挂单手续费
+	feed.SetDepth(btcUsdt, Depth{AskList: DepthRecords{{Price: 100.5, Amount: 5}}, BidList: DepthRecords{{Price: 99, Amount: 1}}})
+	assert.NoError(t, ex.Match(btcUsdt))
+	filled, err := ex.GetOneOrder(fmtId(order), btcUsdt)
+	assert.NoError(t, err)
+	assert.Equal(t, TradeStatus(ORDER_FINISH), filled.Status)
+	assert.Equal(t, 101.0, filled.AvgPrice)
+	assert.InDelta(t, 0.002+0.001, filled.Fee, 1e-12)
+	assert.InDelta(t, 0, ex.Balance("USDT").FrozenAmount, 1e-9)
+
+	trades, err := ex.GetTrades(btcUsdt, 0)
+	assert.NoError(t, err)
+	assert.Len(t, trades, 4)
+	trades, err = ex.GetTrades(btcUsdt, trades[2].Tid)
+	assert.NoError(t, err)
+	assert.Len(t, trades, 1)
+	assert.Equal(t, 101.0, trades[0].Price)
+}
+
+func TestExchange_PriceTimePriority(t *testing.T) {
+	ex, feed := newTestExchange()
+	first, err := ex.LimitBuy("1", "99.5", btcUsdt)
+	assert.NoError(t, err)
+	second, err := ex.LimitBuy("1", "99.5", btcUsdt)
+	assert.NoError(t, err)
+	best, err := ex.LimitBuy("1", "99.8", btcUsdt)
+	assert.NoError(t, err)
+
+	//只有1.5的流动性: 价格高的先成交, 同价先下的先成交
+	feed.SetDepth(btcUsdt, Depth{AskList: DepthRecords{{Price: 99.4, Amount: 1.5}}, BidList: DepthRecords{{Price: 99, Amount: 1}}})
+	orders, err := ex.GetUnfinishedOrders(btcUsdt)
+	assert.NoError(t, err)
+	if assert.Len(t, orders, 2) {
+		assert.Equal(t, first.OrderID, orders[0].OrderID)
+		assert.Equal(t, 0.5, orders[0].DealAmount)
+		assert.Equal(t, TradeStatus(ORDER_PART_FINISH), orders[0].Status)
+		assert.Equal(t, second.OrderID, orders[1].OrderID)
+		assert.Equal(t, 0.0, orders[1].DealAmount)
+	}
+	order, err := ex.GetOneOrder(fmtId(best), btcUsdt)
+	assert.NoError(t, err)
+	assert.Equal(t, TradeStatus(ORDER_FINISH), order.Status)
+	assert.Equal(t, 99.8, order.AvgPrice)
+}
+
+func TestExchange_SelfTradePrevention(t *testing.T) {
+	ex, _ := newTestExchange()
+	ask, err := ex.LimitSell("1", "99.9", btcUsdt)
+	assert.NoError(t, err)
+	assert.Equal(t, TradeStatus(ORDER_UNFINISHED), ask.Status)
+
+	//自己的卖单比盘口卖一更优, 买单不和自己的挂单成交, 直接撤销
+	bid, err := ex.LimitBuy("1.5", "100", btcUsdt)
+	assert.NoError(t, err)
+	assert.Equal(t, TradeStatus(ORDER_CANCEL), bid.Status)
+	assert.Equal(t, 0.0, bid.DealAmount)
+	ask, err = ex.GetOneOrder(fmtId(ask), btcUsdt)
+	assert.NoError(t, err)
+	assert.Equal(t, TradeStatus(ORDER_UNFINISHED), ask.Status)
+	assert.Equal(t, 0.0, ask.DealAmount)
+	assert.Equal(t, 1000.0, ex.Balance("USDT").Amount)
+	assert.InDelta(t, 0, ex.Balance("USDT").FrozenAmount, 1e-9)
+	trades, err := ex.GetTrades(btcUsdt, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, trades)
+}
+
+func TestExchange_SelfTradePreventionAfterFill(t *testing.T) {
+	ex, _ := newTestExchange()
+	ask, err := ex.LimitSell("1", "100.5", btcUsdt)
+	assert.NoError(t, err)
+
+	//先吃掉盘口卖一, 下一档是自己的卖单, 剩下的部分撤销
+	bid, err := ex.LimitBuy("2", "101", btcUsdt)
+	assert.NoError(t, err)
+	assert.Equal(t, TradeStatus(ORDER_CANCEL), bid.Status)
+	assert.Equal(t, 1.0, bid.DealAmount)
+	assert.Equal(t, 100.0, bid.AvgPrice)
+	ask, err = ex.GetOneOrder(fmtId(ask), btcUsdt)
+	assert.NoError(t, err)
+	assert.Equal(t, TradeStatus(ORDER_UNFINISHED), ask.Status)
+	assert.InDelta(t, 900, ex.Balance("USDT").Amount, 1e-9)
+	assert.InDelta(t, 0, ex.Balance("USDT").FrozenAmount, 1e-9)
+
+	trades, err := ex.GetTrades(btcUsdt, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, trades, 1) {
+		assert.Equal(t, 100.0, trades[0].Price)
+		assert.Equal(t, 1.0, trades[0].Amount)
+	}
+}
+
+func TestExchange_MarketOrders(t *testing.T) {
+	ex, _ := newTestExchange()
+
+	//price 为花费的总金额
+	order, err := ex.MarketBuy("", "150", btcUsdt)
+	assert.NoError(t, err)
+	assert.Equal(t, TradeStatus(ORDER_FINISH), order.Status)
+	assert.InDelta(t, 1+50/101.0, order.DealAmount, 1e-9)
+	assert.Equal(t, order.DealAmount, order.Amount)
+	usdt := ex.Balance("USDT")
+	assert.InDelta(t, 850, usdt.Amount, 1e-9)
+	assert.InDelta(t, 0, usdt.FrozenAmount, 1e-9)
+
+	_, err = ex.MarketSell("10", "", btcUsdt)
+	apitest.AssertErrorKind(t, err, ERR_KIND_INSUFFICIENT_FUNDS)
+
+	//流动性不够时没成交的部分撤销
+	order, err = ex.MarketSell("4", "", btcUsdt)
+	assert.NoError(t, err)
+	assert.Equal(t, TradeStatus(ORDER_CANCEL), order.Status)
+	assert.Equal(t, 3.0, order.DealAmount)
+	assert.InDelta(t, (99+2*98)/3.0, order.AvgPrice, 1e-9)
+	btc := ex.Balance("BTC")
+	assert.InDelta(t, 0, btc.FrozenAmount, 1e-9)
+	assert.InDelta(t, 5+(1+50/101.0)*(1-0.002)-3, btc.Amount, 1e-9)
+	assert.InDelta(t, 850+(99+2*98)*(1-0.002), ex.Balance("USDT").Amount, 1e-9)
+}
+
+func TestExchange_CancelOrder(t *testing.T) {
+	ex, _ := newTestExchange()
+	order, err := ex.LimitSell("1", "105", btcUsdt)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, ex.Balance("BTC").FrozenAmount)
+
+	ok, err := ex.CancelOrder(fmtId(order), btcUsdt)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	btc := ex.Balance("BTC")
+	assert.Equal(t, 5.0, btc.Amount)
+	assert.Equal(t, 0.0, btc.FrozenAmount)
+
+	_, err = ex.CancelOrder(fmtId(order), btcUsdt)
+	apitest.AssertErrorKind(t, err, ERR_KIND_INVALID_REQUEST)
+	_, err = ex.GetOneOrder("12345", btcUsdt)
+	apitest.AssertErrorKind(t, err, ERR_KIND_INVALID_REQUEST)
+
+	orders, err := ex.GetUnfinishedOrders(btcUsdt)
+	assert.NoError(t, err)
+	assert.Empty(t, orders)
+	history, err := ex.GetOrderHistory(btcUsdt, 1, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, TradeStatus(ORDER_CANCEL), history[0].Status)
+	}
+	history, err = ex.GetOrderHistory(btcUsdt, 2, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, history)
+}
+
+func TestExchange_InvalidOrders(t *testing.T) {
+	ex, _ := newTestExchange()
+	_, err := ex.LimitBuy("100", "100", btcUsdt)
+	apitest.AssertErrorKind(t, err, ERR_KIND_INSUFFICIENT_FUNDS)
+	_, err = ex.LimitBuy("abc", "100", btcUsdt)
+	apitest.AssertErrorKind(t, err, ERR_KIND_INVALID_REQUEST)
+	_, err = ex.LimitSell("1", "-1", btcUsdt)
+	apitest.AssertErrorKind(t, err, ERR_KIND_INVALID_REQUEST)
+
+	//行情源出错时不冻结资金
+	_, err = ex.LimitBuy("1", "1", NewCurrencyPair("LTC", "USDT"))
+	assert.Error(t, err)
+	assert.Equal(t, 1000.0, ex.Balance("USDT").Amount)
+}
+
+func TestExchange_AccountAndWithdraw(t *testing.T) {
+	ex, _ := newTestExchange()
+	ex.ValuationCurrency = "USDT"
+	_, err := ex.LimitSell("1", "105", btcUsdt)
+	assert.NoError(t, err)
+
+	account, err := ex.GetAccount()
+	assert.NoError(t, err)
+	assert.Equal(t, EXCHANGE_NAME, account.Exchange)
+	assert.Equal(t, SubAccount{Currency: "BTC", Amount: 4, FrozenAmount: 1}, account.SubAccounts["BTC"])
+	assert.InDelta(t, 1000+5*99.5, account.Asset, 1e-9)
+
+	id, err := ex.Withdraw("2", "btc", "0.001", "address", "", "")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, id)
+	assert.InDelta(t, 4-2.001, ex.Balance("BTC").Amount, 1e-9)
+	_, err = ex.Withdraw("2", "btc", "0", "address", "", "")
+	apitest.AssertErrorKind(t, err, ERR_KIND_INSUFFICIENT_FUNDS)
+}
+
+//真实的 Api 也可以作为行情源
+func TestExchange_ApiFeed(t *testing.T) {
+	s := okcointest.NewServer("key", "secret")
+	defer s.Close()
+	s.SetPrice("btc_cny", 28000, 28010)
+	api, err := s.Api()
+	assert.NoError(t, err)
+
+	ex := NewExchange(api)
+	ex.Deposit("CNY", 10000)
+	btcCny := NewCurrencyPair("BTC", "CNY")
+	order, err := ex.LimitBuy("0.1", "28100", btcCny)
+	assert.NoError(t, err)
+	assert.Equal(t, TradeStatus(ORDER_FINISH), order.Status)
+	assert.Equal(t, 28010.0, order.AvgPrice)
+
+	ticker, err := ex.GetTicker(btcCny)
+	assert.NoError(t, err)
+	assert.Equal(t, 28000.0, ticker.Buy)
+
+	_, err = NewExchange(NewStaticFeed()).GetKlineRecords(btcCny, "1min", 10, 0)
+	apitest.AssertErrorKind(t, err, ERR_KIND_UNSUPPORTED)
+}
+
+func TestRecordedFeed(t *testing.T) {
+	feed := NewRecordedFeed([]Snapshot{
+		{Timestamp: 2000, Pair: btcUsdt, Ticker: &Ticker{Last: 102}},
+		{Timestamp: 1000, Pair: btcUsdt, Ticker: &Ticker{Last: 101}, Depth: &Depth{
+			AskList: DepthRecords{{Price: 102, Amount: 1}, {Price: 101.5, Amount: 1}},
+			BidList: DepthRecords{{Price: 100, Amount: 1}, {Price: 100.5, Amount: 1}},
+		}},
+	})
+	_, err := feed.GetTicker(btcUsdt)
+	assert.Error(t, err)
+
+	assert.True(t, feed.Advance(1500))
+	ticker, err := feed.GetTicker(btcUsdt)
+	assert.NoError(t, err)
+	assert.Equal(t, 101.0, ticker.Last)
+	depth, err := feed.GetDepth(btcUsdt, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, DepthRecords{{Price: 101.5, Amount: 1}}, depth.AskList)
+	assert.Equal(t, DepthRecords{{Price: 100.5, Amount: 1}}, depth.BidList)
+
+	assert.False(t, feed.Advance(2000))
+	ticker, err = feed.GetTicker(btcUsdt)
+	assert.NoError(t, err)
+	assert.Equal(t, 102.0, ticker.Last)
+}
+
+func TestRecordedFeed_ConcurrentAdvance(t *testing.T) {
+	var snapshots []Snapshot
+	for i := 1; i <= 100; i++ {
+		snapshots = append(snapshots, Snapshot{Timestamp: int64(i), Pair: btcUsdt, Ticker: &Ticker{Last: float64(i)}})
+	}
+	feed := NewRecordedFeed(snapshots)
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 100; i++ {
+		wg.Add(1)
+		go func(ts int64) {
+			defer wg.Done()
+			feed.Advance(ts)
+			feed.GetTicker(btcUsdt)
+		}(int64(i))
+	}
+	wg.Wait()
+
+	//每个快照只应用一次, 最后的行情是最新的快照
+	assert.False(t, feed.Advance(100))
+	ticker, err := feed.GetTicker(btcUsdt)
+	assert.NoError(t, err)
+	assert.Equal(t, 100.0, ticker.Last)
+}
@@ -0,0 +1,172 @@
+package paper
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+)
+
+//行情源, 模拟交易所用它的盘口作为外部流动性. 任何 Api 都可以直接作为行情源
+type Feed interface {
+	GetTicker(cp CurrencyPair) (*Ticker, error)
+	GetDepth(cp CurrencyPair, size int) (*Depth, error)
+}
+
+//手动设置行情的行情源, 并发安全
+type StaticFeed struct {
+	mu      sync.RWMutex
+	tickers map[string]Ticker
+	depths  map[string]Depth
+}
+
+func NewStaticFeed() *StaticFeed {
+	return &StaticFeed{tickers: map[string]Ticker{}, depths: map[string]Depth{}}
+}
+
+func (f *StaticFeed) SetTicker(cp CurrencyPair, ticker Ticker) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tickers[cp.Symbol()] = ticker
+}
+
+//asks按价格从低到高, bids从高到低保存
+func (f *StaticFeed) SetDepth(cp CurrencyPair, depth Depth) {
+	asks := append(DepthRecords{}, depth.AskList...)
+	bids := append(DepthRecords{}, depth.BidList...)
+	sort.Sort(asks)
+	sort.Sort(sort.Reverse(bids))
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.depths[cp.Symbol()] = Depth{AskList: asks, BidList: bids}
+}
+
+//只设置了盘口时, 用买一卖一的中间价作为最新成交价
+func (f *StaticFeed) GetTicker(cp CurrencyPair) (*Ticker, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if ticker, ok := f.tickers[cp.Symbol()]; ok {
+		return &ticker, nil
+	}
+	depth, ok := f.depths[cp.Symbol()]
+	if !ok || len(depth.AskList) == 0 || len(depth.BidList) == 0 {
+		return nil, fmt.Errorf("paper: no ticker for %s", cp.Symbol())
+	}
+	ticker := Ticker{Buy: depth.BidList[0].Price, Sell: depth.AskList[0].Price}
+	ticker.Last = (ticker.Buy + ticker.Sell) / 2
+	return &ticker, nil
+}
+
+func (f *StaticFeed) GetDepth(cp CurrencyPair, size int) (*Depth, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	depth, ok := f.depths[cp.Symbol()]
+	if !ok {
+		return nil, fmt.Errorf("paper: no depth for %s", cp.Symbol())
+	}
+	return &Depth{AskList: truncate(depth.AskList, size), BidList: truncate(depth.BidList, size)}, nil
+}
+
+func truncate(records DepthRecords, size int) DepthRecords {
+	if size > 0 && len(records) > size {
+		records = records[:size]
+	}
+	return append(DepthRecords{}, records...)
+}
+
+//录制的行情快照, Ticker 和 Depth 为nil时不更新对应的行情
+type Snapshot struct {
+	Timestamp int64 //毫秒
+	Pair      CurrencyPair
+	Ticker    *Ticker
+	Depth     *Depth
+}
+
+//按时间回放录制行情的行情源, Advance 可以和读取行情并发调用
+type RecordedFeed struct {
+	*StaticFeed
+	mu        sync.Mutex //保护 next, 保证并发的 Advance 按顺序应用快照
+	snapshots []Snapshot
+	next      int
+}
+
+//snapshots 按 Timestamp 排序后回放
+func NewRecordedFeed(snapshots []Snapshot) *RecordedFeed {
+	sorted := append([]Snapshot{}, snapshots...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp < sorted[j].Timestamp
+	})
+	return &RecordedFeed{StaticFeed: NewStaticFeed(), snapshots: sorted}
+}
+
+//应用所有 Timestamp <= ts 的快照, 返回是否还有没回放的快照
+func (f *RecordedFeed) Advance(ts int64) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ; f.next < len(f.snapshots) && f.snapshots[f.next].Timestamp <= ts; f.next++ {
+		snapshot := f.snapshots[f.next]
+		if snapshot.Ticker != nil {
+			f.SetTicker(snapshot.Pair, *snapshot.Ticker)
+		}
+		if snapshot.Depth != nil {
+			f.SetDepth(snapshot.Pair, *snapshot.Depth)
+		}
+	}
+	return f.next < len(f.snapshots)
+}
+
+//合约行情源, 任何 FutureApi 都可以直接作为合约行情源
+type FutureFeed interface {
+	GetFutureTicker(cp CurrencyPair, contractType string) (*Ticker, error)
+	GetFutureDepth(cp CurrencyPair, contractType string, size int) (*Depth, error)
+	GetFutureIndex(cp CurrencyPair) (float64, error)
+}
+
+//手动设置行情的合约行情源, 每种合约类型的行情和 StaticFeed 一样保存, 并发安全
+type StaticFutureFeed struct {
+	mu        sync.RWMutex
+	contracts map[string]*StaticFeed
+	indexes   map[string]float64
+}
+
+func NewStaticFutureFeed() *StaticFutureFeed {
+	return &StaticFutureFeed{contracts: map[string]*StaticFeed{}, indexes: map[string]float64{}}
+}
+
+//contractType 如 THIS_WEEK_CONTRACT
+func (f *StaticFutureFeed) Contract(contractType string) *StaticFeed {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	feed, ok := f.contracts[contractType]
+	if !ok {
+		feed = NewStaticFeed()
+		f.contracts[contractType] = feed
+	}
+	return feed
+}
+
+func (f *StaticFutureFeed) SetIndex(cp CurrencyPair, index float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.indexes[cp.Symbol()] = index
+}
+
+func (f *StaticFutureFeed) GetFutureTicker(cp CurrencyPair, contractType string) (*Ticker, error) {
+	return f.Contract(contractType).GetTicker(cp)
+}
+
+func (f *StaticFutureFeed) GetFutureDepth(cp CurrencyPair, contractType string, size int) (*Depth, error) {
+	return f.Contract(contractType).GetDepth(cp, size)
+}
+
+func (f *StaticFutureFeed) GetFutureIndex(cp CurrencyPair) (float64, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	index, ok := f.indexes[cp.Symbol()]
+	if !ok {
+		return 0, fmt.Errorf("paper: no index for %s", cp.Symbol())
+	}
+	return index, nil
+}
@@ -0,0 +1,373 @@
+package paper
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+)
+
+const FUTURE_EXCHANGE_NAME = "paper_future"
+
+//模拟合约交易所, 实现了 FutureApi. 与 OKEx 一样是币本位合约: 每张合约面值若干美元, 保证金和盈亏以币计, 全仓模式.
+//风险率(权益/保证金)不高于 LiquidationRiskRate 时撤销开仓挂单, 仍然不够时按 ForceLiquPrice 强平,
+//每周按 GetDeliveryTime 以指数价格交割当周合约, 次周合约变为当周合约
+type FutureExchange struct {
+	Name                string
+	Feed                FutureFeed
+	FeeRate             float64              //按成交面值折合成币收取的手续费率
+	DepthSize           int                  //每次从 Feed 获取的盘口档数
+	ContractValues      map[Currency]float64 //每张合约的面值(美元), 没有设置的币种为10
+	LiquidationRiskRate float64
+	ExchangeRate        float64      //GetExchangeRate 返回的美元人民币汇率
+	DeliveryWeekday     time.Weekday //每周交割的星期和小时
+	DeliveryHour        int
+	DeliveryLocation    *time.Location   //交割时间所在的时区
+	Now                 func() time.Time //下单、成交和交割时间, 默认 time.Now
+
+	mu           sync.Mutex
+	nextId       int64
+	funds        map[Currency]*futureFund
+	positions    map[string]*futurePosition
+	books        map[string]*book
+	orders       []*futureOrder
+	nextDelivery time.Time
+}
+
+func NewFutureExchange(feed FutureFeed) *FutureExchange {
+	return &FutureExchange{
+		Name:                FUTURE_EXCHANGE_NAME,
+		Feed:                feed,
+		FeeRate:             0.0003,
+		DepthSize:           200,
+		ContractValues:      map[Currency]float64{"BTC": 100},
+		LiquidationRiskRate: 0.1,
+		ExchangeRate:        6.5,
+		DeliveryWeekday:     time.Friday,
+		DeliveryHour:        16,
+		DeliveryLocation:    time.FixedZone("CST", 8*3600),
+		Now:                 time.Now,
+		funds:               map[Currency]*futureFund{},
+		positions:           map[string]*futurePosition{},
+		books:               map[string]*book{},
+	}
+}
+
+//增加合约账户的静态权益, currency 如 BTC
+func (e *FutureExchange) Deposit(currency Currency, amount float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.fund(currency).balance += amount
+}
+
+//先交割到期的合约, 再按最新行情撮合挂单并检查强平
+func (e *FutureExchange) Match(cp CurrencyPair, contractType string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err := e.sync(cp, contractType)
+	return err
+}
+
+func (e *FutureExchange) error(kind int, format string, args ...interface{}) error {
+	return &ApiError{Exchange: e.Name, Kind: ErrorKind(kind), Message: fmt.Sprintf(format, args...)}
+}
+
+func (e *FutureExchange) nowMs() int64 {
+	return e.Now().UnixNano() / int64(time.Millisecond)
+}
+
+func (e *FutureExchange) GetExchangeName() string {
+	return e.Name
+}
+
+//Feed 提供交割预估价时转发给 Feed, 否则用指数价格
+func (e *FutureExchange) GetFutureEstimatedPrice(cp CurrencyPair) (float64, error) {
+	if feed, ok := e.Feed.(interface {
+		GetFutureEstimatedPrice(cp CurrencyPair) (float64, error)
+	}); ok {
+		return feed.GetFutureEstimatedPrice(cp)
+	}
+	return e.Feed.GetFutureIndex(cp)
+}
+
+func (e *FutureExchange) GetFutureTicker(cp CurrencyPair, contractType string) (*Ticker, error) {
+	return e.Feed.GetFutureTicker(cp, contractType)
+}
+
+//Feed 的盘口扣掉已经被吃掉的部分, 再加上账户自己的挂单
+func (e *FutureExchange) GetFutureDepth(cp CurrencyPair, contractType string, size int) (*Depth, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	b, err := e.sync(cp, contractType)
+	if err != nil {
+		return nil, err
+	}
+	asks, bids := map[float64]float64{}, map[float64]float64{}
+	for _, o := range e.openOrders(cp, contractType) {
+		if o.isBuy() {
+			bids[o.Price] += o.remaining()
+		} else {
+			asks[o.Price] += o.remaining()
+		}
+	}
+	return b.merge(asks, bids, size), nil
+}
+
+func (e *FutureExchange) GetFutureIndex(cp CurrencyPair) (float64, error) {
+	return e.Feed.GetFutureIndex(cp)
+}
+
+//先撮合所有有持仓或挂单的合约
+func (e *FutureExchange) GetFutureUserInfo() (*FutureAccount, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.deliver(); err != nil {
+		return nil, err
+	}
+	for _, key := range e.activeContracts() {
+		if _, err := e.refresh(key.pair, key.contractType); err != nil {
+			return nil, err
+		}
+	}
+
+	account := &FutureAccount{FutureSubAccounts: make(map[string]FutureSubAccount, len(e.funds))}
+	for currency, f := range e.funds {
+		e.liquidate(currency)
+		deposit, unreal := e.keepDeposit(currency), e.profitUnreal(currency)
+		rights := f.balance + unreal
+		riskRate := 10000.0
+		if deposit > epsilon {
+			riskRate = rights / deposit
+		}
+		account.FutureSubAccounts[string(currency)] = FutureSubAccount{
+			Currency:      string(currency),
+			AccountRights: rights,
+			KeepDeposit:   deposit,
+			ProfitReal:    f.profitReal,
+			ProfitUnreal:  unreal,
+			RiskRate:      riskRate,
+		}
+	}
+	return account, nil
+}
+
+//开仓检查可用保证金, 平仓检查可平数量; matchPrice 为1时按对手价成交, 没成交的部分撤销
+func (e *FutureExchange) PlaceFutureOrder(cp CurrencyPair, contractType, price, amount string, openType, matchPrice, leverRate int) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	o := &futureOrder{pair: cp, contractType: contractType, matchPrice: matchPrice == 1}
+	o.OType, o.LeverRate = openType, leverRate
+	o.Currency = cp.CustomSymbol("_", true)
+	if openType < OPEN_BUY || openType > CLOSE_SELL {
+		return "", e.error(ERR_KIND_INVALID_REQUEST, "invalid open type %d", openType)
+	}
+	if leverRate <= 0 {
+		return "", e.error(ERR_KIND_INVALID_REQUEST, "invalid lever rate %d", leverRate)
+	}
+	var err error
+	if o.Amount, err = strconv.ParseFloat(amount, 64); err != nil || o.Amount <= 0 || o.Amount != float64(int64(o.Amount)) {
+		return "", e.error(ERR_KIND_INVALID_REQUEST, "invalid amount %q", amount)
+	}
+	if !o.matchPrice {
+		if o.Price, err = strconv.ParseFloat(price, 64); err != nil || o.Price <= 0 {
+			return "", e.error(ERR_KIND_INVALID_REQUEST, "invalid price %q", price)
+		}
+	}
+
+	b, err := e.sync(cp, contractType)
+	if err != nil {
+		return "", err
+	}
+	p := e.position(cp, contractType)
+	if !p.Empty() && p.LeverRate != leverRate {
+		return "", e.error(ERR_KIND_INVALID_REQUEST, "lever rate %d differs from position's %d", leverRate, p.LeverRate)
+	}
+	currency := cp.BaseCurrency
+	switch openType {
+	case OPEN_BUY, OPEN_SELL:
+		required := e.orderMargin(o, b)
+		if available := e.fund(currency).balance + e.profitUnreal(currency) - e.keepDeposit(currency); available+epsilon < required {
+			return "", e.error(ERR_KIND_INSUFFICIENT_FUNDS, "insufficient %s margin: need %v, available %v", currency, required, available)
+		}
+	case CLOSE_BUY, CLOSE_SELL:
+		if available := p.Held(openType) - e.pendingClose(cp, contractType, openType); available+epsilon < o.Amount {
+			return "", e.error(ERR_KIND_INVALID_REQUEST, "close amount %v exceeds available position %v", o.Amount, available)
+		}
+	}
+
+	e.nextId++
+	o.OrderID = e.nextId
+	o.OrderTime = e.nowMs()
+	o.Status = ORDER_UNFINISHED
+	o.ContractName = e.contractName(cp, contractType)
+	e.orders = append(e.orders, o)
+	for e.takeFeed(b, o, true) {
+	}
+	if o.matchPrice && o.open() {
+		o.Status = ORDER_CANCEL
+	}
+	e.liquidate(currency)
+	return strconv.FormatInt(o.OrderID, 10), nil
+}
+
+func (e *FutureExchange) findOrder(cp CurrencyPair, contractType, orderId string) (*futureOrder, error) {
+	for _, o := range e.orders {
+		if strconv.FormatInt(o.OrderID, 10) == orderId && o.pair == cp && o.contractType == contractType {
+			return o, nil
+		}
+	}
+	return nil, e.error(ERR_KIND_INVALID_REQUEST, "order %s not found", orderId)
+}
+
+func (e *FutureExchange) FutureCancelOrder(cp CurrencyPair, contractType, orderId string) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, err := e.sync(cp, contractType); err != nil {
+		return false, err
+	}
+	o, err := e.findOrder(cp, contractType, orderId)
+	if err != nil {
+		return false, err
+	}
+	if !o.open() {
+		return false, e.error(ERR_KIND_INVALID_REQUEST, "order %s is %s", orderId, o.Status)
+	}
+	o.Status = ORDER_CANCEL
+	return true, nil
+}
+
+//没有持仓时返回空
+func (e *FutureExchange) GetFuturePosition(cp CurrencyPair, contractType string) ([]FuturePosition, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, err := e.sync(cp, contractType); err != nil {
+		return nil, err
+	}
+	p, ok := e.positions[contractKey(cp, contractType)]
+	if !ok || p.Empty() {
+		return []FuturePosition{}, nil
+	}
+	return []FuturePosition{{
+		BuyAmount:      p.BuyAmount,
+		BuyAvailable:   p.BuyAmount - e.pendingClose(cp, contractType, CLOSE_BUY),
+		BuyPriceAvg:    p.BuyPriceAvg,
+		BuyPriceCost:   p.BuyPriceAvg,
+		BuyProfitReal:  p.BuyProfitReal,
+		CreateDate:     p.createDate,
+		LeverRate:      p.LeverRate,
+		SellAmount:     p.SellAmount,
+		SellAvailable:  p.SellAmount - e.pendingClose(cp, contractType, CLOSE_SELL),
+		SellPriceAvg:   p.SellPriceAvg,
+		SellPriceCost:  p.SellPriceAvg,
+		SellProfitReal: p.SellProfitReal,
+		Symbol:         cp.CustomSymbol("_", true),
+		ContractType:   contractType,
+		ContractId:     e.contractId(contractType),
+		ForceLiquPrice: e.forceLiquPrice(p),
+	}}, nil
+}
+
+//订单不存在时返回错误
+func (e *FutureExchange) GetFutureOrders(orderIds []string, cp CurrencyPair, contractType string) ([]FutureOrder, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, err := e.sync(cp, contractType); err != nil {
+		return nil, err
+	}
+	orders := make([]FutureOrder, 0, len(orderIds))
+	for _, id := range orderIds {
+		o, err := e.findOrder(cp, contractType, id)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, o.FutureOrder)
+	}
+	return orders, nil
+}
+
+//按下单时间排序
+func (e *FutureExchange) GetUnfinishedFutureOrders(cp CurrencyPair, contractType string) ([]FutureOrder, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, err := e.sync(cp, contractType); err != nil {
+		return nil, err
+	}
+	orders := []FutureOrder{}
+	for _, o := range e.orders {
+		if o.pair == cp && o.contractType == contractType && o.open() {
+			orders = append(orders, o.FutureOrder)
+		}
+	}
+	return orders, nil
+}
+
+//与 OkExApi 一致, 以百分比表示
+func (e *FutureExchange) GetFee() (float64, error) {
+	return e.FeeRate * 100, nil
+}
+
+func (e *FutureExchange) GetExchangeRate() (float64, error) {
+	return e.ExchangeRate, nil
+}
+
+func (e *FutureExchange) GetContractValue(cp CurrencyPair) (float64, error) {
+	return e.contractValue(cp), nil
+}
+
+func (e *FutureExchange) contractValue(cp CurrencyPair) float64 {
+	if v, ok := e.ContractValues[Currency(strings.ToUpper(string(cp.BaseCurrency)))]; ok {
+		return v
+	}
+	return 10
+}
+
+//星期从0(星期一)开始, 与 OkExApi 一致
+func (e *FutureExchange) GetDeliveryTime() (int, int, int, int) {
+	return (int(e.DeliveryWeekday) + 6) % 7, e.DeliveryHour, 0, 0
+}
+
+//Feed 也提供K线时转发给 Feed
+func (e *FutureExchange) GetKlineRecords(contractType string, cp CurrencyPair, period string, size, since int) ([]FutureKline, error) {
+	feed, ok := e.Feed.(interface {
+		GetKlineRecords(contractType string, cp CurrencyPair, period string, size, since int) ([]FutureKline, error)
+	})
+	if !ok {
+		return nil, e.error(ERR_KIND_UNSUPPORTED, "feed does not provide klines")
+	}
+	return feed.GetKlineRecords(contractType, cp, period, size, since)
+}
+
+type contract struct {
+	pair         CurrencyPair
+	contractType string
+}
+
+//有持仓或挂单的合约, 按交易对和合约类型排序
+func (e *FutureExchange) activeContracts() []contract {
+	seen := map[string]contract{}
+	for key, p := range e.positions {
+		if !p.Empty() {
+			seen[key] = contract{p.pair, p.contractType}
+		}
+	}
+	for _, o := range e.orders {
+		if o.open() {
+			seen[contractKey(o.pair, o.contractType)] = contract{o.pair, o.contractType}
+		}
+	}
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	contracts := make([]contract, 0, len(keys))
+	for _, key := range keys {
+		contracts = append(contracts, seen[key])
+	}
+	return contracts
+}
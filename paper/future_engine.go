@@ -0,0 +1,446 @@
+package paper
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+	"github.com/qct/cryptocurrency-exchange-api/margin"
+)
+
+type futureFund struct {
+	balance    float64 //静态权益, 包含已实现盈亏, 扣除了手续费
+	profitReal float64
+}
+
+type futurePosition struct {
+	margin.Position
+	pair         CurrencyPair
+	contractType string
+	createDate   int64
+}
+
+type futureOrder struct {
+	FutureOrder
+	pair         CurrencyPair
+	contractType string
+	matchPrice   bool
+}
+
+func contractKey(cp CurrencyPair, contractType string) string {
+	return cp.Symbol() + "/" + contractType
+}
+
+func (o *futureOrder) open() bool {
+	return o.Status == ORDER_UNFINISHED || o.Status == ORDER_PART_FINISH
+}
+
+func (o *futureOrder) isBuy() bool {
+	return margin.IsBuy(o.OType)
+}
+
+func (o *futureOrder) remaining() float64 {
+	return o.Amount - o.DealAmount
+}
+
+func (o *futureOrder) crosses(price float64) bool {
+	switch {
+	case o.matchPrice:
+		return true
+	case o.isBuy():
+		return price <= o.Price+epsilon
+	default:
+		return price >= o.Price-epsilon
+	}
+}
+
+func (e *FutureExchange) fund(currency Currency) *futureFund {
+	currency = Currency(strings.ToUpper(string(currency)))
+	f, ok := e.funds[currency]
+	if !ok {
+		f = &futureFund{}
+		e.funds[currency] = f
+	}
+	return f
+}
+
+func (e *FutureExchange) position(cp CurrencyPair, contractType string) *futurePosition {
+	key := contractKey(cp, contractType)
+	p, ok := e.positions[key]
+	if !ok {
+		p = &futurePosition{Position: margin.Position{ContractValue: e.contractValue(cp)}, pair: cp, contractType: contractType}
+		e.positions[key] = p
+	}
+	return p
+}
+
+func sameCurrency(a, b Currency) bool {
+	return strings.EqualFold(string(a), string(b))
+}
+
+//按价格优先、时间优先排序的挂单
+func (e *FutureExchange) openOrders(cp CurrencyPair, contractType string) []*futureOrder {
+	var orders []*futureOrder
+	for _, o := range e.orders {
+		if o.pair == cp && o.contractType == contractType && o.open() {
+			orders = append(orders, o)
+		}
+	}
+	sort.SliceStable(orders, func(i, j int) bool {
+		if orders[i].isBuy() != orders[j].isBuy() {
+			return orders[i].isBuy()
+		}
+		if orders[i].isBuy() {
+			return orders[i].Price > orders[j].Price
+		}
+		return orders[i].Price < orders[j].Price
+	})
+	return orders
+}
+
+//挂单中平仓单剩余的张数, 这部分持仓不能再下平仓单
+func (e *FutureExchange) pendingClose(cp CurrencyPair, contractType string, otype int) float64 {
+	pending := 0.0
+	for _, o := range e.openOrders(cp, contractType) {
+		if o.OType == otype {
+			pending += o.remaining()
+		}
+	}
+	return pending
+}
+
+//对手价开仓按盘口第一档估算
+func (e *FutureExchange) orderMargin(o *futureOrder, b *book) float64 {
+	price := o.Price
+	if o.matchPrice {
+		level, _, ok := b.bestLevel(o.isBuy(), o.crosses)
+		if !ok {
+			return 0
+		}
+		price = level
+	}
+	return margin.Deposit(o.remaining(), e.contractValue(o.pair), price, o.LeverRate)
+}
+
+//持仓保证金加上开仓挂单冻结的保证金
+func (e *FutureExchange) keepDeposit(currency Currency) float64 {
+	deposit := 0.0
+	for _, p := range e.positions {
+		if sameCurrency(p.pair.BaseCurrency, currency) {
+			deposit += p.Margin()
+		}
+	}
+	for _, o := range e.orders {
+		if sameCurrency(o.pair.BaseCurrency, currency) && o.open() && !o.matchPrice && margin.IsOpen(o.OType) {
+			deposit += margin.Deposit(o.remaining(), e.contractValue(o.pair), o.Price, o.LeverRate)
+		}
+	}
+	return deposit
+}
+
+//多头按买一, 空头按卖一计算盈亏, 没有盘口时按持仓均价
+func (e *FutureExchange) markPrices(p *futurePosition) (long, short float64) {
+	long, short = p.BuyPriceAvg, p.SellPriceAvg
+	if b, ok := e.books[contractKey(p.pair, p.contractType)]; ok && b.depth != nil {
+		if len(b.depth.BidList) > 0 {
+			long = b.depth.BidList[0].Price
+		}
+		if len(b.depth.AskList) > 0 {
+			short = b.depth.AskList[0].Price
+		}
+	}
+	return long, short
+}
+
+func (e *FutureExchange) positionProfit(p *futurePosition) float64 {
+	return p.ProfitUnreal(e.markPrices(p))
+}
+
+func (e *FutureExchange) profitUnreal(currency Currency) float64 {
+	profit := 0.0
+	for _, p := range e.positions {
+		if sameCurrency(p.pair.BaseCurrency, currency) {
+			profit += e.positionProfit(p)
+		}
+	}
+	return profit
+}
+
+//交割到期合约, 撮合 cp 的挂单, 然后检查强平
+func (e *FutureExchange) sync(cp CurrencyPair, contractType string) (*book, error) {
+	if err := e.deliver(); err != nil {
+		return nil, err
+	}
+	b, err := e.refresh(cp, contractType)
+	if err != nil {
+		return nil, err
+	}
+	e.liquidate(cp.BaseCurrency)
+	return b, nil
+}
+
+func (e *FutureExchange) refresh(cp CurrencyPair, contractType string) (*book, error) {
+	key := contractKey(cp, contractType)
+	b, ok := e.books[key]
+	if !ok {
+		b = &book{pair: cp}
+		e.books[key] = b
+	}
+	depth, err := e.Feed.GetFutureDepth(cp, contractType, e.DepthSize)
+	if err != nil {
+		return nil, err
+	}
+	b.update(depth)
+
+	//挂单被行情穿过时按挂单价成交
+	for _, o := range e.openOrders(cp, contractType) {
+		for e.takeFeed(b, o, false) {
+		}
+	}
+	return b, nil
+}
+
+//o 吃 Feed 盘口中价格能成交的第一档, 返回是否有成交
+func (e *FutureExchange) takeFeed(b *book, o *futureOrder, taker bool) bool {
+	if !o.open() {
+		return false
+	}
+	level, available, ok := b.bestLevel(o.isBuy(), o.crosses)
+	if !ok {
+		return false
+	}
+	price := o.Price
+	if taker {
+		price = level
+	}
+	amount := math.Min(o.remaining(), available)
+	b.consume(o.isBuy(), level, amount)
+	e.fill(o, price, amount)
+	return true
+}
+
+//手续费按成交面值折合成币从静态权益中扣除
+func (e *FutureExchange) fill(o *futureOrder, price, amount float64) {
+	p, f := e.position(o.pair, o.contractType), e.fund(o.pair.BaseCurrency)
+	if p.Empty() {
+		p.createDate = e.nowMs()
+	}
+	e.realize(o.pair.BaseCurrency, p.Fill(o.OType, price, amount, o.LeverRate))
+
+	fee := amount * p.ContractValue / price * e.FeeRate
+	f.balance -= fee
+	o.Fee += fee
+	o.AvgPrice = (o.AvgPrice*o.DealAmount + price*amount) / (o.DealAmount + amount)
+	o.DealAmount += amount
+	if o.remaining() <= epsilon {
+		o.Status = ORDER_FINISH
+	} else {
+		o.Status = ORDER_PART_FINISH
+	}
+}
+
+//按price平掉全部多空持仓
+func (e *FutureExchange) closeAll(p *futurePosition, price float64) {
+	profit := p.Fill(CLOSE_BUY, price, p.BuyAmount, p.LeverRate)
+	profit += p.Fill(CLOSE_SELL, price, p.SellAmount, p.LeverRate)
+	e.realize(p.pair.BaseCurrency, profit)
+}
+
+func (e *FutureExchange) realize(currency Currency, profit float64) {
+	f := e.fund(currency)
+	f.balance += profit
+	f.profitReal += profit
+}
+
+//其他持仓盈亏不变时, 账户风险率降到 LiquidationRiskRate 的价格. 多空相抵或不会爆仓时为0
+func (e *FutureExchange) forceLiquPrice(p *futurePosition) float64 {
+	currency := p.pair.BaseCurrency
+	cv := e.contractValue(p.pair)
+	net := p.BuyAmount - p.SellAmount
+	if math.Abs(net) <= epsilon {
+		return 0
+	}
+	//权益 = rights + k - net*cv/price
+	rights := e.fund(currency).balance + e.profitUnreal(currency) - e.positionProfit(p)
+	k := 0.0
+	if p.BuyAmount > epsilon {
+		k += p.BuyAmount * cv / p.BuyPriceAvg
+	}
+	if p.SellAmount > epsilon {
+		k -= p.SellAmount * cv / p.SellPriceAvg
+	}
+	inverse := (rights + k - e.LiquidationRiskRate*e.keepDeposit(currency)) / (net * cv)
+	if inverse <= 0 {
+		return 0
+	}
+	return 1 / inverse
+}
+
+//风险率不高于 LiquidationRiskRate 时先撤销开仓挂单, 平仓挂单降低风险, 保留; 仍然不够时按预估爆仓价
+//平掉该币种的所有持仓, 再撤销已经没有持仓可平的平仓挂单
+func (e *FutureExchange) liquidate(currency Currency) {
+	if !e.underMargin(currency) {
+		return
+	}
+	for _, o := range e.orders {
+		if sameCurrency(o.pair.BaseCurrency, currency) && o.open() && margin.IsOpen(o.OType) {
+			o.Status = ORDER_CANCEL
+		}
+	}
+	if !e.underMargin(currency) {
+		return
+	}
+
+	type closing struct {
+		p     *futurePosition
+		price float64
+	}
+	var positions []closing
+	for _, p := range e.positions {
+		if sameCurrency(p.pair.BaseCurrency, currency) && !p.Empty() {
+			price := e.forceLiquPrice(p)
+			if price == 0 {
+				long, short := e.markPrices(p)
+				if price = long; p.SellAmount > p.BuyAmount {
+					price = short
+				}
+			}
+			positions = append(positions, closing{p, price})
+		}
+	}
+	for _, c := range positions {
+		e.closeAll(c.p, c.price)
+		c.p.BuyMargin, c.p.SellMargin = 0, 0
+	}
+	for _, o := range e.orders {
+		if sameCurrency(o.pair.BaseCurrency, currency) && o.open() {
+			o.Status = ORDER_CANCEL
+		}
+	}
+	if f := e.fund(currency); f.balance < 0 {
+		f.balance = 0
+	}
+}
+
+func (e *FutureExchange) underMargin(currency Currency) bool {
+	deposit := e.keepDeposit(currency)
+	if deposit <= epsilon {
+		return false
+	}
+	return (e.fund(currency).balance+e.profitUnreal(currency))/deposit <= e.LiquidationRiskRate
+}
+
+//按 Now 交割所有到期的当周合约: 持仓按指数价格平仓, 挂单撤销, 然后次周合约变为当周合约,
+//季度合约离交割不到两周时变为次周合约
+func (e *FutureExchange) deliver() error {
+	now := e.Now()
+	if e.nextDelivery.IsZero() {
+		e.nextDelivery = e.deliveryAfter(now)
+	}
+	for !now.Before(e.nextDelivery) {
+		delivery := e.nextDelivery
+
+		//先取到所有指数价格, 出错时下次再交割
+		indexes := map[string]float64{}
+		for _, p := range e.positions {
+			if p.contractType != THIS_WEEK_CONTRACT || p.Empty() {
+				continue
+			}
+			index, err := e.Feed.GetFutureIndex(p.pair)
+			if err != nil {
+				return err
+			}
+			indexes[p.pair.Symbol()] = index
+		}
+
+		for key, p := range e.positions {
+			if p.contractType != THIS_WEEK_CONTRACT {
+				continue
+			}
+			if index, ok := indexes[p.pair.Symbol()]; ok {
+				e.closeAll(p, index)
+			}
+			delete(e.positions, key)
+		}
+		for _, o := range e.orders {
+			if o.contractType == THIS_WEEK_CONTRACT && o.open() {
+				o.Status = ORDER_CANCEL
+			}
+		}
+		rollQuarter := e.quarterDelivery(delivery).Equal(delivery.AddDate(0, 0, 14))
+		e.relabel(NEXT_WEEK_CONTRACT, THIS_WEEK_CONTRACT)
+		if rollQuarter {
+			e.relabel(QUARTER_CONTRACT, NEXT_WEEK_CONTRACT)
+		}
+		e.books = map[string]*book{}
+		e.nextDelivery = delivery.AddDate(0, 0, 7)
+	}
+	return nil
+}
+
+func (e *FutureExchange) relabel(from, to string) {
+	for key, p := range e.positions {
+		if p.contractType == from {
+			delete(e.positions, key)
+			p.contractType = to
+			e.positions[contractKey(p.pair, to)] = p
+		}
+	}
+	for _, o := range e.orders {
+		if o.contractType == from {
+			o.contractType = to
+		}
+	}
+}
+
+//t 之后的第一个交割时间
+func (e *FutureExchange) deliveryAfter(t time.Time) time.Time {
+	local := t.In(e.DeliveryLocation)
+	d := time.Date(local.Year(), local.Month(), local.Day(), e.DeliveryHour, 0, 0, 0, e.DeliveryLocation)
+	for d.Weekday() != e.DeliveryWeekday || !d.After(t) {
+		d = d.AddDate(0, 0, 1)
+	}
+	return d
+}
+
+//当周合约在 thisWeek 交割时, 季度合约的交割时间: 3、6、9、12月最后一个交割日中, 晚于次周合约的第一个
+func (e *FutureExchange) quarterDelivery(thisWeek time.Time) time.Time {
+	local := thisWeek.In(e.DeliveryLocation)
+	for i := 0; ; i++ {
+		month := time.Date(local.Year(), local.Month()+time.Month(i), 1, e.DeliveryHour, 0, 0, 0, e.DeliveryLocation)
+		if month.Month()%3 != 0 {
+			continue
+		}
+		d := month.AddDate(0, 1, -1)
+		for d.Weekday() != e.DeliveryWeekday {
+			d = d.AddDate(0, 0, -1)
+		}
+		if d.After(thisWeek.AddDate(0, 0, 7)) {
+			return d
+		}
+	}
+}
+
+func (e *FutureExchange) contractDelivery(contractType string) time.Time {
+	switch contractType {
+	case NEXT_WEEK_CONTRACT:
+		return e.nextDelivery.AddDate(0, 0, 7)
+	case QUARTER_CONTRACT:
+		return e.quarterDelivery(e.nextDelivery)
+	}
+	return e.nextDelivery
+}
+
+//交割日期, 如 20171229
+func (e *FutureExchange) contractId(contractType string) int64 {
+	d := e.contractDelivery(contractType).In(e.DeliveryLocation)
+	return int64(d.Year()*10000 + int(d.Month())*100 + d.Day())
+}
+
+//如 BTC1229
+func (e *FutureExchange) contractName(cp CurrencyPair, contractType string) string {
+	d := e.contractDelivery(contractType).In(e.DeliveryLocation)
+	return strings.ToUpper(string(cp.BaseCurrency)) + d.Format("0102")
+}
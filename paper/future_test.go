@@ -0,0 +1,267 @@
+package paper
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+	"github.com/qct/cryptocurrency-exchange-api/apitest"
+	"github.com/stretchr/testify/assert"
+)
+
+var btcUsd = NewCurrencyPair("BTC", "USD")
+
+//星期三, 当周合约 2017-12-22 交割
+var cst = time.FixedZone("CST", 8*3600)
+var startTime = time.Date(2017, 12, 20, 10, 0, 0, 0, cst)
+
+func setFuturePrice(feed *StaticFutureFeed, contractType string, bid, ask float64) {
+	feed.Contract(contractType).SetDepth(btcUsd, Depth{
+		AskList: DepthRecords{{Price: ask, Amount: 100}},
+		BidList: DepthRecords{{Price: bid, Amount: 100}},
+	})
+}
+
+func newTestFutureExchange() (*FutureExchange, *StaticFutureFeed, *time.Time) {
+	feed := NewStaticFutureFeed()
+	setFuturePrice(feed, THIS_WEEK_CONTRACT, 4000, 4001)
+	feed.SetIndex(btcUsd, 4000)
+	now := startTime
+	ex := NewFutureExchange(feed)
+	ex.Now = func() time.Time { return now }
+	ex.Deposit("BTC", 1)
+	return ex, feed, &now
+}
+
+func TestFutureExchange_OpenClose(t *testing.T) {
+	ex, feed, _ := newTestFutureExchange()
+
+	//对手价开多10张
+	_, err := ex.PlaceFutureOrder(btcUsd, THIS_WEEK_CONTRACT, "", "10", OPEN_BUY, 1, 10)
+	assert.NoError(t, err)
+	openFee := 10 * 100 / 4001.0 * ex.FeeRate
+	positions, err := ex.GetFuturePosition(btcUsd, THIS_WEEK_CONTRACT)
+	assert.NoError(t, err)
+	if assert.Len(t, positions, 1) {
+		assert.Equal(t, 10.0, positions[0].BuyAmount)
+		assert.Equal(t, 10.0, positions[0].BuyAvailable)
+		assert.Equal(t, 4001.0, positions[0].BuyPriceAvg)
+		assert.Equal(t, 10, positions[0].LeverRate)
+		assert.Equal(t, "btc_usd", positions[0].Symbol)
+		assert.Equal(t, int64(20171222), positions[0].ContractId)
+	}
+
+	setFuturePrice(feed, THIS_WEEK_CONTRACT, 4400, 4401)
+	account, err := ex.GetFutureUserInfo()
+	assert.NoError(t, err)
+	unreal := 10 * 100 * (1/4001.0 - 1/4400.0)
+	deposit := 10 * 100 / 4001.0 / 10
+	btc := account.FutureSubAccounts["BTC"]
+	assert.InDelta(t, unreal, btc.ProfitUnreal, 1e-12)
+	assert.InDelta(t, 1-openFee+unreal, btc.AccountRights, 1e-12)
+	assert.InDelta(t, deposit, btc.KeepDeposit, 1e-12)
+	assert.InDelta(t, (1-openFee+unreal)/deposit, btc.RiskRate, 1e-9)
+
+	_, err = ex.PlaceFutureOrder(btcUsd, THIS_WEEK_CONTRACT, "4400", "1", OPEN_BUY, 0, 20)
+	apitest.AssertErrorKind(t, err, ERR_KIND_INVALID_REQUEST)
+	_, err = ex.PlaceFutureOrder(btcUsd, THIS_WEEK_CONTRACT, "4400", "100000", OPEN_BUY, 0, 10)
+	apitest.AssertErrorKind(t, err, ERR_KIND_INSUFFICIENT_FUNDS)
+	_, err = ex.PlaceFutureOrder(btcUsd, THIS_WEEK_CONTRACT, "4300", "11", CLOSE_BUY, 0, 10)
+	apitest.AssertErrorKind(t, err, ERR_KIND_INVALID_REQUEST)
+
+	//限价平多, 按买一成交, 盈利计入已实现盈亏
+	orderId, err := ex.PlaceFutureOrder(btcUsd, THIS_WEEK_CONTRACT, "4300", "10", CLOSE_BUY, 0, 10)
+	assert.NoError(t, err)
+	orders, err := ex.GetFutureOrders([]string{orderId}, btcUsd, THIS_WEEK_CONTRACT)
+	assert.NoError(t, err)
+	assert.Equal(t, TradeStatus(ORDER_FINISH), orders[0].Status)
+	assert.Equal(t, 4400.0, orders[0].AvgPrice)
+	assert.Equal(t, CLOSE_BUY, orders[0].OType)
+	assert.Equal(t, "BTC1222", orders[0].ContractName)
+	closeFee := 10 * 100 / 4400.0 * ex.FeeRate
+	assert.InDelta(t, closeFee, orders[0].Fee, 1e-12)
+
+	account, err = ex.GetFutureUserInfo()
+	assert.NoError(t, err)
+	btc = account.FutureSubAccounts["BTC"]
+	assert.InDelta(t, unreal, btc.ProfitReal, 1e-12)
+	assert.InDelta(t, 1-openFee-closeFee+unreal, btc.AccountRights, 1e-12)
+	assert.InDelta(t, 0, btc.KeepDeposit, 1e-12)
+	assert.Equal(t, 10000.0, btc.RiskRate)
+	positions, err = ex.GetFuturePosition(btcUsd, THIS_WEEK_CONTRACT)
+	assert.NoError(t, err)
+	assert.Empty(t, positions)
+}
+
+func TestFutureExchange_RestingOrder(t *testing.T) {
+	ex, feed, _ := newTestFutureExchange()
+	ex.FeeRate = 0
+
+	//高于买一的开空单挂着, 冻结保证金
+	orderId, err := ex.PlaceFutureOrder(btcUsd, THIS_WEEK_CONTRACT, "4500", "5", OPEN_SELL, 0, 20)
+	assert.NoError(t, err)
+	orders, err := ex.GetUnfinishedFutureOrders(btcUsd, THIS_WEEK_CONTRACT)
+	assert.NoError(t, err)
+	assert.Len(t, orders, 1)
+	depth, err := ex.GetFutureDepth(btcUsd, THIS_WEEK_CONTRACT, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, DepthRecords{{Price: 4001, Amount: 100}, {Price: 4500, Amount: 5}}, depth.AskList)
+	account, err := ex.GetFutureUserInfo()
+	assert.NoError(t, err)
+	assert.InDelta(t, 5*100/4500.0/20, account.FutureSubAccounts["BTC"].KeepDeposit, 1e-12)
+
+	ok, err := ex.FutureCancelOrder(btcUsd, THIS_WEEK_CONTRACT, orderId)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	_, err = ex.FutureCancelOrder(btcUsd, THIS_WEEK_CONTRACT, orderId)
+	apitest.AssertErrorKind(t, err, ERR_KIND_INVALID_REQUEST)
+	_, err = ex.GetFutureOrders([]string{"12345"}, btcUsd, THIS_WEEK_CONTRACT)
+	apitest.AssertErrorKind(t, err, ERR_KIND_INVALID_REQUEST)
+
+	//价格涨到挂单价之上后按挂单价成交
+	orderId, err = ex.PlaceFutureOrder(btcUsd, THIS_WEEK_CONTRACT, "4500", "5", OPEN_SELL, 0, 20)
+	assert.NoError(t, err)
+	setFuturePrice(feed, THIS_WEEK_CONTRACT, 4600, 4601)
+	assert.NoError(t, ex.Match(btcUsd, THIS_WEEK_CONTRACT))
+	orders, err = ex.GetFutureOrders([]string{orderId}, btcUsd, THIS_WEEK_CONTRACT)
+	assert.NoError(t, err)
+	assert.Equal(t, TradeStatus(ORDER_FINISH), orders[0].Status)
+	positions, err := ex.GetFuturePosition(btcUsd, THIS_WEEK_CONTRACT)
+	assert.NoError(t, err)
+	assert.Equal(t, 5.0, positions[0].SellAmount)
+	assert.Equal(t, 4500.0, positions[0].SellPriceAvg)
+	assert.Equal(t, 0.0, positions[0].ForceLiquPrice, "short without enough leverage is never liquidated")
+}
+
+func TestFutureExchange_Liquidation(t *testing.T) {
+	feed := NewStaticFutureFeed()
+	setFuturePrice(feed, THIS_WEEK_CONTRACT, 4000, 4001)
+	ex := NewFutureExchange(feed)
+	ex.Now = func() time.Time { return startTime }
+	ex.FeeRate = 0
+	ex.Deposit("BTC", 0.1)
+
+	_, err := ex.PlaceFutureOrder(btcUsd, THIS_WEEK_CONTRACT, "", "40", OPEN_BUY, 1, 20)
+	assert.NoError(t, err)
+	deposit := 40 * 100 / 4001.0 / 20
+	liquPrice := 1 / ((0.1 + 40*100/4001.0 - ex.LiquidationRiskRate*deposit) / (40 * 100))
+	positions, err := ex.GetFuturePosition(btcUsd, THIS_WEEK_CONTRACT)
+	assert.NoError(t, err)
+	assert.InDelta(t, liquPrice, positions[0].ForceLiquPrice, 1e-9)
+
+	//价格高于爆仓价时不强平
+	setFuturePrice(feed, THIS_WEEK_CONTRACT, liquPrice+1, liquPrice+2)
+	positions, err = ex.GetFuturePosition(btcUsd, THIS_WEEK_CONTRACT)
+	assert.NoError(t, err)
+	assert.Len(t, positions, 1)
+
+	//跌破爆仓价后按爆仓价平仓
+	setFuturePrice(feed, THIS_WEEK_CONTRACT, 3500, 3501)
+	account, err := ex.GetFutureUserInfo()
+	assert.NoError(t, err)
+	btc := account.FutureSubAccounts["BTC"]
+	assert.InDelta(t, 40*100*(1/4001.0-1/liquPrice), btc.ProfitReal, 1e-12)
+	assert.InDelta(t, ex.LiquidationRiskRate*deposit, btc.AccountRights, 1e-12)
+	assert.Equal(t, 0.0, btc.KeepDeposit)
+	positions, err = ex.GetFuturePosition(btcUsd, THIS_WEEK_CONTRACT)
+	assert.NoError(t, err)
+	assert.Empty(t, positions)
+}
+
+//撤销开仓挂单后风险率恢复时保留平仓挂单, 强平后撤销没有持仓可平的平仓挂单
+func TestFutureExchange_LiquidationKeepsCloseOrders(t *testing.T) {
+	feed := NewStaticFutureFeed()
+	setFuturePrice(feed, THIS_WEEK_CONTRACT, 4000, 4001)
+	ex := NewFutureExchange(feed)
+	ex.Now = func() time.Time { return startTime }
+	ex.FeeRate = 0
+	ex.Deposit("BTC", 0.1)
+
+	_, err := ex.PlaceFutureOrder(btcUsd, THIS_WEEK_CONTRACT, "", "40", OPEN_BUY, 1, 20)
+	assert.NoError(t, err)
+	openId, err := ex.PlaceFutureOrder(btcUsd, THIS_WEEK_CONTRACT, "3000", "25", OPEN_BUY, 0, 20)
+	assert.NoError(t, err)
+	closeId, err := ex.PlaceFutureOrder(btcUsd, THIS_WEEK_CONTRACT, "5000", "10", CLOSE_BUY, 0, 20)
+	assert.NoError(t, err)
+
+	//算上开仓挂单的保证金风险率不够, 撤销开仓挂单后够了
+	setFuturePrice(feed, THIS_WEEK_CONTRACT, 3660, 3661)
+	orders, err := ex.GetFutureOrders([]string{openId, closeId}, btcUsd, THIS_WEEK_CONTRACT)
+	assert.NoError(t, err)
+	if assert.Len(t, orders, 2) {
+		assert.Equal(t, TradeStatus(ORDER_CANCEL), orders[0].Status)
+		assert.Equal(t, TradeStatus(ORDER_UNFINISHED), orders[1].Status)
+	}
+	positions, err := ex.GetFuturePosition(btcUsd, THIS_WEEK_CONTRACT)
+	assert.NoError(t, err)
+	if assert.Len(t, positions, 1) {
+		assert.Equal(t, 40.0, positions[0].BuyAmount)
+		assert.Equal(t, 30.0, positions[0].BuyAvailable)
+	}
+
+	//强平后平仓挂单没有持仓可平, 被撤销
+	setFuturePrice(feed, THIS_WEEK_CONTRACT, 3500, 3501)
+	orders, err = ex.GetFutureOrders([]string{closeId}, btcUsd, THIS_WEEK_CONTRACT)
+	assert.NoError(t, err)
+	if assert.Len(t, orders, 1) {
+		assert.Equal(t, TradeStatus(ORDER_CANCEL), orders[0].Status)
+	}
+	positions, err = ex.GetFuturePosition(btcUsd, THIS_WEEK_CONTRACT)
+	assert.NoError(t, err)
+	assert.Empty(t, positions)
+}
+
+func TestFutureExchange_Delivery(t *testing.T) {
+	ex, feed, now := newTestFutureExchange()
+	ex.FeeRate = 0
+	setFuturePrice(feed, NEXT_WEEK_CONTRACT, 4100, 4101)
+	setFuturePrice(feed, QUARTER_CONTRACT, 4200, 4201)
+	weekday, hour, minute, second := ex.GetDeliveryTime()
+	assert.Equal(t, []int{4, 16, 0, 0}, []int{weekday, hour, minute, second})
+
+	_, err := ex.PlaceFutureOrder(btcUsd, THIS_WEEK_CONTRACT, "", "10", OPEN_BUY, 1, 10)
+	assert.NoError(t, err)
+	_, err = ex.PlaceFutureOrder(btcUsd, NEXT_WEEK_CONTRACT, "", "5", OPEN_SELL, 1, 10)
+	assert.NoError(t, err)
+	_, err = ex.PlaceFutureOrder(btcUsd, QUARTER_CONTRACT, "", "1", OPEN_BUY, 1, 10)
+	assert.NoError(t, err)
+	orderId, err := ex.PlaceFutureOrder(btcUsd, THIS_WEEK_CONTRACT, "3000", "1", OPEN_BUY, 0, 10)
+	assert.NoError(t, err)
+	positions, err := ex.GetFuturePosition(btcUsd, QUARTER_CONTRACT)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(20180330), positions[0].ContractId)
+
+	//当周合约按指数价格交割, 挂单撤销, 次周合约变为当周合约
+	feed.SetIndex(btcUsd, 4200)
+	*now = time.Date(2017, 12, 22, 16, 0, 0, 0, cst)
+	account, err := ex.GetFutureUserInfo()
+	assert.NoError(t, err)
+	assert.InDelta(t, 10*100*(1/4001.0-1/4200.0), account.FutureSubAccounts["BTC"].ProfitReal, 1e-12)
+	orders, err := ex.GetFutureOrders([]string{orderId}, btcUsd, THIS_WEEK_CONTRACT)
+	assert.NoError(t, err)
+	assert.Equal(t, TradeStatus(ORDER_CANCEL), orders[0].Status)
+	positions, err = ex.GetFuturePosition(btcUsd, THIS_WEEK_CONTRACT)
+	assert.NoError(t, err)
+	if assert.Len(t, positions, 1) {
+		assert.Equal(t, 5.0, positions[0].SellAmount)
+		assert.Equal(t, int64(20171229), positions[0].ContractId)
+	}
+	positions, err = ex.GetFuturePosition(btcUsd, NEXT_WEEK_CONTRACT)
+	assert.NoError(t, err)
+	assert.Empty(t, positions)
+
+	//季度合约离交割两周时变为次周合约
+	*now = time.Date(2018, 3, 16, 16, 0, 0, 0, cst)
+	positions, err = ex.GetFuturePosition(btcUsd, NEXT_WEEK_CONTRACT)
+	assert.NoError(t, err)
+	if assert.Len(t, positions, 1) {
+		assert.Equal(t, 1.0, positions[0].BuyAmount)
+		assert.Equal(t, int64(20180330), positions[0].ContractId)
+	}
+	positions, err = ex.GetFuturePosition(btcUsd, QUARTER_CONTRACT)
+	assert.NoError(t, err)
+	assert.Empty(t, positions)
+	account, err = ex.GetFutureUserInfo()
+	assert.NoError(t, err)
+	assert.InDelta(t, 10*100*(1/4001.0-1/4200.0)+5*100*(1/4200.0-1/4100.0), account.FutureSubAccounts["BTC"].ProfitReal, 1e-12)
+}
@@ -0,0 +1,111 @@
+package poloniex
+
+import (
+	"testing"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+)
+
+func FuzzParseDepth(f *testing.F) {
+	f.Add([]byte(`{"asks":[["0.00007600",1164],["0.00007620",1300]],"bids":[["0.00006901",200],["0.00006900",408]],"isFrozen":"0","seq":18849}`))
+	f.Add([]byte(`{"error":"Invalid currency pair."}`))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		depth, err := parseDepth(body)
+		if err == nil && depth == nil {
+			t.Fatal("nil depth without error")
+		}
+	})
+}
+
+func FuzzParseTicker(f *testing.F) {
+	f.Add([]byte(`{"BTC_LTC":{"last":"0.0251","lowestAsk":"0.02589999","highestBid":"0.0251","percentChange":"0.02390438","baseVolume":"6.16485315","quoteVolume":"245.82513926","high24hr":"0.026","low24hr":"0.024"}}`))
+	pair := NewCurrencyPair("BTC", "LTC")
+	f.Fuzz(func(t *testing.T, body []byte) {
+		ticker, err := parseTicker(body, pair)
+		if err == nil && ticker == nil {
+			t.Fatal("nil ticker without error")
+		}
+	})
+}
+
+func FuzzParseTrades(f *testing.F) {
+	f.Add([]byte(`[{"globalTradeID":254912903,"tradeID":13,"date":"2017-10-01 00:00:05","type":"sell","rate":"0.07010000","amount":"0.20000000","total":"0.01402000"},{"globalTradeID":254912902,"tradeID":12,"date":"2017-10-01 00:00:03","type":"buy","rate":"0.07020000","amount":"1.50000000","total":"0.10530000"}]`), int64(12))
+	f.Add([]byte(`[{"tradeID":1,"date":"2017-10-01","type":"buy","rate":"1","amount":"1"}]`), int64(0))
+	f.Fuzz(func(t *testing.T, body []byte, since int64) {
+		trades, err := parseTrades(body, since)
+		if err != nil {
+			return
+		}
+		if trades == nil {
+			t.Fatal("nil trades without error")
+		}
+		for _, v := range trades {
+			if v.Tid <= since {
+				t.Fatalf("trade %d not after %d", v.Tid, since)
+			}
+		}
+	})
+}
+
+func FuzzParseChartData(f *testing.F) {
+	f.Add([]byte(`[{"date":1506787200,"high":0.0705,"low":0.0698,"open":0.07,"close":0.0702,"volume":7.02,"quoteVolume":100.3,"weightedAverage":0.07}]`))
+	f.Add([]byte(`[{"date":0,"high":0,"low":0,"open":0,"close":0,"volume":0,"quoteVolume":0,"weightedAverage":0}]`))
+	f.Add([]byte(`{"error":"Invalid currency pair."}`))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		klines, err := parseChartData(body)
+		if err != nil {
+			return
+		}
+		if klines == nil {
+			t.Fatal("nil klines without error")
+		}
+		for _, k := range klines {
+			if k.Timestamp == 0 {
+				t.Fatal("empty kline placeholder not skipped")
+			}
+		}
+	})
+}
+
+func FuzzParseOrderTrades(f *testing.F) {
+	f.Add([]byte(`[{"globalTradeID":20825863,"tradeID":147142,"currencyPair":"BTC_XVC","type":"buy","rate":"0.00018500","amount":"455.34206390","total":"0.08423828","fee":"0.00200000","date":"2016-03-14 01:04:36"}]`))
+	f.Add([]byte(`{"error":"Order not found, or you are not the person who placed it."}`))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		order, err := parseOrderTrades(body)
+		if err == nil && order == nil {
+			t.Fatal("nil order without error")
+		}
+	})
+}
+
+func FuzzParseOpenOrders(f *testing.F) {
+	f.Add([]byte(`[{"orderNumber":"120466","type":"sell","rate":"0.025","amount":"100","total":"2.5"}]`))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		parseOpenOrders(body)
+	})
+}
+
+func FuzzParseAccount(f *testing.F) {
+	f.Add([]byte(`{"LTC":{"available":"5.015","onOrders":"1.0025","btcValue":"0.078"},"NXT":{"available":"1.5","onOrders":"0","btcValue":"0"}}`))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		account, err := parseAccount(body)
+		if err == nil && account == nil {
+			t.Fatal("nil account without error")
+		}
+	})
+}
+
+func FuzzParseCurrencies(f *testing.F) {
+	f.Add([]byte(`{"1CR":{"id":1,"name":"1CRedit","txFee":"0.01000000","minConf":3,"depositAddress":null,"disabled":0,"delisted":1,"frozen":0}}`))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		parseCurrencies(body)
+	})
+}
+
+func FuzzParseSuccess(f *testing.F) {
+	f.Add([]byte(`{"success":1,"message":"Transferred 2 BTC from exchange to lending account."}`))
+	f.Add([]byte(`{"success":0}`))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		parseSuccess(body)
+	})
+}
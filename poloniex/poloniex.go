@@ -1,11 +1,11 @@
 package poloniex
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	. "github.com/qct/cryptocurrency-exchange-api"
-	"log"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -16,13 +16,32 @@ import (
 const (
 	EXCHANGE_NAME  = "poloniex.com"
 	BASE_URL       = "https://poloniex.com/"
-	TRADE_API      = BASE_URL + "tradingApi"
-	PUBLIC_URL     = BASE_URL + "public"
+	TRADE_URI      = "tradingApi"
+	PUBLIC_URI     = "public"
 	TICKER_API     = "?command=returnTicker"
 	CURRENCIES_API = "?command=returnCurrencies"
 	ORDER_BOOK_API = "?command=returnOrderBook&currencyPair=%s&depth=%d"
+	TRADES_API     = "?command=returnTradeHistory&currencyPair=%s"
+	CHART_API      = "?command=returnChartData&currencyPair=%s&period=%d&start=%d&end=%d"
+	DATE_FORMAT    = "2006-01-02 15:04:05"
 )
 
+//returnChartData 支持的K线周期(秒)
+var klinePeriods = map[string]int{
+	"5min":  300,
+	"15min": 900,
+	"30min": 1800,
+	"2hour": 7200,
+	"4hour": 14400,
+	"1day":  86400,
+}
+
+//官方限制每秒6次, 超过会被临时封ip; 公共接口和交易接口共用额度
+var DefaultRateLimitPolicy = RateLimitPolicy{
+	Rate:  6,
+	Burst: 6,
+}
+
 type PoloniexDepositsWithdrawals struct {
 	Deposits []struct {
 		Currency      string  `json:"currency"`
@@ -46,57 +65,67 @@ type PoloniexDepositsWithdrawals struct {
 	} `json:"withdrawals"`
 }
 
+type poloTicker struct {
+	Last          JsonFloat64 `json:"last"`
+	LowestAsk     JsonFloat64 `json:"lowestAsk"`
+	HighestBid    JsonFloat64 `json:"highestBid"`
+	High24hr      JsonFloat64 `json:"high24hr"`
+	Low24hr       JsonFloat64 `json:"low24hr"`
+	QuoteVolume   JsonFloat64 `json:"quoteVolume"`
+	PercentChange JsonFloat64 `json:"percentChange"`
+}
+
+type poloCurrency struct {
+	ID             JsonInt64   `json:"id"`
+	Name           string      `json:"name"`
+	TxFee          JsonFloat64 `json:"txFee"`
+	MinConf        JsonInt64   `json:"minConf"`
+	DepositAddress *string     `json:"depositAddress"`
+	Disabled       JsonInt64   `json:"disabled"`
+	Delisted       JsonInt64   `json:"delisted"`
+	Frozen         JsonInt64   `json:"frozen"`
+}
+
 type PoloApi struct {
-	accessKey,
-	secretKey string
-	client *http.Client
+	signer  Signer
+	client  *http.Client
+	baseUrl string
+	clock   Clock
+}
+
+func init() {
+	RegisterApi(POLONIEX, ApiDriver{
+		New: func(config ApiConfig) (Api, error) {
+			nonce := config.Nonce
+			if nonce == nil {
+				nonce = SharedNonceProvider(POLONIEX, config.ApiKey)
+			}
+			signer := &ApiSigner{Credentials: config.CredentialProvider(), Nonce: nonce}
+			return &PoloApi{signer, config.HttpClient, ResolveBaseUrl(BASE_URL, config.BaseUrl), ExchangeClock(POLONIEX, config.BaseUrl)}, nil
+		},
+		DefaultRateLimit: DefaultRateLimitPolicy,
+		ServerTime:       ServerTime,
+	})
 }
 
 func New(client *http.Client, accessKey, secretKey string) *PoloApi {
-	return &PoloApi{accessKey, secretKey, client}
+	return NewWithNonce(client, accessKey, secretKey, SharedNonceProvider(POLONIEX, accessKey))
+}
+
+func NewWithNonce(client *http.Client, accessKey, secretKey string, nonce NonceProvider) *PoloApi {
+	return &PoloApi{&ApiSigner{Credentials: StaticCredentials{ApiKey: accessKey, ApiSecretKey: secretKey}, Nonce: nonce}, client, BASE_URL, ExchangeClock(POLONIEX, "")}
 }
 
 func (p *PoloApi) GetDepth(cp CurrencyPair, size int) (*Depth, error) {
-	resp, err := HttpGet(p.client, PUBLIC_URL+fmt.Sprintf(ORDER_BOOK_API, cp.Symbol(), size))
+	resp, err := HttpGetBytes(p.client, p.baseUrl+PUBLIC_URI+fmt.Sprintf(ORDER_BOOK_API, cp.Symbol(), size))
 	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
-	if resp["asks"] == nil {
-		log.Println(resp)
-		return nil, errors.New(fmt.Sprintf("%+v", resp))
-	}
-	if _, ok := resp["asks"].([]interface{}); !ok {
-		log.Println(resp)
-		return nil, errors.New(fmt.Sprintf("%+v", resp))
-	}
-
-	var depth Depth
-	for _, v := range resp["asks"].([]interface{}) {
-		var dr DepthRecord
-		for i, vv := range v.([]interface{}) {
-			switch i {
-			case 0:
-				dr.Price, _ = strconv.ParseFloat(vv.(string), 64)
-			case 1:
-				dr.Amount = vv.(float64)
-			}
-		}
-		depth.AskList = append(depth.AskList, dr)
-	}
-	for _, v := range resp["bids"].([]interface{}) {
-		var dr DepthRecord
-		for i, vv := range v.([]interface{}) {
-			switch i {
-			case 0:
-				dr.Price, _ = strconv.ParseFloat(vv.(string), 64)
-			case 1:
-				dr.Amount = vv.(float64)
-			}
-		}
-		depth.BidList = append(depth.BidList, dr)
+	depth, err := parseDepth(resp)
+	if err != nil {
+		return nil, err
 	}
-	return &depth, nil
+	return depth, nil
 }
 
 func (p *PoloApi) LimitBuy(amount, price string, cp CurrencyPair) (*Order, error) {
@@ -107,107 +136,74 @@ func (p *PoloApi) LimitSell(amount, price string, cp CurrencyPair) (*Order, erro
 	return p.placeLimitOrder(SELL, amount, price, cp)
 }
 
+//poloniex没有市价单
 func (p *PoloApi) MarketBuy(amount, price string, cp CurrencyPair) (*Order, error) {
-	return &Order{}, nil
+	return nil, NewUnsupportedError(EXCHANGE_NAME, "MarketBuy")
 }
 
 func (p *PoloApi) MarketSell(amount, price string, cp CurrencyPair) (*Order, error) {
-	return &Order{}, nil
+	return nil, NewUnsupportedError(EXCHANGE_NAME, "MarketSell")
 }
 
 func (p *PoloApi) CancelOrder(orderId string, cp CurrencyPair) (bool, error) {
 	postData := url.Values{}
 	postData.Set("command", "cancelOrder")
 	postData.Set("orderNumber", orderId)
-
-	sign, err := p.buildPostForm(&postData)
+	resp, err := p.tradingApi(postData)
 	if err != nil {
-		log.Println(err)
 		return false, err
 	}
-
-	headers := map[string]string{
-		"Key":  p.accessKey,
-		"Sign": sign}
-	resp, err := HttpPostForm2(p.client, TRADE_API, postData, headers)
-	if err != nil {
-		log.Println(err)
-		return false, err
-	}
-
-	respMap := make(map[string]interface{})
-	err = json.Unmarshal(resp, &respMap)
-	if err != nil || respMap["error"] != nil {
-		log.Println(err, string(resp))
-		return false, err
-	}
-
-	success := int(respMap["success"].(float64))
-	if success != 1 {
-		log.Println(respMap)
-		return false, nil
-	}
-	return true, nil
+	return parseSuccess(resp)
 }
 
+//poloniex没有查询订单状态的接口, 由成交记录和未完成订单推断: 在未完成订单里的是未成交或部分成交,
+//不在未完成订单里但有成交记录的视为全部成交(部分成交后撤销的订单也会被当作全部成交, Amount 为成交量),
+//两边都查不到的(已撤销或不存在)返回 ERR_KIND_INVALID_REQUEST
 func (p *PoloApi) GetOneOrder(orderId string, cp CurrencyPair) (*Order, error) {
 	postData := url.Values{}
 	postData.Set("command", "returnOrderTrades")
 	postData.Set("orderNumber", orderId)
-	sign, _ := p.buildPostForm(&postData)
-	headers := map[string]string{
-		"Key":  p.accessKey,
-		"Sign": sign}
-
-	resp, err := HttpPostForm2(p.client, TRADE_API, postData, headers)
+	resp, err := p.tradingApi(postData)
 	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
-	if strings.Contains(string(resp), "error") {
-		orders, err1 := p.GetUnfinishedOrders(cp)
-		if err1 != nil {
-			log.Println(err1)
-		} else {
-			_ordId, _ := strconv.Atoi(orderId)
-			for _, ord := range orders {
-				if ord.OrderID == _ordId {
-					return &ord, nil
-				}
-			}
-		}
-		return nil, errors.New(string(resp))
-	}
 
-	respMap := make([]interface{}, 0)
-	err = json.Unmarshal(resp, &respMap)
+	//还没有成交的订单查不到成交记录
+	order, tradesErr := parseOrderTrades(resp)
+	if tradesErr != nil && ClassifyError(tradesErr) != ERR_KIND_INVALID_REQUEST {
+		return nil, tradesErr
+	}
+	orders, err := p.GetUnfinishedOrders(cp)
 	if err != nil {
-		log.Println(err, string(resp))
 		return nil, err
 	}
 
-	order := new(Order)
-	order.OrderID, _ = strconv.Atoi(orderId)
-	order.CurrencyPair = cp.Symbol()
-
-	total := 0.0
-	for _, v := range respMap {
-		vv := v.(map[string]interface{})
-		_amount, _ := strconv.ParseFloat(vv["amount"].(string), 64)
-		_rate, _ := strconv.ParseFloat(vv["rate"].(string), 64)
-		_fee, _ := strconv.ParseFloat(vv["fee"].(string), 64)
-
-		order.DealAmount += _amount
-		total += (_amount * _rate)
-		order.Fee = _fee
-
-		if strings.Compare("sell", vv["type"].(string)) == 0 {
-			order.Side = TradeSide(SELL)
-		} else {
-			order.Side = TradeSide(BUY)
+	_ordId, _ := strconv.Atoi(orderId)
+	for _, ord := range orders {
+		if ord.OrderID != _ordId {
+			continue
+		}
+		if order != nil && order.DealAmount > 0 {
+			ord.Amount += order.DealAmount //未完成订单的 amount 是剩余数量
+			ord.DealAmount = order.DealAmount
+			ord.AvgPrice = order.AvgPrice
+			ord.Fee = order.Fee
+			ord.Status = ORDER_PART_FINISH
 		}
+		return &ord, nil
 	}
-	order.AvgPrice = total / order.DealAmount
+	if tradesErr != nil {
+		return nil, tradesErr
+	}
+	//成交记录为空又不在未完成订单里, 是没有任何成交就撤销了的订单
+	if order.DealAmount <= 0 {
+		return nil, &ApiError{Exchange: EXCHANGE_NAME, Kind: ERR_KIND_INVALID_REQUEST, Message: "order " + orderId + " is neither open nor filled"}
+	}
+
+	order.OrderID = _ordId
+	order.CurrencyPair = cp.Symbol()
+	order.Amount = order.DealAmount
+	order.Status = ORDER_FINISH
 	return order, nil
 }
 
@@ -215,47 +211,17 @@ func (p *PoloApi) GetUnfinishedOrders(cp CurrencyPair) ([]Order, error) {
 	postData := url.Values{}
 	postData.Set("command", "returnOpenOrders")
 	postData.Set("currencyPair", cp.Symbol())
-
-	sign, err := p.buildPostForm(&postData)
+	resp, err := p.tradingApi(postData)
 	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
 
-	headers := map[string]string{
-		"Key":  p.accessKey,
-		"Sign": sign}
-	resp, err := HttpPostForm2(p.client, TRADE_API, postData, headers)
+	orders, err := parseOpenOrders(resp)
 	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
-
-	orderAr := make([]interface{}, 1)
-	err = json.Unmarshal(resp, &orderAr)
-	if err != nil {
-		log.Println(err, string(resp))
-		return nil, err
-	}
-
-	orders := make([]Order, 0)
-	for _, v := range orderAr {
-		vv := v.(map[string]interface{})
-		order := Order{}
-		order.CurrencyPair = cp.Symbol()
-		order.OrderID, _ = strconv.Atoi(vv["orderNumber"].(string))
-		order.Amount, _ = strconv.ParseFloat(vv["amount"].(string), 64)
-		order.Price, _ = strconv.ParseFloat(vv["rate"].(string), 64)
-		order.Status = ORDER_UNFINISHED
-
-		side := vv["type"].(string)
-		switch side {
-		case "buy":
-			order.Side = TradeSide(BUY)
-		case "sell":
-			order.Side = TradeSide(SELL)
-		}
-		orders = append(orders, order)
+	for i := range orders {
+		orders[i].CurrencyPair = cp.Symbol()
 	}
 	return orders, nil
 }
@@ -263,57 +229,19 @@ func (p *PoloApi) GetUnfinishedOrders(cp CurrencyPair) ([]Order, error) {
 func (p *PoloApi) GetAccount() (*Account, error) {
 	postData := url.Values{}
 	postData.Add("command", "returnCompleteBalances")
-	sign, err := p.buildPostForm(&postData)
+	resp, err := p.tradingApi(postData)
 	if err != nil {
 		return nil, err
 	}
-	headers := map[string]string{
-		"Key":  p.accessKey,
-		"Sign": sign}
-	resp, err := HttpPostForm2(p.client, TRADE_API, postData, headers)
-	if err != nil {
-		log.Println(err)
-		return nil, err
-	}
-
-	respMap := make(map[string]interface{})
-	err = json.Unmarshal(resp, &respMap)
-
-	if err != nil || respMap["error"] != nil {
-		log.Println(err)
-		return nil, err
-	}
-
-	acc := new(Account)
-	acc.Exchange = EXCHANGE_NAME
-	acc.SubAccounts = make(map[string]SubAccount)
-
-	for k, v := range respMap {
-		vv := v.(map[string]interface{})
-		subAcc := SubAccount{}
-		subAcc.Currency = k
-		subAcc.Amount, _ = strconv.ParseFloat(vv["available"].(string), 64)
-		subAcc.FrozenAmount, _ = strconv.ParseFloat(vv["onOrders"].(string), 64)
-		acc.SubAccounts[subAcc.Currency] = subAcc
-	}
-	return acc, nil
+	return parseAccount(resp)
 }
 
 func (p *PoloApi) GetTicker(cp CurrencyPair) (*Ticker, error) {
-	resp, err := HttpGet(p.client, PUBLIC_URL+TICKER_API)
+	resp, err := HttpGetBytes(p.client, p.baseUrl+PUBLIC_URI+TICKER_API)
 	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
-	tickerMap := resp[cp.Symbol()].(map[string]interface{})
-	ticker := new(Ticker)
-	ticker.High, _ = strconv.ParseFloat(tickerMap["high24hr"].(string), 64)
-	ticker.Low, _ = strconv.ParseFloat(tickerMap["low24hr"].(string), 64)
-	ticker.Last, _ = strconv.ParseFloat(tickerMap["last"].(string), 64)
-	ticker.Buy, _ = strconv.ParseFloat(tickerMap["highestBid"].(string), 64)
-	ticker.Sell, _ = strconv.ParseFloat(tickerMap["lowestAsk"].(string), 64)
-	ticker.Vol, _ = strconv.ParseFloat(tickerMap["quoteVolume"].(string), 64)
-	return ticker, nil
+	return parseTicker(resp, cp)
 }
 
 func (p *PoloApi) Withdraw(amount, currency, fees, receiveAddr, memo, safePwd string) (string, error) {
@@ -325,56 +253,72 @@ func (p *PoloApi) Withdraw(amount, currency, fees, receiveAddr, memo, safePwd st
 	if memo != "" {
 		params.Add("paymentId", memo)
 	}
-	sign, err := p.buildPostForm(&params)
+	resp, err := p.tradingApi(params)
 	if err != nil {
 		return "", err
 	}
-	headers := map[string]string{
-		"Key":  p.accessKey,
-		"Sign": sign}
-
-	resp, err := HttpPostForm2(p.client, TRADE_API, params, headers)
 
-	if err != nil {
-		log.Println(err)
-		return "", err
+	var result struct {
+		Response string `json:"response"`
 	}
-
-	respMap := make(map[string]interface{})
-	err = json.Unmarshal(resp, &respMap)
+	err = decodeResponse(resp, &result)
 	if err != nil {
-		log.Println(err)
 		return "", err
 	}
-
-	if respMap["error"] == nil {
-		return string(resp), nil
-	}
-
-	return "", errors.New(string(resp))
+	return string(resp), nil
 }
 
 func (p *PoloApi) GetExchangeName() string {
 	return EXCHANGE_NAME
 }
 
+//period 只支持 klinePeriods 中的周期; since 为毫秒, 返回since之后的size根K线, 为0时返回最近的size根
 func (p *PoloApi) GetKlineRecords(cp CurrencyPair, period string, size, since int) ([]Kline, error) {
-	return nil, nil
+	seconds, ok := klinePeriods[period]
+	if !ok {
+		return nil, &ApiError{Exchange: EXCHANGE_NAME, Kind: ERR_KIND_UNSUPPORTED, Message: "unsupported kline period " + period}
+	}
+	start := int64(since / 1000)
+	if since == 0 {
+		start = p.clock.Now().Unix() - int64(seconds*size)
+	}
+	resp, err := HttpGetBytes(p.client, p.baseUrl+PUBLIC_URI+fmt.Sprintf(CHART_API, cp.Symbol(), seconds, start, start+int64(seconds*(size+1))))
+	if err != nil {
+		return nil, err
+	}
+
+	klines, err := parseChartData(resp)
+	if err != nil {
+		return nil, err
+	}
+	if size > 0 && len(klines) > size {
+		if since == 0 {
+			klines = klines[len(klines)-size:]
+		} else {
+			klines = klines[:size]
+		}
+	}
+	return klines, nil
 }
 
+//poloniex不提供历史订单接口
 func (p *PoloApi) GetOrderHistory(cp CurrencyPair, currentPage, pageSize int) ([]Order, error) {
-	return []Order{}, nil
+	return nil, NewUnsupportedError(EXCHANGE_NAME, "GetOrderHistory")
 }
 
+//最近的200笔成交, 只返回 tradeID 大于since的, 按时间升序
 func (p *PoloApi) GetTrades(cp CurrencyPair, since int64) ([]Trade, error) {
-	return []Trade{}, nil
+	resp, err := HttpGetBytes(p.client, p.baseUrl+PUBLIC_URI+fmt.Sprintf(TRADES_API, cp.Symbol()))
+	if err != nil {
+		return nil, err
+	}
+	return parseTrades(resp, since)
 }
 
 //-------------------------
 func (p *PoloApi) GetDepositsWithdrawals(start, end string) (*PoloniexDepositsWithdrawals, error) {
 	params := url.Values{}
 	params.Set("command", "returnDepositsWithdrawals")
-	println(start)
 	if start != "" {
 		params.Set("start", start)
 	} else {
@@ -387,108 +331,110 @@ func (p *PoloApi) GetDepositsWithdrawals(start, end string) (*PoloniexDepositsWi
 		params.Set("end", strconv.FormatInt(time.Now().Unix(), 10))
 	}
 
-	sign, err := p.buildPostForm(&params)
+	resp, err := p.tradingApi(params)
 	if err != nil {
 		return nil, err
 	}
 
-	headers := map[string]string{
-		"Key":  p.accessKey,
-		"Sign": sign}
-
-	resp, err := HttpPostForm2(p.client, TRADE_API, params, headers)
+	records := new(PoloniexDepositsWithdrawals)
+	err = decodeResponse(resp, records)
 	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
-
-	println(string(resp))
-
-	records := new(PoloniexDepositsWithdrawals)
-	err = json.Unmarshal(resp, records)
-
-	return records, err
+	return records, nil
 }
 
 func (p *PoloApi) GetCurrency(currency string) (*PoloniexCurrency, error) {
-	resp, err := HttpGet(p.client, PUBLIC_URL+CURRENCIES_API)
-
-	if err != nil || resp["error"] != nil {
-		log.Println(err)
+	currencies, err := p.GetAllCurrencies()
+	if err != nil {
 		return nil, err
 	}
-
-	currencyMap := resp[strings.ToUpper(currency)].(map[string]interface{})
-
-	poloniexCurrency := new(PoloniexCurrency)
-	poloniexCurrency.ID = int(currencyMap["id"].(float64))
-	poloniexCurrency.Name, _ = currencyMap["name"].(string)
-	poloniexCurrency.TxFee, _ = strconv.ParseFloat(currencyMap["txFee"].(string), 64)
-	poloniexCurrency.MinConf = int(currencyMap["minConf"].(float64))
-	poloniexCurrency.DepositAddress, _ = currencyMap["depositAddress"].(string)
-	poloniexCurrency.Disabled = int(currencyMap["disabled"].(float64))
-	poloniexCurrency.Delisted = int(currencyMap["delisted"].(float64))
-	poloniexCurrency.Frozen = int(currencyMap["frozen"].(float64))
-
+	poloniexCurrency, ok := currencies[strings.ToUpper(currency)]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("unknown currency %s", currency))
+	}
 	return poloniexCurrency, nil
 }
 
 func (p *PoloApi) GetAllCurrencies() (map[string]*PoloniexCurrency, error) {
-	respmap, err := HttpGet(p.client, PUBLIC_URL+CURRENCIES_API)
+	resp, err := HttpGetBytes(p.client, p.baseUrl+PUBLIC_URI+CURRENCIES_API)
+	if err != nil {
+		return nil, err
+	}
+	return parseCurrencies(resp)
+}
 
-	if err != nil || respmap["error"] != nil {
-		log.Println(err)
+func (p *PoloApi) Transfer(currency, amount string, from, to AccountType) (*TransferResult, error) {
+	fromAccount, err := poloAccountName(from)
+	if err != nil {
+		return nil, err
+	}
+	toAccount, err := poloAccountName(to)
+	if err != nil {
 		return nil, err
 	}
 
-	result := map[string]*PoloniexCurrency{}
-	for k, v := range respmap {
-		currencyMap := v.(map[string]interface{})
-		poloniexCurrency := new(PoloniexCurrency)
-		poloniexCurrency.ID = int(currencyMap["id"].(float64))
-		poloniexCurrency.Name, _ = currencyMap["name"].(string)
-		poloniexCurrency.TxFee, _ = strconv.ParseFloat(currencyMap["txFee"].(string), 64)
-		poloniexCurrency.MinConf = int(currencyMap["minConf"].(float64))
-		poloniexCurrency.DepositAddress, _ = currencyMap["depositAddress"].(string)
-		poloniexCurrency.Disabled = int(currencyMap["disabled"].(float64))
-		poloniexCurrency.Delisted = int(currencyMap["delisted"].(float64))
-		poloniexCurrency.Frozen = int(currencyMap["frozen"].(float64))
+	params := url.Values{}
+	params.Set("command", "transferBalance")
+	params.Set("currency", strings.ToUpper(currency))
+	params.Set("amount", amount)
+	params.Set("fromAccount", fromAccount)
+	params.Set("toAccount", toAccount)
+	resp, err := p.tradingApi(params)
+	if err != nil {
+		return nil, err
+	}
 
-		result[k] = poloniexCurrency
+	_, err = parseSuccess(resp)
+	if err != nil {
+		return nil, err
 	}
-	return result, nil
+
+	transfer := new(TransferResult)
+	transfer.Currency = strings.ToUpper(currency)
+	transfer.Amount, _ = strconv.ParseFloat(amount, 64)
+	transfer.From = from
+	transfer.To = to
+	return transfer, nil
 }
 
 //-------------------------
 
+func poloAccountName(at AccountType) (string, error) {
+	switch at {
+	case ACCOUNT_SPOT:
+		return "exchange", nil
+	case ACCOUNT_MARGIN:
+		return "margin", nil
+	case ACCOUNT_LENDING:
+		return "lending", nil
+	default:
+		return "", NewUnsupportedError(EXCHANGE_NAME, fmt.Sprintf("transfer with %s account", at))
+	}
+}
+
 func (p *PoloApi) placeLimitOrder(command TradeSide, amount, price string, cp CurrencyPair) (*Order, error) {
 	postData := url.Values{}
 	postData.Set("command", strings.ToLower(command.String()))
 	postData.Set("currencyPair", cp.Symbol())
 	postData.Set("rate", price)
 	postData.Set("amount", amount)
-	sign, _ := p.buildPostForm(&postData)
-	headers := map[string]string{
-		"Key":  p.accessKey,
-		"Sign": sign}
-
-	resp, err := HttpPostForm2(p.client, TRADE_API, postData, headers)
+	resp, err := p.tradingApi(postData)
 	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
 
-	respMap := make(map[string]interface{})
-	err = json.Unmarshal(resp, &respMap)
-	if err != nil || respMap["error"] != nil {
-		log.Println(err, string(resp))
+	var result struct {
+		OrderNumber JsonInt64 `json:"orderNumber"`
+	}
+	err = decodeResponse(resp, &result)
+	if err != nil {
 		return nil, err
 	}
 
-	orderNumber := respMap["orderNumber"].(string)
 	order := new(Order)
 	order.OrderTime = int(time.Now().Unix() * 1000)
-	order.OrderID, _ = strconv.Atoi(orderNumber)
+	order.OrderID = int(result.OrderNumber)
 	order.Amount, _ = strconv.ParseFloat(amount, 64)
 	order.Price, _ = strconv.ParseFloat(price, 64)
 	order.Status = ORDER_UNFINISHED
@@ -497,12 +443,295 @@ func (p *PoloApi) placeLimitOrder(command TradeSide, amount, price string, cp Cu
 	return order, nil
 }
 
-func (p *PoloApi) buildPostForm(postForm *url.Values) (string, error) {
-	postForm.Add("nonce", fmt.Sprintf("%d", time.Now().UnixNano()+500000000000))
-	payload := postForm.Encode()
-	sign, err := GetParamHmacSHA512Sign(p.secretKey, payload)
+//poloniex没有时间接口, 用响应头 Date 作为服务端时间
+func ServerTime(client *http.Client, baseUrl string) ServerTimeFunc {
+	return HttpDateServerTime(client, ResolveBaseUrl(BASE_URL, baseUrl)+PUBLIC_URI+fmt.Sprintf(ORDER_BOOK_API, "BTC_ETH", 1))
+}
+
+//签名后调用交易接口
+func (p *PoloApi) tradingApi(postData url.Values) ([]byte, error) {
+	signed, err := p.signer.Sign("POST", "/"+TRADE_URI, postData, p.clock.Now())
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	return HttpPostForm2(p.client, p.baseUrl+TRADE_URI, signed.Params, signed.Headers)
+}
+
+func errorKind(msg string) ErrorKind {
+	lower := strings.ToLower(msg)
+	switch {
+	case strings.Contains(lower, "api key") || strings.Contains(lower, "permission") || strings.Contains(lower, "nonce"):
+		return ERR_KIND_AUTH
+	case strings.Contains(lower, "not enough") || strings.Contains(lower, "insufficient"):
+		return ERR_KIND_INSUFFICIENT_FUNDS
+	case strings.Contains(lower, "please do not make more than"):
+		return ERR_KIND_RATE_LIMIT
+	case strings.Contains(lower, "invalid") || strings.Contains(lower, "not found") || strings.Contains(lower, "must be"):
+		return ERR_KIND_INVALID_REQUEST
+	}
+	return ERR_KIND_UNKNOWN
+}
+
+//出错时返回 {"error": "..."}
+func checkError(body []byte) error {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return &DecodeError{Err: errors.New("empty response"), Body: body}
+	}
+	if body[0] != '{' {
+		return nil
+	}
+
+	var r struct {
+		Error *string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &r); err != nil {
+		return &DecodeError{Err: err, Body: body}
+	}
+	if r.Error != nil {
+		return &ApiError{Exchange: EXCHANGE_NAME, Kind: errorKind(*r.Error), Message: *r.Error}
+	}
+	return nil
+}
+
+func decodeResponse(body []byte, result interface{}) error {
+	if err := checkError(body); err != nil {
+		return err
+	}
+	return DecodeJSON(body, result)
+}
+
+func parseSuccess(body []byte) (bool, error) {
+	var result struct {
+		Success JsonInt64 `json:"success"`
+		Message string    `json:"message"`
+	}
+	err := decodeResponse(body, &result)
+	if err != nil {
+		return false, err
+	}
+	if result.Success != 1 {
+		return false, &ApiError{Exchange: EXCHANGE_NAME, Kind: errorKind(result.Message), Message: string(body)}
+	}
+	return true, nil
+}
+
+func parseDepth(body []byte) (*Depth, error) {
+	var resp struct {
+		Asks JsonDepthEntries `json:"asks"`
+		Bids JsonDepthEntries `json:"bids"`
+	}
+	err := decodeResponse(body, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Asks == nil {
+		return nil, &DecodeError{Err: errors.New("missing asks"), Body: body}
+	}
+
+	var depth Depth
+	if depth.AskList, err = resp.Asks.DepthRecords(); err != nil {
+		return nil, &DecodeError{Err: err, Body: body}
+	}
+	if depth.BidList, err = resp.Bids.DepthRecords(); err != nil {
+		return nil, &DecodeError{Err: err, Body: body}
+	}
+	return &depth, nil
+}
+
+func parseTicker(body []byte, cp CurrencyPair) (*Ticker, error) {
+	var resp map[string]poloTicker
+	err := decodeResponse(body, &resp)
+	if err != nil {
+		return nil, err
+	}
+	t, ok := resp[cp.Symbol()]
+	if !ok {
+		return nil, &ApiError{Exchange: EXCHANGE_NAME, Kind: ERR_KIND_INVALID_REQUEST, Message: "unknown currency pair " + cp.Symbol()}
+	}
+
+	ticker := new(Ticker)
+	ticker.High = float64(t.High24hr)
+	ticker.Low = float64(t.Low24hr)
+	ticker.Last = float64(t.Last)
+	ticker.Buy = float64(t.HighestBid)
+	ticker.Sell = float64(t.LowestAsk)
+	ticker.Vol = float64(t.QuoteVolume)
+	return ticker, nil
+}
+
+func parseOrderTrades(body []byte) (*Order, error) {
+	var trades []struct {
+		Type   string      `json:"type"`
+		Rate   JsonFloat64 `json:"rate"`
+		Amount JsonFloat64 `json:"amount"`
+		Fee    JsonFloat64 `json:"fee"`
+	}
+	err := decodeResponse(body, &trades)
+	if err != nil {
+		return nil, err
+	}
+
+	order := new(Order)
+	total := 0.0
+	for _, v := range trades {
+		order.DealAmount += float64(v.Amount)
+		total += float64(v.Amount) * float64(v.Rate)
+		order.Fee = float64(v.Fee)
+
+		if strings.Compare("sell", v.Type) == 0 {
+			order.Side = TradeSide(SELL)
+		} else {
+			order.Side = TradeSide(BUY)
+		}
+	}
+	if order.DealAmount > 0 {
+		order.AvgPrice = total / order.DealAmount
+	}
+	return order, nil
+}
+
+//返回的成交按时间倒序, date 为UTC时间
+func parseTrades(body []byte, since int64) ([]Trade, error) {
+	var resp []struct {
+		TradeID JsonInt64   `json:"tradeID"`
+		Date    string      `json:"date"`
+		Type    string      `json:"type"`
+		Rate    JsonFloat64 `json:"rate"`
+		Amount  JsonFloat64 `json:"amount"`
+	}
+	err := decodeResponse(body, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	trades := make([]Trade, 0, len(resp))
+	for i := len(resp) - 1; i >= 0; i-- {
+		v := resp[i]
+		if int64(v.TradeID) <= since {
+			continue
+		}
+		date, err := time.Parse(DATE_FORMAT, v.Date)
+		if err != nil {
+			return nil, &DecodeError{Err: err, Body: body}
+		}
+		trades = append(trades, Trade{
+			Tid:    int64(v.TradeID),
+			Type:   v.Type,
+			Amount: float64(v.Amount),
+			Price:  float64(v.Rate),
+			Date:   date.UnixNano() / int64(time.Millisecond),
+		})
+	}
+	return trades, nil
+}
+
+//没有数据时返回一根date为0的K线; volume 为计价币成交额, quoteVolume 为币的成交量
+func parseChartData(body []byte) ([]Kline, error) {
+	var resp []struct {
+		Date        JsonInt64   `json:"date"`
+		High        JsonFloat64 `json:"high"`
+		Low         JsonFloat64 `json:"low"`
+		Open        JsonFloat64 `json:"open"`
+		Close       JsonFloat64 `json:"close"`
+		QuoteVolume JsonFloat64 `json:"quoteVolume"`
+	}
+	err := decodeResponse(body, &resp)
+	if err != nil {
+		return nil, err
 	}
-	return sign, nil
+
+	klines := make([]Kline, 0, len(resp))
+	for _, v := range resp {
+		if v.Date == 0 {
+			continue
+		}
+		klines = append(klines, Kline{
+			Timestamp: int64(v.Date),
+			Open:      float64(v.Open),
+			Close:     float64(v.Close),
+			High:      float64(v.High),
+			Low:       float64(v.Low),
+			Vol:       float64(v.QuoteVolume),
+		})
+	}
+	return klines, nil
+}
+
+func parseOpenOrders(body []byte) ([]Order, error) {
+	var orderAr []struct {
+		OrderNumber JsonInt64   `json:"orderNumber"`
+		Type        string      `json:"type"`
+		Rate        JsonFloat64 `json:"rate"`
+		Amount      JsonFloat64 `json:"amount"`
+	}
+	err := decodeResponse(body, &orderAr)
+	if err != nil {
+		return nil, err
+	}
+
+	orders := make([]Order, 0, len(orderAr))
+	for _, v := range orderAr {
+		order := Order{}
+		order.OrderID = int(v.OrderNumber)
+		order.Amount = float64(v.Amount)
+		order.Price = float64(v.Rate)
+		order.Status = ORDER_UNFINISHED
+		switch v.Type {
+		case "buy":
+			order.Side = TradeSide(BUY)
+		case "sell":
+			order.Side = TradeSide(SELL)
+		}
+		orders = append(orders, order)
+	}
+	return orders, nil
+}
+
+func parseAccount(body []byte) (*Account, error) {
+	var balances map[string]struct {
+		Available JsonFloat64 `json:"available"`
+		OnOrders  JsonFloat64 `json:"onOrders"`
+	}
+	err := decodeResponse(body, &balances)
+	if err != nil {
+		return nil, err
+	}
+
+	acc := new(Account)
+	acc.Exchange = EXCHANGE_NAME
+	acc.SubAccounts = make(map[string]SubAccount, len(balances))
+	for k, v := range balances {
+		subAcc := SubAccount{}
+		subAcc.Currency = k
+		subAcc.Amount = float64(v.Available)
+		subAcc.FrozenAmount = float64(v.OnOrders)
+		acc.SubAccounts[subAcc.Currency] = subAcc
+	}
+	return acc, nil
+}
+
+func parseCurrencies(body []byte) (map[string]*PoloniexCurrency, error) {
+	var currencies map[string]poloCurrency
+	err := decodeResponse(body, &currencies)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]*PoloniexCurrency, len(currencies))
+	for k, v := range currencies {
+		poloniexCurrency := new(PoloniexCurrency)
+		poloniexCurrency.ID = int(v.ID)
+		poloniexCurrency.Name = v.Name
+		poloniexCurrency.TxFee = float64(v.TxFee)
+		poloniexCurrency.MinConf = int(v.MinConf)
+		if v.DepositAddress != nil {
+			poloniexCurrency.DepositAddress = *v.DepositAddress
+		}
+		poloniexCurrency.Disabled = int(v.Disabled)
+		poloniexCurrency.Delisted = int(v.Delisted)
+		poloniexCurrency.Frozen = int(v.Frozen)
+		result[k] = poloniexCurrency
+	}
+	return result, nil
 }
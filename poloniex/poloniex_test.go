@@ -1,11 +1,210 @@
 package poloniex
 
 import (
-	"github.com/qct/cryptocurrency-exchange-api"
-	"github.com/qct/cryptocurrency-exchange-api/builder"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+	"github.com/qct/cryptocurrency-exchange-api/cassette"
+	"github.com/stretchr/testify/assert"
 )
 
-func main() {
-	api := builder.NewApiBuilder().Build(coinapi.POLONIEX)
-	api.LimitBuy("0.2", "21.0", coinapi.NewCurrencyPair("abc", "def"))
+//回放 testdata/cassettes 下的请求. 现有的cassette是按接口文档手写的合成数据, 设置 CASSETTE_RECORD=1 和 POLONIEX_API_KEY/POLONIEX_SECRET_KEY 时对真实接口录制并覆盖
+
+var btcEth = NewCurrencyPair("BTC", "ETH")
+
+func newTestApi(t *testing.T, name string) *PoloApi {
+	apiKey, secretKey := os.Getenv("POLONIEX_API_KEY"), os.Getenv("POLONIEX_SECRET_KEY")
+	recorder, err := cassette.New(filepath.Join("testdata", "cassettes", name+".json"), cassette.ModeFromEnv(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder.Redactor.AddSecret(apiKey, secretKey)
+	t.Cleanup(func() {
+		assert.NoError(t, recorder.Stop())
+	})
+	return NewWithNonce(recorder.Client(), apiKey, secretKey, NewMonotonicNonce())
+}
+
+func TestPoloApi_GetTicker(t *testing.T) {
+	ticker, err := newTestApi(t, "GetTicker").GetTicker(btcEth)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.07, ticker.Last)
+	assert.Equal(t, 0.0699, ticker.Buy)
+	assert.Equal(t, 0.0701, ticker.Sell)
+	assert.Equal(t, 0.072, ticker.High)
+	assert.Equal(t, 0.068, ticker.Low)
+	assert.Equal(t, 14285.7, ticker.Vol)
+}
+
+func TestPoloApi_GetDepth(t *testing.T) {
+	depth, err := newTestApi(t, "GetDepth").GetDepth(btcEth, 2)
+	assert.NoError(t, err)
+	assert.Len(t, depth.AskList, 2)
+	assert.Equal(t, 0.0701, depth.AskList[0].Price)
+	assert.Equal(t, 1.5, depth.AskList[0].Amount)
+	assert.Equal(t, 2.25, depth.BidList[0].Amount)
+}
+
+func TestPoloApi_GetAllCurrencies(t *testing.T) {
+	currencies, err := newTestApi(t, "GetAllCurrencies").GetAllCurrencies()
+	assert.NoError(t, err)
+	assert.Len(t, currencies, 2)
+	assert.Equal(t, &PoloniexCurrency{ID: 28, Name: "Bitcoin", TxFee: 0.0005, MinConf: 1}, currencies["BTC"])
+}
+
+//GetCurrency 从 GetAllCurrencies 的结果里查找
+func TestPoloApi_GetCurrency(t *testing.T) {
+	currency, err := newTestApi(t, "GetAllCurrencies").GetCurrency("xmr")
+	assert.NoError(t, err)
+	assert.Equal(t, "Monero", currency.Name)
+	assert.Equal(t, 6, currency.MinConf)
+	assert.Equal(t, REDACTED, currency.DepositAddress)
+}
+
+func TestPoloApi_LimitBuy(t *testing.T) {
+	order, err := newTestApi(t, "LimitBuy").LimitBuy("1.5", "0.07", btcEth)
+	assert.NoError(t, err)
+	assert.Equal(t, 31226040, order.OrderID)
+	assert.Equal(t, TradeSide(BUY), order.Side)
+	assert.Equal(t, 0.07, order.Price)
+	assert.Equal(t, 1.5, order.Amount)
+	assert.Equal(t, "BTC_ETH", order.CurrencyPair)
+}
+
+func TestPoloApi_LimitSell(t *testing.T) {
+	_, err := newTestApi(t, "LimitSell").LimitSell("100", "0.08", btcEth)
+	var apiErr *ApiError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, ErrorKind(ERR_KIND_INSUFFICIENT_FUNDS), apiErr.Kind)
+}
+
+func TestPoloApi_CancelOrder(t *testing.T) {
+	ok, err := newTestApi(t, "CancelOrder").CancelOrder("31226040", btcEth)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestPoloApi_GetOneOrder(t *testing.T) {
+	api := newTestApi(t, "GetOneOrder")
+	order, err := api.GetOneOrder("31226040", btcEth)
+	assert.NoError(t, err)
+	assert.Equal(t, 31226040, order.OrderID)
+	assert.Equal(t, TradeSide(BUY), order.Side)
+	assert.Equal(t, 1.5, order.DealAmount)
+	assert.InDelta(t, 0.0666667, order.AvgPrice, 1e-6)
+	assert.Equal(t, "BTC_ETH", order.CurrencyPair)
+	//有成交且不在未完成订单里
+	assert.Equal(t, TradeStatus(ORDER_FINISH), order.Status)
+	assert.Equal(t, 1.5, order.Amount)
+
+	//没有成交记录的订单从未完成订单里找
+	order, err = api.GetOneOrder("31226041", btcEth)
+	assert.NoError(t, err)
+	assert.Equal(t, 31226041, order.OrderID)
+	assert.Equal(t, TradeSide(SELL), order.Side)
+	assert.Equal(t, TradeStatus(ORDER_UNFINISHED), order.Status)
+
+	//有成交也在未完成订单里
+	order, err = api.GetOneOrder("31226042", btcEth)
+	assert.NoError(t, err)
+	assert.Equal(t, TradeStatus(ORDER_PART_FINISH), order.Status)
+	assert.Equal(t, 1.0, order.Amount)
+	assert.Equal(t, 0.5, order.DealAmount)
+	assert.Equal(t, 0.065, order.AvgPrice)
+
+	//成交记录为空也不在未完成订单里
+	order, err = api.GetOneOrder("31226043", btcEth)
+	assert.Nil(t, order)
+	var apiErr *ApiError
+	if assert.True(t, errors.As(err, &apiErr), "expected ApiError, got %v", err) {
+		assert.Equal(t, ErrorKind(ERR_KIND_INVALID_REQUEST), apiErr.Kind)
+	}
+}
+
+func TestPoloApi_GetTrades(t *testing.T) {
+	trades, err := newTestApi(t, "GetTrades").GetTrades(btcEth, 11)
+	assert.NoError(t, err)
+	assert.Equal(t, []Trade{
+		{Tid: 12, Type: "buy", Amount: 1.5, Price: 0.0702, Date: 1506816003000},
+		{Tid: 13, Type: "sell", Amount: 0.2, Price: 0.0701, Date: 1506816005000},
+	}, trades)
+}
+
+func TestPoloApi_GetKlineRecords(t *testing.T) {
+	klines, err := newTestApi(t, "GetKlineRecords").GetKlineRecords(btcEth, "5min", 2, 1506787200000)
+	assert.NoError(t, err)
+	assert.Equal(t, []Kline{
+		{Timestamp: 1506787200, Open: 0.07, Close: 0.0702, High: 0.0705, Low: 0.0698, Vol: 100.3},
+		{Timestamp: 1506787500, Open: 0.0702, Close: 0.0701, High: 0.0706, Low: 0.0701, Vol: 50},
+	}, klines)
+}
+
+func TestPoloApi_GetUnfinishedOrders(t *testing.T) {
+	orders, err := newTestApi(t, "GetUnfinishedOrders").GetUnfinishedOrders(btcEth)
+	assert.NoError(t, err)
+	assert.Len(t, orders, 2)
+	assert.Equal(t, Order{OrderID: 31226040, Amount: 1.5, Price: 0.07, Status: ORDER_UNFINISHED, Side: BUY, CurrencyPair: "BTC_ETH"}, orders[0])
+	assert.Equal(t, TradeSide(SELL), orders[1].Side)
+}
+
+func TestPoloApi_GetAccount(t *testing.T) {
+	account, err := newTestApi(t, "GetAccount").GetAccount()
+	assert.NoError(t, err)
+	assert.Equal(t, EXCHANGE_NAME, account.Exchange)
+	assert.Equal(t, SubAccount{Currency: "BTC", Amount: 0.5, FrozenAmount: 0.105}, account.SubAccounts["BTC"])
+	assert.Equal(t, SubAccount{Currency: "ETH", Amount: 12, FrozenAmount: 2}, account.SubAccounts["ETH"])
+}
+
+func TestPoloApi_Withdraw(t *testing.T) {
+	resp, err := newTestApi(t, "Withdraw").Withdraw("0.1", "btc", "", "1BoatSLRHtKNngkdXEeobR76b53LETtpyT", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"response":"Withdrew 0.10000000 BTC."}`, resp)
+}
+
+func TestPoloApi_GetDepositsWithdrawals(t *testing.T) {
+	records, err := newTestApi(t, "GetDepositsWithdrawals").GetDepositsWithdrawals("1506787200", "1506873600")
+	assert.NoError(t, err)
+	assert.Len(t, records.Deposits, 1)
+	assert.Equal(t, 0.5, records.Deposits[0].Amount)
+	assert.Equal(t, "COMPLETE", records.Deposits[0].Status)
+	assert.Len(t, records.Withdrawals, 1)
+	assert.Equal(t, int64(134933), records.Withdrawals[0].WithdrawalNumber)
+	assert.Equal(t, 0.1, records.Withdrawals[0].Amount)
+}
+
+func TestPoloApi_Transfer(t *testing.T) {
+	api := newTestApi(t, "Transfer")
+	transfer, err := api.Transfer("btc", "0.5", ACCOUNT_SPOT, ACCOUNT_MARGIN)
+	assert.NoError(t, err)
+	assert.Equal(t, &TransferResult{Currency: "BTC", Amount: 0.5, From: ACCOUNT_SPOT, To: ACCOUNT_MARGIN}, transfer)
+
+	_, err = api.Transfer("btc", "0.5", ACCOUNT_SPOT, ACCOUNT_FUTURES)
+	assertUnsupported(t, err)
+	assert.Contains(t, err.Error(), "FUTURES account")
+}
+
+//不访问网络的方法
+func TestPoloApi_Unsupported(t *testing.T) {
+	api := NewWithNonce(nil, "", "", NewMonotonicNonce())
+	assert.Equal(t, EXCHANGE_NAME, api.GetExchangeName())
+
+	_, err := api.MarketBuy("1", "", btcEth)
+	assertUnsupported(t, err)
+	_, err = api.MarketSell("1", "", btcEth)
+	assertUnsupported(t, err)
+	_, err = api.GetOrderHistory(btcEth, 1, 10)
+	assertUnsupported(t, err)
+	_, err = api.GetKlineRecords(btcEth, "1min", 10, 0)
+	assertUnsupported(t, err)
+}
+
+func assertUnsupported(t *testing.T, err error) {
+	var apiErr *ApiError
+	if assert.True(t, errors.As(err, &apiErr), "expected ApiError, got %v", err) {
+		assert.Equal(t, ErrorKind(ERR_KIND_UNSUPPORTED), apiErr.Kind)
+		assert.Equal(t, EXCHANGE_NAME, apiErr.Exchange)
+	}
 }
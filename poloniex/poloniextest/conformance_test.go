@@ -0,0 +1,20 @@
+package poloniextest
+
+import (
+	"testing"
+
+	"github.com/qct/cryptocurrency-exchange-api/apitest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_ApiConformance(t *testing.T) {
+	s := NewServer("key", "secret")
+	defer s.Close()
+	s.SetPrice("BTC_ETH", 0.05, 0.051)
+	s.SetBalance("BTC", 10)
+	s.SetBalance("ETH", 10)
+	api, err := s.Api()
+	assert.NoError(t, err)
+
+	apitest.TestApi(t, apitest.Config{Api: api, Pair: btcEth, Amount: 1, KlinePeriod: "5min"})
+}
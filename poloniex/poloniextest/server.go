@@ -0,0 +1,477 @@
+//poloniex 公共接口和交易接口的本地模拟, 用于不访问网络地测试 PoloApi.
+//服务端保存余额、挂单、成交和充提记录, 校验 Key/Sign 请求头的HmacSHA512签名, 并要求nonce严格递增.
+//行情由测试通过 SetPrice 设置, 价格变化时撮合挂单
+package poloniextest
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+	_ "github.com/qct/cryptocurrency-exchange-api/poloniex"
+)
+
+const (
+	PUBLIC_PATH = "/public"
+	TRADE_PATH  = "/tradingApi"
+)
+
+//返回的错误信息, 与交易所一致
+const (
+	ERR_INVALID_KEY     = "Invalid API key/secret pair."
+	ERR_INVALID_COMMAND = "Invalid command."
+	ERR_INVALID_PAIR    = "Invalid currency pair."
+	ERR_INVALID_ORDER   = "Invalid order number, or you are not the person who placed the order."
+	ERR_ORDER_NOT_FOUND = "Order not found, or you are not the person who placed it."
+	ERR_TOTAL_TOO_SMALL = "Total must be at least 0.0001."
+)
+
+//每档默认挂单量, 模拟盘口外的流动性
+const DEFAULT_LIQUIDITY = 1000
+
+type Server struct {
+	*httptest.Server
+	ApiKey    string
+	SecretKey string
+	MakerFee  float64          //挂单成交的手续费率, 从买到的币中扣除
+	TakerFee  float64          //吃单成交的手续费率
+	Now       func() time.Time //订单、成交和充提时间, 默认 time.Now
+
+	mu          sync.Mutex
+	nextId      int64
+	lastNonce   int64
+	markets     map[string]*market
+	currencies  map[string]PoloniexCurrency
+	available   map[string]float64 //exchange 账户
+	onOrders    map[string]float64
+	accounts    map[string]map[string]float64 //margin、lending 账户的余额
+	orders      []*order
+	fills       []fill
+	deposits    []transfer
+	withdrawals []transfer
+}
+
+type market struct {
+	id          int64
+	bid, ask    float64
+	last, open  float64
+	high, low   float64
+	baseVolume  float64
+	quoteVolume float64
+}
+
+type order struct {
+	id        int64
+	pair      string //BTC_ETH: 用BTC计价买卖ETH
+	side      string //buy, sell
+	rate      float64
+	amount    float64
+	remaining float64
+	date      time.Time
+}
+
+type fill struct {
+	tradeId     int64
+	orderNumber int64
+	pair        string
+	side        string
+	rate        float64
+	amount      float64
+	fee         float64 //费率
+	date        time.Time
+}
+
+type transfer struct {
+	id       int64
+	currency string
+	address  string
+	amount   float64
+	fee      float64
+	date     time.Time
+}
+
+//启动模拟服务, 只接受用apiKey/secretKey签名的请求
+func NewServer(apiKey, secretKey string) *Server {
+	s := &Server{
+		ApiKey:    apiKey,
+		SecretKey: secretKey,
+		MakerFee:  0.0015,
+		TakerFee:  0.0025,
+		Now:       time.Now,
+		nextId:    100000,
+		markets:   map[string]*market{},
+		currencies: map[string]PoloniexCurrency{
+			"BTC": {ID: 28, Name: "Bitcoin", TxFee: 0.0005, MinConf: 1},
+			"ETH": {ID: 267, Name: "Ethereum", TxFee: 0.005, MinConf: 35},
+			"LTC": {ID: 125, Name: "Litecoin", TxFee: 0.001, MinConf: 4},
+		},
+		available: map[string]float64{},
+		onOrders:  map[string]float64{},
+		accounts:  map[string]map[string]float64{"margin": {}, "lending": {}},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+//通过注册表构建指向模拟服务的 PoloApi
+func (s *Server) Api() (Api, error) {
+	driver, err := LookupApi(POLONIEX)
+	if err != nil {
+		return nil, err
+	}
+	return driver.New(ApiConfig{HttpClient: s.Client(), ApiKey: s.ApiKey, ApiSecretKey: s.SecretKey, BaseUrl: s.URL})
+}
+
+//设置 returnCurrencies 返回的币种信息, 提现手续费按 TxFee 扣除
+func (s *Server) SetCurrency(symbol string, currency PoloniexCurrency) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.currencies[strings.ToUpper(symbol)] = currency
+}
+
+//设置可用余额, currency 如 BTC
+func (s *Server) SetBalance(currency string, amount float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.available[strings.ToUpper(currency)] = amount
+}
+
+//可用和挂单冻结的余额
+func (s *Server) Balance(currency string) (available, onOrders float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	currency = strings.ToUpper(currency)
+	return s.available[currency], s.onOrders[currency]
+}
+
+//margin、lending 账户的余额, 由 transferBalance 从 exchange 账户转入
+func (s *Server) AccountBalance(account, currency string) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.accounts[account][strings.ToUpper(currency)]
+}
+
+//模拟一笔到账的充值, 出现在 returnDepositsWithdrawals 中
+func (s *Server) Deposit(currency string, amount float64, address string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	currency = strings.ToUpper(currency)
+	s.available[currency] += amount
+	s.deposits = append(s.deposits, transfer{id: s.newId(), currency: currency, address: address, amount: amount, date: s.Now()})
+}
+
+//设置交易对(如 BTC_ETH)的买一卖一价, 并撮合价格已经到达的挂单
+func (s *Server) SetPrice(pair string, bid, ask float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.markets[pair]
+	if !ok {
+		m = &market{id: int64(len(s.markets) + 1), open: (bid + ask) / 2, last: (bid + ask) / 2, high: ask, low: bid}
+		s.markets[pair] = m
+	}
+	m.bid, m.ask = bid, ask
+	for _, o := range s.orders {
+		if o.pair == pair && o.remaining > 0 {
+			s.matchOrder(o, false)
+		}
+	}
+}
+
+func (s *Server) newId() int64 {
+	s.nextId++
+	return s.nextId
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var resp interface{}
+	var errMsg string
+	switch {
+	case r.URL.Path == PUBLIC_PATH && r.Method == "GET":
+		resp, errMsg = s.public(r.URL.Query())
+	case r.URL.Path == TRADE_PATH && r.Method == "POST":
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp, errMsg = s.trading(r.Header, string(body))
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if errMsg != "" {
+		resp = map[string]string{"error": errMsg}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+type command func(s *Server, params url.Values) (interface{}, string)
+
+var publicCommands = map[string]command{
+	"returnTicker":       (*Server).returnTicker,
+	"returnOrderBook":    (*Server).returnOrderBook,
+	"returnCurrencies":   (*Server).returnCurrencies,
+	"returnTradeHistory": (*Server).returnTradeHistory,
+	"returnChartData":    (*Server).returnChartData,
+}
+
+var tradingCommands = map[string]command{
+	"buy":                       (*Server).buy,
+	"sell":                      (*Server).sell,
+	"cancelOrder":               (*Server).cancelOrder,
+	"returnOpenOrders":          (*Server).returnOpenOrders,
+	"returnOrderTrades":         (*Server).returnOrderTrades,
+	"returnCompleteBalances":    (*Server).returnCompleteBalances,
+	"withdraw":                  (*Server).withdraw,
+	"transferBalance":           (*Server).transferBalance,
+	"returnDepositsWithdrawals": (*Server).returnDepositsWithdrawals,
+}
+
+func (s *Server) public(params url.Values) (interface{}, string) {
+	cmd, ok := publicCommands[params.Get("command")]
+	if !ok {
+		return nil, ERR_INVALID_COMMAND
+	}
+	return cmd(s, params)
+}
+
+//签名是对请求体的HmacSHA512, nonce必须大于之前所有请求的nonce
+func (s *Server) trading(header http.Header, body string) (interface{}, string) {
+	mac := hmac.New(sha512.New, []byte(s.SecretKey))
+	mac.Write([]byte(body))
+	sign := hex.EncodeToString(mac.Sum(nil))
+	if header.Get("Key") != s.ApiKey || !hmac.Equal([]byte(strings.ToLower(header.Get("Sign"))), []byte(sign)) {
+		return nil, ERR_INVALID_KEY
+	}
+
+	params, err := url.ParseQuery(body)
+	if err != nil {
+		return nil, ERR_INVALID_COMMAND
+	}
+	nonce, err := strconv.ParseInt(params.Get("nonce"), 10, 64)
+	if err != nil || nonce <= s.lastNonce {
+		return nil, fmt.Sprintf("Nonce must be greater than %d. You provided %s.", s.lastNonce, params.Get("nonce"))
+	}
+	s.lastNonce = nonce
+
+	cmd, ok := tradingCommands[params.Get("command")]
+	if !ok {
+		return nil, ERR_INVALID_COMMAND
+	}
+	return cmd(s, params)
+}
+
+func (s *Server) returnTicker(params url.Values) (interface{}, string) {
+	tickers := map[string]interface{}{}
+	for pair, m := range s.markets {
+		change := 0.0
+		if m.open > 0 {
+			change = m.last/m.open - 1
+		}
+		tickers[pair] = map[string]interface{}{
+			"id":            m.id,
+			"last":          formatFloat(m.last),
+			"lowestAsk":     formatFloat(m.ask),
+			"highestBid":    formatFloat(m.bid),
+			"percentChange": formatFloat(change),
+			"baseVolume":    formatFloat(m.baseVolume),
+			"quoteVolume":   formatFloat(m.quoteVolume),
+			"isFrozen":      "0",
+			"high24hr":      formatFloat(m.high),
+			"low24hr":       formatFloat(m.low),
+		}
+	}
+	return tickers, ""
+}
+
+//asks按价格从低到高, bids从高到低; 盘口之外是挂单量为 DEFAULT_LIQUIDITY 的买一卖一, 加上账户自己的挂单
+func (s *Server) returnOrderBook(params url.Values) (interface{}, string) {
+	pair := params.Get("currencyPair")
+	m, ok := s.markets[pair]
+	if !ok {
+		return nil, ERR_INVALID_PAIR
+	}
+	asks := map[float64]float64{m.ask: DEFAULT_LIQUIDITY}
+	bids := map[float64]float64{m.bid: DEFAULT_LIQUIDITY}
+	for _, o := range s.orders {
+		if o.pair != pair || o.remaining <= 0 {
+			continue
+		}
+		if o.side == "buy" {
+			bids[o.rate] += o.remaining
+		} else {
+			asks[o.rate] += o.remaining
+		}
+	}
+	depth, err := strconv.Atoi(params.Get("depth"))
+	if err != nil {
+		depth = 50
+	}
+	return map[string]interface{}{
+		"asks":     bookLevels(asks, depth, false),
+		"bids":     bookLevels(bids, depth, true),
+		"isFrozen": "0",
+		"seq":      s.nextId,
+	}, ""
+}
+
+func bookLevels(levels map[float64]float64, depth int, desc bool) [][]interface{} {
+	prices := make([]float64, 0, len(levels))
+	for price := range levels {
+		prices = append(prices, price)
+	}
+	if desc {
+		sort.Sort(sort.Reverse(sort.Float64Slice(prices)))
+	} else {
+		sort.Float64s(prices)
+	}
+	if depth > 0 && len(prices) > depth {
+		prices = prices[:depth]
+	}
+
+	entries := make([][]interface{}, 0, len(prices))
+	for _, price := range prices {
+		entries = append(entries, []interface{}{formatFloat(price), levels[price]})
+	}
+	return entries
+}
+
+func (s *Server) returnCurrencies(params url.Values) (interface{}, string) {
+	currencies := map[string]interface{}{}
+	for symbol, c := range s.currencies {
+		var address interface{}
+		if c.DepositAddress != "" {
+			address = c.DepositAddress
+		}
+		currencies[symbol] = map[string]interface{}{
+			"id":             c.ID,
+			"name":           c.Name,
+			"txFee":          formatFloat(c.TxFee),
+			"minConf":        c.MinConf,
+			"depositAddress": address,
+			"disabled":       c.Disabled,
+			"delisted":       c.Delisted,
+			"frozen":         c.Frozen,
+		}
+	}
+	return currencies, ""
+}
+
+//按时间倒序返回最近的200笔成交; 指定 start/end(unix秒) 时返回区间内最多50000笔成交
+func (s *Server) returnTradeHistory(params url.Values) (interface{}, string) {
+	pair := params.Get("currencyPair")
+	if _, ok := s.markets[pair]; !ok {
+		return nil, ERR_INVALID_PAIR
+	}
+	start, end, errMsg := timeRange(params, false)
+	if errMsg != "" {
+		return nil, errMsg
+	}
+	limit := 200
+	if params.Get("start") != "" {
+		limit = 50000
+	}
+	trades := []map[string]interface{}{}
+	for i := len(s.fills) - 1; i >= 0 && len(trades) < limit; i-- {
+		f := s.fills[i]
+		if f.pair != pair || f.date.Unix() < start || f.date.Unix() > end {
+			continue
+		}
+		trades = append(trades, map[string]interface{}{
+			"globalTradeID": f.tradeId,
+			"tradeID":       f.tradeId,
+			"date":          f.date.UTC().Format(DATE_FORMAT),
+			"type":          f.side,
+			"rate":          formatFloat(f.rate),
+			"amount":        formatFloat(f.amount),
+			"total":         formatFloat(f.rate * f.amount),
+		})
+	}
+	return trades, ""
+}
+
+//returnChartData 支持的周期(秒)
+var chartPeriods = map[int64]bool{300: true, 900: true, 1800: true, 7200: true, 14400: true, 86400: true}
+
+//由成交生成K线, 没有成交的周期不返回; 区间内没有成交时与交易所一样返回一根全为0的K线
+func (s *Server) returnChartData(params url.Values) (interface{}, string) {
+	pair := params.Get("currencyPair")
+	if _, ok := s.markets[pair]; !ok {
+		return nil, ERR_INVALID_PAIR
+	}
+	period, err := strconv.ParseInt(params.Get("period"), 10, 64)
+	if err != nil || !chartPeriods[period] {
+		return nil, "Invalid period."
+	}
+	start, end, errMsg := timeRange(params, true)
+	if errMsg != "" {
+		return nil, errMsg
+	}
+
+	candles := []map[string]interface{}{}
+	var last map[string]interface{}
+	for _, f := range s.fills {
+		if f.pair != pair || f.date.Unix() < start || f.date.Unix() > end {
+			continue
+		}
+		date := f.date.Unix() - f.date.Unix()%period
+		if last == nil || last["date"] != date {
+			last = map[string]interface{}{"date": date, "open": f.rate, "high": f.rate, "low": f.rate, "volume": 0.0, "quoteVolume": 0.0}
+			candles = append(candles, last)
+		}
+		last["high"] = math.Max(last["high"].(float64), f.rate)
+		last["low"] = math.Min(last["low"].(float64), f.rate)
+		last["close"] = f.rate
+		last["volume"] = last["volume"].(float64) + f.rate*f.amount
+		last["quoteVolume"] = last["quoteVolume"].(float64) + f.amount
+		last["weightedAverage"] = last["volume"].(float64) / last["quoteVolume"].(float64)
+	}
+	if len(candles) == 0 {
+		candles = append(candles, map[string]interface{}{"date": 0, "high": 0, "low": 0, "open": 0, "close": 0, "volume": 0, "quoteVolume": 0, "weightedAverage": 0})
+	}
+	return candles, ""
+}
+
+//start/end 为unix秒, 包含两端; 不要求时没有指定的一端不限制
+func timeRange(params url.Values, required bool) (start, end int64, errMsg string) {
+	start, end = 0, math.MaxInt64
+	if v := params.Get("start"); v != "" || required {
+		if start, errMsg = parseTime(v); errMsg != "" {
+			return
+		}
+	}
+	if v := params.Get("end"); v != "" || required {
+		end, errMsg = parseTime(v)
+	}
+	return
+}
+
+func parseTime(v string) (int64, string) {
+	t, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, "Required parameter missing."
+	}
+	return t, ""
+}
+
+func formatFloat(v float64) string {
+	return fmt.Sprintf("%.8f", v)
+}
@@ -0,0 +1,243 @@
+package poloniextest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+	"github.com/qct/cryptocurrency-exchange-api/apitest"
+	"github.com/qct/cryptocurrency-exchange-api/poloniex"
+	"github.com/stretchr/testify/assert"
+)
+
+var btcEth = NewCurrencyPair("BTC", "ETH")
+
+//每次都返回同一个值, 用来模拟nonce重复
+type fixedNonce int64
+
+func (n fixedNonce) Next(min int64) (int64, error) {
+	return int64(n), nil
+}
+
+func TestServer_Trading(t *testing.T) {
+	s := NewServer("key", "secret")
+	defer s.Close()
+	s.SetPrice("BTC_ETH", 0.05, 0.051)
+	s.SetBalance("BTC", 1)
+	s.SetBalance("ETH", 10)
+	api, err := s.Api()
+	assert.NoError(t, err)
+
+	ticker, err := api.GetTicker(btcEth)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.05, ticker.Buy)
+	assert.Equal(t, 0.051, ticker.Sell)
+
+	//低于卖一的买单挂在盘口上, 冻结BTC
+	order, err := api.LimitBuy("2", "0.049", btcEth)
+	assert.NoError(t, err)
+	available, onOrders := s.Balance("BTC")
+	assert.InDelta(t, 0.902, available, 1e-9)
+	assert.InDelta(t, 0.098, onOrders, 1e-9)
+	depth, err := api.GetDepth(btcEth, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.049, depth.BidList[1].Price)
+	assert.Equal(t, 2.0, depth.BidList[1].Amount)
+
+	//还没有成交时 GetOneOrder 从未完成订单里找
+	unfinished, err := api.GetOneOrder(fmtId(order), btcEth)
+	assert.NoError(t, err)
+	assert.Equal(t, order.OrderID, unfinished.OrderID)
+	assert.Equal(t, TradeStatus(ORDER_UNFINISHED), unfinished.Status)
+
+	//价格穿过挂单后按挂单价成交, 扣挂单手续费
+	s.SetPrice("BTC_ETH", 0.048, 0.0485)
+	filled, err := api.GetOneOrder(fmtId(order), btcEth)
+	assert.NoError(t, err)
+	assert.Equal(t, TradeStatus(ORDER_FINISH), filled.Status)
+	assert.Equal(t, 2.0, filled.DealAmount)
+	assert.Equal(t, 0.049, filled.AvgPrice)
+	assert.Equal(t, s.MakerFee, filled.Fee)
+	available, _ = s.Balance("ETH")
+	assert.InDelta(t, 10+2*(1-s.MakerFee), available, 1e-9)
+	_, onOrders = s.Balance("BTC")
+	assert.InDelta(t, 0, onOrders, 1e-9)
+
+	//可以立即成交的卖单按买一成交, 扣吃单手续费
+	_, err = api.LimitSell("1", "0.04", btcEth)
+	assert.NoError(t, err)
+	available, _ = s.Balance("BTC")
+	assert.InDelta(t, 0.902+0.048*(1-s.TakerFee), available, 1e-9)
+
+	_, err = api.LimitSell("100", "0.04", btcEth)
+	apitest.AssertErrorKind(t, err, ERR_KIND_INSUFFICIENT_FUNDS)
+	_, err = api.LimitBuy("0.001", "0.04", btcEth)
+	apitest.AssertErrorKind(t, err, ERR_KIND_INVALID_REQUEST)
+
+	//撤单解冻
+	order, err = api.LimitSell("1", "0.06", btcEth)
+	assert.NoError(t, err)
+	orders, err := api.GetUnfinishedOrders(btcEth)
+	assert.NoError(t, err)
+	assert.Len(t, orders, 1)
+	assert.Equal(t, TradeSide(SELL), orders[0].Side)
+	ok, err := api.CancelOrder(fmtId(order), btcEth)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	_, err = api.CancelOrder(fmtId(order), btcEth)
+	apitest.AssertErrorKind(t, err, ERR_KIND_INVALID_REQUEST)
+
+	account, err := api.GetAccount()
+	assert.NoError(t, err)
+	assert.InDelta(t, 10+2*(1-s.MakerFee)-1, account.SubAccounts["ETH"].Amount, 1e-8)
+	assert.Equal(t, 0.0, account.SubAccounts["ETH"].FrozenAmount)
+}
+
+func TestServer_Transfers(t *testing.T) {
+	s := NewServer("key", "secret")
+	defer s.Close()
+	s.SetBalance("ETH", 2)
+	s.Deposit("ETH", 5, "0xdeposit")
+	api, err := s.Api()
+	assert.NoError(t, err)
+	polo := api.(*poloniex.PoloApi)
+
+	currency, err := polo.GetCurrency("eth")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.005, currency.TxFee)
+
+	_, err = api.Withdraw("3", "eth", "", "0xwithdraw", "", "")
+	assert.NoError(t, err)
+	available, _ := s.Balance("ETH")
+	assert.InDelta(t, 4, available, 1e-9)
+	_, err = api.Withdraw("5", "eth", "", "0xwithdraw", "", "")
+	apitest.AssertErrorKind(t, err, ERR_KIND_INSUFFICIENT_FUNDS)
+}
+
+func TestServer_TransferBalance(t *testing.T) {
+	s := NewServer("key", "secret")
+	defer s.Close()
+	s.SetBalance("BTC", 1)
+	api, err := s.Api()
+	assert.NoError(t, err)
+	transfer, ok := api.(TransferApi)
+	if !assert.True(t, ok) {
+		return
+	}
+
+	result, err := transfer.Transfer("btc", "0.4", ACCOUNT_SPOT, ACCOUNT_MARGIN)
+	assert.NoError(t, err)
+	assert.Equal(t, &TransferResult{Currency: "BTC", Amount: 0.4, From: ACCOUNT_SPOT, To: ACCOUNT_MARGIN}, result)
+	available, _ := s.Balance("BTC")
+	assert.InDelta(t, 0.6, available, 1e-9)
+	assert.InDelta(t, 0.4, s.AccountBalance("margin", "BTC"), 1e-9)
+
+	_, err = transfer.Transfer("btc", "0.1", ACCOUNT_MARGIN, ACCOUNT_LENDING)
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.3, s.AccountBalance("margin", "BTC"), 1e-9)
+	assert.InDelta(t, 0.1, s.AccountBalance("lending", "BTC"), 1e-9)
+
+	_, err = transfer.Transfer("btc", "1", ACCOUNT_MARGIN, ACCOUNT_SPOT)
+	apitest.AssertErrorKind(t, err, ERR_KIND_INSUFFICIENT_FUNDS)
+	_, err = transfer.Transfer("xyz", "1", ACCOUNT_SPOT, ACCOUNT_MARGIN)
+	assert.Error(t, err)
+	available, _ = s.Balance("BTC")
+	assert.InDelta(t, 0.6, available, 1e-9)
+}
+
+func TestServer_DepositsWithdrawals(t *testing.T) {
+	s := NewServer("key", "secret")
+	defer s.Close()
+	s.Deposit("ETH", 5, "0xdeposit")
+	api, err := s.Api()
+	assert.NoError(t, err)
+	_, err = api.Withdraw("1", "ETH", "", "0xwithdraw", "", "")
+	assert.NoError(t, err)
+
+	polo := api.(*poloniex.PoloApi)
+	records, err := polo.GetDepositsWithdrawals("", "")
+	assert.NoError(t, err)
+	if assert.Len(t, records.Deposits, 1) {
+		assert.Equal(t, 5.0, records.Deposits[0].Amount)
+		assert.Equal(t, "COMPLETE", records.Deposits[0].Status)
+	}
+	if assert.Len(t, records.Withdrawals, 1) {
+		assert.Equal(t, "0xwithdraw", records.Withdrawals[0].Address)
+		assert.Equal(t, 1.0, records.Withdrawals[0].Amount)
+	}
+
+	records, err = polo.GetDepositsWithdrawals("0", "1")
+	assert.NoError(t, err)
+	assert.Empty(t, records.Deposits)
+	assert.Empty(t, records.Withdrawals)
+}
+
+//成交记录和K线由账户自己的成交生成
+func TestServer_MarketData(t *testing.T) {
+	s := NewServer("key", "secret")
+	defer s.Close()
+	now := time.Date(2017, 10, 1, 0, 0, 0, 0, time.UTC)
+	s.Now = func() time.Time { return now }
+	s.SetPrice("BTC_ETH", 0.05, 0.051)
+	s.SetBalance("BTC", 1)
+	s.SetBalance("ETH", 10)
+	api, err := s.Api()
+	assert.NoError(t, err)
+
+	_, err = api.LimitBuy("1", "0.052", btcEth)
+	assert.NoError(t, err)
+	now = now.Add(time.Minute)
+	_, err = api.LimitSell("1", "0.04", btcEth)
+	assert.NoError(t, err)
+	now = now.Add(6 * time.Minute)
+	_, err = api.LimitBuy("2", "0.06", btcEth)
+	assert.NoError(t, err)
+
+	trades, err := api.GetTrades(btcEth, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, trades, 3) {
+		assert.Equal(t, Trade{Tid: trades[0].Tid, Type: "buy", Amount: 1, Price: 0.051, Date: 1506816000000}, trades[0])
+		assert.Equal(t, Trade{Tid: trades[1].Tid, Type: "sell", Amount: 1, Price: 0.05, Date: 1506816060000}, trades[1])
+		trades, err = api.GetTrades(btcEth, trades[1].Tid)
+		assert.NoError(t, err)
+		assert.Len(t, trades, 1)
+	}
+
+	klines, err := api.GetKlineRecords(btcEth, "5min", 10, 1506816000000)
+	assert.NoError(t, err)
+	assert.Equal(t, []Kline{
+		{Timestamp: 1506816000, Open: 0.051, Close: 0.05, High: 0.051, Low: 0.05, Vol: 2},
+		{Timestamp: 1506816300, Open: 0.051, Close: 0.051, High: 0.051, Low: 0.051, Vol: 2},
+	}, klines)
+	klines, err = api.GetKlineRecords(btcEth, "5min", 10, 1506817200000)
+	assert.NoError(t, err)
+	assert.Empty(t, klines)
+	_, err = api.GetKlineRecords(btcEth, "1min", 10, 0)
+	apitest.AssertErrorKind(t, err, ERR_KIND_UNSUPPORTED)
+}
+
+func TestServer_VerifySignature(t *testing.T) {
+	s := NewServer("key", "secret")
+	defer s.Close()
+	driver, err := LookupApi(POLONIEX)
+	assert.NoError(t, err)
+
+	api, err := driver.New(ApiConfig{HttpClient: s.Client(), ApiKey: "key", ApiSecretKey: "wrong", BaseUrl: s.URL})
+	assert.NoError(t, err)
+	_, err = api.GetAccount()
+	apitest.AssertErrorKind(t, err, ERR_KIND_AUTH)
+
+	//重复的nonce被拒绝
+	api, err = driver.New(ApiConfig{HttpClient: s.Client(), ApiKey: "key", ApiSecretKey: "secret", BaseUrl: s.URL, Nonce: fixedNonce(1)})
+	assert.NoError(t, err)
+	_, err = api.GetAccount()
+	assert.NoError(t, err)
+	_, err = api.GetAccount()
+	apitest.AssertErrorKind(t, err, ERR_KIND_AUTH)
+	assert.Equal(t, ErrorKind(ERR_KIND_AUTH), ClassifyError(err))
+}
+
+func fmtId(order *Order) string {
+	return fmt.Sprintf("%d", order.OrderID)
+}
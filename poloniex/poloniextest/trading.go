@@ -0,0 +1,365 @@
+package poloniextest
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//比较金额时容忍的浮点误差
+const epsilon = 1e-9
+
+const DATE_FORMAT = "2006-01-02 15:04:05"
+
+//BTC_ETH => BTC(计价), ETH(交易的币)
+func splitPair(pair string) (quote, coin string) {
+	i := strings.Index(pair, "_")
+	if i < 0 {
+		return pair, ""
+	}
+	return pair[:i], pair[i+1:]
+}
+
+func parseAmount(params url.Values, name string) (float64, string) {
+	amount, err := strconv.ParseFloat(params.Get(name), 64)
+	if err != nil || amount <= 0 {
+		return 0, fmt.Sprintf("Invalid %s parameter.", name)
+	}
+	return amount, ""
+}
+
+func (f *fill) json() map[string]interface{} {
+	return map[string]interface{}{
+		"globalTradeID": f.tradeId,
+		"tradeID":       f.tradeId,
+		"currencyPair":  f.pair,
+		"type":          f.side,
+		"rate":          formatFloat(f.rate),
+		"amount":        formatFloat(f.amount),
+		"total":         formatFloat(f.rate * f.amount),
+		"fee":           formatFloat(f.fee),
+		"date":          f.date.UTC().Format(DATE_FORMAT),
+	}
+}
+
+func (s *Server) buy(params url.Values) (interface{}, string) {
+	return s.placeOrder("buy", params)
+}
+
+func (s *Server) sell(params url.Values) (interface{}, string) {
+	return s.placeOrder("sell", params)
+}
+
+//冻结资金后立即按盘口撮合, 没成交的挂在服务端等 SetPrice
+func (s *Server) placeOrder(side string, params url.Values) (interface{}, string) {
+	pair := params.Get("currencyPair")
+	if _, ok := s.markets[pair]; !ok {
+		return nil, ERR_INVALID_PAIR
+	}
+	rate, errMsg := parseAmount(params, "rate")
+	if errMsg != "" {
+		return nil, errMsg
+	}
+	amount, errMsg := parseAmount(params, "amount")
+	if errMsg != "" {
+		return nil, errMsg
+	}
+	total := rate * amount
+	if total < 0.0001 {
+		return nil, ERR_TOTAL_TOO_SMALL
+	}
+
+	quote, coin := splitPair(pair)
+	if side == "buy" {
+		if s.available[quote]+epsilon < total {
+			return nil, fmt.Sprintf("Not enough %s.", quote)
+		}
+		s.available[quote] -= total
+		s.onOrders[quote] += total
+	} else {
+		if s.available[coin]+epsilon < amount {
+			return nil, fmt.Sprintf("Not enough %s.", coin)
+		}
+		s.available[coin] -= amount
+		s.onOrders[coin] += amount
+	}
+
+	o := &order{id: s.newId(), pair: pair, side: side, rate: rate, amount: amount, remaining: amount, date: s.Now()}
+	s.orders = append(s.orders, o)
+	trades := []map[string]interface{}{}
+	if f := s.matchOrder(o, true); f != nil {
+		trades = append(trades, map[string]interface{}{
+			"tradeID": fmt.Sprintf("%d", f.tradeId),
+			"type":    f.side,
+			"rate":    formatFloat(f.rate),
+			"amount":  formatFloat(f.amount),
+			"total":   formatFloat(f.rate * f.amount),
+			"date":    f.date.UTC().Format(DATE_FORMAT),
+		})
+	}
+	return map[string]interface{}{"orderNumber": fmt.Sprintf("%d", o.id), "resultingTrades": trades}, ""
+}
+
+//taker为true时是新下的单, 按对手价成交并收 TakerFee; 否则是挂单被价格穿过, 按挂单价成交并收 MakerFee.
+//手续费从买到的币中扣除
+func (s *Server) matchOrder(o *order, taker bool) *fill {
+	m := s.markets[o.pair]
+	price, fee := o.rate, s.MakerFee
+	switch {
+	case o.side == "buy" && m.ask > 0 && o.rate >= m.ask:
+		if taker {
+			price, fee = m.ask, s.TakerFee
+		}
+		quote, coin := splitPair(o.pair)
+		s.onOrders[quote] -= o.rate * o.remaining
+		s.available[quote] += (o.rate - price) * o.remaining
+		s.available[coin] += o.remaining * (1 - fee)
+	case o.side == "sell" && m.bid > 0 && o.rate <= m.bid:
+		if taker {
+			price, fee = m.bid, s.TakerFee
+		}
+		quote, coin := splitPair(o.pair)
+		s.onOrders[coin] -= o.remaining
+		s.available[quote] += price * o.remaining * (1 - fee)
+	default:
+		return nil
+	}
+
+	f := fill{tradeId: s.newId(), orderNumber: o.id, pair: o.pair, side: o.side, rate: price, amount: o.remaining, fee: fee, date: s.Now()}
+	s.fills = append(s.fills, f)
+	o.remaining = 0
+
+	m.last = price
+	if price > m.high {
+		m.high = price
+	}
+	if price < m.low {
+		m.low = price
+	}
+	m.baseVolume += price * f.amount
+	m.quoteVolume += f.amount
+	return &f
+}
+
+func (s *Server) findOrder(orderNumber string) *order {
+	for _, o := range s.orders {
+		if fmt.Sprintf("%d", o.id) == orderNumber {
+			return o
+		}
+	}
+	return nil
+}
+
+//撤单后解冻未成交部分
+func (s *Server) cancelOrder(params url.Values) (interface{}, string) {
+	o := s.findOrder(params.Get("orderNumber"))
+	if o == nil || o.remaining <= 0 {
+		return nil, ERR_INVALID_ORDER
+	}
+	quote, coin := splitPair(o.pair)
+	if o.side == "buy" {
+		s.onOrders[quote] -= o.rate * o.remaining
+		s.available[quote] += o.rate * o.remaining
+	} else {
+		s.onOrders[coin] -= o.remaining
+		s.available[coin] += o.remaining
+	}
+	amount := o.remaining
+	o.remaining = 0
+	return map[string]interface{}{
+		"success": 1,
+		"amount":  formatFloat(amount),
+		"message": fmt.Sprintf("Order #%d canceled.", o.id),
+	}, ""
+}
+
+func (s *Server) openOrders(pair string) []map[string]interface{} {
+	orders := []map[string]interface{}{}
+	for _, o := range s.orders {
+		if o.pair != pair || o.remaining <= 0 {
+			continue
+		}
+		orders = append(orders, map[string]interface{}{
+			"orderNumber":    fmt.Sprintf("%d", o.id),
+			"type":           o.side,
+			"rate":           formatFloat(o.rate),
+			"startingAmount": formatFloat(o.amount),
+			"amount":         formatFloat(o.remaining),
+			"total":          formatFloat(o.rate * o.remaining),
+			"date":           o.date.UTC().Format(DATE_FORMAT),
+			"margin":         0,
+		})
+	}
+	return orders
+}
+
+//currencyPair 为 all 时按交易对返回
+func (s *Server) returnOpenOrders(params url.Values) (interface{}, string) {
+	pair := params.Get("currencyPair")
+	if pair != "all" {
+		if _, ok := s.markets[pair]; !ok {
+			return nil, ERR_INVALID_PAIR
+		}
+		return s.openOrders(pair), ""
+	}
+	all := map[string]interface{}{}
+	for pair := range s.markets {
+		all[pair] = s.openOrders(pair)
+	}
+	return all, ""
+}
+
+//没有成交记录的订单返回错误
+func (s *Server) returnOrderTrades(params url.Values) (interface{}, string) {
+	orderNumber := params.Get("orderNumber")
+	trades := []map[string]interface{}{}
+	for i := range s.fills {
+		if fmt.Sprintf("%d", s.fills[i].orderNumber) == orderNumber {
+			trades = append(trades, s.fills[i].json())
+		}
+	}
+	if len(trades) == 0 {
+		return nil, ERR_ORDER_NOT_FOUND
+	}
+	return trades, ""
+}
+
+//btcValue 按 BTC_XXX 的最新成交价折算
+func (s *Server) returnCompleteBalances(params url.Values) (interface{}, string) {
+	currencies := map[string]bool{}
+	for _, balances := range []map[string]float64{s.available, s.onOrders} {
+		for currency := range balances {
+			currencies[currency] = true
+		}
+	}
+	for currency := range s.currencies {
+		currencies[currency] = true
+	}
+
+	balances := map[string]interface{}{}
+	for currency := range currencies {
+		total := s.available[currency] + s.onOrders[currency]
+		btcValue := 0.0
+		if currency == "BTC" {
+			btcValue = total
+		} else if m, ok := s.markets["BTC_"+currency]; ok {
+			btcValue = total * m.last
+		}
+		balances[currency] = map[string]string{
+			"available": formatFloat(s.available[currency]),
+			"onOrders":  formatFloat(s.onOrders[currency]),
+			"btcValue":  formatFloat(btcValue),
+		}
+	}
+	return balances, ""
+}
+
+//提现立即完成, 手续费按币种的 TxFee 记录
+func (s *Server) withdraw(params url.Values) (interface{}, string) {
+	currency := strings.ToUpper(params.Get("currency"))
+	c, ok := s.currencies[currency]
+	if !ok || c.Disabled != 0 {
+		return nil, "Invalid currency."
+	}
+	address := params.Get("address")
+	if address == "" {
+		return nil, "Required parameter missing."
+	}
+	amount, errMsg := parseAmount(params, "amount")
+	if errMsg != "" {
+		return nil, errMsg
+	}
+	if s.available[currency]+epsilon < amount {
+		return nil, fmt.Sprintf("Not enough %s.", currency)
+	}
+	s.available[currency] -= amount
+	s.withdrawals = append(s.withdrawals, transfer{id: s.newId(), currency: currency, address: address, amount: amount, fee: c.TxFee, date: s.Now()})
+	return map[string]string{"response": fmt.Sprintf("Withdrew %.8f %s.", amount, currency)}, ""
+}
+
+//在 exchange、margin、lending 账户之间划转可用余额
+func (s *Server) transferBalance(params url.Values) (interface{}, string) {
+	currency := strings.ToUpper(params.Get("currency"))
+	if _, ok := s.currencies[currency]; !ok {
+		return nil, "Invalid currency."
+	}
+	amount, errMsg := parseAmount(params, "amount")
+	if errMsg != "" {
+		return nil, errMsg
+	}
+	from, to := s.balances(params.Get("fromAccount")), s.balances(params.Get("toAccount"))
+	if from == nil || to == nil || params.Get("fromAccount") == params.Get("toAccount") {
+		return nil, "Invalid account."
+	}
+	if from[currency]+epsilon < amount {
+		return nil, fmt.Sprintf("Not enough %s.", currency)
+	}
+	from[currency] -= amount
+	to[currency] += amount
+	return map[string]interface{}{
+		"success": 1,
+		"message": fmt.Sprintf("Transferred %s %s from %s to %s account.", params.Get("amount"), currency, params.Get("fromAccount"), params.Get("toAccount")),
+	}, ""
+}
+
+//账户的可用余额, 未知的账户返回nil
+func (s *Server) balances(account string) map[string]float64 {
+	if account == "exchange" {
+		return s.available
+	}
+	return s.accounts[account]
+}
+
+//start/end 为unix时间戳(秒), 包含两端
+func (s *Server) returnDepositsWithdrawals(params url.Values) (interface{}, string) {
+	start, err := strconv.ParseInt(params.Get("start"), 10, 64)
+	if err != nil {
+		return nil, "Required parameter missing."
+	}
+	end, err := strconv.ParseInt(params.Get("end"), 10, 64)
+	if err != nil {
+		return nil, "Required parameter missing."
+	}
+	inRange := func(t time.Time) bool {
+		return t.Unix() >= start && t.Unix() <= end
+	}
+
+	deposits := []map[string]interface{}{}
+	for _, d := range s.deposits {
+		if inRange(d.date) {
+			deposits = append(deposits, map[string]interface{}{
+				"currency":      d.currency,
+				"address":       d.address,
+				"amount":        formatFloat(d.amount),
+				"confirmations": s.currencies[d.currency].MinConf,
+				"txid":          txid(d.id),
+				"timestamp":     d.date.Unix(),
+				"status":        "COMPLETE",
+			})
+		}
+	}
+	withdrawals := []map[string]interface{}{}
+	for _, w := range s.withdrawals {
+		if inRange(w.date) {
+			withdrawals = append(withdrawals, map[string]interface{}{
+				"withdrawalNumber": w.id,
+				"currency":         w.currency,
+				"address":          w.address,
+				"amount":           formatFloat(w.amount),
+				"fee":              formatFloat(w.fee),
+				"timestamp":        w.date.Unix(),
+				"status":           "COMPLETE: " + txid(w.id),
+				"ipAddress":        "127.0.0.1",
+				"txid":             txid(w.id),
+				"confirmations":    s.currencies[w.currency].MinConf,
+			})
+		}
+	}
+	return map[string]interface{}{"deposits": deposits, "withdrawals": withdrawals}, ""
+}
+
+func txid(id int64) string {
+	return fmt.Sprintf("%064x", id)
+}
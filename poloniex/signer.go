@@ -0,0 +1,40 @@
+package poloniex
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+)
+
+//poloniex: 对带nonce的参数串做HmacSHA512, 通过 Key/Sign 请求头传递
+type ApiSigner struct {
+	Credentials CredentialProvider
+	Nonce       NonceProvider //为nil时直接使用时间戳
+}
+
+func (s *ApiSigner) Sign(method, path string, params url.Values, timestamp time.Time) (*SignedRequest, error) {
+	credentials, err := s.Credentials.Credentials()
+	if err != nil {
+		return nil, err
+	}
+	signed := CopyValues(params)
+	if signed.Get("nonce") == "" {
+		nonce := timestamp.UnixNano() + 500000000000
+		if s.Nonce != nil {
+			if nonce, err = s.Nonce.Next(nonce); err != nil {
+				return nil, err
+			}
+		}
+		signed.Set("nonce", fmt.Sprintf("%d", nonce))
+	}
+	sign, err := GetParamHmacSHA512Sign(credentials.ApiSecretKey, signed.Encode())
+	if err != nil {
+		return nil, err
+	}
+	headers := map[string]string{
+		"Key":  credentials.ApiKey,
+		"Sign": sign}
+	return &SignedRequest{Params: signed, Headers: headers}, nil
+}
@@ -0,0 +1,37 @@
+package poloniex
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	. "github.com/qct/cryptocurrency-exchange-api"
+	"github.com/stretchr/testify/assert"
+)
+
+//Poloniex 的文档只说明 Sign 是 POST 参数串的 HMAC-SHA512, 没有公布示例签名.
+//这里断言签名的是完整的请求体, HMAC-SHA512 本身由 sign_util_test 中 RFC 4231 的向量验证
+func TestApiSigner_Sign(t *testing.T) {
+	params := url.Values{}
+	params.Set("command", "returnBalances")
+	params.Set("nonce", "1500000000000000000")
+
+	signer := &ApiSigner{Credentials: StaticCredentials{ApiKey: "key", ApiSecretKey: "secret"}}
+	signed, err := signer.Sign("POST", "/tradingApi", params, time.Unix(0, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, "key", signed.Headers["Key"])
+	expected, _ := GetParamHmacSHA512Sign("secret", "command=returnBalances&nonce=1500000000000000000")
+	assert.Equal(t, expected, signed.Headers["Sign"])
+	assert.Equal(t, "command=returnBalances&nonce=1500000000000000000", signed.Params.Encode())
+}
+
+func TestApiSigner_SignNonce(t *testing.T) {
+	params := url.Values{}
+	params.Set("command", "returnBalances")
+
+	signer := &ApiSigner{Credentials: StaticCredentials{ApiKey: "key", ApiSecretKey: "secret"}}
+	signed, err := signer.Sign("POST", "/tradingApi", params, time.Unix(1, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, "501000000000", signed.Params.Get("nonce"))
+	assert.Empty(t, params.Get("nonce"))
+}
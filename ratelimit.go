@@ -0,0 +1,188 @@
+package coinapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+)
+
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+//令牌桶限频策略
+type RateLimitPolicy struct {
+	Rate    float64        //每秒补充的令牌数
+	Burst   int            //桶容量
+	Weights map[string]int //接口权重, key见 RequestEndpoint(如 trade.do、poloniex 的 returnBalances), 未配置的接口权重为1
+}
+
+func (p RateLimitPolicy) Weight(endpoint string) int {
+	if w, ok := p.Weights[endpoint]; ok && w > 0 {
+		return w
+	}
+	return 1
+}
+
+func normalizePolicy(policy RateLimitPolicy) RateLimitPolicy {
+	if policy.Burst <= 0 {
+		policy.Burst = 1
+	}
+	return policy
+}
+
+type RateLimiter struct {
+	mu     sync.Mutex
+	policy RateLimitPolicy
+	tokens float64
+	last   time.Time
+}
+
+func NewRateLimiter(policy RateLimitPolicy) *RateLimiter {
+	policy = normalizePolicy(policy)
+	return &RateLimiter{policy: policy, tokens: float64(policy.Burst), last: time.Now()}
+}
+
+func (l *RateLimiter) Policy() RateLimitPolicy {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.policy
+}
+
+//修改限频策略, 已经积累的令牌保留, 但不超过新的桶容量
+func (l *RateLimiter) SetPolicy(policy RateLimitPolicy) {
+	policy = normalizePolicy(policy)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(time.Now())
+	l.policy = policy
+	if l.tokens > float64(policy.Burst) {
+		l.tokens = float64(policy.Burst)
+	}
+}
+
+//不等待, 令牌不足时直接返回false
+func (l *RateLimiter) Allow(weight int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(time.Now())
+	if l.tokens >= float64(weight) {
+		l.tokens -= float64(weight)
+		return true
+	}
+	return false
+}
+
+//等待直到拿到weight个令牌.
+//ctx 被标记为 fail fast(见 WithRateLimitFailFast), 或者 ctx 的 deadline 早于可用时间时, 立即返回 ErrRateLimited
+func (l *RateLimiter) Wait(ctx context.Context, weight int) error {
+	l.mu.Lock()
+	if l.policy.Rate <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	l.refill(now)
+	need := float64(weight)
+	if l.tokens >= need {
+		l.tokens -= need
+		l.mu.Unlock()
+		return nil
+	}
+
+	delay := time.Duration((need - l.tokens) / l.policy.Rate * float64(time.Second))
+	if isRateLimitFailFast(ctx) {
+		l.mu.Unlock()
+		return ErrRateLimited
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(now.Add(delay)) {
+		l.mu.Unlock()
+		return ErrRateLimited
+	}
+	l.tokens -= need //预占令牌, 排在后面的请求会等待更久
+	l.mu.Unlock()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.tokens += need
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (l *RateLimiter) refill(now time.Time) {
+	elapsed := now.Sub(l.last).Seconds()
+	l.last = now
+	if elapsed <= 0 {
+		return
+	}
+	l.tokens += elapsed * l.policy.Rate
+	if l.tokens > float64(l.policy.Burst) {
+		l.tokens = float64(l.policy.Burst)
+	}
+}
+
+type rateLimitFailFastKey struct{}
+
+//令牌不足时不等待, 直接返回 ErrRateLimited
+func WithRateLimitFailFast(ctx context.Context) context.Context {
+	return context.WithValue(ctx, rateLimitFailFastKey{}, true)
+}
+
+func isRateLimitFailFast(ctx context.Context) bool {
+	failFast, _ := ctx.Value(rateLimitFailFastKey{}).(bool)
+	return failFast
+}
+
+var (
+	sharedLimitersMu sync.Mutex
+	sharedLimiters   = map[string]*RateLimiter{}
+)
+
+//同一个交易所、同一个apiKey共用一个限频器. 限频器按第一次传入的policy配置;
+//之后传入不同的policy时不会修改已有的限频器(否则会改变之前构建的api的限频), 只记一条警告日志
+func SharedRateLimiter(exchange, apiKey string, policy RateLimitPolicy) *RateLimiter {
+	key := exchange + "|" + apiKey
+	sharedLimitersMu.Lock()
+	defer sharedLimitersMu.Unlock()
+	if l, ok := sharedLimiters[key]; ok {
+		if current := l.Policy(); !reflect.DeepEqual(current, normalizePolicy(policy)) {
+			DefaultLogger.Warn("shared rate limiter already configured, ignoring different policy", "exchange", exchange,
+				"rate", current.Rate, "burst", current.Burst, "ignored_rate", policy.Rate, "ignored_burst", policy.Burst)
+		}
+		return l
+	}
+	l := NewRateLimiter(policy)
+	sharedLimiters[key] = l
+	return l
+}
+
+//拿到令牌后调用, method 为发起请求的adapter方法(见 ApiMethod), endpoint 见 RequestEndpoint, wait 为等待令牌的时间
+type RateLimitObserver func(method, endpoint string, wait time.Duration)
+
+//请求发出前按接口权重从限频器取令牌
+func RateLimit(limiter *RateLimiter, failFast bool, observers ...RateLimitObserver) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			ctx := req.Context()
+			if failFast {
+				ctx = WithRateLimitFailFast(ctx)
+			}
+			endpoint := RequestEndpoint(req)
+			start := time.Now()
+			if err := limiter.Wait(ctx, limiter.Policy().Weight(endpoint)); err != nil {
+				return nil, err
+			}
+			for _, observe := range observers {
+				observe(ApiMethod(ctx), endpoint, time.Since(start))
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package coinapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	l := NewRateLimiter(RateLimitPolicy{Rate: 1, Burst: 3})
+	assert.True(t, l.Allow(2))
+	assert.False(t, l.Allow(2))
+	assert.True(t, l.Allow(1))
+	assert.False(t, l.Allow(1))
+
+	//Burst 不大于0时按1处理
+	l = NewRateLimiter(RateLimitPolicy{Rate: 1})
+	assert.Equal(t, 1, l.Policy().Burst)
+	assert.True(t, l.Allow(1))
+	assert.False(t, l.Allow(1))
+}
+
+func TestRateLimiter_Wait(t *testing.T) {
+	l := NewRateLimiter(RateLimitPolicy{Rate: 20, Burst: 1})
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, l.Wait(context.Background(), 1))
+	}
+	//第一个令牌在桶里, 之后每个等50ms
+	elapsed := time.Since(start)
+	assert.True(t, elapsed >= 90*time.Millisecond, "elapsed %v", elapsed)
+	assert.True(t, elapsed < time.Second, "elapsed %v", elapsed)
+
+	//Rate 为0时不限频
+	l = NewRateLimiter(RateLimitPolicy{})
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, l.Wait(context.Background(), 1))
+	}
+}
+
+//等待中被取消时归还预占的令牌, 不影响后面的请求
+func TestRateLimiter_WaitCanceled(t *testing.T) {
+	l := NewRateLimiter(RateLimitPolicy{Rate: 10, Burst: 1})
+	assert.True(t, l.Allow(1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	assert.Equal(t, context.Canceled, l.Wait(ctx, 5))
+
+	start := time.Now()
+	assert.NoError(t, l.Wait(context.Background(), 1))
+	elapsed := time.Since(start)
+	assert.True(t, elapsed < 150*time.Millisecond, "refund missing, waited %v", elapsed)
+}
+
+func TestRateLimiter_FailFast(t *testing.T) {
+	l := NewRateLimiter(RateLimitPolicy{Rate: 1, Burst: 1})
+	assert.NoError(t, l.Wait(WithRateLimitFailFast(context.Background()), 1))
+	assert.Equal(t, ErrRateLimited, l.Wait(WithRateLimitFailFast(context.Background()), 1))
+
+	//deadline 早于令牌可用的时间
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, ErrRateLimited, l.Wait(ctx, 1))
+
+	//被拒绝的请求不占用令牌
+	l.SetPolicy(RateLimitPolicy{Rate: 100, Burst: 1})
+	time.Sleep(15 * time.Millisecond)
+	assert.True(t, l.Allow(1))
+}
+
+func TestSharedRateLimiter(t *testing.T) {
+	a := SharedRateLimiter("ratelimit_test", "key", RateLimitPolicy{Rate: 1, Burst: 2})
+	assert.Equal(t, a, SharedRateLimiter("ratelimit_test", "key", RateLimitPolicy{Rate: 1, Burst: 2}))
+	assert.NotEqual(t, a, SharedRateLimiter("ratelimit_test", "other", RateLimitPolicy{Rate: 1, Burst: 2}))
+
+	//后传入的不同policy不改变已有的限频器, 只记警告日志
+	var buf bytes.Buffer
+	logger := DefaultLogger
+	DefaultLogger = NewTextLogger(&buf, LOG_DEBUG)
+	defer func() { DefaultLogger = logger }()
+	b := SharedRateLimiter("ratelimit_test", "key", RateLimitPolicy{Rate: 5, Burst: 1, Weights: map[string]int{"trade.do": 2}})
+	assert.True(t, a == b)
+	assert.Equal(t, 1.0, a.Policy().Rate)
+	assert.Equal(t, 2, a.Policy().Burst)
+	assert.Equal(t, 1, a.Policy().Weight("trade.do"))
+	assert.Contains(t, buf.String(), "ignoring different policy")
+	assert.NotContains(t, buf.String(), "key")
+	assert.True(t, a.Allow(1))
+	assert.True(t, a.Allow(1))
+	assert.False(t, a.Allow(1))
+}
+
+func TestRateLimit_Middleware(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer s.Close()
+
+	var endpoints []string
+	l := NewRateLimiter(RateLimitPolicy{Rate: 1, Burst: 3, Weights: map[string]int{"trade.do": 3}})
+	client := WithMiddleware(s.Client(), RateLimit(l, true, func(method, endpoint string, wait time.Duration) {
+		endpoints = append(endpoints, method+" "+endpoint)
+	}))
+	client = WithMiddleware(client, TagApiMethod("GetTicker"))
+	_, err := HttpGetBytes(client, s.URL+"/api/v1/trade.do")
+	assert.NoError(t, err)
+	_, err = HttpGetBytes(client, s.URL+"/api/v1/ticker.do")
+	assert.True(t, errors.Is(err, ErrRateLimited), "%v", err)
+	assert.Equal(t, []string{"GetTicker trade.do"}, endpoints)
+}
@@ -0,0 +1,140 @@
+package coinapi
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const REDACTED = "***"
+
+//默认会被打码的参数名/字段名(不区分大小写), 覆盖各交易所签名和提现接口用到的字段
+var SensitiveFields = []string{
+	"apiKey", "api_key", "accesskey", "access_key", "key",
+	"secretKey", "secret_key", "secret", "sign", "signature",
+	"trade_pwd", "tradePwd", "safePwd", "password", "passphrase",
+}
+
+//RedactAddresses 为true时额外打码的字段
+var AddressFields = []string{"address", "addr", "withdraw_address", "receiveAddr", "paymentId"}
+
+//去掉日志和错误信息里的key、签名、交易密码, 以及可选的充提地址.
+//能识别 a=b&c=d 形式的表单/查询串、"a":"b" 形式的json, 以及通过 AddSecret 登记的原文
+type Redactor struct {
+	RedactAddresses bool
+
+	mu      sync.RWMutex
+	secrets []string
+}
+
+var DefaultRedactor = &Redactor{}
+
+//用 DefaultRedactor 打码
+func Redact(s string) string {
+	return DefaultRedactor.Redact(s)
+}
+
+var (
+	sensitivePatterns = fieldPatterns(SensitiveFields)
+	addressPatterns   = fieldPatterns(AddressFields)
+	//btc/ltc base58、bech32 和 eth 地址
+	addressValuePattern = regexp.MustCompile(`\b([13LM][1-9A-HJ-NP-Za-km-z]{25,34}|(bc|ltc)1[02-9ac-hj-np-z]{11,71}|0x[0-9a-fA-F]{40})\b`)
+)
+
+//登记需要在任何地方都打码的原文, 如apiKey本身
+func (r *Redactor) AddSecret(secrets ...string) {
+	if r.known(secrets) {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, secret := range secrets {
+		//太短的值打码会误伤正常文本
+		if len(secret) < 6 || containsString(r.secrets, secret) {
+			continue
+		}
+		r.secrets = append(r.secrets, secret)
+	}
+	//先替换长的, 避免一个secret是另一个的前缀时只替换了一半
+	sort.Slice(r.secrets, func(i, j int) bool { return len(r.secrets[i]) > len(r.secrets[j]) })
+}
+
+//每次签名都会登记key, 已经登记过时只需要读锁
+func (r *Redactor) known(secrets []string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, secret := range secrets {
+		if len(secret) >= 6 && !containsString(r.secrets, secret) {
+			return false
+		}
+	}
+	return true
+}
+
+//把provider每次返回的key都登记到redactor, 轮换后的新key同样会被打码
+func RedactedCredentials(provider CredentialProvider, redactor *Redactor) CredentialProvider {
+	return redactedCredentials{provider, redactor}
+}
+
+type redactedCredentials struct {
+	provider CredentialProvider
+	redactor *Redactor
+}
+
+func (c redactedCredentials) Credentials() (Credentials, error) {
+	credentials, err := c.provider.Credentials()
+	if err == nil {
+		c.redactor.AddSecret(credentials.ApiKey, credentials.ApiSecretKey)
+	}
+	return credentials, err
+}
+
+func (r *Redactor) Redact(s string) string {
+	if s == "" {
+		return s
+	}
+	r.mu.RLock()
+	for _, secret := range r.secrets {
+		s = strings.Replace(s, secret, REDACTED, -1)
+	}
+	r.mu.RUnlock()
+
+	s = redactFields(s, sensitivePatterns)
+	if r.RedactAddresses {
+		s = redactFields(s, addressPatterns)
+		s = addressValuePattern.ReplaceAllString(s, REDACTED)
+	}
+	return s
+}
+
+type fieldPattern struct {
+	form *regexp.Regexp
+	json *regexp.Regexp
+}
+
+func fieldPatterns(fields []string) fieldPattern {
+	quoted := make([]string, len(fields))
+	for i, f := range fields {
+		quoted[i] = regexp.QuoteMeta(f)
+	}
+	names := strings.Join(quoted, "|")
+	return fieldPattern{
+		form: regexp.MustCompile(`(?i)((?:^|[?&\s,;])(?:` + names + `)=)[^&\s"',;]*`),
+		json: regexp.MustCompile(`(?i)("(?:` + names + `)"\s*:\s*)("(?:[^"\\]|\\.)*"|[^,}\]\s]+)`),
+	}
+}
+
+func redactFields(s string, p fieldPattern) string {
+	s = p.form.ReplaceAllString(s, "${1}"+REDACTED)
+	return p.json.ReplaceAllString(s, `${1}"`+REDACTED+`"`)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package coinapi
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var secretValues = []string{"my-api-key-123", "my-secret-456", "SIGN0123456789ABCDEF", "tradepass", "safepass"}
+
+func assertNoSecrets(t *testing.T, s string) {
+	for _, secret := range secretValues {
+		assert.False(t, strings.Contains(s, secret), "%q leaks %q", s, secret)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	for _, s := range []string{
+		//okcoin.cn / okex 的签名表单
+		"amount=1&apiKey=my-api-key-123&sign=SIGN0123456789ABCDEF&symbol=btc_cny",
+		"api_key=my-api-key-123&secret_key=my-secret-456&symbol=btc_usd",
+		//chbtc、okcoin 提现
+		"accesskey=my-api-key-123&method=withdraw&safePwd=safepass&sign=SIGN0123456789ABCDEF",
+		"https://www.okcoin.cn/api/v1/withdraw.do?trade_pwd=tradepass&apiKey=my-api-key-123",
+		//json 和请求头
+		`{"Key":"my-api-key-123","Sign":"SIGN0123456789ABCDEF","nested":{"trade_pwd":"tradepass"}}`,
+		`{"api_key": "my-api-key-123", "secret": "my-secret-456"}`,
+	} {
+		redacted := Redact(s)
+		assertNoSecrets(t, redacted)
+		assert.Contains(t, redacted, REDACTED)
+	}
+	assert.Equal(t, "symbol=btc_cny&type=buy", Redact("symbol=btc_cny&type=buy"))
+	assert.Equal(t, "amount=1&apiKey=***&sign=***&symbol=btc_cny", Redact("amount=1&apiKey=my-api-key-123&sign=SIGN0123456789ABCDEF&symbol=btc_cny"))
+}
+
+func TestRedact_SecretsAndAddresses(t *testing.T) {
+	redactor := &Redactor{}
+	redactor.AddSecret("my-api-key-123", "abc")
+	assert.Equal(t, "invalid key *** abc", redactor.Redact("invalid key my-api-key-123 abc"))
+
+	body := `{"deposits":[{"currency":"BTC","address":"1BoatSLRHtKNngkdXEeobR76b53LETtpyT","amount":"1.5"}]}`
+	assert.Equal(t, body, redactor.Redact(body))
+	redactor.RedactAddresses = true
+	assert.Equal(t, `{"deposits":[{"currency":"BTC","address":"***","amount":"1.5"}]}`, redactor.Redact(body))
+	assert.Equal(t, "sent to ***", redactor.Redact("sent to 0x52908400098527886E0F7030069857D2E4169EE7"))
+}
+
+func TestRedact_Errors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"bad request","api_key":"my-api-key-123","sign":"SIGN0123456789ABCDEF"}`))
+	}))
+	url := ts.URL + "/api/v1/withdraw.do?api_key=my-api-key-123&trade_pwd=tradepass"
+
+	_, err := HttpGetBytes(ts.Client(), url)
+	assert.Error(t, err)
+	assertNoSecrets(t, err.Error())
+
+	_, err = HttpGetBytes(ts.Client(), "http://127.0.0.1:1/?apiKey=my-api-key-123&safePwd=safepass")
+	assert.Error(t, err)
+	assertNoSecrets(t, err.Error())
+
+	err = DecodeJSON([]byte(`{"apiKey":"my-api-key-123",`), &struct{}{})
+	assertNoSecrets(t, err.Error())
+
+	err = &ApiError{Exchange: "okcoin.cn", Message: "invalid sign=SIGN0123456789ABCDEF"}
+	assertNoSecrets(t, err.Error())
+
+	//请求日志
+	var buf bytes.Buffer
+	ts.Close()
+	client := WithMiddleware(ts.Client(), LogRequests(NewTextLogger(&buf, LOG_DEBUG), "x"))
+	HttpGetBytes(client, url)
+	assert.NotEmpty(t, buf.String())
+	assertNoSecrets(t, buf.String())
+}
@@ -0,0 +1,129 @@
+package coinapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var ErrUnsupportedExchange = errors.New("unsupported exchange")
+
+//构建api所需的配置
+type ApiConfig struct {
+	HttpClient   *http.Client
+	ApiKey       string
+	ApiSecretKey string
+	Credentials  CredentialProvider //不为nil时优先于 ApiKey/ApiSecretKey
+	BaseUrl      string             //替换交易所默认的 协议://主机/ 部分, 用于指向本地的模拟服务, 为空时使用默认地址
+	Nonce        NonceProvider      //为nil时使用 SharedNonceProvider
+}
+
+func (c ApiConfig) CredentialProvider() CredentialProvider {
+	if c.Credentials != nil {
+		return c.Credentials
+	}
+	return StaticCredentials{ApiKey: c.ApiKey, ApiSecretKey: c.ApiSecretKey}
+}
+
+//现货交易所的注册信息, 由各交易所包在 init() 中调用 RegisterApi 注册
+type ApiDriver struct {
+	New              func(config ApiConfig) (Api, error)
+	DefaultRateLimit RateLimitPolicy
+	ServerTime       func(client *http.Client, baseUrl string) ServerTimeFunc //可选, 用于同步服务端时间
+}
+
+type FutureApiDriver struct {
+	New              func(config ApiConfig) (FutureApi, error)
+	DefaultRateLimit RateLimitPolicy
+	ServerTime       func(client *http.Client, baseUrl string) ServerTimeFunc
+}
+
+var (
+	driversMu     sync.RWMutex
+	apiDrivers    = map[string]ApiDriver{}
+	futureDrivers = map[string]FutureApiDriver{}
+)
+
+//重复注册同一交易所会panic
+func RegisterApi(exName string, driver ApiDriver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	if driver.New == nil {
+		panic("coinapi: RegisterApi driver.New is nil for " + exName)
+	}
+	if _, dup := apiDrivers[exName]; dup {
+		panic("coinapi: RegisterApi called twice for " + exName)
+	}
+	apiDrivers[exName] = driver
+}
+
+func RegisterFutureApi(exName string, driver FutureApiDriver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	if driver.New == nil {
+		panic("coinapi: RegisterFutureApi driver.New is nil for " + exName)
+	}
+	if _, dup := futureDrivers[exName]; dup {
+		panic("coinapi: RegisterFutureApi called twice for " + exName)
+	}
+	futureDrivers[exName] = driver
+}
+
+func LookupApi(exName string) (ApiDriver, error) {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	driver, ok := apiDrivers[exName]
+	if !ok {
+		return ApiDriver{}, fmt.Errorf("%w: %s", ErrUnsupportedExchange, exName)
+	}
+	return driver, nil
+}
+
+func LookupFutureApi(exName string) (FutureApiDriver, error) {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	driver, ok := futureDrivers[exName]
+	if !ok {
+		return FutureApiDriver{}, fmt.Errorf("%w: %s", ErrUnsupportedExchange, exName)
+	}
+	return driver, nil
+}
+
+//已注册的现货交易所, 按名称排序
+func Apis() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	names := make([]string, 0, len(apiDrivers))
+	for name := range apiDrivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func FutureApis() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	names := make([]string, 0, len(futureDrivers))
+	for name := range futureDrivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//用baseUrl替换defaultUrl的 协议://主机 部分, 保留defaultUrl的路径. baseUrl为空时返回defaultUrl
+func ResolveBaseUrl(defaultUrl, baseUrl string) string {
+	if baseUrl == "" {
+		return defaultUrl
+	}
+	u, err := url.Parse(defaultUrl)
+	if err != nil {
+		return defaultUrl
+	}
+	return strings.TrimSuffix(baseUrl, "/") + u.Path
+}
@@ -0,0 +1,107 @@
+package coinapi
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+type RetryPolicy struct {
+	MaxAttempts     int           //总调用次数(含第一次), <=0 表示不限, 由 MaxElapsedTime 控制; 两者都不限时按 UNBOUNDED_RETRY_MAX_ATTEMPTS
+	InitialInterval time.Duration //第一次重试前的等待时间
+	MaxInterval     time.Duration //单次等待时间上限
+	Multiplier      float64       //每次重试等待时间的增长倍数
+	Jitter          float64       //等待时间随机浮动比例, 0~1
+	MaxElapsedTime  time.Duration //从第一次调用开始的总耗时上限, 0 表示不限
+	Idempotent      bool          //为false时只重试确定没有被交易所处理的错误, 用于下单等非幂等操作
+
+	OnRetry func(attempt int, err error, wait time.Duration) //每次重试前回调, 可用于记录日志
+}
+
+//查询类接口的默认重试策略
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:     5,
+	InitialInterval: 200 * time.Millisecond,
+	MaxInterval:     5 * time.Second,
+	Multiplier:      2,
+	Jitter:          0.2,
+	MaxElapsedTime:  30 * time.Second,
+	Idempotent:      true,
+}
+
+//MaxAttempts 和 MaxElapsedTime 都不限时的调用次数上限, 避免交易所持续出错时无限重试
+const UNBOUNDED_RETRY_MAX_ATTEMPTS = 10
+
+//按策略调用fn直到成功, 返回最后一次的错误. 用法:
+//
+//	var orders []Order
+//	err := Retry(ctx, DefaultRetryPolicy, func() (err error) {
+//		orders, err = api.GetUnfinishedOrders(cp)
+//		return
+//	})
+//
+//下单时把 Idempotent 设为false, 只重试没有发到交易所的请求, 避免重复下单
+func Retry(ctx context.Context, policy RetryPolicy, fn func() error) error {
+	if policy.MaxAttempts <= 0 && policy.MaxElapsedTime <= 0 {
+		policy.MaxAttempts = UNBOUNDED_RETRY_MAX_ATTEMPTS
+	}
+	start := time.Now()
+	interval := policy.InitialInterval
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !policy.shouldRetry(err) {
+			return err
+		}
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			return err
+		}
+
+		wait := policy.jitter(interval)
+		var httpErr *HttpError
+		if errors.As(err, &httpErr) && httpErr.RetryAfter > wait {
+			wait = httpErr.RetryAfter //交易所要求的等待时间优先
+		}
+		if policy.MaxElapsedTime > 0 && time.Since(start)+wait > policy.MaxElapsedTime {
+			return err
+		}
+		if policy.OnRetry != nil {
+			policy.OnRetry(attempt, err, wait)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		interval = policy.next(interval)
+	}
+}
+
+func (p RetryPolicy) shouldRetry(err error) bool {
+	if p.Idempotent {
+		return IsRetryable(err)
+	}
+	return IsNotDelivered(err)
+}
+
+func (p RetryPolicy) next(interval time.Duration) time.Duration {
+	if p.Multiplier > 1 {
+		interval = time.Duration(float64(interval) * p.Multiplier)
+	}
+	if p.MaxInterval > 0 && interval > p.MaxInterval {
+		interval = p.MaxInterval
+	}
+	return interval
+}
+
+func (p RetryPolicy) jitter(interval time.Duration) time.Duration {
+	if p.Jitter <= 0 || interval <= 0 {
+		return interval
+	}
+	delta := p.Jitter * float64(interval)
+	return time.Duration(float64(interval) - delta + rand.Float64()*2*delta)
+}
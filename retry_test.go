@@ -0,0 +1,147 @@
+package coinapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errServer = &HttpError{StatusCode: 503, Status: "503 Service Unavailable"}
+
+//记录每次重试前的等待时间
+func retryWaits(policy RetryPolicy, fn func() error) ([]time.Duration, error) {
+	var waits []time.Duration
+	policy.OnRetry = func(attempt int, err error, wait time.Duration) {
+		waits = append(waits, wait)
+	}
+	err := Retry(context.Background(), policy, fn)
+	return waits, err
+}
+
+func TestRetry_Backoff(t *testing.T) {
+	calls := 0
+	policy := RetryPolicy{MaxAttempts: 5, InitialInterval: time.Millisecond, MaxInterval: 5 * time.Millisecond, Multiplier: 2, Idempotent: true}
+	waits, err := retryWaits(policy, func() error {
+		calls++
+		return errServer
+	})
+	assert.Equal(t, errServer, err)
+	assert.Equal(t, 5, calls)
+	assert.Equal(t, []time.Duration{time.Millisecond, 2 * time.Millisecond, 4 * time.Millisecond, 5 * time.Millisecond}, waits)
+
+	//成功或者不可重试的错误立即返回
+	calls = 0
+	waits, err = retryWaits(policy, func() error {
+		calls++
+		if calls == 2 {
+			return nil
+		}
+		return errServer
+	})
+	assert.NoError(t, err)
+	assert.Len(t, waits, 1)
+	invalid := &ApiError{Kind: ERR_KIND_INVALID_REQUEST}
+	waits, err = retryWaits(policy, func() error {
+		return invalid
+	})
+	assert.Equal(t, invalid, err)
+	assert.Empty(t, waits)
+}
+
+func TestRetry_Jitter(t *testing.T) {
+	policy := RetryPolicy{Jitter: 0.2}
+	for i := 0; i < 1000; i++ {
+		wait := policy.jitter(100 * time.Millisecond)
+		assert.True(t, wait >= 80*time.Millisecond && wait <= 120*time.Millisecond, "wait %v", wait)
+	}
+	assert.Equal(t, 100*time.Millisecond, RetryPolicy{}.jitter(100*time.Millisecond))
+}
+
+//Retry-After 比退避时间长时按 Retry-After 等待
+func TestRetry_RetryAfter(t *testing.T) {
+	limited := &HttpError{StatusCode: 429, Status: "429 Too Many Requests", RetryAfter: 20 * time.Millisecond}
+	policy := RetryPolicy{MaxAttempts: 3, InitialInterval: time.Millisecond, Multiplier: 2, Idempotent: true}
+	waits, err := retryWaits(policy, func() error {
+		return limited
+	})
+	assert.Equal(t, limited, err)
+	assert.Equal(t, []time.Duration{20 * time.Millisecond, 20 * time.Millisecond}, waits)
+
+	limited.RetryAfter = time.Millisecond
+	policy.InitialInterval = 10 * time.Millisecond
+	waits, _ = retryWaits(policy, func() error {
+		return limited
+	})
+	assert.Equal(t, []time.Duration{10 * time.Millisecond, 20 * time.Millisecond}, waits)
+}
+
+func TestRetry_ContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	calls := 0
+	start := time.Now()
+	err := Retry(ctx, RetryPolicy{InitialInterval: time.Hour, MaxElapsedTime: 2 * time.Hour, Idempotent: true}, func() error {
+		calls++
+		return errServer
+	})
+	assert.Equal(t, errServer, err)
+	assert.Equal(t, 1, calls)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestRetry_MaxElapsedTime(t *testing.T) {
+	calls := 0
+	waits, err := retryWaits(RetryPolicy{InitialInterval: 30 * time.Millisecond, MaxElapsedTime: 75 * time.Millisecond, Idempotent: true}, func() error {
+		calls++
+		return errServer
+	})
+	assert.Equal(t, errServer, err)
+	//正常情况下调用3次; 机器繁忙、sleep 超时较多时可能提前在第2次停止, 但计划的等待总和不会超过上限
+	assert.True(t, calls == 2 || calls == 3, "calls %d", calls)
+	total := time.Duration(0)
+	for _, wait := range waits {
+		total += wait
+	}
+	assert.True(t, total <= 75*time.Millisecond, "waits %v", waits)
+
+	//没有任何上限时按 UNBOUNDED_RETRY_MAX_ATTEMPTS 停止
+	calls = 0
+	err = Retry(context.Background(), RetryPolicy{Idempotent: true}, func() error {
+		calls++
+		return errServer
+	})
+	assert.Equal(t, errServer, err)
+	assert.Equal(t, UNBOUNDED_RETRY_MAX_ATTEMPTS, calls)
+}
+
+//非幂等操作只重试没有发到交易所的请求
+func TestRetry_NotIdempotent(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, InitialInterval: time.Millisecond}
+	for _, c := range []struct {
+		err   error
+		calls int
+	}{
+		{ErrRateLimited, 3},
+		{&HttpError{StatusCode: 429, Status: "429 Too Many Requests"}, 3},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, 3},
+		{&net.DNSError{Err: "no such host", Name: "www.okcoin.cn"}, 3},
+		{errServer, 1},
+		{io.ErrUnexpectedEOF, 1},
+		{&net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}, 1},
+		{errors.New("unknown"), 1},
+	} {
+		calls := 0
+		err := Retry(context.Background(), policy, func() error {
+			calls++
+			return c.err
+		})
+		assert.Equal(t, c.err, err)
+		assert.Equal(t, c.calls, calls, "%v", c.err)
+	}
+}
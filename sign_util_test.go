@@ -0,0 +1,37 @@
+package coinapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//各交易所签名用到的摘要算法, 期望值取自算法规范中公布的测试向量.
+//交易所本身没有公布可以复现的签名结果, 各 signer_test 在这些算法之上验证参数的拼接方式
+func TestSignUtil_PublishedVectors(t *testing.T) {
+	jefe, data := "Jefe", "what do ya want for nothing?"
+	for _, c := range []struct {
+		name     string
+		sign     func(secret, params string) (string, error)
+		secret   string
+		params   string
+		expected string
+	}{
+		//RFC 1321 附录 A.5
+		{"md5", GetParamMD5Sign, "", "abc", "900150983cd24fb0d6963f7d28e17f72"},
+		//FIPS 180-2 附录 A.1
+		{"sha1", func(_, params string) (string, error) { return GetSHA(params) }, "", "abc", "a9993e364706816aba3e25717850c26c9cd0d89d"},
+		//RFC 2104 附录 / RFC 2202 test case 2
+		{"hmac-md5", GetParamHmacMD5Sign, jefe, data, "750c783e6ab0b503eaa86e310a5db738"},
+		//RFC 2202 test case 2
+		{"hmac-sha1", GetParamHmacSHA1Sign, jefe, data, "effcdf6ae5eb2fa2d27416d5f184df9c259a7c79"},
+		//RFC 4231 test case 2
+		{"hmac-sha256", GetParamHmacSHA256Sign, jefe, data, "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"},
+		{"hmac-sha512", GetParamHmacSHA512Sign, jefe, data, "164b7a7bfcf819e2e395fbe73b56e0a387bd64222e831fd610270cd7ea250554" +
+			"9758bf75c05a994a6d034f65f8f0e6fdcaeab1a34d4a6b4b636e070a38bce737"},
+	} {
+		sign, err := c.sign(c.secret, c.params)
+		assert.NoError(t, err)
+		assert.Equal(t, c.expected, sign, c.name)
+	}
+}
@@ -0,0 +1,26 @@
+package coinapi
+
+import (
+	"net/url"
+	"time"
+)
+
+//签名后的请求参数和请求头
+type SignedRequest struct {
+	Params  url.Values
+	Headers map[string]string
+}
+
+//请求签名, 每个交易所一个实现.
+//method、path 为http方法和请求路径, params 为业务参数(不会被修改), timestamp 为请求时间
+type Signer interface {
+	Sign(method, path string, params url.Values, timestamp time.Time) (*SignedRequest, error)
+}
+
+func CopyValues(values url.Values) url.Values {
+	copied := make(url.Values, len(values))
+	for k, v := range values {
+		copied[k] = append([]string(nil), v...)
+	}
+	return copied
+}
@@ -0,0 +1,98 @@
+package coinapi
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+//推送行情. 每个订阅返回一个事件通道和 Subscription, 订阅结束(Unsubscribe 或 ctx 结束)后通道被关闭
+type StreamApi interface {
+	SubscribeTicker(ctx context.Context, cp CurrencyPair) (<-chan TickerEvent, *Subscription, error)
+
+	//size 为盘口档数
+	SubscribeDepth(ctx context.Context, cp CurrencyPair, size int) (<-chan DepthEvent, *Subscription, error)
+
+	//整个交易所的逐笔成交, 只推送订阅之后的成交
+	SubscribeTrades(ctx context.Context, cp CurrencyPair) (<-chan TradeEvent, *Subscription, error)
+
+	//period 与 GetKlineRecords 一致, 如 1min; 当前K线更新和新K线开始时都会推送
+	SubscribeKline(ctx context.Context, cp CurrencyPair, period string) (<-chan KlineEvent, *Subscription, error)
+}
+
+//所有推送事件的公共字段
+type StreamEvent struct {
+	Exchange   string
+	Pair       CurrencyPair
+	ReceivedAt time.Time //本地收到数据的时间
+}
+
+type TickerEvent struct {
+	StreamEvent
+	Ticker Ticker
+}
+
+type DepthEvent struct {
+	StreamEvent
+	Depth Depth
+}
+
+type TradeEvent struct {
+	StreamEvent
+	Trade Trade
+}
+
+type KlineEvent struct {
+	StreamEvent
+	Period string
+	Kline  Kline
+}
+
+//一个行情订阅
+type Subscription struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu           sync.Mutex
+	unsubscribed bool
+	err          error
+}
+
+//ctx 结束时订阅自动结束
+func NewSubscription(ctx context.Context) (context.Context, *Subscription) {
+	ctx, cancel := context.WithCancel(ctx)
+	return ctx, &Subscription{cancel: cancel, done: make(chan struct{})}
+}
+
+//结束订阅, 等到事件通道关闭后返回. 可以重复调用.
+//实现正在进行的请求不能被打断时(如 PollingStream), 会阻塞到该请求返回
+func (s *Subscription) Unsubscribe() {
+	s.mu.Lock()
+	s.unsubscribed = true
+	s.mu.Unlock()
+	s.cancel()
+	<-s.done
+}
+
+//订阅结束后关闭
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+//订阅结束的原因: Unsubscribe 时为nil, ctx 结束时为 ctx.Err(), 或者实现报告的致命错误
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+//由 StreamApi 的实现在关闭事件通道后调用, err 为订阅异常结束的原因
+func (s *Subscription) Finish(err error) {
+	s.mu.Lock()
+	if !s.unsubscribed {
+		s.err = err
+	}
+	s.mu.Unlock()
+	s.cancel()
+	close(s.done)
+}
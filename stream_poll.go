@@ -0,0 +1,190 @@
+package coinapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+//默认的轮询间隔
+const DEFAULT_POLL_INTERVAL = time.Second
+
+//通过定时调用 Api 实现 StreamApi, 用于没有推送接口的交易所. 行情没有变化时不推送;
+//消费者处理不过来时轮询会等待, 不会丢弃事件.
+//Api 的调用不受 ctx 控制, Unsubscribe 会等到正在进行的调用返回(最长为 http client 的超时时间);
+//Api panic 时订阅结束, Subscription.Err 返回包含 panic 内容的错误
+type PollingStream struct {
+	Api      Api
+	Interval time.Duration   //轮询间隔, 为0时为 DEFAULT_POLL_INTERVAL
+	Buffer   int             //事件通道的缓冲大小
+	Clock    Clock           //ReceivedAt 的时间源, 为nil时为 LocalClock
+	OnError  func(err error) //轮询出错时回调, 之后继续轮询
+}
+
+func NewPollingStream(api Api, interval time.Duration) *PollingStream {
+	return &PollingStream{Api: api, Interval: interval}
+}
+
+func (s *PollingStream) SubscribeTicker(ctx context.Context, cp CurrencyPair) (<-chan TickerEvent, *Subscription, error) {
+	ch := make(chan TickerEvent, s.Buffer)
+	var last *Ticker
+	sub := s.start(ctx, func() { close(ch) }, func(ctx context.Context) error {
+		ticker, err := s.Api.GetTicker(cp)
+		if err != nil {
+			return err
+		}
+		if last != nil && sameTicker(*last, *ticker) {
+			return nil
+		}
+		last = ticker
+		select {
+		case ch <- TickerEvent{StreamEvent: s.envelope(cp), Ticker: *ticker}:
+		case <-ctx.Done():
+		}
+		return nil
+	})
+	return ch, sub, nil
+}
+
+func (s *PollingStream) SubscribeDepth(ctx context.Context, cp CurrencyPair, size int) (<-chan DepthEvent, *Subscription, error) {
+	if size <= 0 {
+		return nil, nil, errors.New("depth size must be positive")
+	}
+	ch := make(chan DepthEvent, s.Buffer)
+	var last *Depth
+	sub := s.start(ctx, func() { close(ch) }, func(ctx context.Context) error {
+		depth, err := s.Api.GetDepth(cp, size)
+		if err != nil {
+			return err
+		}
+		if last != nil && reflect.DeepEqual(last, depth) {
+			return nil
+		}
+		last = depth
+		select {
+		case ch <- DepthEvent{StreamEvent: s.envelope(cp), Depth: *depth}:
+		case <-ctx.Done():
+		}
+		return nil
+	})
+	return ch, sub, nil
+}
+
+//第一次轮询只记录最新的成交编号, 之后按 Tid 顺序推送新成交
+func (s *PollingStream) SubscribeTrades(ctx context.Context, cp CurrencyPair) (<-chan TradeEvent, *Subscription, error) {
+	ch := make(chan TradeEvent, s.Buffer)
+	since, started := int64(0), false
+	sub := s.start(ctx, func() { close(ch) }, func(ctx context.Context) error {
+		trades, err := s.Api.GetTrades(cp, since)
+		if err != nil {
+			return err
+		}
+		env := s.envelope(cp)
+		for _, trade := range sortedTrades(trades) {
+			if trade.Tid <= since {
+				continue
+			}
+			since = trade.Tid
+			if !started {
+				continue
+			}
+			select {
+			case ch <- TradeEvent{StreamEvent: env, Trade: trade}:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		started = true
+		return nil
+	})
+	return ch, sub, nil
+}
+
+//推送最新K线有变化的部分, 包括上一根K线收盘时的最终值
+func (s *PollingStream) SubscribeKline(ctx context.Context, cp CurrencyPair, period string) (<-chan KlineEvent, *Subscription, error) {
+	if period == "" {
+		return nil, nil, errors.New("empty kline period")
+	}
+	ch := make(chan KlineEvent, s.Buffer)
+	var last *Kline
+	sub := s.start(ctx, func() { close(ch) }, func(ctx context.Context) error {
+		klines, err := s.Api.GetKlineRecords(cp, period, 2, 0)
+		if err != nil {
+			return err
+		}
+		env := s.envelope(cp)
+		for _, k := range klines {
+			if last != nil && (k.Timestamp < last.Timestamp || k == *last) {
+				continue
+			}
+			if last == nil && k.Timestamp != klines[len(klines)-1].Timestamp {
+				continue //第一次只推送最新的K线
+			}
+			kline := k
+			last = &kline
+			select {
+			case ch <- KlineEvent{StreamEvent: env, Period: period, Kline: k}:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		return nil
+	})
+	return ch, sub, nil
+}
+
+func (s *PollingStream) envelope(cp CurrencyPair) StreamEvent {
+	clock := s.Clock
+	if clock == nil {
+		clock = LocalClock
+	}
+	return StreamEvent{Exchange: s.Api.GetExchangeName(), Pair: cp, ReceivedAt: clock.Now()}
+}
+
+//立即轮询一次, 之后每隔 Interval 轮询, 直到订阅结束
+func (s *PollingStream) start(ctx context.Context, closeChannel func(), poll func(ctx context.Context) error) *Subscription {
+	ctx, sub := NewSubscription(ctx)
+	interval := s.Interval
+	if interval <= 0 {
+		interval = DEFAULT_POLL_INTERVAL
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		defer func() {
+			if r := recover(); r != nil {
+				closeChannel()
+				sub.Finish(fmt.Errorf("polling stream panicked: %v", r))
+			}
+		}()
+		for {
+			if err := poll(ctx); err != nil && ctx.Err() == nil && s.OnError != nil {
+				s.OnError(err)
+			}
+			select {
+			case <-ctx.Done():
+				closeChannel()
+				sub.Finish(ctx.Err())
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return sub
+}
+
+//大部分交易所每次返回的 Date 都是当前时间, 不作为行情变化
+func sameTicker(a, b Ticker) bool {
+	a.Date, b.Date = 0, 0
+	return a == b
+}
+
+//交易所返回的成交不一定按 Tid 升序
+func sortedTrades(trades []Trade) []Trade {
+	sorted := append([]Trade{}, trades...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Tid < sorted[j].Tid })
+	return sorted
+}
@@ -0,0 +1,220 @@
+package coinapi
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//按调用次数返回预设的行情, 超出后重复最后一个
+type streamTestApi struct {
+	Api
+
+	mu      sync.Mutex
+	tickers []*Ticker
+	trades  [][]Trade
+	klines  [][]Kline
+	calls   int
+	err     error
+}
+
+func (a *streamTestApi) GetExchangeName() string {
+	return "stream_test"
+}
+
+func (a *streamTestApi) next(n int) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	i := a.calls
+	a.calls++
+	if i >= n {
+		i = n - 1
+	}
+	return i
+}
+
+func (a *streamTestApi) GetTicker(cp CurrencyPair) (*Ticker, error) {
+	if a.err != nil {
+		return nil, a.err
+	}
+	return a.tickers[a.next(len(a.tickers))], nil
+}
+
+func (a *streamTestApi) GetDepth(cp CurrencyPair, size int) (*Depth, error) {
+	return &Depth{AskList: DepthRecords{{Price: 101, Amount: 1}}, BidList: DepthRecords{{Price: 100, Amount: 1}}}, nil
+}
+
+func (a *streamTestApi) GetTrades(cp CurrencyPair, since int64) ([]Trade, error) {
+	return a.trades[a.next(len(a.trades))], nil
+}
+
+func (a *streamTestApi) GetKlineRecords(cp CurrencyPair, period string, size, since int) ([]Kline, error) {
+	return a.klines[a.next(len(a.klines))], nil
+}
+
+func newTestStream(api Api) *PollingStream {
+	return NewPollingStream(api, time.Millisecond)
+}
+
+func TestPollingStream_Ticker(t *testing.T) {
+	cp := NewCurrencyPair("BTC", "USD")
+	api := &streamTestApi{tickers: []*Ticker{{Last: 100, Date: 1}, {Last: 100, Date: 2}, {Last: 101, Date: 3}}}
+	ch, sub, err := newTestStream(api).SubscribeTicker(context.Background(), cp)
+	assert.NoError(t, err)
+
+	e := <-ch
+	assert.Equal(t, "stream_test", e.Exchange)
+	assert.Equal(t, cp, e.Pair)
+	assert.False(t, e.ReceivedAt.IsZero())
+	assert.Equal(t, 100.0, e.Ticker.Last)
+	//只有 Date 变化的行情不推送
+	assert.Equal(t, 101.0, (<-ch).Ticker.Last)
+
+	sub.Unsubscribe()
+	_, ok := <-ch
+	assert.False(t, ok)
+	assert.NoError(t, sub.Err())
+}
+
+func TestPollingStream_Depth(t *testing.T) {
+	ch, sub, err := newTestStream(&streamTestApi{}).SubscribeDepth(context.Background(), NewCurrencyPair("BTC", "USD"), 5)
+	assert.NoError(t, err)
+	e := <-ch
+	assert.Equal(t, 101.0, e.Depth.AskList[0].Price)
+	select {
+	case <-ch:
+		t.Fatal("unchanged depth was pushed")
+	case <-time.After(20 * time.Millisecond):
+	}
+	sub.Unsubscribe()
+
+	_, _, err = newTestStream(&streamTestApi{}).SubscribeDepth(context.Background(), NewCurrencyPair("BTC", "USD"), 0)
+	assert.Error(t, err)
+}
+
+//订阅之前的成交不推送, 之后的按 Tid 顺序推送且不重复
+func TestPollingStream_Trades(t *testing.T) {
+	api := &streamTestApi{trades: [][]Trade{
+		{{Tid: 2}, {Tid: 1}},
+		{{Tid: 4}, {Tid: 2}, {Tid: 3}},
+		{{Tid: 3}, {Tid: 4}, {Tid: 5}},
+	}}
+	ch, sub, err := newTestStream(api).SubscribeTrades(context.Background(), NewCurrencyPair("BTC", "USD"))
+	assert.NoError(t, err)
+	var tids []int64
+	for len(tids) < 3 {
+		tids = append(tids, (<-ch).Trade.Tid)
+	}
+	assert.Equal(t, []int64{3, 4, 5}, tids)
+	sub.Unsubscribe()
+}
+
+//K线更新和新K线开始都推送, 上一根K线的最终值在新K线之前推送
+func TestPollingStream_Kline(t *testing.T) {
+	api := &streamTestApi{klines: [][]Kline{
+		{{Timestamp: 0, Close: 1}, {Timestamp: 60, Close: 2}},
+		{{Timestamp: 0, Close: 1}, {Timestamp: 60, Close: 3}},
+		{{Timestamp: 60, Close: 4}, {Timestamp: 120, Close: 5}},
+	}}
+	ch, sub, err := newTestStream(api).SubscribeKline(context.Background(), NewCurrencyPair("BTC", "USD"), "1min")
+	assert.NoError(t, err)
+	var closes []float64
+	for len(closes) < 4 {
+		e := <-ch
+		assert.Equal(t, "1min", e.Period)
+		closes = append(closes, e.Kline.Close)
+	}
+	assert.Equal(t, []float64{2, 3, 4, 5}, closes)
+	sub.Unsubscribe()
+
+	_, _, err = newTestStream(api).SubscribeKline(context.Background(), NewCurrencyPair("BTC", "USD"), "")
+	assert.Error(t, err)
+}
+
+func TestPollingStream_CancelAndError(t *testing.T) {
+	var mu sync.Mutex
+	var errs []error
+	api := &streamTestApi{err: errors.New("boom")}
+	stream := newTestStream(api)
+	stream.OnError = func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, sub, err := stream.SubscribeTicker(ctx, NewCurrencyPair("BTC", "USD"))
+	assert.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	<-sub.Done()
+	_, ok := <-ch
+	assert.False(t, ok)
+	assert.Equal(t, context.Canceled, sub.Err())
+	mu.Lock()
+	assert.NotEmpty(t, errs)
+	assert.EqualError(t, errs[0], "boom")
+	mu.Unlock()
+
+	//订阅结束后可以重复 Unsubscribe
+	sub.Unsubscribe()
+	assert.Equal(t, context.Canceled, sub.Err())
+}
+
+//GetTicker panic, 或者阻塞到 release 被关闭
+type panicStreamApi struct {
+	streamTestApi
+	release chan struct{}
+}
+
+func (a *panicStreamApi) GetTicker(cp CurrencyPair) (*Ticker, error) {
+	if a.release != nil {
+		<-a.release
+		return &Ticker{Last: 1}, nil
+	}
+	panic("adapter bug")
+}
+
+func TestPollingStream_Panic(t *testing.T) {
+	stream := newTestStream(&panicStreamApi{})
+	ch, sub, err := stream.SubscribeTicker(context.Background(), NewCurrencyPair("BTC", "USD"))
+	assert.NoError(t, err)
+
+	select {
+	case <-sub.Done():
+	case <-time.After(time.Second):
+		t.Fatal("subscription did not finish after panic")
+	}
+	_, ok := <-ch
+	assert.False(t, ok)
+	assert.EqualError(t, sub.Err(), "polling stream panicked: adapter bug")
+}
+
+func TestPollingStream_UnsubscribeWaitsForPoll(t *testing.T) {
+	api := &panicStreamApi{release: make(chan struct{})}
+	stream := newTestStream(api)
+	ch, sub, err := stream.SubscribeTicker(context.Background(), NewCurrencyPair("BTC", "USD"))
+	assert.NoError(t, err)
+
+	unsubscribed := make(chan struct{})
+	go func() {
+		sub.Unsubscribe()
+		close(unsubscribed)
+	}()
+	select {
+	case <-unsubscribed:
+		t.Fatal("Unsubscribe returned while GetTicker was in flight")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(api.release)
+	<-unsubscribed
+	for range ch {
+	}
+	assert.NoError(t, sub.Err())
+}
@@ -0,0 +1,6 @@
+package coinapi
+
+//账户间划转(币币、杠杆、合约、借贷)，不是所有交易所都支持全部组合
+type TransferApi interface {
+	Transfer(currency, amount string, from, to AccountType) (*TransferResult, error)
+}
@@ -1,58 +1,186 @@
 package coinapi
 
-import "strconv"
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
 
+//不能识别的类型返回0
 func ToFloat64(v interface{}) float64 {
 	if v == nil {
 		return 0.0
 	}
 
-	switch v.(type) {
+	switch vv := v.(type) {
 	case float64:
-		return v.(float64)
+		return vv
+	case float32:
+		return float64(vv)
+	case int:
+		return float64(vv)
+	case int64:
+		return float64(vv)
+	case json.Number:
+		vF, _ := vv.Float64()
+		return vF
+	case JsonFloat64:
+		return float64(vv)
 	case string:
-		vStr := v.(string)
-		vF, _ := strconv.ParseFloat(vStr, 64)
+		vF, _ := strconv.ParseFloat(strings.Replace(vv, ",", "", -1), 64)
 		return vF
 	default:
-		panic("to float64 error.")
+		return 0.0
 	}
 }
 
+//不能识别的类型返回0
 func ToInt(v interface{}) int {
 	if v == nil {
 		return 0
 	}
 
-	switch v.(type) {
+	switch vv := v.(type) {
 	case string:
-		vStr := v.(string)
-		vInt, _ := strconv.Atoi(vStr)
+		vInt, _ := strconv.Atoi(vv)
 		return vInt
 	case int:
-		return v.(int)
+		return vv
+	case int64:
+		return int(vv)
 	case float64:
-		vF := v.(float64)
-		return int(vF)
+		return int(vv)
+	case json.Number:
+		vInt, _ := vv.Int64()
+		return int(vInt)
+	case JsonInt64:
+		return int(vv)
 	default:
-		panic("to int error.")
+		return 0
 	}
 }
 
+//不能识别的类型返回0
 func ToUint64(v interface{}) uint64 {
 	if v == nil {
 		return 0
 	}
 
-	switch v.(type) {
+	switch vv := v.(type) {
 	case int:
-		return uint64(v.(int))
+		return uint64(vv)
+	case int64:
+		return uint64(vv)
 	case float64:
-		return uint64((v.(float64)))
+		return uint64(vv)
+	case json.Number:
+		uV, _ := strconv.ParseUint(vv.String(), 10, 64)
+		return uV
+	case JsonInt64:
+		return uint64(vv)
 	case string:
-		uV, _ := strconv.ParseUint(v.(string), 10, 64)
+		uV, _ := strconv.ParseUint(vv, 10, 64)
 		return uV
 	default:
-		panic("to uint64 error.")
+		return 0
+	}
+}
+
+//交易所有时把数字编码成字符串(可能带千分位逗号), 有时直接是数字, 两种都能反序列化; null和空字符串为0
+type JsonFloat64 float64
+
+func (f *JsonFloat64) UnmarshalJSON(data []byte) error {
+	s, err := unquoteNumber(data)
+	if err != nil || s == "" {
+		*f = 0
+		return err
+	}
+	v, err := strconv.ParseFloat(strings.Replace(s, ",", "", -1), 64)
+	if err != nil {
+		return fmt.Errorf("invalid number %s", data)
+	}
+	*f = JsonFloat64(v)
+	return nil
+}
+
+//同 JsonFloat64, 带小数的数字会被截断
+type JsonInt64 int64
+
+func (i *JsonInt64) UnmarshalJSON(data []byte) error {
+	s, err := unquoteNumber(data)
+	if err != nil || s == "" {
+		*i = 0
+		return err
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		fv, ferr := strconv.ParseFloat(s, 64)
+		if ferr != nil {
+			return fmt.Errorf("invalid integer %s", data)
+		}
+		v = int64(fv)
+	}
+	*i = JsonInt64(v)
+	return nil
+}
+
+func unquoteNumber(data []byte) (string, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return "", nil
+	}
+	if data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(s), nil
+	}
+	if data[0] == '-' || (data[0] >= '0' && data[0] <= '9') {
+		return string(data), nil
+	}
+	return "", fmt.Errorf("invalid number %s", data)
+}
+
+//[[price, amount], ...] 格式的深度数据
+type JsonDepthEntries [][]JsonFloat64
+
+func (entries JsonDepthEntries) DepthRecords() (DepthRecords, error) {
+	records := make(DepthRecords, 0, len(entries))
+	for _, e := range entries {
+		if len(e) < 2 {
+			return nil, fmt.Errorf("invalid depth entry %v", e)
+		}
+		records = append(records, DepthRecord{Price: float64(e[0]), Amount: float64(e[1])})
+	}
+	return records, nil
+}
+
+//先写临时文件再rename, 避免进程中途退出留下半截内容
+func writeFileAtomic(file string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Chmod(perm)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
 	}
+	return err
 }